@@ -10,30 +10,50 @@ import (
 	"time"
 
 	"github.com/gorilla/mux"
+	"github.com/jakthom/s3c/pkg/cache"
 	"github.com/jakthom/s3c/pkg/config"
+	"github.com/jakthom/s3c/pkg/cors"
 	"github.com/jakthom/s3c/pkg/handler"
+	"github.com/jakthom/s3c/pkg/lifecycle"
 	"github.com/jakthom/s3c/pkg/middleware"
-	fileorigin "github.com/jakthom/s3c/pkg/origin/file"
+	"github.com/jakthom/s3c/pkg/notification"
+	"github.com/jakthom/s3c/pkg/origin"
 	s3auth "github.com/jakthom/s3c/pkg/s3/auth"
 	s3bucket "github.com/jakthom/s3c/pkg/s3/bucket"
 	s3handler "github.com/jakthom/s3c/pkg/s3/handler"
 	s3middleware "github.com/jakthom/s3c/pkg/s3/middleware"
+	s3multipart "github.com/jakthom/s3c/pkg/s3/multipart"
 	s3object "github.com/jakthom/s3c/pkg/s3/object"
+	s3policy "github.com/jakthom/s3c/pkg/s3/policy"
 	s3service "github.com/jakthom/s3c/pkg/s3/service"
+	s3sts "github.com/jakthom/s3c/pkg/s3/sts"
 	"github.com/jakthom/s3c/pkg/util"
+	"github.com/jakthom/s3c/pkg/website"
 	"github.com/rs/zerolog/log"
 )
 
 var VERSION string
 
 type S3c struct {
-	config         *config.Config
-	server         *http.Server
-	origin         *fileorigin.FileOrigin
-	authController *s3auth.BasicAuthController // TODO -> Add more customizable authorization
-	serviceHandler *s3service.ServiceHandler
-	bucketHandler  *s3bucket.BucketHandler
-	objectHandler  *s3object.ObjectHandler
+	config           *config.Config
+	server           *http.Server
+	origin           origin.Origin
+	cache            *cache.Cache
+	authController   s3auth.AuthController
+	authorizer       *s3policy.Authorizer
+	policies         *s3policy.Store
+	lifecycles       *lifecycle.Store
+	lifecycleWorker  *lifecycle.Worker
+	corsConfigs      *cors.Store
+	websites         *website.Store
+	websiteServer    *http.Server
+	notifications    *notification.Store
+	outbox           *notification.Outbox
+	serviceHandler   *s3service.ServiceHandler
+	bucketHandler    *s3bucket.BucketHandler
+	objectHandler    *s3object.ObjectHandler
+	multipartHandler *s3multipart.MultipartHandler
+	stsHandler       *s3sts.STSHandler
 }
 
 func (s *S3c) configure() {
@@ -44,7 +64,7 @@ func (s *S3c) configure() {
 		log.Fatal().Err(err).Msg("Failed to read configuration file")
 	}
 	s.config = &conf
-	util.Pprint(s.config)
+	util.Pprint(s.config.Redacted())
 }
 
 func (s *S3c) initializeServer() {
@@ -52,19 +72,27 @@ func (s *S3c) initializeServer() {
 	// Generic Middleware
 	router.Use(middleware.RequestIdMiddleware)
 	// router.Use(middleware.DebugMiddleware)
-	// S3 Middleware
-	router.Use(s3middleware.EtagMiddleware)
-	router.Use(s3middleware.AuthenticationMiddleware(s.authController))
-	// s3c metadata routes
+	// s3c metadata routes, which are served without auth
 	router.Handle("/s3c/health", http.HandlerFunc(handler.HealthcheckHandler))
+	// S3 routes
+	s3router := router.PathPrefix("/").Subrouter()
+	// S3 Middleware. CORS preflights are answered before authentication, as
+	// browsers never sign them.
+	s3router.Use(s3middleware.CORSMiddleware(s.corsConfigs))
+	s3router.Use(s3middleware.AuthenticationMiddleware(s.authController, s.config.Auth.SignatureV2))
+	s3router.Use(s3middleware.EtagMiddleware)
+	s3router.Use(s3middleware.AuthorizationMiddleware(s.authorizer))
+	// CORS preflights, which are answered by the CORSMiddleware
+	s3router.Methods(http.MethodOptions).Handler(s3handler.MethodNotAllowedHandler())
 	// S3 Service
-	router.Handle("/", http.HandlerFunc(s.serviceHandler.Get)) // Service
+	s3router.Methods(http.MethodPost).Path("/").HandlerFunc(s.stsHandler.Post) // STS
+	s3router.Handle("/", http.HandlerFunc(s.serviceHandler.Get))               // Service
 	// S3 Object
-	s3object.AddSubrouter(router, s.objectHandler)
+	s3object.AddSubrouter(s3router, s.objectHandler, s.multipartHandler)
 	// S3 Bucket
-	s3bucket.AddSubrouter(router, s.bucketHandler)
+	s3bucket.AddSubrouter(s3router, s.bucketHandler, s.multipartHandler, s.objectHandler)
 	// Not Implemented routes
-	s3handler.AddNotImplementedRoutes(router)
+	s3handler.AddNotImplementedRoutes(s3router)
 	// Method Not Allowed
 	router.MethodNotAllowedHandler = s3handler.MethodNotAllowedHandler()
 	// Not Found Handler
@@ -75,25 +103,116 @@ func (s *S3c) initializeServer() {
 	}
 }
 
+// initializeWebsiteServer creates the listener serving buckets as static
+// websites, which is separate from the S3 API as its requests are anonymous
+// and addressed by path or host rather than by operation
+func (s *S3c) initializeWebsiteServer() {
+	router := mux.NewRouter()
+	router.Use(middleware.RequestIdMiddleware)
+	router.PathPrefix("/").Handler(&website.Handler{
+		Websites:   s.websites,
+		Controller: s.origin.ObjectController(),
+		Authorizer: s.authorizer,
+		Domain:     s.config.Website.Domain,
+	})
+	s.websiteServer = &http.Server{
+		Addr:    ":" + s.config.Website.Port,
+		Handler: router,
+	}
+}
+
+func (s *S3c) initializeCache() {
+	maxSize, err := s.config.Cache.Bytes()
+	if err != nil {
+		log.Fatal().Err(err).Msg("Invalid cache size")
+	}
+	c, err := cache.New(s.config.Cache.Directory, maxSize, s.config.Cache.MaxAge)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed to open cache")
+	}
+	s.cache = c
+	s.origin = cache.NewOrigin(s.origin, c)
+}
+
 func (s *S3c) Initialize() {
 	log.Info().Msg("Initializing s3c")
 	s.configure()
-	s.origin = fileorigin.NewOrigin("data")
-	s.authController = &s3auth.BasicAuthController{
-		Region:          "us-east-1", // TODO -> Fixme
-		AccessKeyId:     s.config.Auth.KeyID,
-		SecretAccessKey: s.config.Auth.Secret,
+	o, err := origin.NewOriginFromConfig(s.config.Origin)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed to create origin")
+	}
+	s.origin = o
+	if s.config.Cache.Enabled {
+		s.initializeCache()
+	}
+	credentials, err := s3auth.NewCredentialStore(s.config.Auth)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed to load credentials")
+	}
+	s.authController = credentials
+	s.policies, err = s3policy.NewStore(s.config.Auth.PolicyDirectory, s.config.BucketACLs())
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed to open bucket policies")
+	}
+	s.authorizer = s3policy.NewAuthorizer(credentials, s.policies)
+	s.lifecycles, err = lifecycle.NewStore(s.config.Lifecycle.Directory)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed to open bucket lifecycle configurations")
+	}
+	s.corsConfigs, err = cors.NewStore(s.config.CORS.Directory)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed to open bucket CORS configurations")
+	}
+	s.websites, err = website.NewStore(s.config.Website.Directory)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed to open bucket website configurations")
+	}
+	targets := []string{}
+	for name := range s.config.Notifications.Targets {
+		targets = append(targets, name)
+	}
+	s.notifications, err = notification.NewStore(s.config.Notifications.Directory, targets)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed to open bucket notification configurations")
+	}
+	s.outbox, err = notification.NewOutbox(s.config.Notifications)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed to open notification outbox")
+	}
+	region := s.config.Origin.Location
+	if region == "" {
+		region = s3auth.DefaultRegion
+	}
+	notifier := notification.NewNotifier(s.notifications, s.outbox, region)
+	if s.config.Lifecycle.Interval > 0 {
+		s.lifecycleWorker = lifecycle.NewWorker(s.lifecycles, s.origin, s.config.Lifecycle.Interval)
 	}
 	s.serviceHandler = &s3service.ServiceHandler{
-		Controller: s.origin.ServiceController,
+		Controller: s.origin.ServiceController(),
 	}
 	s.bucketHandler = &s3bucket.BucketHandler{
-		Controller: s.origin.BucketController,
+		Controller:    s.origin.BucketController(),
+		Policies:      s.policies,
+		Lifecycles:    s.lifecycles,
+		CORSConfigs:   s.corsConfigs,
+		Websites:      s.websites,
+		Notifications: s.notifications,
 	}
 	s.objectHandler = &s3object.ObjectHandler{
-		Controller: s.origin.ObjectController,
+		Controller: s.origin.ObjectController(),
+		Notifier:   notifier,
+	}
+	s.multipartHandler = &s3multipart.MultipartHandler{
+		Controller: s.origin.MultipartController(),
+		Notifier:   notifier,
+	}
+	s.stsHandler = &s3sts.STSHandler{
+		Controller: credentials,
 	}
 	s.initializeServer()
+	if s.config.Website.Port != "" {
+		s.initializeWebsiteServer()
+	}
 }
 
 func (s *S3c) Run() {
@@ -104,14 +223,41 @@ func (s *S3c) Run() {
 			log.Info().Msgf("s3c server shut down")
 		}
 	}()
+	if s.websiteServer != nil {
+		go func() {
+			log.Info().Msg("s3c is serving websites on port: " + s.config.Website.Port)
+			if err := s.websiteServer.ListenAndServe(); err != nil && errors.Is(err, http.ErrServerClosed) {
+				log.Info().Msgf("s3c website server shut down")
+			}
+		}()
+	}
+	// Lifecycle rules are applied, and notifications delivered, in the
+	// background until shutdown
+	workerCtx, stopWorker := context.WithCancel(context.Background())
+	defer stopWorker()
+	if s.lifecycleWorker != nil {
+		go s.lifecycleWorker.Run(workerCtx)
+	}
+	go s.outbox.Run(workerCtx)
 	// Safe shutdown
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
 	<-quit
 	log.Info().Msg("shutting down s3c server...")
+	stopWorker()
 	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
 	defer cancel()
 	if err := s.server.Shutdown(ctx); err != nil {
 		log.Fatal().Stack().Err(err).Msg("server forced to shutdown")
 	}
+	if s.websiteServer != nil {
+		if err := s.websiteServer.Shutdown(ctx); err != nil {
+			log.Error().Err(err).Msg("website server forced to shutdown")
+		}
+	}
+	if s.cache != nil {
+		if err := s.cache.Close(); err != nil {
+			log.Error().Err(err).Msg("failed to persist cache index")
+		}
+	}
 }
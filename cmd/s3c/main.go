@@ -1,6 +1,12 @@
 package main
 
+import "os"
+
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "presign" {
+		presign(os.Args[2:])
+		return
+	}
 	s3c := S3c{}
 	s3c.Initialize()
 	s3c.Run()
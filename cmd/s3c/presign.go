@@ -0,0 +1,69 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/jakthom/s3c/pkg/config"
+	s3auth "github.com/jakthom/s3c/pkg/s3/auth"
+	"github.com/rs/zerolog/log"
+)
+
+// presign prints a presigned url of an object, signed with the configured
+// credentials, so it can be handed to clients that must not hold them.
+//
+//	s3c presign [-method GET] [-expires 1h] [-key KEY] [-endpoint http://localhost:8080] bucket/key
+func presign(args []string) {
+	flags := flag.NewFlagSet("presign", flag.ExitOnError)
+	method := flags.String("method", http.MethodGet, "the HTTP method the url may be used with")
+	expires := flags.Duration("expires", time.Hour, "how long the url is valid for, at most 168h")
+	endpoint := flags.String("endpoint", "", "the url s3c is reachable at (default http://localhost:<port>)")
+	accessKey := flags.String("key", "", "the access key to sign with (default auth.keyId)")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "usage: s3c presign [flags] bucket/key")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if flags.NArg() != 1 || !strings.Contains(flags.Arg(0), "/") {
+		flags.Usage()
+		os.Exit(2)
+	}
+	if *expires < time.Second || *expires > s3auth.MaxPresignExpiry*time.Second {
+		log.Fatal().Msg("Presigned urls must expire within 1s and 168h")
+	}
+
+	conf, err := config.GetConfig()
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed to read configuration file")
+	}
+	if *accessKey == "" {
+		*accessKey = conf.Auth.KeyID
+	}
+	store, err := s3auth.NewCredentialStore(conf.Auth)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed to load credentials")
+	}
+	region := s3auth.Regions(conf.Auth)[0]
+	secretKey, err := store.SecretKey(*accessKey, region)
+	if err != nil || secretKey == "" {
+		log.Fatal().Err(err).Msg("Unknown or unusable access key: " + *accessKey)
+	}
+	if *endpoint == "" {
+		*endpoint = "http://localhost:" + conf.Port
+	}
+	base, err := url.Parse(*endpoint)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Invalid endpoint: " + *endpoint)
+	}
+	req, err := http.NewRequest(strings.ToUpper(*method), base.JoinPath(flags.Arg(0)).String(), nil)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed to build request")
+	}
+	s3auth.PresignV4(req, *accessKey, secretKey, region, time.Now(), *expires)
+	fmt.Println(req.URL.String())
+}
@@ -1,3 +1,350 @@
 package cache
 
-// The future home of a local cache implementation
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	s3object "github.com/jakthom/s3c/pkg/s3/object"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// INDEX_FILE is the name of the persistent cache index
+	INDEX_FILE string = "index.json"
+	// OBJECTS_DIRECTORY is the directory cached objects are stored in
+	OBJECTS_DIRECTORY string = "objects"
+	// TMP_DIRECTORY is the directory objects are staged in while being cached
+	TMP_DIRECTORY string = "tmp"
+)
+
+// ErrTooLarge is returned when an object is larger than the cache itself
+var ErrTooLarge = errors.New("object is too large to cache")
+
+// Entry is an object stored in the cache
+type Entry struct {
+	// Bucket and Key identify the cached object
+	Bucket string `json:"bucket"`
+	Key    string `json:"key"`
+	// ETag is the ETag of the object, as returned by the origin
+	ETag string `json:"etag"`
+	// Version is the version ID of the object, as returned by the origin
+	Version string `json:"version,omitempty"`
+	// Metadata is the metadata of the object, as returned by the origin
+	Metadata *s3object.Metadata `json:"metadata,omitempty"`
+	// ModTime specifies when the object was modified in the origin
+	ModTime time.Time `json:"modTime"`
+	// Size is the size of the object in bytes
+	Size int64 `json:"size"`
+	// ValidatedAt is when the entry was last known to match the origin
+	ValidatedAt time.Time `json:"validatedAt"`
+	// file is the name of the local file holding the object contents
+	file string
+}
+
+// Cache is a disk-backed LRU object cache. Cached objects are stored as
+// individual files, and an index of entries is persisted so the cache
+// survives restarts.
+type Cache struct {
+	directory string
+	maxSize   int64
+	maxAge    time.Duration
+
+	mu      sync.Mutex
+	size    int64
+	lru     *list.List
+	entries map[string]*list.Element
+	filling map[string]*Filler
+}
+
+// New opens the cache stored in `directory`, creating it if it does not
+// exist. `maxSize` is the maximum number of bytes stored. Entries older than
+// `maxAge` are revalidated against the origin; if `maxAge` is 0 entries are
+// trusted until they are evicted or invalidated.
+func New(directory string, maxSize int64, maxAge time.Duration) (*Cache, error) {
+	for _, dir := range []string{OBJECTS_DIRECTORY, TMP_DIRECTORY} {
+		if err := os.MkdirAll(filepath.Join(directory, dir), 0755); err != nil {
+			return nil, err
+		}
+	}
+	c := &Cache{
+		directory: directory,
+		maxSize:   maxSize,
+		maxAge:    maxAge,
+		lru:       list.New(),
+		entries:   map[string]*list.Element{},
+		filling:   map[string]*Filler{},
+	}
+	if err := c.load(); err != nil {
+		return nil, err
+	}
+	log.Info().Str("directory", directory).Int64("size", c.size).Int("entries", c.lru.Len()).Msg("Opened cache")
+	return c, nil
+}
+
+// entryName returns the name of the file storing an object
+func entryName(bucket, key string) string {
+	sum := sha256.Sum256([]byte(bucket + "/" + key))
+	return hex.EncodeToString(sum[:])
+}
+
+func (c *Cache) objectPath(name string) string {
+	return filepath.Join(c.directory, OBJECTS_DIRECTORY, name)
+}
+
+// Open returns the cached entry of an object along with its opened contents.
+// If the object is not cached, `ok` is false.
+func (c *Cache) Open(bucket, key string) (entry Entry, file *os.File, ok bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	element, ok := c.entries[entryName(bucket, key)]
+	if !ok {
+		return Entry{}, nil, false
+	}
+	e := element.Value.(*Entry)
+	file, err := os.Open(c.objectPath(e.file))
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to open cached object: " + key)
+		c.remove(element)
+		return Entry{}, nil, false
+	}
+	c.lru.MoveToFront(element)
+	return *e, file, true
+}
+
+// Stat returns the cached entry of an object without opening its contents.
+// If the object is not cached, `ok` is false.
+func (c *Cache) Stat(bucket, key string) (entry Entry, ok bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	element, ok := c.entries[entryName(bucket, key)]
+	if !ok {
+		return Entry{}, false
+	}
+	c.lru.MoveToFront(element)
+	return *element.Value.(*Entry), true
+}
+
+// Stale returns whether an entry must be revalidated against the origin
+func (c *Cache) Stale(entry Entry) bool {
+	return c.maxAge > 0 && time.Since(entry.ValidatedAt) > c.maxAge
+}
+
+// Revalidate marks an entry as matching the origin
+func (c *Cache) Revalidate(bucket, key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if element, ok := c.entries[entryName(bucket, key)]; ok {
+		element.Value.(*Entry).ValidatedAt = time.Now()
+	}
+}
+
+// Filler stages the contents of an object as they are read from the origin,
+// and stores them as its cached copy once they have all been read
+type Filler struct {
+	cache   *Cache
+	entry   Entry
+	name    string
+	tmp     *os.File
+	written int64
+	// invalidated is set when the object is written, deleted or evicted
+	// while it is filled, so that the old contents are not stored. It is
+	// guarded by the lock of the cache.
+	invalidated bool
+}
+
+// Fill begins filling the cached copy of an object, whose size must be
+// known. If the object is already being filled by another request, nil is
+// returned and nothing is stored.
+func (c *Cache) Fill(entry Entry) (*Filler, error) {
+	if entry.Size > c.maxSize {
+		return nil, ErrTooLarge
+	}
+	name := entryName(entry.Bucket, entry.Key)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.filling[name] != nil {
+		return nil, nil
+	}
+	tmp, err := os.CreateTemp(filepath.Join(c.directory, TMP_DIRECTORY), name+"-")
+	if err != nil {
+		return nil, err
+	}
+	f := &Filler{cache: c, entry: entry, name: name, tmp: tmp}
+	c.filling[name] = f
+	return f, nil
+}
+
+// Written returns how many bytes of the object have been staged
+func (f *Filler) Written() int64 {
+	return f.written
+}
+
+// Write stages the next bytes of the object
+func (f *Filler) Write(p []byte) (int, error) {
+	n, err := f.tmp.Write(p)
+	f.written += int64(n)
+	return n, err
+}
+
+// Commit stores the staged contents as the cached copy of the object,
+// evicting the least recently used entries as required. Incomplete contents
+// are discarded.
+func (f *Filler) Commit() error {
+	c := f.cache
+	defer os.Remove(f.tmp.Name())
+	err := f.tmp.Close()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.filling, f.name)
+	if err != nil || f.invalidated || f.written != f.entry.Size {
+		return err
+	}
+	if element, exists := c.entries[f.name]; exists {
+		c.remove(element)
+	}
+	if err := os.Rename(f.tmp.Name(), c.objectPath(f.name)); err != nil {
+		return err
+	}
+	entry := f.entry
+	entry.ValidatedAt = time.Now()
+	entry.file = f.name
+	c.entries[f.name] = c.lru.PushFront(&entry)
+	c.size += entry.Size
+	for c.size > c.maxSize {
+		c.remove(c.lru.Back())
+	}
+	c.persist()
+	return nil
+}
+
+// Abort discards the staged contents of the object
+func (f *Filler) Abort() {
+	f.tmp.Close()
+	os.Remove(f.tmp.Name())
+	f.cache.mu.Lock()
+	defer f.cache.mu.Unlock()
+	delete(f.cache.filling, f.name)
+}
+
+// Invalidate removes the cached copy of an object, if any
+func (c *Cache) Invalidate(bucket, key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	name := entryName(bucket, key)
+	if f := c.filling[name]; f != nil {
+		f.invalidated = true
+	}
+	if element, ok := c.entries[name]; ok {
+		c.remove(element)
+		c.persist()
+	}
+}
+
+// InvalidateBucket removes the cached copies of all objects in a bucket
+func (c *Cache) InvalidateBucket(bucket string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, f := range c.filling {
+		if f.entry.Bucket == bucket {
+			f.invalidated = true
+		}
+	}
+	for element := c.lru.Front(); element != nil; {
+		next := element.Next()
+		if element.Value.(*Entry).Bucket == bucket {
+			c.remove(element)
+		}
+		element = next
+	}
+	c.persist()
+}
+
+// Close persists the cache index, including the current LRU order
+func (c *Cache) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.persist()
+}
+
+// remove deletes an entry and its contents. The caller must hold the lock.
+func (c *Cache) remove(element *list.Element) {
+	e := c.lru.Remove(element).(*Entry)
+	delete(c.entries, e.file)
+	c.size -= e.Size
+	if err := os.Remove(c.objectPath(e.file)); err != nil && !os.IsNotExist(err) {
+		log.Error().Err(err).Msg("Failed to remove cached object: " + e.Key)
+	}
+}
+
+// persist atomically writes the index, most recently used entry first. The
+// caller must hold the lock.
+func (c *Cache) persist() error {
+	entries := make([]*Entry, 0, c.lru.Len())
+	for element := c.lru.Front(); element != nil; element = element.Next() {
+		entries = append(entries, element.Value.(*Entry))
+	}
+	payload, err := json.Marshal(entries)
+	if err != nil {
+		return err
+	}
+	indexPath := filepath.Join(c.directory, INDEX_FILE)
+	tmpPath := indexPath + ".tmp"
+	if err := os.WriteFile(tmpPath, payload, 0644); err != nil {
+		log.Error().Err(err).Msg("Failed to write cache index")
+		return err
+	}
+	return os.Rename(tmpPath, indexPath)
+}
+
+// load reads the persisted index, dropping entries whose contents are
+// missing and removing contents that are not indexed
+func (c *Cache) load() error {
+	payload, err := os.ReadFile(filepath.Join(c.directory, INDEX_FILE))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	var entries []*Entry
+	if len(payload) > 0 {
+		if err := json.Unmarshal(payload, &entries); err != nil {
+			log.Error().Err(err).Msg("Discarding unreadable cache index")
+			entries = nil
+		}
+	}
+	for _, e := range entries {
+		e.file = entryName(e.Bucket, e.Key)
+		info, err := os.Stat(c.objectPath(e.file))
+		if err != nil || info.Size() != e.Size {
+			continue
+		}
+		if _, exists := c.entries[e.file]; exists {
+			continue
+		}
+		c.entries[e.file] = c.lru.PushBack(e)
+		c.size += e.Size
+	}
+	for c.size > c.maxSize {
+		c.remove(c.lru.Back())
+	}
+
+	files, err := os.ReadDir(filepath.Join(c.directory, OBJECTS_DIRECTORY))
+	if err != nil {
+		return err
+	}
+	for _, file := range files {
+		if _, ok := c.entries[file.Name()]; !ok {
+			os.Remove(c.objectPath(file.Name()))
+		}
+	}
+	tmpFiles, _ := os.ReadDir(filepath.Join(c.directory, TMP_DIRECTORY))
+	for _, file := range tmpFiles {
+		os.Remove(filepath.Join(c.directory, TMP_DIRECTORY, file.Name()))
+	}
+	return c.persist()
+}
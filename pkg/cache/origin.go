@@ -0,0 +1,327 @@
+package cache
+
+import (
+	"io"
+	"net/http"
+
+	"github.com/jakthom/s3c/pkg/origin"
+	s3bucket "github.com/jakthom/s3c/pkg/s3/bucket"
+	s3multipart "github.com/jakthom/s3c/pkg/s3/multipart"
+	s3object "github.com/jakthom/s3c/pkg/s3/object"
+	s3service "github.com/jakthom/s3c/pkg/s3/service"
+	"github.com/rs/zerolog/log"
+)
+
+// CachedOrigin is a read-through cache in front of an origin. Objects read
+// through it are stored in the cache, and writes made through it invalidate
+// the cached copies.
+type CachedOrigin struct {
+	origin              origin.Origin
+	bucketController    *CachedBucketController
+	objectController    *CachedObjectController
+	multipartController *CachedMultipartController
+}
+
+func NewOrigin(o origin.Origin, c *Cache) *CachedOrigin {
+	return &CachedOrigin{
+		origin: o,
+		bucketController: &CachedBucketController{
+			BucketController: o.BucketController(),
+			cache:            c,
+		},
+		objectController: &CachedObjectController{
+			next:  o.ObjectController(),
+			cache: c,
+		},
+		multipartController: &CachedMultipartController{
+			MultipartController: o.MultipartController(),
+			cache:               c,
+		},
+	}
+}
+
+func (o *CachedOrigin) Type() string {
+	return o.origin.Type()
+}
+
+func (o *CachedOrigin) ServiceController() s3service.ServiceController {
+	return o.origin.ServiceController()
+}
+
+func (o *CachedOrigin) BucketController() s3bucket.BucketController {
+	return o.bucketController
+}
+
+func (o *CachedOrigin) ObjectController() s3object.ObjectController {
+	return o.objectController
+}
+
+func (o *CachedOrigin) MultipartController() s3multipart.MultipartController {
+	return o.multipartController
+}
+
+type CachedBucketController struct {
+	s3bucket.BucketController
+	cache *Cache
+}
+
+func (c *CachedBucketController) DeleteBucket(r *http.Request, bucket string) error {
+	defer c.cache.InvalidateBucket(bucket)
+	return c.BucketController.DeleteBucket(r, bucket)
+}
+
+type CachedObjectController struct {
+	next  s3object.ObjectController
+	cache *Cache
+}
+
+func (c *CachedObjectController) GetObject(r *http.Request, bucket, key, version string) (*s3object.GetObjectResult, error) {
+	// Only the current version of an object is cached
+	if version != "" {
+		return c.next.GetObject(r, bucket, key, version)
+	}
+
+	entry, file, ok := c.cache.Open(bucket, key)
+	if ok {
+		if !c.cache.Stale(entry) {
+			log.Debug().Msg("Serving cached object: " + key)
+			return cachedResult(entry, file), nil
+		}
+		valid, err := c.revalidate(r, bucket, key, entry)
+		if valid {
+			return cachedResult(entry, file), nil
+		}
+		file.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	result, err := c.next.GetObject(r, bucket, key, version)
+	if err != nil {
+		return nil, err
+	}
+	if result.DeleteMarker {
+		return result, nil
+	}
+	return c.fill(bucket, key, result)
+}
+
+// GetObjectRange serves ranges of cached objects from the cache. Ranges of
+// objects that are not cached are read from the origin without caching the
+// object, as are parts, whose boundaries the cache does not know.
+func (c *CachedObjectController) GetObjectRange(r *http.Request, bucket, key, version string, rng s3object.ObjectRange) (*s3object.GetObjectRangeResult, error) {
+	if version != "" || rng.PartNumber > 0 {
+		return c.next.GetObjectRange(r, bucket, key, version, rng)
+	}
+
+	entry, file, ok := c.cache.Open(bucket, key)
+	if ok {
+		if !c.cache.Stale(entry) {
+			log.Debug().Msg("Serving cached object range: " + key)
+			return s3object.SliceObject(r, cachedResult(entry, file), rng, nil)
+		}
+		valid, err := c.revalidate(r, bucket, key, entry)
+		if valid {
+			return s3object.SliceObject(r, cachedResult(entry, file), rng, nil)
+		}
+		file.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+	return c.next.GetObjectRange(r, bucket, key, version, rng)
+}
+
+// HeadObject describes cached objects from the cache, and revalidates stale
+// entries with a HEAD of the origin rather than a GET
+func (c *CachedObjectController) HeadObject(r *http.Request, bucket, key, version string, partNumber int) (*s3object.HeadObjectResult, error) {
+	if version != "" || partNumber > 0 {
+		return c.next.HeadObject(r, bucket, key, version, partNumber)
+	}
+
+	entry, ok := c.cache.Stat(bucket, key)
+	if ok && !c.cache.Stale(entry) {
+		log.Debug().Msg("Describing cached object: " + key)
+		return cachedHeadResult(entry), nil
+	}
+
+	result, err := c.next.HeadObject(r, bucket, key, version, partNumber)
+	if ok {
+		if err == nil && matches(entry, &result.GetObjectResult) {
+			log.Debug().Msg("Revalidated cached object: " + key)
+			c.cache.Revalidate(bucket, key)
+			return cachedHeadResult(entry), nil
+		}
+		c.cache.Invalidate(bucket, key)
+	}
+	return result, err
+}
+
+// revalidate checks a stale entry against the origin with a HEAD rather than
+// a GET, so that the object is only read again if it has changed. Entries
+// that no longer match the origin are invalidated.
+func (c *CachedObjectController) revalidate(r *http.Request, bucket, key string, entry Entry) (bool, error) {
+	result, err := c.next.HeadObject(r, bucket, key, "", 0)
+	if err == nil && matches(entry, &result.GetObjectResult) {
+		log.Debug().Msg("Revalidated cached object: " + key)
+		c.cache.Revalidate(bucket, key)
+		return true, nil
+	}
+	c.cache.Invalidate(bucket, key)
+	return false, err
+}
+
+// matches returns whether a cached entry is the current version of the
+// object described by an origin result
+func matches(entry Entry, result *s3object.GetObjectResult) bool {
+	return !result.DeleteMarker && result.ETag == entry.ETag && result.Version == entry.Version && result.ModTime.Equal(entry.ModTime)
+}
+
+// fill returns an origin result whose contents are stored in the cache as
+// they are read. If the object can't be cached the origin result is
+// returned as is.
+func (c *CachedObjectController) fill(bucket, key string, result *s3object.GetObjectResult) (*s3object.GetObjectResult, error) {
+	size, err := result.Content.Seek(0, io.SeekEnd)
+	if err == nil {
+		_, err = result.Content.Seek(0, io.SeekStart)
+	}
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to size object: " + key)
+		return result, nil
+	}
+	if size > c.cache.maxSize {
+		return result, nil
+	}
+
+	filler, err := c.cache.Fill(Entry{
+		Bucket:   bucket,
+		Key:      key,
+		ETag:     result.ETag,
+		Version:  result.Version,
+		ModTime:  result.ModTime,
+		Size:     size,
+		Metadata: result.Metadata,
+	})
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to cache object: " + key)
+	}
+	if filler == nil {
+		return result, nil
+	}
+	filled := *result
+	filled.Content = &fillingContent{content: result.Content, filler: filler, key: key}
+	return &filled, nil
+}
+
+// fillingContent reads the contents of an object from the origin, staging
+// them in the cache as they are read. They are stored once read in full and
+// closed; reads that skip ahead of what has been staged abandon the fill.
+type fillingContent struct {
+	content io.ReadSeeker
+	filler  *Filler
+	key     string
+	offset  int64
+}
+
+func (f *fillingContent) Read(p []byte) (int, error) {
+	n, err := f.content.Read(p)
+	if f.filler != nil && n > 0 {
+		written := f.filler.Written()
+		if f.offset > written {
+			f.abort()
+		} else if end := f.offset + int64(n); end > written {
+			// Bytes that were read before are not staged again
+			if _, err := f.filler.Write(p[written-f.offset : n]); err != nil {
+				log.Error().Err(err).Msg("Failed to cache object: " + f.key)
+				f.abort()
+			}
+		}
+	}
+	f.offset += int64(n)
+	return n, err
+}
+
+func (f *fillingContent) Seek(offset int64, whence int) (int64, error) {
+	position, err := f.content.Seek(offset, whence)
+	if err == nil {
+		f.offset = position
+	}
+	return position, err
+}
+
+// Close stores the staged contents in the cache, if they are complete, and
+// closes the origin contents
+func (f *fillingContent) Close() error {
+	if f.filler != nil {
+		if err := f.filler.Commit(); err != nil {
+			log.Error().Err(err).Msg("Failed to cache object: " + f.key)
+		}
+		f.filler = nil
+	}
+	if closer, ok := f.content.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+// abort abandons the fill
+func (f *fillingContent) abort() {
+	f.filler.Abort()
+	f.filler = nil
+}
+
+func (c *CachedObjectController) CopyObject(r *http.Request, srcBucket, srcKey string, getResult *s3object.GetObjectResult, destBucket, destKey string) (*s3object.PutObjectResult, error) {
+	defer c.cache.Invalidate(destBucket, destKey)
+	return c.next.CopyObject(r, srcBucket, srcKey, getResult, destBucket, destKey)
+}
+
+func (c *CachedObjectController) PutObject(r *http.Request, bucket, key string, reader io.Reader) (*s3object.PutObjectResult, error) {
+	defer c.cache.Invalidate(bucket, key)
+	return c.next.PutObject(r, bucket, key, reader)
+}
+
+func (c *CachedObjectController) GetObjectTagging(r *http.Request, bucket, key, version string) (*s3object.ObjectTaggingResult, error) {
+	return c.next.GetObjectTagging(r, bucket, key, version)
+}
+
+// PutObjectTagging invalidates the cached object, whose tag count is stored
+// with it
+func (c *CachedObjectController) PutObjectTagging(r *http.Request, bucket, key, version string, tags map[string]string) (string, error) {
+	defer c.cache.Invalidate(bucket, key)
+	return c.next.PutObjectTagging(r, bucket, key, version, tags)
+}
+
+func (c *CachedObjectController) DeleteObject(r *http.Request, bucket, key, version string) (*s3object.DeleteObjectResult, error) {
+	defer c.cache.Invalidate(bucket, key)
+	return c.next.DeleteObject(r, bucket, key, version)
+}
+
+type CachedMultipartController struct {
+	s3multipart.MultipartController
+	cache *Cache
+}
+
+func (c *CachedMultipartController) CompleteMultipart(r *http.Request, bucket, key, uploadID string, parts []*s3multipart.Part) (*s3multipart.CompleteMultipartResult, error) {
+	defer c.cache.Invalidate(bucket, key)
+	return c.MultipartController.CompleteMultipart(r, bucket, key, uploadID, parts)
+}
+
+// cachedResult builds a GetObject result reading from a cached copy
+func cachedResult(entry Entry, file io.ReadSeeker) *s3object.GetObjectResult {
+	return &s3object.GetObjectResult{
+		ETag:     entry.ETag,
+		Version:  entry.Version,
+		ModTime:  entry.ModTime,
+		Metadata: entry.Metadata,
+		Content:  file,
+	}
+}
+
+// cachedHeadResult builds a HeadObject result describing a cached copy
+func cachedHeadResult(entry Entry) *s3object.HeadObjectResult {
+	return &s3object.HeadObjectResult{
+		GetObjectResult: *cachedResult(entry, nil),
+		Size:            entry.Size,
+	}
+}
@@ -1,8 +1,13 @@
 package config
 
 import (
+	"fmt"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 
+	"github.com/mitchellh/mapstructure"
 	"github.com/rs/zerolog/log"
 	"github.com/spf13/viper"
 )
@@ -14,11 +19,35 @@ const (
 	DEBUG                        string = "DEBUG"
 	TRACE                        string = "TRACE"
 	YAML_CONFIG_TYPE             string = "yaml"
+	// Cache Defaults
+	DEFAULT_CACHE_DIRECTORY string = "cache"
+	DEFAULT_CACHE_SIZE      string = "1GB"
+	// Auth Defaults
+	DEFAULT_POLICY_DIRECTORY string = "policies"
+	// Lifecycle Defaults
+	DEFAULT_LIFECYCLE_DIRECTORY string        = "lifecycle"
+	DEFAULT_LIFECYCLE_INTERVAL  time.Duration = time.Hour
+	// CORS Defaults
+	DEFAULT_CORS_DIRECTORY string = "cors"
+	// Website Defaults
+	DEFAULT_WEBSITE_DIRECTORY string = "website"
+	// Notification Defaults
+	DEFAULT_NOTIFICATION_DIRECTORY      string        = "notifications"
+	DEFAULT_NOTIFICATION_MAX_ATTEMPTS   int           = 10
+	DEFAULT_NOTIFICATION_RETRY_INTERVAL time.Duration = time.Second
+	// REDACTED replaces the secrets of a printed configuration
+	REDACTED string = "REDACTED"
 )
 
 type Origin struct {
-	Type   string `json:"type"`   // One of "fs", "s3", "gcs", "r2"
-	Bucket string `json:"bucket"` // The s3-compat bucket name
+	Type         string        `json:"type"`         // One of "fs", "s3", "gcs", "r2"
+	Bucket       string        `json:"bucket"`       // The s3-compat bucket name. If set, s3c buckets are prefixes within it
+	Prefix       string        `json:"prefix"`       // An optional key prefix within the s3-compat bucket
+	Endpoint     string        `json:"endpoint"`     // The s3-compat endpoint url, ie "http://localhost:9000"
+	Location     string        `json:"location"`     // The s3-compat region
+	StorageClass string        `json:"storageclass"` // The storage class of objects written to the s3-compat origin
+	Directory    string        `json:"directory"`    // The local data directory of a "fs" origin
+	Auth         `json:"auth"` // Credentials for the s3-compat origin
 }
 
 type Auth struct {
@@ -26,10 +55,179 @@ type Auth struct {
 	Secret string `json:"secret"`
 }
 
+// Authentication configures who may make requests to s3c
+type Authentication struct {
+	KeyID           string   `json:"keyId"`           // The access key id of the single, unnamed user. Optional if users are configured
+	Secret          string   `json:"secret"`          // The secret access key of the single, unnamed user
+	Regions         []string `json:"regions"`         // The regions requests may be signed for. Defaults to "us-east-1"
+	Users           []User   `json:"users"`           // Users and their access keys
+	CredentialsFile string   `json:"credentialsFile"` // An optional yaml file of additional users, reloaded when it changes
+	PolicyDirectory string   `json:"policyDirectory"` // The local directory bucket policies are stored in
+	SignatureV2     bool     `json:"signatureV2"`     // Whether legacy clients may sign requests with AWS' auth V2
+	SessionKey      string   `json:"sessionKey"`      // The server key session tokens are signed with. If unset, a random key is used and sessions end with s3c
+	Roles           []Role   `json:"roles"`           // Roles users may assume to receive temporary credentials
+}
+
+// User is a user of s3c, who may have several access keys
+type User struct {
+	Name        string      `json:"name"`        // The unique name of the user, used as their canonical ID
+	DisplayName string      `json:"displayName"` // The display name of the user. Defaults to the name
+	Disabled    bool        `json:"disabled"`    // Disabled users cannot authenticate with any of their keys
+	Admin       bool        `json:"admin"`       // Admins may perform any action that a bucket policy does not deny
+	Policy      string      `json:"policy"`      // An optional AWS-style json policy document of the actions the user may perform
+	Keys        []AccessKey `json:"keys"`        // The access keys of the user
+}
+
+// Role is a set of permissions users may assume for the duration of a
+// session, through the sts AssumeRole api
+type Role struct {
+	Name        string        `json:"name"`        // The unique name of the role
+	Policy      string        `json:"policy"`      // The AWS-style json policy document of the actions sessions of the role may perform
+	MaxDuration time.Duration `json:"maxDuration"` // The maximum duration of sessions of the role, from 15m to 12h. Defaults to 1h
+}
+
+// AccessKey is an access key a user signs requests with
+type AccessKey struct {
+	KeyID    string    `json:"keyId"`
+	Secret   string    `json:"secret"`
+	Disabled bool      `json:"disabled"` // Disabled keys cannot be used to authenticate
+	Expires  time.Time `json:"expires"`  // An optional RFC 3339 time after which the key cannot be used, ie 2025-01-01T00:00:00Z
+}
+
+// decodeHook decodes durations and times, which yaml may leave as strings
+var decodeHook = viper.DecodeHook(mapstructure.ComposeDecodeHookFunc(
+	mapstructure.StringToTimeDurationHookFunc(),
+	mapstructure.StringToSliceHookFunc(","),
+	mapstructure.StringToTimeHookFunc(time.RFC3339),
+))
+
+// credentialsFile is the layout of a credentials file
+type credentialsFile struct {
+	Users []User `json:"users"`
+}
+
+// ReadCredentialsFile reads the users of a yaml credentials file
+func ReadCredentialsFile(path string) ([]User, error) {
+	v := viper.New()
+	v.SetConfigFile(path)
+	v.SetConfigType(YAML_CONFIG_TYPE)
+	if err := v.ReadInConfig(); err != nil {
+		return nil, err
+	}
+	file := credentialsFile{}
+	if err := v.Unmarshal(&file, decodeHook); err != nil {
+		return nil, err
+	}
+	return file.Users, nil
+}
+
+// Bucket configures a bucket
+type Bucket struct {
+	Access string `json:"access"` // Who may access the bucket without credentials: one of "private", "public-read", "public-read-write"
+}
+
+type Cache struct {
+	Enabled   bool          `json:"enabled"`
+	Directory string        `json:"directory"` // The local directory cached objects are stored in
+	MaxSize   string        `json:"maxSize"`   // The maximum size of the cache, ie "512MB" or "10GB"
+	MaxAge    time.Duration `json:"maxAge"`    // How long cached objects are served before being revalidated. 0 never revalidates
+}
+
+// Bytes returns the maximum size of the cache in bytes
+func (c Cache) Bytes() (int64, error) {
+	return ParseSize(c.MaxSize)
+}
+
+// Lifecycle configures the expiration of objects by the lifecycle rules of
+// their buckets
+type Lifecycle struct {
+	Directory string        `json:"directory"` // The local directory bucket lifecycle configurations are stored in
+	Interval  time.Duration `json:"interval"`  // How often lifecycle rules are applied. 0 never applies them
+}
+
+// CORS configures the storage of the CORS configurations of buckets
+type CORS struct {
+	Directory string `json:"directory"` // The local directory bucket CORS configurations are stored in
+}
+
+// Website configures the storage of the website configurations of buckets,
+// and the listener serving them as static websites
+type Website struct {
+	Directory string `json:"directory"` // The local directory bucket website configurations are stored in
+	Port      string `json:"port"`      // The port websites are served on. If not set, they are not served
+	Domain    string `json:"domain"`    // If set, websites are served at <bucket>.<domain> rather than /<bucket>/
+}
+
+// Notifications configures the storage of the notification configurations
+// of buckets, and the delivery of their notifications to webhook targets
+type Notifications struct {
+	Directory     string                        `json:"directory"`     // The local directory notification configurations and undelivered notifications are stored in
+	MaxAttempts   int                           `json:"maxAttempts"`   // How many times a notification is sent before it is given up on
+	RetryInterval time.Duration                 `json:"retryInterval"` // How long a failed notification waits to be retried, doubling with every attempt
+	Targets       map[string]NotificationTarget `json:"targets"`       // Webhook targets by name, notified by queue configurations with the ARN arn:s3c:sqs::<name>:webhook
+}
+
+// NotificationTarget is a webhook notifications are POSTed to
+type NotificationTarget struct {
+	Endpoint  string `json:"endpoint"`  // The URL of the webhook
+	AuthToken string `json:"authToken"` // If set, sent as a bearer token
+}
+
 type Config struct {
-	Port   string `json:"port"`
-	Origin `json:"origin"`
-	Auth   `json:"auth"`
+	Port          string `json:"port"`
+	Origin        `json:"origin"`
+	Auth          Authentication `json:"auth"`
+	Cache         `json:"cache"`
+	Lifecycle     Lifecycle         `json:"lifecycle"`
+	CORS          CORS              `json:"cors"`
+	Website       Website           `json:"website"`
+	Notifications Notifications     `json:"notifications"`
+	Buckets       map[string]Bucket `json:"buckets"` // Bucket configuration by bucket name
+}
+
+// BucketACLs returns the configured access of each bucket
+func (c Config) BucketACLs() map[string]string {
+	acls := map[string]string{}
+	for name, bucket := range c.Buckets {
+		if bucket.Access != "" {
+			acls[name] = bucket.Access
+		}
+	}
+	return acls
+}
+
+// Redacted returns a copy of the configuration without its secrets, so that
+// it can be printed
+func (c Config) Redacted() Config {
+	c.Origin.Auth.Secret = redact(c.Origin.Auth.Secret)
+	c.Auth.Secret = redact(c.Auth.Secret)
+	c.Auth.SessionKey = redact(c.Auth.SessionKey)
+	users := make([]User, len(c.Auth.Users))
+	for i, user := range c.Auth.Users {
+		keys := make([]AccessKey, len(user.Keys))
+		for j, key := range user.Keys {
+			key.Secret = redact(key.Secret)
+			keys[j] = key
+		}
+		user.Keys = keys
+		users[i] = user
+	}
+	c.Auth.Users = users
+	targets := map[string]NotificationTarget{}
+	for name, target := range c.Notifications.Targets {
+		target.AuthToken = redact(target.AuthToken)
+		targets[name] = target
+	}
+	c.Notifications.Targets = targets
+	return c
+}
+
+// redact replaces a secret, if it is set
+func redact(secret string) string {
+	if secret == "" {
+		return ""
+	}
+	return REDACTED
 }
 
 // Get configuration. If the specified file cannot be read fall back to sane defaults.
@@ -40,13 +238,65 @@ func GetConfig() (Config, error) {
 		confPath = DEFAULT_HERCULES_CONFIG_PATH
 	}
 	log.Info().Msg("loading config from " + confPath)
-	config := &Config{}
+	config := &Config{
+		Auth: Authentication{
+			PolicyDirectory: DEFAULT_POLICY_DIRECTORY,
+		},
+		Cache: Cache{
+			Directory: DEFAULT_CACHE_DIRECTORY,
+			MaxSize:   DEFAULT_CACHE_SIZE,
+		},
+		Lifecycle: Lifecycle{
+			Directory: DEFAULT_LIFECYCLE_DIRECTORY,
+			Interval:  DEFAULT_LIFECYCLE_INTERVAL,
+		},
+		CORS: CORS{
+			Directory: DEFAULT_CORS_DIRECTORY,
+		},
+		Website: Website{
+			Directory: DEFAULT_WEBSITE_DIRECTORY,
+		},
+		Notifications: Notifications{
+			Directory:     DEFAULT_NOTIFICATION_DIRECTORY,
+			MaxAttempts:   DEFAULT_NOTIFICATION_MAX_ATTEMPTS,
+			RetryInterval: DEFAULT_NOTIFICATION_RETRY_INTERVAL,
+		},
+	}
 	// Try to get configuration from file
 	viper.SetConfigFile(confPath)
 	viper.SetConfigType(YAML_CONFIG_TYPE)
 	err := viper.ReadInConfig()
-	if err := viper.Unmarshal(config); err != nil {
-		log.Error().Stack().Err(err)
+	if err := viper.Unmarshal(config, decodeHook); err != nil {
+		log.Error().Stack().Err(err).Msg("Failed to parse configuration")
 	}
 	return *config, err
 }
+
+// ParseSize parses a human-readable size such as "512MB" or "10GB" into
+// bytes. Sizes are base 1024; a bare number is a size in bytes.
+func ParseSize(size string) (int64, error) {
+	units := []struct {
+		suffix     string
+		multiplier int64
+	}{
+		{"TB", 1 << 40},
+		{"GB", 1 << 30},
+		{"MB", 1 << 20},
+		{"KB", 1 << 10},
+		{"B", 1},
+	}
+	s := strings.ToUpper(strings.TrimSpace(size))
+	multiplier := int64(1)
+	for _, unit := range units {
+		if strings.HasSuffix(s, unit.suffix) {
+			s = strings.TrimSpace(strings.TrimSuffix(s, unit.suffix))
+			multiplier = unit.multiplier
+			break
+		}
+	}
+	value, err := strconv.ParseFloat(s, 64)
+	if err != nil || value < 0 {
+		return 0, fmt.Errorf("invalid size: %q", size)
+	}
+	return int64(value * float64(multiplier)), nil
+}
@@ -0,0 +1,115 @@
+package cors
+
+import (
+	"encoding/xml"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	s3bucket "github.com/jakthom/s3c/pkg/s3/bucket"
+	s3error "github.com/jakthom/s3c/pkg/s3/error"
+	"github.com/rs/zerolog/log"
+)
+
+// Store persists the CORS configurations of buckets as xml files within a
+// directory. They are kept in memory, as every cross-origin request is
+// checked against them.
+type Store struct {
+	dir     string
+	mu      sync.RWMutex
+	configs map[string]*s3bucket.CORSConfiguration
+}
+
+// NewStore creates a store of the bucket CORS configurations in a
+// directory
+func NewStore(dir string) (*Store, error) {
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return nil, err
+	}
+	s := &Store{
+		dir:     dir,
+		configs: map[string]*s3bucket.CORSConfiguration{},
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range entries {
+		if entry.IsDir() || filepath.Ext(entry.Name()) != ".xml" {
+			continue
+		}
+		bucket := strings.TrimSuffix(entry.Name(), ".xml")
+		content, err := os.ReadFile(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+		config := &s3bucket.CORSConfiguration{}
+		if err := xml.Unmarshal(content, config); err != nil {
+			log.Error().Err(err).Msg("Ignoring invalid bucket CORS configuration: " + bucket)
+			continue
+		}
+		s.configs[bucket] = config
+	}
+	return s, nil
+}
+
+func (s *Store) path(bucket string) string {
+	return filepath.Join(s.dir, bucket+".xml")
+}
+
+func (s *Store) GetBucketCors(r *http.Request, bucket string) (*s3bucket.CORSConfiguration, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	config, ok := s.configs[bucket]
+	if !ok {
+		return nil, s3error.NoSuchCORSConfigurationError(r)
+	}
+	return config, nil
+}
+
+func (s *Store) PutBucketCors(r *http.Request, bucket string, config *s3bucket.CORSConfiguration) error {
+	document, err := xml.Marshal(config)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := writeFileAtomic(s.path(bucket), document); err != nil {
+		log.Error().Err(err).Msg("Failed to write bucket CORS configuration: " + bucket)
+		return err
+	}
+	s.configs[bucket] = config
+	return nil
+}
+
+func (s *Store) DeleteBucketCors(r *http.Request, bucket string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := os.Remove(s.path(bucket)); err != nil && !os.IsNotExist(err) {
+		log.Error().Err(err).Msg("Failed to delete bucket CORS configuration: " + bucket)
+		return err
+	}
+	delete(s.configs, bucket)
+	return nil
+}
+
+// writeFileAtomic writes a file by renaming a temporary file in its
+// directory into place, so that it is never partially written
+func writeFileAtomic(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".tmp-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,127 @@
+package lifecycle
+
+import (
+	"encoding/xml"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	s3bucket "github.com/jakthom/s3c/pkg/s3/bucket"
+	s3error "github.com/jakthom/s3c/pkg/s3/error"
+	"github.com/rs/zerolog/log"
+)
+
+// Store persists the lifecycle configurations of buckets as xml files within
+// a directory. They are kept in memory, to be applied to the origin by a
+// Worker.
+type Store struct {
+	dir     string
+	mu      sync.RWMutex
+	configs map[string]*s3bucket.LifecycleConfiguration
+}
+
+// NewStore creates a store of the bucket lifecycle configurations in a
+// directory
+func NewStore(dir string) (*Store, error) {
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return nil, err
+	}
+	s := &Store{
+		dir:     dir,
+		configs: map[string]*s3bucket.LifecycleConfiguration{},
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range entries {
+		if entry.IsDir() || filepath.Ext(entry.Name()) != ".xml" {
+			continue
+		}
+		bucket := strings.TrimSuffix(entry.Name(), ".xml")
+		content, err := os.ReadFile(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+		config := &s3bucket.LifecycleConfiguration{}
+		if err := xml.Unmarshal(content, config); err != nil {
+			log.Error().Err(err).Msg("Ignoring invalid bucket lifecycle configuration: " + bucket)
+			continue
+		}
+		s.configs[bucket] = config
+	}
+	return s, nil
+}
+
+func (s *Store) path(bucket string) string {
+	return filepath.Join(s.dir, bucket+".xml")
+}
+
+// Configurations returns the lifecycle configuration of every bucket that
+// has one
+func (s *Store) Configurations() map[string]*s3bucket.LifecycleConfiguration {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	configs := make(map[string]*s3bucket.LifecycleConfiguration, len(s.configs))
+	for bucket, config := range s.configs {
+		configs[bucket] = config
+	}
+	return configs
+}
+
+func (s *Store) GetBucketLifecycle(r *http.Request, bucket string) (*s3bucket.LifecycleConfiguration, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	config, ok := s.configs[bucket]
+	if !ok {
+		return nil, s3error.NoSuchLifecycleConfigurationError(r)
+	}
+	return config, nil
+}
+
+func (s *Store) PutBucketLifecycle(r *http.Request, bucket string, config *s3bucket.LifecycleConfiguration) error {
+	document, err := xml.Marshal(config)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := writeFileAtomic(s.path(bucket), document); err != nil {
+		log.Error().Err(err).Msg("Failed to write bucket lifecycle configuration: " + bucket)
+		return err
+	}
+	s.configs[bucket] = config
+	return nil
+}
+
+func (s *Store) DeleteBucketLifecycle(r *http.Request, bucket string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := os.Remove(s.path(bucket)); err != nil && !os.IsNotExist(err) {
+		log.Error().Err(err).Msg("Failed to delete bucket lifecycle configuration: " + bucket)
+		return err
+	}
+	delete(s.configs, bucket)
+	return nil
+}
+
+// writeFileAtomic writes a file by renaming a temporary file in its
+// directory into place, so that it is never partially written
+func writeFileAtomic(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".tmp-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,67 @@
+package lifecycle
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	s3bucket "github.com/jakthom/s3c/pkg/s3/bucket"
+	s3error "github.com/jakthom/s3c/pkg/s3/error"
+)
+
+func TestStore(t *testing.T) {
+	dir := t.TempDir()
+	store, err := NewStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.GetBucketLifecycle(testRequest(), "bucket"); !isCode(err, "NoSuchLifecycleConfiguration") {
+		t.Errorf("bucket without a configuration: got %v", err)
+	}
+	config := &s3bucket.LifecycleConfiguration{Rules: []s3bucket.LifecycleRule{{
+		ID:         "logs",
+		Filter:     prefixFilter("logs/"),
+		Status:     s3bucket.LifecycleEnabled,
+		Expiration: &s3bucket.LifecycleExpiration{Days: 30},
+	}}}
+	if err := store.PutBucketLifecycle(testRequest(), "bucket", config); err != nil {
+		t.Fatal(err)
+	}
+
+	// Configurations are read back from their directory, skipping invalid
+	// ones
+	if err := os.WriteFile(filepath.Join(dir, "invalid.xml"), []byte("<LifecycleConfiguration>"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	reloaded, err := NewStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	configs := reloaded.Configurations()
+	if len(configs) != 1 {
+		t.Fatalf("reloaded %d configurations, want 1", len(configs))
+	}
+	rule := configs["bucket"].Rules[0]
+	if prefix, _, _, _ := rule.Criteria(); rule.ID != "logs" || prefix != "logs/" || rule.Status != s3bucket.LifecycleEnabled || rule.Expiration.Days != 30 {
+		t.Errorf("reloaded rule = %+v", rule)
+	}
+
+	if err := reloaded.DeleteBucketLifecycle(testRequest(), "bucket"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := reloaded.GetBucketLifecycle(testRequest(), "bucket"); !isCode(err, "NoSuchLifecycleConfiguration") {
+		t.Errorf("deleted configuration: got %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "bucket.xml")); !os.IsNotExist(err) {
+		t.Error("deleted configuration remains on disk")
+	}
+	// Deleting a missing configuration succeeds
+	if err := reloaded.DeleteBucketLifecycle(testRequest(), "bucket"); err != nil {
+		t.Error(err)
+	}
+}
+
+func isCode(err error, code string) bool {
+	s3Err, ok := err.(*s3error.Error)
+	return ok && s3Err.Code == code
+}
@@ -0,0 +1,320 @@
+package lifecycle
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/jakthom/s3c/pkg/origin"
+	s3bucket "github.com/jakthom/s3c/pkg/s3/bucket"
+	s3multipart "github.com/jakthom/s3c/pkg/s3/multipart"
+	s3object "github.com/jakthom/s3c/pkg/s3/object"
+	"github.com/rs/zerolog/log"
+)
+
+// listPageSize is how many objects, versions or uploads are listed at once
+// while applying lifecycle rules
+const listPageSize int = 1000
+
+// Report counts what applying lifecycle rules deleted
+type Report struct {
+	// Expired is the number of current versions of objects expired
+	Expired int
+	// NoncurrentExpired is the number of noncurrent versions permanently
+	// deleted
+	NoncurrentExpired int
+	// DeleteMarkersRemoved is the number of expired delete markers removed
+	DeleteMarkersRemoved int
+	// UploadsAborted is the number of incomplete multipart uploads aborted
+	UploadsAborted int
+}
+
+func (r Report) total() int {
+	return r.Expired + r.NoncurrentExpired + r.DeleteMarkersRemoved + r.UploadsAborted
+}
+
+// Worker periodically applies the lifecycle rules of buckets to an origin.
+// It works through the controllers of the origin, so it applies to any of
+// them, and writes through the cache invalidate it.
+type Worker struct {
+	store     *Store
+	buckets   s3bucket.BucketController
+	objects   s3object.ObjectController
+	multipart s3multipart.MultipartController
+	interval  time.Duration
+}
+
+func NewWorker(store *Store, o origin.Origin, interval time.Duration) *Worker {
+	return &Worker{
+		store:     store,
+		buckets:   o.BucketController(),
+		objects:   o.ObjectController(),
+		multipart: o.MultipartController(),
+		interval:  interval,
+	}
+}
+
+// Run applies lifecycle rules right away, and then every interval until the
+// context is done
+func (w *Worker) Run(ctx context.Context) {
+	log.Info().Str("interval", w.interval.String()).Msg("Applying bucket lifecycle rules")
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+	for {
+		report := w.Apply(ctx, time.Now())
+		if report.total() > 0 {
+			log.Info().Int("expired", report.Expired).Int("noncurrentExpired", report.NoncurrentExpired).Int("deleteMarkersRemoved", report.DeleteMarkersRemoved).Int("uploadsAborted", report.UploadsAborted).Msg("Applied bucket lifecycle rules")
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Apply applies the lifecycle rules of every bucket as of `now`
+func (w *Worker) Apply(ctx context.Context, now time.Time) Report {
+	report := Report{}
+	for bucket, config := range w.store.Configurations() {
+		if ctx.Err() != nil {
+			break
+		}
+		r, err := http.NewRequestWithContext(ctx, http.MethodDelete, "/"+bucket, nil)
+		if err != nil {
+			log.Error().Err(err).Msg("Failed to apply lifecycle rules of bucket: " + bucket)
+			continue
+		}
+		for i := range config.Rules {
+			rule := &config.Rules[i]
+			if rule.Status != s3bucket.LifecycleEnabled {
+				continue
+			}
+			if err := w.applyRule(r, bucket, rule, now, &report); err != nil {
+				log.Error().Err(err).Msg("Failed to apply lifecycle rule " + rule.ID + " of bucket: " + bucket)
+			}
+		}
+	}
+	return report
+}
+
+func (w *Worker) applyRule(r *http.Request, bucket string, rule *s3bucket.LifecycleRule, now time.Time, report *Report) error {
+	if e := rule.Expiration; e != nil && !e.ExpiredObjectDeleteMarker {
+		if err := w.expireCurrent(r, bucket, rule, now, report); err != nil {
+			return err
+		}
+	}
+	if rule.NoncurrentVersionExpiration != nil || (rule.Expiration != nil && rule.Expiration.ExpiredObjectDeleteMarker) {
+		if err := w.expireVersions(r, bucket, rule, now, report); err != nil {
+			return err
+		}
+	}
+	if rule.AbortIncompleteMultipartUpload != nil {
+		if err := w.abortUploads(r, bucket, rule, now, report); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// expireCurrent deletes the current versions of the objects a rule has
+// expired. In a versioned bucket they become noncurrent, behind a delete
+// marker.
+func (w *Worker) expireCurrent(r *http.Request, bucket string, rule *s3bucket.LifecycleRule, now time.Time, report *Report) error {
+	prefix, tags, greaterThan, lessThan := rule.Criteria()
+	date, hasDate := rule.Expiration.ExpirationDate()
+	if hasDate && now.Before(date) {
+		return nil
+	}
+	token := ""
+	for {
+		result, err := w.buckets.ListObjectsV2(r, bucket, prefix, token, "", "", listPageSize, false)
+		if err != nil {
+			return err
+		}
+		for _, object := range result.Contents {
+			if !hasDate && now.Before(expiry(object.LastModified, rule.Expiration.Days)) {
+				continue
+			}
+			if !sizeMatches(int64(object.Size), greaterThan, lessThan) || !w.tagsMatch(r, bucket, object.Key, "", tags) {
+				continue
+			}
+			if _, err := w.objects.DeleteObject(r, bucket, object.Key, ""); err != nil {
+				log.Error().Err(err).Msg("Failed to expire object: " + bucket + "/" + object.Key)
+				continue
+			}
+			log.Info().Str("rule", rule.ID).Msg("Expired object: " + bucket + "/" + object.Key)
+			report.Expired++
+		}
+		if !result.IsTruncated || result.NextContinuationToken == "" {
+			return nil
+		}
+		token = result.NextContinuationToken
+	}
+}
+
+// version is a version or delete marker of an object, as listed
+type version struct {
+	key          string
+	id           string
+	isLatest     bool
+	deleteMarker bool
+	modTime      time.Time
+	size         int64
+}
+
+// expireVersions permanently deletes the noncurrent versions a rule has
+// expired, and the delete markers left without noncurrent versions. The
+// versions of each key are gathered, newest first, before they are expired.
+func (w *Worker) expireVersions(r *http.Request, bucket string, rule *s3bucket.LifecycleRule, now time.Time, report *Report) error {
+	prefix, _, _, _ := rule.Criteria()
+	keyMarker, versionMarker := "", ""
+	var versions []version
+	for {
+		result, err := w.buckets.ListObjectVersions(r, bucket, prefix, keyMarker, versionMarker, "", listPageSize)
+		if err != nil {
+			return err
+		}
+		page := make([]version, 0, len(result.Versions)+len(result.DeleteMarkers))
+		for _, v := range result.Versions {
+			page = append(page, version{key: v.Key, id: v.Version, isLatest: v.IsLatest, modTime: v.LastModified, size: int64(v.Size)})
+		}
+		for _, m := range result.DeleteMarkers {
+			page = append(page, version{key: m.Key, id: m.Version, isLatest: m.IsLatest, deleteMarker: true, modTime: m.LastModified})
+		}
+		sort.SliceStable(page, func(i, j int) bool {
+			if page[i].key != page[j].key {
+				return page[i].key < page[j].key
+			}
+			if page[i].isLatest != page[j].isLatest {
+				return page[i].isLatest
+			}
+			return page[i].modTime.After(page[j].modTime)
+		})
+		for _, v := range page {
+			if len(versions) > 0 && versions[0].key != v.key {
+				w.expireKey(r, bucket, rule, versions, now, report)
+				versions = nil
+			}
+			versions = append(versions, v)
+		}
+		if !result.IsTruncated || result.NextKeyMarker == "" {
+			break
+		}
+		keyMarker, versionMarker = result.NextKeyMarker, result.NextVersionIDMarker
+	}
+	if len(versions) > 0 {
+		w.expireKey(r, bucket, rule, versions, now, report)
+	}
+	return nil
+}
+
+// expireKey applies a rule to the versions of a key, newest first. A
+// version becomes noncurrent when the next newer one is written.
+func (w *Worker) expireKey(r *http.Request, bucket string, rule *s3bucket.LifecycleRule, versions []version, now time.Time, report *Report) {
+	_, tags, greaterThan, lessThan := rule.Criteria()
+	remaining := versions
+	if e := rule.NoncurrentVersionExpiration; e != nil {
+		remaining = []version{versions[0]}
+		newer := 0
+		for i := 1; i < len(versions); i++ {
+			v := versions[i]
+			if v.deleteMarker {
+				remaining = append(remaining, v)
+				continue
+			}
+			expired := newer >= e.NewerNoncurrentVersions && !now.Before(expiry(versions[i-1].modTime, e.NoncurrentDays))
+			newer++
+			if !expired || !sizeMatches(v.size, greaterThan, lessThan) || !w.tagsMatch(r, bucket, v.key, v.id, tags) {
+				remaining = append(remaining, v)
+				continue
+			}
+			if _, err := w.objects.DeleteObject(r, bucket, v.key, v.id); err != nil {
+				log.Error().Err(err).Msg("Failed to expire noncurrent version " + v.id + " of object: " + bucket + "/" + v.key)
+				remaining = append(remaining, v)
+				continue
+			}
+			log.Info().Str("rule", rule.ID).Str("version", v.id).Msg("Expired noncurrent version of object: " + bucket + "/" + v.key)
+			report.NoncurrentExpired++
+		}
+	}
+	if e := rule.Expiration; e == nil || !e.ExpiredObjectDeleteMarker {
+		return
+	}
+	// A delete marker is expired once it is the only version of its key
+	if marker := remaining[0]; len(remaining) == 1 && marker.deleteMarker && marker.isLatest {
+		if _, err := w.objects.DeleteObject(r, bucket, marker.key, marker.id); err != nil {
+			log.Error().Err(err).Msg("Failed to remove expired delete marker of object: " + bucket + "/" + marker.key)
+			return
+		}
+		log.Info().Str("rule", rule.ID).Str("version", marker.id).Msg("Removed expired delete marker of object: " + bucket + "/" + marker.key)
+		report.DeleteMarkersRemoved++
+	}
+}
+
+// abortUploads aborts the multipart uploads initiated too long ago by a rule
+func (w *Worker) abortUploads(r *http.Request, bucket string, rule *s3bucket.LifecycleRule, now time.Time, report *Report) error {
+	prefix, _, _, _ := rule.Criteria()
+	days := rule.AbortIncompleteMultipartUpload.DaysAfterInitiation
+	keyMarker, uploadIDMarker := "", ""
+	for {
+		result, err := w.multipart.ListMultipart(r, bucket, keyMarker, uploadIDMarker, listPageSize)
+		if err != nil {
+			return err
+		}
+		for _, upload := range result.Uploads {
+			if !strings.HasPrefix(upload.Key, prefix) || now.Before(expiry(upload.Initiated, days)) {
+				continue
+			}
+			if err := w.multipart.AbortMultipart(r, bucket, upload.Key, upload.UploadID); err != nil {
+				log.Error().Err(err).Msg("Failed to abort multipart upload " + upload.UploadID + " of object: " + bucket + "/" + upload.Key)
+				continue
+			}
+			log.Info().Str("rule", rule.ID).Str("uploadId", upload.UploadID).Msg("Aborted incomplete multipart upload of object: " + bucket + "/" + upload.Key)
+			report.UploadsAborted++
+		}
+		if !result.IsTruncated || len(result.Uploads) == 0 {
+			return nil
+		}
+		last := result.Uploads[len(result.Uploads)-1]
+		keyMarker, uploadIDMarker = last.Key, last.UploadID
+	}
+}
+
+// tagsMatch returns whether a version of an object has all of the given
+// tags. Objects whose tags can't be read don't match.
+func (w *Worker) tagsMatch(r *http.Request, bucket, key, id string, tags map[string]string) bool {
+	if len(tags) == 0 {
+		return true
+	}
+	result, err := w.objects.GetObjectTagging(r, bucket, key, id)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to get tags of object: " + bucket + "/" + key)
+		return false
+	}
+	for key, value := range tags {
+		if actual, ok := result.Tags[key]; !ok || actual != value {
+			return false
+		}
+	}
+	return true
+}
+
+// sizeMatches returns whether a size is within the exclusive bounds of a
+// rule, which are zero if unset
+func sizeMatches(size, greaterThan, lessThan int64) bool {
+	return (greaterThan == 0 || size > greaterThan) && (lessThan == 0 || size < lessThan)
+}
+
+// expiry returns when something dated `t` expires after a number of days.
+// As in s3, expiry is rounded up to the next midnight UTC.
+func expiry(t time.Time, days int) time.Time {
+	t = t.UTC().AddDate(0, 0, days)
+	midnight := t.Truncate(24 * time.Hour)
+	if midnight.Before(t) {
+		midnight = midnight.Add(24 * time.Hour)
+	}
+	return midnight
+}
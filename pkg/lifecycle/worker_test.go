@@ -0,0 +1,259 @@
+package lifecycle
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	fileorigin "github.com/jakthom/s3c/pkg/origin/file"
+	s3bucket "github.com/jakthom/s3c/pkg/s3/bucket"
+	s3util "github.com/jakthom/s3c/pkg/s3/util"
+)
+
+func testRequest() *http.Request {
+	return httptest.NewRequest(http.MethodGet, "/", nil)
+}
+
+// newTestWorker returns a worker applying rules to a bucket of a new file
+// origin
+func newTestWorker(t *testing.T, versioning string, rules ...s3bucket.LifecycleRule) (*Worker, *fileorigin.FileOrigin) {
+	t.Helper()
+	o, err := fileorigin.NewOrigin(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := o.BucketController().CreateBucket(testRequest(), "bucket"); err != nil {
+		t.Fatal(err)
+	}
+	if versioning != s3bucket.VersioningDisabled {
+		if err := o.BucketController().SetBucketVersioning(testRequest(), "bucket", versioning); err != nil {
+			t.Fatal(err)
+		}
+	}
+	store, err := NewStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range rules {
+		rules[i].Status = s3bucket.LifecycleEnabled
+	}
+	if err := store.PutBucketLifecycle(testRequest(), "bucket", &s3bucket.LifecycleConfiguration{Rules: rules}); err != nil {
+		t.Fatal(err)
+	}
+	return NewWorker(store, o, time.Hour), o
+}
+
+func putObject(t *testing.T, o *fileorigin.FileOrigin, key, content string, tags map[string]string) {
+	t.Helper()
+	if _, err := o.ObjectController().PutObject(testRequest(), "bucket", key, strings.NewReader(content)); err != nil {
+		t.Fatal(err)
+	}
+	if len(tags) > 0 {
+		if _, err := o.ObjectController().PutObjectTagging(testRequest(), "bucket", key, "", tags); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// listKeys returns the keys of the current objects of the bucket
+func listKeys(t *testing.T, o *fileorigin.FileOrigin) string {
+	t.Helper()
+	result, err := o.BucketController().ListObjectsV2(testRequest(), "bucket", "", "", "", "", 1000, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var keys []string
+	for _, object := range result.Contents {
+		keys = append(keys, object.Key)
+	}
+	return strings.Join(keys, ",")
+}
+
+func prefixFilter(prefix string) *s3bucket.LifecycleFilter {
+	return &s3bucket.LifecycleFilter{Prefix: &prefix}
+}
+
+func TestExpiry(t *testing.T) {
+	tests := []struct {
+		t    time.Time
+		days int
+		want time.Time
+	}{
+		// The example of AWS' lifecycle documentation: an object created at
+		// 10:30 on January 15 expiring after 3 days expires at midnight on
+		// January 19
+		{time.Date(2014, 1, 15, 10, 30, 0, 0, time.UTC), 3, time.Date(2014, 1, 19, 0, 0, 0, 0, time.UTC)},
+		{time.Date(2014, 1, 15, 0, 0, 0, 0, time.UTC), 3, time.Date(2014, 1, 18, 0, 0, 0, 0, time.UTC)},
+		{time.Date(2014, 1, 15, 23, 30, 0, 0, time.FixedZone("UTC-2", -2*60*60)), 1, time.Date(2014, 1, 18, 0, 0, 0, 0, time.UTC)},
+	}
+	for _, tt := range tests {
+		if got := expiry(tt.t, tt.days); !got.Equal(tt.want) {
+			t.Errorf("%v after %d days = %v, want %v", tt.t, tt.days, got, tt.want)
+		}
+	}
+}
+
+func TestExpireCurrent(t *testing.T) {
+	now := time.Now()
+	greaterThan := int64(4)
+	tests := []struct {
+		name    string
+		rule    s3bucket.LifecycleRule
+		at      time.Time
+		expired int
+		remain  string
+	}{
+		{"before the expiry", s3bucket.LifecycleRule{Filter: &s3bucket.LifecycleFilter{}, Expiration: &s3bucket.LifecycleExpiration{Days: 30}}, now.AddDate(0, 0, 29), 0, "big,logs/a,logs/big,logs/tagged"},
+		{"after the expiry", s3bucket.LifecycleRule{Filter: &s3bucket.LifecycleFilter{}, Expiration: &s3bucket.LifecycleExpiration{Days: 30}}, now.AddDate(0, 0, 31), 4, ""},
+		{"at a past date", s3bucket.LifecycleRule{Filter: &s3bucket.LifecycleFilter{}, Expiration: &s3bucket.LifecycleExpiration{Date: "2020-01-01T00:00:00Z"}}, now, 4, ""},
+		{"at a future date", s3bucket.LifecycleRule{Filter: &s3bucket.LifecycleFilter{}, Expiration: &s3bucket.LifecycleExpiration{Date: "2999-01-01T00:00:00Z"}}, now, 0, "big,logs/a,logs/big,logs/tagged"},
+		{"of a prefix", s3bucket.LifecycleRule{Filter: prefixFilter("logs/"), Expiration: &s3bucket.LifecycleExpiration{Days: 1}}, now.AddDate(0, 0, 2), 3, "big"},
+		{"of a tag", s3bucket.LifecycleRule{Filter: &s3bucket.LifecycleFilter{Tag: &s3util.Tag{Key: "class", Value: "temporary"}}, Expiration: &s3bucket.LifecycleExpiration{Days: 1}}, now.AddDate(0, 0, 2), 1, "big,logs/a,logs/big"},
+		{"of a size", s3bucket.LifecycleRule{Filter: &s3bucket.LifecycleFilter{ObjectSizeGreaterThan: &greaterThan}, Expiration: &s3bucket.LifecycleExpiration{Days: 1}}, now.AddDate(0, 0, 2), 2, "logs/a,logs/tagged"},
+		{"of a prefix and size", s3bucket.LifecycleRule{Filter: &s3bucket.LifecycleFilter{And: &s3bucket.LifecycleAnd{Prefix: "logs/", ObjectSizeGreaterThan: 4}}, Expiration: &s3bucket.LifecycleExpiration{Days: 1}}, now.AddDate(0, 0, 2), 1, "big,logs/a,logs/tagged"},
+	}
+	for _, tt := range tests {
+		worker, o := newTestWorker(t, s3bucket.VersioningDisabled, tt.rule)
+		putObject(t, o, "logs/a", "a", nil)
+		putObject(t, o, "logs/big", "large object", nil)
+		putObject(t, o, "logs/tagged", "t", map[string]string{"class": "temporary"})
+		putObject(t, o, "big", "large object", nil)
+
+		report := worker.Apply(context.Background(), tt.at)
+		if report != (Report{Expired: tt.expired}) {
+			t.Errorf("%s: report = %+v, want %d expired", tt.name, report, tt.expired)
+		}
+		if remain := listKeys(t, o); remain != tt.remain {
+			t.Errorf("%s: remaining objects %q, want %q", tt.name, remain, tt.remain)
+		}
+	}
+
+	// Disabled rules are not applied
+	worker, o := newTestWorker(t, s3bucket.VersioningDisabled, s3bucket.LifecycleRule{Filter: &s3bucket.LifecycleFilter{}, Expiration: &s3bucket.LifecycleExpiration{Days: 1}})
+	putObject(t, o, "key", "content", nil)
+	worker.store.configs["bucket"].Rules[0].Status = s3bucket.LifecycleDisabled
+	if report := worker.Apply(context.Background(), now.AddDate(1, 0, 0)); report != (Report{}) {
+		t.Errorf("disabled rule: report = %+v", report)
+	}
+}
+
+// listVersions returns the number of versions and delete markers of a key,
+// and whether its latest version is a delete marker
+func listVersions(t *testing.T, o *fileorigin.FileOrigin, key string) (versions, deleteMarkers int, deleted bool) {
+	t.Helper()
+	result, err := o.BucketController().ListObjectVersions(testRequest(), "bucket", key, "", "", "", 1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, marker := range result.DeleteMarkers {
+		deleted = deleted || marker.IsLatest
+	}
+	return len(result.Versions), len(result.DeleteMarkers), deleted
+}
+
+func TestExpireVersions(t *testing.T) {
+	now := time.Now()
+
+	// In a versioned bucket expired objects become noncurrent, behind a
+	// delete marker
+	worker, o := newTestWorker(t, s3bucket.VersioningEnabled, s3bucket.LifecycleRule{Filter: &s3bucket.LifecycleFilter{}, Expiration: &s3bucket.LifecycleExpiration{Days: 1}})
+	putObject(t, o, "key", "content", nil)
+	if report := worker.Apply(context.Background(), now.AddDate(0, 0, 2)); report != (Report{Expired: 1}) {
+		t.Errorf("versioned expiration: report = %+v", report)
+	}
+	if versions, deleteMarkers, deleted := listVersions(t, o, "key"); versions != 1 || deleteMarkers != 1 || !deleted {
+		t.Errorf("versioned expiration left %d versions and %d delete markers, deleted %v", versions, deleteMarkers, deleted)
+	}
+
+	tests := []struct {
+		name       string
+		newer      int
+		at         time.Time
+		noncurrent int
+		versions   int
+	}{
+		{"before they expire", 0, now, 0, 3},
+		{"after they expire", 0, now.AddDate(0, 0, 2), 2, 1},
+		{"retaining newer versions", 1, now.AddDate(0, 0, 2), 1, 2},
+		{"retaining every version", 2, now.AddDate(0, 0, 2), 0, 3},
+	}
+	for _, tt := range tests {
+		worker, o := newTestWorker(t, s3bucket.VersioningEnabled, s3bucket.LifecycleRule{
+			Filter:                      prefixFilter("logs/"),
+			NoncurrentVersionExpiration: &s3bucket.NoncurrentVersionExpiration{NoncurrentDays: 1, NewerNoncurrentVersions: tt.newer},
+		})
+		for _, content := range []string{"one", "two", "three"} {
+			putObject(t, o, "logs/key", content, nil)
+			putObject(t, o, "other", content, nil)
+		}
+		if report := worker.Apply(context.Background(), tt.at); report != (Report{NoncurrentExpired: tt.noncurrent}) {
+			t.Errorf("%s: report = %+v, want %d noncurrent versions expired", tt.name, report, tt.noncurrent)
+		}
+		if versions, _, _ := listVersions(t, o, "logs/key"); versions != tt.versions {
+			t.Errorf("%s: %d versions remain, want %d", tt.name, versions, tt.versions)
+		}
+		if versions, _, _ := listVersions(t, o, "other"); versions != 3 {
+			t.Errorf("%s: %d versions of an object outside of the prefix remain", tt.name, versions)
+		}
+	}
+
+	// Delete markers are removed once their noncurrent versions are
+	worker, o = newTestWorker(t, s3bucket.VersioningEnabled, s3bucket.LifecycleRule{
+		Filter:                      &s3bucket.LifecycleFilter{},
+		Expiration:                  &s3bucket.LifecycleExpiration{ExpiredObjectDeleteMarker: true},
+		NoncurrentVersionExpiration: &s3bucket.NoncurrentVersionExpiration{NoncurrentDays: 1},
+	})
+	putObject(t, o, "deleted", "content", nil)
+	putObject(t, o, "current", "content", nil)
+	if _, err := o.ObjectController().DeleteObject(testRequest(), "bucket", "deleted", ""); err != nil {
+		t.Fatal(err)
+	}
+	if report := worker.Apply(context.Background(), now); report != (Report{}) {
+		t.Errorf("delete marker with a noncurrent version: report = %+v", report)
+	}
+	if report := worker.Apply(context.Background(), now.AddDate(0, 0, 2)); report != (Report{NoncurrentExpired: 1, DeleteMarkersRemoved: 1}) {
+		t.Errorf("expired delete marker: report = %+v", report)
+	}
+	if versions, deleteMarkers, _ := listVersions(t, o, "deleted"); versions != 0 || deleteMarkers != 0 {
+		t.Errorf("deleted object left %d versions and %d delete markers", versions, deleteMarkers)
+	}
+	if listKeys(t, o) != "current" {
+		t.Errorf("remaining objects %q, want current", listKeys(t, o))
+	}
+}
+
+func TestAbortUploads(t *testing.T) {
+	worker, o := newTestWorker(t, s3bucket.VersioningDisabled, s3bucket.LifecycleRule{
+		Filter:                         prefixFilter("logs/"),
+		AbortIncompleteMultipartUpload: &s3bucket.AbortIncompleteMultipartUpload{DaysAfterInitiation: 7},
+	})
+	for _, key := range []string{"logs/a", "logs/b", "other"} {
+		if _, err := o.MultipartController().InitMultipart(testRequest(), "bucket", key); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	now := time.Now()
+	if report := worker.Apply(context.Background(), now.AddDate(0, 0, 6)); report != (Report{}) {
+		t.Errorf("recent uploads: report = %+v", report)
+	}
+	if report := worker.Apply(context.Background(), now.AddDate(0, 0, 8)); report != (Report{UploadsAborted: 2}) {
+		t.Errorf("incomplete uploads: report = %+v", report)
+	}
+	result, err := o.MultipartController().ListMultipart(testRequest(), "bucket", "", "", 1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var keys []string
+	for _, upload := range result.Uploads {
+		keys = append(keys, upload.Key)
+	}
+	sort.Strings(keys)
+	if strings.Join(keys, ",") != "other" {
+		t.Errorf("remaining uploads of %v, want other", keys)
+	}
+}
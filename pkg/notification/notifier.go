@@ -0,0 +1,125 @@
+package notification
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	s3auth "github.com/jakthom/s3c/pkg/s3/auth"
+	s3event "github.com/jakthom/s3c/pkg/s3/event"
+	s3policy "github.com/jakthom/s3c/pkg/s3/policy"
+	s3util "github.com/jakthom/s3c/pkg/s3/util"
+	"github.com/rs/zerolog/log"
+)
+
+// Notifier queues the notifications of the events of objects to the targets
+// of the notification configurations of their buckets
+type Notifier struct {
+	store  *Store
+	outbox *Outbox
+	region string
+}
+
+func NewNotifier(store *Store, outbox *Outbox, region string) *Notifier {
+	return &Notifier{store: store, outbox: outbox, region: region}
+}
+
+// identity is the JSON marshallable identity of a user in a record
+type identity struct {
+	PrincipalID string `json:"principalId"`
+}
+
+// record is the JSON marshallable record of an event, in the format of s3
+// event notifications
+type record struct {
+	EventVersion      string   `json:"eventVersion"`
+	EventSource       string   `json:"eventSource"`
+	AWSRegion         string   `json:"awsRegion"`
+	EventTime         string   `json:"eventTime"`
+	EventName         string   `json:"eventName"`
+	UserIdentity      identity `json:"userIdentity"`
+	RequestParameters struct {
+		SourceIPAddress string `json:"sourceIPAddress"`
+	} `json:"requestParameters"`
+	ResponseElements struct {
+		RequestID string `json:"x-amz-request-id"`
+		ID2       string `json:"x-amz-id-2"`
+	} `json:"responseElements"`
+	S3 struct {
+		SchemaVersion   string `json:"s3SchemaVersion"`
+		ConfigurationID string `json:"configurationId"`
+		Bucket          struct {
+			Name string `json:"name"`
+			ARN  string `json:"arn"`
+		} `json:"bucket"`
+		Object struct {
+			Key       string `json:"key"`
+			Size      int64  `json:"size,omitempty"`
+			ETag      string `json:"eTag,omitempty"`
+			VersionID string `json:"versionId,omitempty"`
+			Sequencer string `json:"sequencer"`
+		} `json:"object"`
+	} `json:"s3"`
+}
+
+func (n *Notifier) Notify(r *http.Request, event s3event.Event) {
+	config := n.store.configuration(event.Bucket)
+	if config == nil {
+		return
+	}
+	now := time.Now().UTC()
+	for _, queue := range config.QueueConfigurations {
+		if !queue.Matches(event.Name, event.Key) {
+			continue
+		}
+		target, _ := targetName(queue.Queue)
+		body, err := json.Marshal(struct {
+			Records []record `json:"Records"`
+		}{
+			Records: []record{n.record(r, event, queue.ID, now)},
+		})
+		if err == nil {
+			err = n.outbox.Enqueue(target, body)
+		}
+		if err != nil {
+			log.Error().Err(err).Msg("Failed to queue notification of " + event.Name + " to " + target + ": " + event.Bucket + "/" + event.Key)
+		}
+	}
+}
+
+// record returns the record of an event notified by a configuration
+func (n *Notifier) record(r *http.Request, event s3event.Event, configurationID string, now time.Time) record {
+	rec := record{
+		EventVersion: "2.1",
+		EventSource:  "aws:s3",
+		AWSRegion:    n.region,
+		EventTime:    now.Format("2006-01-02T15:04:05.000Z"),
+		EventName:    event.Name,
+		UserIdentity: identity{PrincipalID: "anonymous"},
+	}
+	if user := s3auth.RequestUser(r); user != nil {
+		rec.UserIdentity.PrincipalID = user.ID
+	}
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		rec.RequestParameters.SourceIPAddress = host
+	}
+	requestID := mux.Vars(r)["requestID"]
+	rec.ResponseElements.RequestID = requestID
+	rec.ResponseElements.ID2 = requestID
+	rec.S3.SchemaVersion = "1.0"
+	rec.S3.ConfigurationID = configurationID
+	rec.S3.Bucket.Name = event.Bucket
+	rec.S3.Bucket.ARN = s3policy.BucketResource(event.Bucket)
+	// Keys are form encoded but for their slashes, as in s3 records
+	rec.S3.Object.Key = strings.ReplaceAll(url.QueryEscape(event.Key), "%2F", "/")
+	rec.S3.Object.Size = event.Size
+	rec.S3.Object.ETag = s3util.StripETagQuotes(event.ETag)
+	rec.S3.Object.VersionID = event.Version
+	rec.S3.Object.Sequencer = fmt.Sprintf("%016X", now.UnixNano())
+	return rec
+}
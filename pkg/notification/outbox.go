@@ -0,0 +1,220 @@
+package notification
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jakthom/s3c/pkg/config"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// maxRetryInterval is the longest a failed notification waits to be
+	// retried
+	maxRetryInterval = time.Hour
+	// deliveryTimeout is how long a target has to accept a notification
+	deliveryTimeout = 10 * time.Second
+)
+
+// message is a notification waiting in the outbox to be delivered
+type message struct {
+	Target      string          `json:"target"`
+	Body        json.RawMessage `json:"body"`
+	Attempts    int             `json:"attempts"`
+	NextAttempt time.Time       `json:"nextAttempt"`
+}
+
+// Outbox durably queues notifications as json files within a directory
+// until they are delivered to their webhook target, retrying failed
+// deliveries with an exponential backoff. Notifications that are never
+// delivered are moved to a `failed` directory. Pending notifications
+// survive restarts.
+type Outbox struct {
+	dir           string
+	failedDir     string
+	targets       map[string]config.NotificationTarget
+	maxAttempts   int
+	retryInterval time.Duration
+	client        *http.Client
+	// wake signals the outbox that a notification was queued
+	wake chan struct{}
+}
+
+// NewOutbox creates the outbox of the notifications to the configured
+// targets, within the notifications directory
+func NewOutbox(conf config.Notifications) (*Outbox, error) {
+	o := &Outbox{
+		dir:           filepath.Join(conf.Directory, "outbox"),
+		failedDir:     filepath.Join(conf.Directory, "failed"),
+		targets:       conf.Targets,
+		maxAttempts:   conf.MaxAttempts,
+		retryInterval: conf.RetryInterval,
+		client:        &http.Client{Timeout: deliveryTimeout},
+		wake:          make(chan struct{}, 1),
+	}
+	for _, dir := range []string{o.dir, o.failedDir} {
+		if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+			return nil, err
+		}
+	}
+	return o, nil
+}
+
+// Enqueue durably queues a notification to a target
+func (o *Outbox) Enqueue(target string, body []byte) error {
+	document, err := json.Marshal(message{Target: target, Body: body})
+	if err != nil {
+		return err
+	}
+	// Names sort in the order notifications were queued
+	name := fmt.Sprintf("%020d-%s.json", time.Now().UnixNano(), uuid.New().String())
+	if err := writeFileAtomic(filepath.Join(o.dir, name), document); err != nil {
+		return err
+	}
+	select {
+	case o.wake <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// Run delivers queued notifications until the context is cancelled
+func (o *Outbox) Run(ctx context.Context) {
+	for {
+		next := o.deliver(ctx, time.Now())
+		var timer *time.Timer
+		var retry <-chan time.Time
+		if !next.IsZero() {
+			timer = time.NewTimer(time.Until(next))
+			retry = timer.C
+		}
+		select {
+		case <-ctx.Done():
+		case <-o.wake:
+		case <-retry:
+		}
+		if timer != nil {
+			timer.Stop()
+		}
+		if ctx.Err() != nil {
+			return
+		}
+	}
+}
+
+// deliver delivers the notifications that are due in the order they were
+// queued, returning when the next one that failed is due to be retried, or
+// the zero time if none is
+func (o *Outbox) deliver(ctx context.Context, now time.Time) time.Time {
+	entries, err := os.ReadDir(o.dir)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to read notification outbox: " + o.dir)
+		return now.Add(o.retryInterval)
+	}
+	var next time.Time
+	for _, entry := range entries {
+		if ctx.Err() != nil {
+			return next
+		}
+		if entry.IsDir() || filepath.Ext(entry.Name()) != ".json" {
+			continue
+		}
+		path := filepath.Join(o.dir, entry.Name())
+		content, err := os.ReadFile(path)
+		if err != nil {
+			log.Error().Err(err).Msg("Failed to read notification: " + path)
+			continue
+		}
+		m := &message{}
+		if err := json.Unmarshal(content, m); err != nil {
+			log.Error().Err(err).Msg("Ignoring invalid notification: " + path)
+			o.fail(path, entry.Name())
+			continue
+		}
+		if m.NextAttempt.After(now) {
+			if next.IsZero() || m.NextAttempt.Before(next) {
+				next = m.NextAttempt
+			}
+			continue
+		}
+		err = o.send(ctx, m)
+		if err == nil {
+			if err := os.Remove(path); err != nil {
+				log.Error().Err(err).Msg("Failed to remove delivered notification: " + path)
+			}
+			continue
+		}
+		m.Attempts++
+		if m.Attempts >= o.maxAttempts {
+			log.Error().Err(err).Msg("Giving up on notification to " + m.Target + " after " + strconv.Itoa(m.Attempts) + " attempts: " + entry.Name())
+			o.fail(path, entry.Name())
+			continue
+		}
+		log.Warn().Err(err).Msg("Failed to deliver notification to " + m.Target + ", retrying: " + entry.Name())
+		m.NextAttempt = now.Add(o.backoff(m.Attempts))
+		document, err := json.Marshal(m)
+		if err == nil {
+			err = writeFileAtomic(path, document)
+		}
+		if err != nil {
+			log.Error().Err(err).Msg("Failed to reschedule notification: " + path)
+		}
+		if next.IsZero() || m.NextAttempt.Before(next) {
+			next = m.NextAttempt
+		}
+	}
+	return next
+}
+
+// backoff returns how long a notification that failed a number of times
+// waits to be retried
+func (o *Outbox) backoff(attempts int) time.Duration {
+	interval := o.retryInterval
+	for i := 1; i < attempts && interval < maxRetryInterval; i++ {
+		interval *= 2
+	}
+	return min(interval, maxRetryInterval)
+}
+
+// send POSTs a notification to its target, which must accept it with a 2xx
+// status
+func (o *Outbox) send(ctx context.Context, m *message) error {
+	target, ok := o.targets[m.Target]
+	if !ok {
+		return errors.New("unknown notification target: " + m.Target)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, target.Endpoint, bytes.NewReader(m.Body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if target.AuthToken != "" {
+		req.Header.Set("Authorization", "Bearer "+target.AuthToken)
+	}
+	resp, err := o.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return errors.New("notification target responded " + strings.TrimSpace(resp.Status))
+	}
+	return nil
+}
+
+// fail moves a notification that cannot be delivered out of the outbox
+func (o *Outbox) fail(path, name string) {
+	if err := os.Rename(path, filepath.Join(o.failedDir, name)); err != nil {
+		log.Error().Err(err).Msg("Failed to move undelivered notification: " + path)
+	}
+}
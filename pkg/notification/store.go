@@ -0,0 +1,148 @@
+package notification
+
+import (
+	"encoding/xml"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	s3bucket "github.com/jakthom/s3c/pkg/s3/bucket"
+	s3error "github.com/jakthom/s3c/pkg/s3/error"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// arnPrefix and arnSuffix surround the name of a target in the ARN that
+	// queue configurations refer to it by
+	arnPrefix = "arn:s3c:sqs::"
+	arnSuffix = ":webhook"
+)
+
+// targetName returns the name of the target of an ARN
+func targetName(arn string) (string, bool) {
+	if !strings.HasPrefix(arn, arnPrefix) || !strings.HasSuffix(arn, arnSuffix) {
+		return "", false
+	}
+	return strings.TrimSuffix(strings.TrimPrefix(arn, arnPrefix), arnSuffix), true
+}
+
+// Store persists the notification configurations of buckets as xml files
+// within a directory. They are kept in memory, as every event of an object is
+// checked against them.
+type Store struct {
+	dir     string
+	targets map[string]bool
+	mu      sync.RWMutex
+	configs map[string]*s3bucket.NotificationConfiguration
+}
+
+// NewStore creates a store of the bucket notification configurations in a
+// directory, which may notify the given targets
+func NewStore(dir string, targets []string) (*Store, error) {
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return nil, err
+	}
+	s := &Store{
+		dir:     dir,
+		targets: map[string]bool{},
+		configs: map[string]*s3bucket.NotificationConfiguration{},
+	}
+	for _, target := range targets {
+		s.targets[target] = true
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range entries {
+		if entry.IsDir() || filepath.Ext(entry.Name()) != ".xml" {
+			continue
+		}
+		bucket := strings.TrimSuffix(entry.Name(), ".xml")
+		content, err := os.ReadFile(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+		config := &s3bucket.NotificationConfiguration{}
+		if err := xml.Unmarshal(content, config); err != nil {
+			log.Error().Err(err).Msg("Ignoring invalid bucket notification configuration: " + bucket)
+			continue
+		}
+		s.configs[bucket] = config
+	}
+	return s, nil
+}
+
+func (s *Store) path(bucket string) string {
+	return filepath.Join(s.dir, bucket+".xml")
+}
+
+// configuration returns the notification configuration of a bucket, or nil
+// if it has none
+func (s *Store) configuration(bucket string) *s3bucket.NotificationConfiguration {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.configs[bucket]
+}
+
+func (s *Store) GetBucketNotification(r *http.Request, bucket string) (*s3bucket.NotificationConfiguration, error) {
+	if config := s.configuration(bucket); config != nil {
+		return config, nil
+	}
+	return &s3bucket.NotificationConfiguration{}, nil
+}
+
+func (s *Store) PutBucketNotification(r *http.Request, bucket string, config *s3bucket.NotificationConfiguration) error {
+	if len(config.QueueConfigurations) == 0 {
+		return s.DeleteBucketNotification(r, bucket)
+	}
+	for _, queue := range config.QueueConfigurations {
+		if target, ok := targetName(queue.Queue); !ok || !s.targets[target] {
+			return s3error.InvalidRequestError(r, "Unable to validate the following destination configurations: "+queue.Queue)
+		}
+	}
+	document, err := xml.Marshal(config)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := writeFileAtomic(s.path(bucket), document); err != nil {
+		log.Error().Err(err).Msg("Failed to write bucket notification configuration: " + bucket)
+		return err
+	}
+	s.configs[bucket] = config
+	return nil
+}
+
+func (s *Store) DeleteBucketNotification(r *http.Request, bucket string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := os.Remove(s.path(bucket)); err != nil && !os.IsNotExist(err) {
+		log.Error().Err(err).Msg("Failed to delete bucket notification configuration: " + bucket)
+		return err
+	}
+	delete(s.configs, bucket)
+	return nil
+}
+
+// writeFileAtomic writes a file by renaming a temporary file in its
+// directory into place, so that it is never partially written
+func writeFileAtomic(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".tmp-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,72 @@
+package fileorigin
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+)
+
+// BUCKETS_DIRECTORY is where bucket configuration is stored, relative to the
+// system directory
+const BUCKETS_DIRECTORY string = "buckets"
+
+// bucketConfig is the configuration of a bucket
+type bucketConfig struct {
+	// Versioning is the versioning status of the bucket
+	Versioning string `json:"versioning,omitempty"`
+	// Tags are the tags of the bucket
+	Tags map[string]string `json:"tags,omitempty"`
+}
+
+// bucketConfigStore persists the configuration of each bucket as a json file
+// beneath the system directory
+type bucketConfigStore struct {
+	dir    string
+	tmpDir string
+}
+
+func newBucketConfigStore(dataDir string) bucketConfigStore {
+	return bucketConfigStore{
+		dir:    filepath.Join(dataDir, SYSTEM_DIRECTORY, BUCKETS_DIRECTORY),
+		tmpDir: filepath.Join(dataDir, SYSTEM_DIRECTORY, TMP_DIRECTORY),
+	}
+}
+
+func (s bucketConfigStore) path(bucket string) string {
+	return filepath.Join(s.dir, bucket+".json")
+}
+
+// get returns the configuration of a bucket. Buckets that have never been
+// configured have an empty configuration.
+func (s bucketConfigStore) get(bucket string) (*bucketConfig, error) {
+	conf := &bucketConfig{}
+	payload, err := os.ReadFile(s.path(bucket))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return conf, nil
+		}
+		return nil, err
+	}
+	if err := json.Unmarshal(payload, conf); err != nil {
+		return nil, err
+	}
+	return conf, nil
+}
+
+// put atomically replaces the configuration of a bucket
+func (s bucketConfigStore) put(bucket string, conf *bucketConfig) error {
+	payload, err := json.Marshal(conf)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(s.tmpDir, s.path(bucket), payload)
+}
+
+// delete removes the configuration of a bucket
+func (s bucketConfigStore) delete(bucket string) error {
+	err := os.Remove(s.path(bucket))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
@@ -1,36 +1,86 @@
 package fileorigin
 
 import (
+	"crypto/md5"
+	"encoding/hex"
 	"io"
 	"net/http"
 	"os"
 	"path/filepath"
+	"sort"
+	"strings"
 
 	s3bucket "github.com/jakthom/s3c/pkg/s3/bucket"
+	s3error "github.com/jakthom/s3c/pkg/s3/error"
+	s3multipart "github.com/jakthom/s3c/pkg/s3/multipart"
 	s3object "github.com/jakthom/s3c/pkg/s3/object"
 	s3service "github.com/jakthom/s3c/pkg/s3/service"
+	s3util "github.com/jakthom/s3c/pkg/s3/util"
 	"github.com/rs/zerolog/log"
 )
 
+const ORIGIN_TYPE string = "fs"
+
+// FileOrigin is an origin backed by a directory on the local filesystem.
+// Each bucket is a top-level directory and each object is a file within it.
 type FileOrigin struct {
-	ServiceController *FileOriginServiceController
-	BucketController  *FileOriginBucketController
-	ObjectController  *FileOriginObjectController
+	serviceController   *FileOriginServiceController
+	bucketController    *FileOriginBucketController
+	objectController    *FileOriginObjectController
+	multipartController *FileOriginMultipartController
 }
 
-func NewOrigin(dataDirectory string) *FileOrigin {
-	os.Mkdir(dataDirectory, 0755)
+func NewOrigin(dataDirectory string) (*FileOrigin, error) {
+	if err := os.MkdirAll(dataDirectory, 0755); err != nil {
+		log.Error().Err(err).Msg("Failed to create data directory: " + dataDirectory)
+		return nil, err
+	}
+	metadata := newMetadataStore(dataDirectory)
+	buckets := newBucketConfigStore(dataDirectory)
+	versions := newVersionStore(dataDirectory, metadata, buckets)
+	tmpDir := filepath.Join(dataDirectory, SYSTEM_DIRECTORY, TMP_DIRECTORY)
 	return &FileOrigin{
-		ServiceController: &FileOriginServiceController{
+		serviceController: &FileOriginServiceController{
 			dataDir: dataDirectory,
 		},
-		BucketController: &FileOriginBucketController{
-			dataDir: dataDirectory,
+		bucketController: &FileOriginBucketController{
+			dataDir:  dataDirectory,
+			metadata: metadata,
+			buckets:  buckets,
+			versions: versions,
 		},
-		ObjectController: &FileOriginObjectController{
-			dataDir: dataDirectory,
+		objectController: &FileOriginObjectController{
+			dataDir:  dataDirectory,
+			tmpDir:   tmpDir,
+			versions: versions,
 		},
-	}
+		multipartController: &FileOriginMultipartController{
+			dataDir:   dataDirectory,
+			uploadDir: filepath.Join(dataDirectory, SYSTEM_DIRECTORY, MULTIPART_DIRECTORY),
+			tmpDir:    tmpDir,
+			versions:  versions,
+		},
+	}, nil
+}
+
+func (o *FileOrigin) Type() string {
+	return ORIGIN_TYPE
+}
+
+func (o *FileOrigin) ServiceController() s3service.ServiceController {
+	return o.serviceController
+}
+
+func (o *FileOrigin) BucketController() s3bucket.BucketController {
+	return o.bucketController
+}
+
+func (o *FileOrigin) ObjectController() s3object.ObjectController {
+	return o.objectController
+}
+
+func (o *FileOrigin) MultipartController() s3multipart.MultipartController {
+	return o.multipartController
 }
 
 type FileOriginServiceController struct {
@@ -47,7 +97,7 @@ func (c *FileOriginServiceController) ListBuckets(*http.Request) (*s3service.Lis
 	var buckets []*s3bucket.Bucket
 
 	for _, file := range files {
-		if file.IsDir() {
+		if file.IsDir() && file.Name() != SYSTEM_DIRECTORY {
 			info, _ := file.Info()
 			bucket := s3bucket.Bucket{
 				Name:         file.Name(),
@@ -63,115 +113,515 @@ func (c *FileOriginServiceController) ListBuckets(*http.Request) (*s3service.Lis
 }
 
 type FileOriginBucketController struct {
-	dataDir string
+	dataDir  string
+	metadata metadataStore
+	buckets  bucketConfigStore
+	versions versionStore
 }
 
 func (c *FileOriginBucketController) GetLocation(r *http.Request, bucket string) (string, error) {
+	if _, err := requireBucket(r, c.dataDir, bucket); err != nil {
+		return "", err
+	}
 	return c.dataDir, nil
 }
 
 func (c *FileOriginBucketController) ListObjects(r *http.Request, bucket, prefix, marker, delimiter string, maxKeys int) (*s3bucket.ListObjectsResult, error) {
-	directory := filepath.Join(c.dataDir, bucket, prefix)
-	var objects []*s3object.Object
-	var commonPrefixes []*s3object.CommonPrefixes
-	result, err := os.ReadDir(directory)
+	page, err := c.list(r, bucket, prefix, marker, delimiter, maxKeys)
+	if err != nil {
+		return nil, err
+	}
+	objects, err := c.objects(bucket, page)
 	if err != nil {
-		log.Error().Err(err).Msg("Failed to list objects")
 		return nil, err
 	}
-	for _, file := range result {
-		info, _ := file.Info()
-		if info.IsDir() {
-			prefix := s3object.CommonPrefixes{
-				Prefix: file.Name() + "/", // Add trailing slash to indicate it's a directory
+	return &s3bucket.ListObjectsResult{
+		Contents:       objects,
+		CommonPrefixes: commonPrefixes(page),
+		IsTruncated:    page.isTruncated,
+	}, nil
+}
+
+func (c *FileOriginBucketController) ListObjectsV2(r *http.Request, bucket, prefix, continuationToken, startAfter, delimiter string, maxKeys int, fetchOwner bool) (*s3bucket.ListObjectsV2Result, error) {
+	after := startAfter
+	if continuationToken != "" {
+		key, err := decodeContinuationToken(continuationToken)
+		if err != nil {
+			return nil, s3error.InvalidArgumentError(r)
+		}
+		if key > after {
+			after = key
+		}
+	}
+	page, err := c.list(r, bucket, prefix, after, delimiter, maxKeys)
+	if err != nil {
+		return nil, err
+	}
+	objects, err := c.objects(bucket, page)
+	if err != nil {
+		return nil, err
+	}
+	result := s3bucket.ListObjectsV2Result{
+		Contents:       objects,
+		CommonPrefixes: commonPrefixes(page),
+		IsTruncated:    page.isTruncated,
+	}
+	if page.isTruncated {
+		result.NextContinuationToken = encodeContinuationToken(page.next)
+	}
+	return &result, nil
+}
+
+func (c *FileOriginBucketController) ListObjectVersions(r *http.Request, bucket, prefix, keyMarker, versionMarker string, delimiter string, maxKeys int) (*s3bucket.ListObjectVersionsResult, error) {
+	bucketDir, err := requireBucket(r, c.dataDir, bucket)
+	if err != nil {
+		return nil, err
+	}
+	var entries []listEntry
+	err = walkBucket(bucketDir, prefix, "", delimiter, func(entry listEntry) bool {
+		entries = append(entries, entry)
+		return true
+	})
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to list objects in bucket: " + bucket)
+		return nil, err
+	}
+	stored, err := c.versions.listBucket(bucket, prefix)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to list object versions in bucket: " + bucket)
+		return nil, err
+	}
+
+	// Merge the current and stored versions of each key
+	current := map[string]listEntry{}
+	var keys []string
+	for _, entry := range entries {
+		current[entry.key] = entry
+		keys = append(keys, entry.key)
+	}
+	for key := range stored {
+		if _, ok := current[key]; !ok {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	result := s3bucket.ListObjectVersionsResult{}
+	if maxKeys == 0 {
+		return &result, nil
+	}
+	count := 0
+	lastPrefix := ""
+	for _, key := range keys {
+		if key < keyMarker || (key == keyMarker && versionMarker == "") {
+			continue
+		}
+		if delimiter != "" {
+			if i := strings.Index(key[len(prefix):], delimiter); i >= 0 {
+				commonPrefix := key[:len(prefix)+i+len(delimiter)]
+				if commonPrefix <= keyMarker || commonPrefix == lastPrefix {
+					continue
+				}
+				if count == maxKeys {
+					result.IsTruncated = true
+					break
+				}
+				count++
+				lastPrefix = commonPrefix
+				result.CommonPrefixes = append(result.CommonPrefixes, &s3object.CommonPrefixes{Prefix: commonPrefix})
+				result.NextKeyMarker, result.NextVersionIDMarker = commonPrefix, ""
+				continue
 			}
-			commonPrefixes = append(commonPrefixes, &prefix)
-		} else {
-			object := s3object.Object{
-				Key:          file.Name(),
-				LastModified: info.ModTime(),
-				Size:         uint64(info.Size()),
+		}
+
+		// The current version of a key is its newest
+		versions := stored[key]
+		if entry, ok := current[key]; ok {
+			meta, err := c.versions.current(bucket, key)
+			if err != nil {
+				log.Error().Err(err).Msg("Failed to read metadata of: " + key)
+				return nil, err
 			}
-			objects = append(objects, &object)
+			versions = append([]*version{{
+				Key:      key,
+				ModTime:  entry.info.ModTime(),
+				Size:     entry.info.Size(),
+				Metadata: *meta,
+			}}, versions...)
+		}
+		skipping := key == keyMarker
+		for i, v := range versions {
+			if skipping {
+				skipping = v.id() != versionMarker
+				continue
+			}
+			if count == maxKeys {
+				result.IsTruncated = true
+				break
+			}
+			count++
+			if v.DeleteMarker {
+				result.DeleteMarkers = append(result.DeleteMarkers, &s3object.DeleteMarker{
+					Key:          key,
+					Version:      v.id(),
+					IsLatest:     i == 0,
+					LastModified: v.ModTime,
+				})
+			} else {
+				result.Versions = append(result.Versions, &s3bucket.Version{
+					Key:          key,
+					Version:      v.id(),
+					IsLatest:     i == 0,
+					LastModified: v.ModTime,
+					ETag:         v.Metadata.ETag,
+					Size:         uint64(v.Size),
+					StorageClass: "STANDARD",
+				})
+			}
+			result.NextKeyMarker, result.NextVersionIDMarker = key, v.id()
+		}
+		if result.IsTruncated {
+			break
 		}
 	}
-	listObjectsResult := s3bucket.ListObjectsResult{}
-	if objects != nil {
-		listObjectsResult.Contents = objects
+	return &result, nil
+}
+
+func (c *FileOriginBucketController) GetBucketVersioning(r *http.Request, bucket string) (string, error) {
+	if _, err := requireBucket(r, c.dataDir, bucket); err != nil {
+		return "", err
 	}
-	if commonPrefixes != nil {
-		listObjectsResult.CommonPrefixes = commonPrefixes
+	conf, err := c.buckets.get(bucket)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to read configuration of bucket: " + bucket)
+		return "", err
 	}
-	return &listObjectsResult, nil
+	return conf.Versioning, nil
 }
 
-func (c *FileOriginObjectController) CopyObject(r *http.Request, srcBucket, srcKey string, getResult *s3object.GetObjectResult, destBucket, destKey string) (string, error) {
-	sourcePath := filepath.Join(c.dataDir, srcBucket, srcKey)
-	destinationPath := filepath.Join(c.dataDir, destBucket, destKey)
-	err := copyFile(sourcePath, destinationPath)
+func (c *FileOriginBucketController) SetBucketVersioning(r *http.Request, bucket, status string) error {
+	if _, err := requireBucket(r, c.dataDir, bucket); err != nil {
+		return err
+	}
+	conf, err := c.buckets.get(bucket)
 	if err != nil {
-		log.Error().Err(err).Msg("Failed to copy object from path: " + sourcePath + " to path: " + destinationPath)
-		return "", err
+		log.Error().Err(err).Msg("Failed to read configuration of bucket: " + bucket)
+		return err
+	}
+	// Once enabled, versioning can only be suspended
+	if status == s3bucket.VersioningDisabled && conf.Versioning != s3bucket.VersioningDisabled {
+		return s3error.IllegalVersioningConfigurationError(r)
+	}
+	conf.Versioning = status
+	if err := c.buckets.put(bucket, conf); err != nil {
+		log.Error().Err(err).Msg("Failed to write configuration of bucket: " + bucket)
+		return err
+	}
+	log.Info().Msg("Set versioning of bucket " + bucket + " to: " + status)
+	return nil
+}
+
+func (c *FileOriginBucketController) GetBucketTagging(r *http.Request, bucket string) (map[string]string, error) {
+	if _, err := requireBucket(r, c.dataDir, bucket); err != nil {
+		return nil, err
+	}
+	conf, err := c.buckets.get(bucket)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to read configuration of bucket: " + bucket)
+		return nil, err
+	}
+	if len(conf.Tags) == 0 {
+		return nil, s3error.NoSuchTagSetError(r)
+	}
+	return conf.Tags, nil
+}
+
+func (c *FileOriginBucketController) PutBucketTagging(r *http.Request, bucket string, tags map[string]string) error {
+	if _, err := requireBucket(r, c.dataDir, bucket); err != nil {
+		return err
+	}
+	conf, err := c.buckets.get(bucket)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to read configuration of bucket: " + bucket)
+		return err
+	}
+	conf.Tags = tags
+	if err := c.buckets.put(bucket, conf); err != nil {
+		log.Error().Err(err).Msg("Failed to write configuration of bucket: " + bucket)
+		return err
+	}
+	return nil
+}
+
+// list returns the page of a bucket listing that starts after the key `after`
+func (c *FileOriginBucketController) list(r *http.Request, bucket, prefix, after, delimiter string, maxKeys int) (listPage, error) {
+	bucketDir, err := requireBucket(r, c.dataDir, bucket)
+	if err != nil {
+		return listPage{}, err
+	}
+	p := paginator{
+		prefix:    prefix,
+		after:     after,
+		delimiter: delimiter,
+		maxKeys:   maxKeys,
+	}
+	if err := walkBucket(bucketDir, prefix, after, delimiter, p.add); err != nil {
+		log.Error().Err(err).Msg("Failed to list objects in bucket: " + bucket)
+		return listPage{}, err
+	}
+	return p.page, nil
+}
+
+// objects builds the objects on a page of a bucket listing
+func (c *FileOriginBucketController) objects(bucket string, page listPage) ([]*s3object.Object, error) {
+	var objects []*s3object.Object
+	for _, entry := range page.objects {
+		meta, err := c.versions.current(bucket, entry.key)
+		if err != nil {
+			log.Error().Err(err).Msg("Failed to read metadata of: " + entry.key)
+			return nil, err
+		}
+		objects = append(objects, &s3object.Object{
+			Key:          entry.key,
+			LastModified: entry.info.ModTime(),
+			ETag:         meta.ETag,
+			Size:         uint64(entry.info.Size()),
+			StorageClass: "STANDARD",
+		})
+	}
+	return objects, nil
+}
+
+// commonPrefixes builds the common prefixes on a page of a bucket listing
+func commonPrefixes(page listPage) []*s3object.CommonPrefixes {
+	var prefixes []*s3object.CommonPrefixes
+	for _, prefix := range page.commonPrefixes {
+		prefixes = append(prefixes, &s3object.CommonPrefixes{Prefix: prefix})
+	}
+	return prefixes
+}
+
+func (c *FileOriginObjectController) CopyObject(r *http.Request, srcBucket, srcKey string, getResult *s3object.GetObjectResult, destBucket, destKey string) (*s3object.PutObjectResult, error) {
+	if _, err := objectPath(r, c.dataDir, destBucket, destKey); err != nil {
+		return nil, err
+	}
+	if _, err := requireBucket(r, c.dataDir, destBucket); err != nil {
+		return nil, err
 	}
-	return destinationPath, nil
+	// The source may be a noncurrent version, so its contents are copied
+	// rather than the file at its path
+	result, err := c.put(r, destBucket, destKey, getResult.Content, getResult.Metadata, nil)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to copy object from: " + srcKey + " to: " + destKey)
+		return nil, err
+	}
+	return result, nil
 }
 
 func (c *FileOriginBucketController) CreateBucket(r *http.Request, bucket string) error {
-	bucketDir := filepath.Join(c.dataDir, bucket)
-	err := os.Mkdir(bucketDir, 0755)
-	return err
+	bucketDir, err := bucketPath(r, c.dataDir, bucket)
+	if err != nil {
+		return err
+	}
+	return os.Mkdir(bucketDir, 0755)
 }
 
 func (c *FileOriginBucketController) DeleteBucket(r *http.Request, bucket string) error {
-	bucketDir := filepath.Join(c.dataDir, bucket)
-	err := os.RemoveAll(bucketDir)
-	return err
+	bucketDir, err := requireBucket(r, c.dataDir, bucket)
+	if err != nil {
+		return err
+	}
+	// Only empty buckets are deleted, and their system state only once they
+	// are confirmed to be
+	holdsObjects, err := hasObjects(bucketDir)
+	if err != nil {
+		return err
+	}
+	holdsVersions, err := c.versions.hasVersions(bucket)
+	if err != nil {
+		return err
+	}
+	if holdsObjects || holdsVersions {
+		return s3error.BucketNotEmptyError(r)
+	}
+	if err := os.RemoveAll(bucketDir); err != nil {
+		return err
+	}
+	if err := c.versions.deleteBucket(bucket); err != nil {
+		return err
+	}
+	if err := c.buckets.delete(bucket); err != nil {
+		return err
+	}
+	return c.metadata.deleteBucket(bucket)
 }
 
 type FileOriginObjectController struct {
-	dataDir string
+	dataDir  string
+	tmpDir   string
+	versions versionStore
 }
 
 func (c *FileOriginObjectController) GetObject(r *http.Request, bucket, key, version string) (*s3object.GetObjectResult, error) {
-	filePath := filepath.Join(c.dataDir, bucket, key)
+	filePath, err := objectPath(r, c.dataDir, bucket, key)
+	if err != nil {
+		return nil, err
+	}
 	log.Info().Msg("Getting object from path: " + filePath)
-	file, err := os.Open(filePath)
+	result, _, err := c.versions.open(r, bucket, key, version)
 	if err != nil {
 		log.Error().Err(err).Msg("Failed to get object from path: " + filePath)
 		return nil, err
 	}
-	info, _ := file.Stat()
-	getObjectResult := s3object.GetObjectResult{
-		ModTime: info.ModTime(),
-		Content: file,
+	return result, nil
+}
+
+func (c *FileOriginObjectController) GetObjectRange(r *http.Request, bucket, key, version string, rng s3object.ObjectRange) (*s3object.GetObjectRangeResult, error) {
+	filePath, err := objectPath(r, c.dataDir, bucket, key)
+	if err != nil {
+		return nil, err
+	}
+	log.Info().Msg("Getting object range from path: " + filePath)
+	result, partSizes, err := c.versions.open(r, bucket, key, version)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to get object from path: " + filePath)
+		return nil, err
+	}
+	return s3object.SliceObject(r, result, rng, partSizes)
+}
+
+func (c *FileOriginObjectController) HeadObject(r *http.Request, bucket, key, version string, partNumber int) (*s3object.HeadObjectResult, error) {
+	filePath, err := objectPath(r, c.dataDir, bucket, key)
+	if err != nil {
+		return nil, err
+	}
+	log.Info().Msg("Getting object metadata from path: " + filePath)
+	result, err := c.versions.stat(r, bucket, key, version, partNumber)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to get object metadata from path: " + filePath)
+		return nil, err
 	}
-	return &getObjectResult, nil
+	return result, nil
 }
 
 func (c *FileOriginObjectController) PutObject(r *http.Request, bucket, key string, reader io.Reader) (*s3object.PutObjectResult, error) {
-	filePath := filepath.Join(c.dataDir, bucket, key)
+	filePath, err := objectPath(r, c.dataDir, bucket, key)
+	if err != nil {
+		return nil, err
+	}
 	log.Info().Msg("Putting object to path: " + filePath)
-	file, err := os.Create(filePath)
+	// Committing an object creates its directories, so a missing bucket
+	// would be created with it
+	if _, err := requireBucket(r, c.dataDir, bucket); err != nil {
+		return nil, err
+	}
+	condition, err := s3util.WriteConditionFromRequest(r)
+	if err != nil {
+		return nil, err
+	}
+	// Conditions are checked before the upload is read, and again once it is
+	// committed
+	if err := c.versions.check(r, bucket, key, condition); err != nil {
+		return nil, err
+	}
+	result, err := c.put(r, bucket, key, reader, s3object.MetadataFromHeader(r.Header), condition)
 	if err != nil {
 		log.Error().Err(err).Msg("Failed to put object to path: " + filePath)
 		return nil, err
 	}
-	defer file.Close()
-	_, err = io.Copy(file, reader)
+	return result, nil
+}
+
+// put stages the contents of `reader` and commits them as the current
+// version of an object, along with its metadata, if `condition` holds
+func (c *FileOriginObjectController) put(r *http.Request, bucket, key string, reader io.Reader, metadata *s3object.Metadata, condition *s3util.WriteCondition) (*s3object.PutObjectResult, error) {
+	tmp, err := createTemp(c.tmpDir)
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(tmp.Name())
+	hash := md5.New()
+	_, err = io.Copy(io.MultiWriter(tmp, hash), reader)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return nil, err
+	}
+	// The staged file keeps its modification time when committed
+	info, err := os.Stat(tmp.Name())
+	if err != nil {
+		return nil, err
+	}
+	if checksum := s3util.PayloadChecksum(reader); checksum != nil {
+		metadata.Checksum = checksum
+	}
+	etag := hex.EncodeToString(hash.Sum(nil))
+	versionID, err := c.versions.commit(r, bucket, key, tmp.Name(), &objectMetadata{ETag: etag, Metadata: metadata}, condition)
+	if err != nil {
+		return nil, err
+	}
+	return &s3object.PutObjectResult{
+		ETag:     etag,
+		Version:  versionID,
+		ModTime:  info.ModTime(),
+		Metadata: metadata,
+	}, nil
+}
+
+func (c *FileOriginObjectController) GetObjectTagging(r *http.Request, bucket, key, version string) (*s3object.ObjectTaggingResult, error) {
+	filePath, err := objectPath(r, c.dataDir, bucket, key)
+	if err != nil {
+		return nil, err
+	}
+	log.Info().Msg("Getting object tags from path: " + filePath)
+	result, _, _, err := c.versions.locate(r, bucket, key, version)
 	if err != nil {
-		log.Error().Err(err).Msg("Failed to copy object to path: " + filePath)
+		log.Error().Err(err).Msg("Failed to get object tags from path: " + filePath)
 		return nil, err
 	}
-	return &s3object.PutObjectResult{}, nil
+	if result.DeleteMarker {
+		if version != "" {
+			return nil, s3error.MethodNotAllowedError(r)
+		}
+		return nil, s3error.NoSuchKeyError(r)
+	}
+	tagging := &s3object.ObjectTaggingResult{Version: result.Version}
+	if result.Metadata != nil {
+		tagging.Tags = result.Metadata.Tags
+	}
+	return tagging, nil
+}
+
+func (c *FileOriginObjectController) PutObjectTagging(r *http.Request, bucket, key, version string, tags map[string]string) (string, error) {
+	filePath, err := objectPath(r, c.dataDir, bucket, key)
+	if err != nil {
+		return "", err
+	}
+	log.Info().Msg("Putting object tags to path: " + filePath)
+	versionID, err := c.versions.tag(r, bucket, key, version, tags)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to put object tags to path: " + filePath)
+		return "", err
+	}
+	return versionID, nil
 }
 
 func (c *FileOriginObjectController) DeleteObject(r *http.Request, bucket, key, version string) (*s3object.DeleteObjectResult, error) {
-	filePath := filepath.Join(c.dataDir, bucket, key)
+	filePath, err := objectPath(r, c.dataDir, bucket, key)
+	if err != nil {
+		return nil, err
+	}
 	log.Info().Msg("Deleting object from path: " + filePath)
-	err := os.Remove(filePath)
+	var result *s3object.DeleteObjectResult
+	if version != "" {
+		result, err = c.versions.deleteVersion(r, bucket, key, version)
+	} else {
+		result, err = c.versions.deleteObject(bucket, key)
+	}
 	if err != nil {
 		log.Error().Err(err).Msg("Failed to delete object from path: " + filePath)
 		return nil, err
 	}
-	return &s3object.DeleteObjectResult{}, nil
+	return result, nil
 }
@@ -0,0 +1,160 @@
+package fileorigin
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	s3bucket "github.com/jakthom/s3c/pkg/s3/bucket"
+	s3error "github.com/jakthom/s3c/pkg/s3/error"
+)
+
+func newTestOrigin(t *testing.T, buckets ...string) (*FileOrigin, string) {
+	t.Helper()
+	dataDir := t.TempDir()
+	o, err := NewOrigin(dataDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, bucket := range buckets {
+		if err := o.BucketController().CreateBucket(testRequest(), bucket); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return o, dataDir
+}
+
+func testRequest() *http.Request {
+	return httptest.NewRequest(http.MethodGet, "/", nil)
+}
+
+// errorCode returns the s3 error code of an error, or its message if it is
+// not an s3 error
+func errorCode(err error) string {
+	if s3Err, ok := err.(*s3error.Error); ok {
+		return s3Err.Code
+	}
+	if err == nil {
+		return ""
+	}
+	return err.Error()
+}
+
+func putObject(t *testing.T, o *FileOrigin, bucket, key, content string) {
+	t.Helper()
+	if _, err := o.ObjectController().PutObject(testRequest(), bucket, key, strings.NewReader(content)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestWritesRequireBucket(t *testing.T) {
+	o, dataDir := newTestOrigin(t, "src")
+	putObject(t, o, "src", "key", "content")
+	objects := o.ObjectController()
+
+	_, err := objects.PutObject(testRequest(), "missing", "dir/key", strings.NewReader("content"))
+	if code := errorCode(err); code != "NoSuchBucket" {
+		t.Errorf("put to a missing bucket: got %q, want NoSuchBucket", code)
+	}
+
+	src, err := objects.GetObject(testRequest(), "src", "key", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer src.Close()
+	_, err = objects.CopyObject(testRequest(), "src", "key", src, "missing", "key")
+	if code := errorCode(err); code != "NoSuchBucket" {
+		t.Errorf("copy to a missing bucket: got %q, want NoSuchBucket", code)
+	}
+
+	// A bucket deleted while an upload is in progress is not recreated by
+	// completing the upload
+	multipart := o.MultipartController()
+	if err := o.BucketController().CreateBucket(testRequest(), "gone"); err != nil {
+		t.Fatal(err)
+	}
+	uploadID, err := multipart.InitMultipart(testRequest(), "gone", "key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := multipart.UploadMultipartChunk(testRequest(), "gone", "key", uploadID, 1, strings.NewReader("part")); err != nil {
+		t.Fatal(err)
+	}
+	if err := o.BucketController().DeleteBucket(testRequest(), "gone"); err != nil {
+		t.Fatal(err)
+	}
+	_, err = multipart.CompleteMultipart(testRequest(), "gone", "key", uploadID, nil)
+	if code := errorCode(err); code != "NoSuchBucket" {
+		t.Errorf("complete in a missing bucket: got %q, want NoSuchBucket", code)
+	}
+
+	for _, bucket := range []string{"missing", "gone"} {
+		if _, err := os.Stat(filepath.Join(dataDir, bucket)); !os.IsNotExist(err) {
+			t.Errorf("bucket %q was created by a write", bucket)
+		}
+	}
+}
+
+func TestDeleteBucketRequiresEmptyBucket(t *testing.T) {
+	o, dataDir := newTestOrigin(t, "bucket")
+	buckets := o.BucketController()
+	objects := o.ObjectController()
+
+	if err := buckets.DeleteBucket(testRequest(), "missing"); errorCode(err) != "NoSuchBucket" {
+		t.Errorf("delete of a missing bucket: got %q, want NoSuchBucket", errorCode(err))
+	}
+
+	if err := buckets.SetBucketVersioning(testRequest(), "bucket", s3bucket.VersioningEnabled); err != nil {
+		t.Fatal(err)
+	}
+	putObject(t, o, "bucket", "dir/key", "content")
+	if err := buckets.DeleteBucket(testRequest(), "bucket"); errorCode(err) != "BucketNotEmpty" {
+		t.Errorf("delete of a bucket with an object: got %q, want BucketNotEmpty", errorCode(err))
+	}
+
+	// Noncurrent versions and delete markers keep the bucket from being
+	// deleted, along with its versions
+	if _, err := objects.DeleteObject(testRequest(), "bucket", "dir/key", ""); err != nil {
+		t.Fatal(err)
+	}
+	if err := buckets.DeleteBucket(testRequest(), "bucket"); errorCode(err) != "BucketNotEmpty" {
+		t.Errorf("delete of a bucket with versions: got %q, want BucketNotEmpty", errorCode(err))
+	}
+	versions, err := buckets.ListObjectVersions(testRequest(), "bucket", "", "", "", "", 1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(versions.Versions) != 1 || len(versions.DeleteMarkers) != 1 {
+		t.Fatalf("got %d versions and %d delete markers, want 1 of each", len(versions.Versions), len(versions.DeleteMarkers))
+	}
+	if _, err := objects.DeleteObject(testRequest(), "bucket", "dir/key", versions.Versions[0].Version); err != nil {
+		t.Fatal(err)
+	}
+	if err := buckets.DeleteBucket(testRequest(), "bucket"); errorCode(err) != "BucketNotEmpty" {
+		t.Errorf("delete of a bucket with a delete marker: got %q, want BucketNotEmpty", errorCode(err))
+	}
+	if _, err := objects.DeleteObject(testRequest(), "bucket", "dir/key", versions.DeleteMarkers[0].Version); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := buckets.DeleteBucket(testRequest(), "bucket"); err != nil {
+		t.Fatalf("delete of an empty bucket: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dataDir, "bucket")); !os.IsNotExist(err) {
+		t.Error("bucket directory remains after the bucket is deleted")
+	}
+	// A new bucket of the same name starts without the old configuration
+	if err := buckets.CreateBucket(testRequest(), "bucket"); err != nil {
+		t.Fatal(err)
+	}
+	status, err := buckets.GetBucketVersioning(testRequest(), "bucket")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status != s3bucket.VersioningDisabled {
+		t.Errorf("recreated bucket has versioning %q", status)
+	}
+}
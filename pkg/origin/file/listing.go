@@ -0,0 +1,201 @@
+package fileorigin
+
+import (
+	"encoding/base64"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// listEntry is an object found while walking a bucket
+type listEntry struct {
+	key  string
+	info fs.FileInfo
+}
+
+// listPage is a page of a bucket listing
+type listPage struct {
+	// objects are the objects on the page
+	objects []listEntry
+	// commonPrefixes are the common prefixes on the page
+	commonPrefixes []string
+	// isTruncated specifies whether the listing continues past this page
+	isTruncated bool
+	// next is the last key or common prefix on the page, from which the
+	// listing continues
+	next string
+}
+
+// walkBucket visits the objects in a bucket with the given prefix that sort
+// after the key `after`, in key order, until `visit` returns false. If a
+// delimiter is given, a directory whose keys all share a common prefix is
+// visited once, as an entry without info keyed by the directory, and only if
+// it holds any object.
+func walkBucket(bucketDir, prefix, after, delimiter string, visit func(listEntry) bool) error {
+	// Only walk the deepest directory that can contain the prefix
+	dir := ""
+	if i := strings.LastIndex(prefix, "/"); i >= 0 {
+		dir = prefix[:i+1]
+	}
+	_, err := walkDir(bucketDir, dir, prefix, after, delimiter, visit)
+	return err
+}
+
+// walkDir visits the objects in the directory of a bucket with keys starting
+// with `dir`, returning false once `visit` does
+func walkDir(bucketDir, dir, prefix, after, delimiter string, visit func(listEntry) bool) (bool, error) {
+	path := filepath.Join(bucketDir, filepath.FromSlash(dir))
+	dirEntries, err := os.ReadDir(path)
+	if err != nil {
+		if dir != "" && os.IsNotExist(err) {
+			return true, nil
+		}
+		return false, err
+	}
+	// The keys of a directory's objects all start with its name and a slash,
+	// so sorting directories by that visits keys in order
+	keys := make([]string, len(dirEntries))
+	for i, d := range dirEntries {
+		keys[i] = dir + d.Name()
+		if d.IsDir() {
+			keys[i] += "/"
+		}
+	}
+	sort.Sort(byKey{keys, dirEntries})
+
+	for i, d := range dirEntries {
+		key := keys[i]
+		if !d.IsDir() {
+			if key <= after || !strings.HasPrefix(key, prefix) {
+				continue
+			}
+			info, err := d.Info()
+			if err != nil {
+				return false, err
+			}
+			if !visit(listEntry{key: key, info: info}) {
+				return false, nil
+			}
+			continue
+		}
+		if !strings.HasPrefix(key, prefix) && !strings.HasPrefix(prefix, key) {
+			continue
+		}
+		// Skip directories whose keys all sort before `after`
+		if key < after && !strings.HasPrefix(after, key) {
+			continue
+		}
+		if delimiter != "" && strings.HasPrefix(key, prefix) && strings.Contains(key[len(prefix):], delimiter) {
+			// The directory is within a common prefix, so its objects need
+			// not be listed
+			found, err := hasObjects(filepath.Join(path, d.Name()))
+			if err != nil {
+				return false, err
+			}
+			if found && !visit(listEntry{key: key}) {
+				return false, nil
+			}
+			continue
+		}
+		more, err := walkDir(bucketDir, key, prefix, after, delimiter, visit)
+		if err != nil || !more {
+			return more, err
+		}
+	}
+	return true, nil
+}
+
+// byKey sorts the entries of a directory by their keys
+type byKey struct {
+	keys    []string
+	entries []fs.DirEntry
+}
+
+func (b byKey) Len() int           { return len(b.keys) }
+func (b byKey) Less(i, j int) bool { return b.keys[i] < b.keys[j] }
+func (b byKey) Swap(i, j int) {
+	b.keys[i], b.keys[j] = b.keys[j], b.keys[i]
+	b.entries[i], b.entries[j] = b.entries[j], b.entries[i]
+}
+
+// hasObjects returns whether a directory holds any object
+func hasObjects(dir string) (bool, error) {
+	found := false
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() {
+			found = true
+			return filepath.SkipAll
+		}
+		return nil
+	})
+	return found, err
+}
+
+// paginator collects the page of a sorted listing that starts after the key
+// `after`. Keys sharing a prefix up to `delimiter` are grouped into common
+// prefixes, each of which counts as a single key towards `maxKeys`.
+type paginator struct {
+	prefix    string
+	after     string
+	delimiter string
+	maxKeys   int
+	count     int
+	page      listPage
+}
+
+// add adds the next entry of the listing to the page, returning false once
+// the page is complete
+func (p *paginator) add(entry listEntry) bool {
+	if p.maxKeys == 0 {
+		return false
+	}
+	if entry.key <= p.after {
+		return true
+	}
+	commonPrefix := ""
+	if p.delimiter != "" {
+		if i := strings.Index(entry.key[len(p.prefix):], p.delimiter); i >= 0 {
+			commonPrefix = entry.key[:len(p.prefix)+i+len(p.delimiter)]
+		}
+	}
+	if commonPrefix != "" {
+		// Keys within an already listed common prefix are skipped
+		if commonPrefix <= p.after || commonPrefix == p.page.next {
+			return true
+		}
+	}
+	if p.count == p.maxKeys {
+		p.page.isTruncated = true
+		return false
+	}
+	p.count++
+	if commonPrefix != "" {
+		p.page.commonPrefixes = append(p.page.commonPrefixes, commonPrefix)
+		p.page.next = commonPrefix
+	} else {
+		p.page.objects = append(p.page.objects, entry)
+		p.page.next = entry.key
+	}
+	return true
+}
+
+// encodeContinuationToken creates an opaque continuation token from the
+// key a listing continues after
+func encodeContinuationToken(key string) string {
+	return base64.URLEncoding.EncodeToString([]byte(key))
+}
+
+// decodeContinuationToken returns the key a continuation token continues
+// after
+func decodeContinuationToken(token string) (string, error) {
+	key, err := base64.URLEncoding.DecodeString(token)
+	if err != nil {
+		return "", err
+	}
+	return string(key), nil
+}
@@ -0,0 +1,138 @@
+package fileorigin
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+var listingKeys = []string{
+	"a",
+	"a-b",
+	"a0",
+	"b/1",
+	"b/2/x",
+	"b/2/y",
+	"b/3-1",
+	"b/3-2",
+	"b-c/d",
+	"c/d/e/f",
+	"c/d/g",
+}
+
+func newListingBucket(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	for _, key := range listingKeys {
+		path := filepath.Join(dir, filepath.FromSlash(key))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(key), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Directories without objects are not listed
+	if err := os.MkdirAll(filepath.Join(dir, "empty", "dir"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+// expectedListing lists the keys and common prefixes of `listingKeys` with
+// a prefix and delimiter, in order
+func expectedListing(prefix, delimiter string) []string {
+	keys := append([]string(nil), listingKeys...)
+	sort.Strings(keys)
+	var listed []string
+	for _, key := range keys {
+		if !strings.HasPrefix(key, prefix) {
+			continue
+		}
+		if delimiter != "" {
+			if i := strings.Index(key[len(prefix):], delimiter); i >= 0 {
+				key = key[:len(prefix)+i+len(delimiter)]
+			}
+		}
+		if len(listed) == 0 || listed[len(listed)-1] != key {
+			listed = append(listed, key)
+		}
+	}
+	return listed
+}
+
+func TestListingPages(t *testing.T) {
+	bucketDir := newListingBucket(t)
+	for _, prefix := range []string{"", "a", "b/", "b/2", "b/3", "c/d/", "missing/"} {
+		for _, delimiter := range []string{"", "/", "-"} {
+			for _, maxKeys := range []int{1, 2, 3, 1000} {
+				var listed []string
+				after := ""
+				for pages := 0; ; pages++ {
+					if pages > len(listingKeys) {
+						t.Fatalf("prefix %q delimiter %q max %d: listing does not end", prefix, delimiter, maxKeys)
+					}
+					p := paginator{prefix: prefix, after: after, delimiter: delimiter, maxKeys: maxKeys}
+					if err := walkBucket(bucketDir, prefix, after, delimiter, p.add); err != nil {
+						t.Fatal(err)
+					}
+					if n := len(p.page.objects) + len(p.page.commonPrefixes); n > maxKeys {
+						t.Fatalf("prefix %q delimiter %q max %d: page of %d keys", prefix, delimiter, maxKeys, n)
+					}
+					var page []string
+					for _, entry := range p.page.objects {
+						page = append(page, entry.key)
+					}
+					page = append(page, p.page.commonPrefixes...)
+					sort.Strings(page)
+					listed = append(listed, page...)
+					if !p.page.isTruncated {
+						break
+					}
+					after = p.page.next
+				}
+				if want := expectedListing(prefix, delimiter); !reflect.DeepEqual(listed, want) {
+					t.Errorf("prefix %q delimiter %q max %d: listed %q, want %q", prefix, delimiter, maxKeys, listed, want)
+				}
+			}
+		}
+	}
+}
+
+func TestWalkBucketStopsAtFullPage(t *testing.T) {
+	bucketDir := newListingBucket(t)
+	visited := 0
+	p := paginator{maxKeys: 2}
+	err := walkBucket(bucketDir, "", "", "", func(entry listEntry) bool {
+		visited++
+		return p.add(entry)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if visited != 3 {
+		t.Errorf("visited %d objects for a page of 2, want 3", visited)
+	}
+	if !p.page.isTruncated || p.page.next != "a-b" {
+		t.Errorf("page truncated %v after %q, want truncated after %q", p.page.isTruncated, p.page.next, "a-b")
+	}
+}
+
+func TestWalkBucketSkipsCommonPrefixes(t *testing.T) {
+	bucketDir := newListingBucket(t)
+	var visited []string
+	err := walkBucket(bucketDir, "", "", "/", func(entry listEntry) bool {
+		visited = append(visited, entry.key)
+		return true
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"a", "a-b", "a0", "b-c/", "b/", "c/"}
+	if !reflect.DeepEqual(visited, want) {
+		t.Errorf("visited %q, want %q", visited, want)
+	}
+}
@@ -0,0 +1,93 @@
+package fileorigin
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+
+	s3object "github.com/jakthom/s3c/pkg/s3/object"
+)
+
+const (
+	// SYSTEM_DIRECTORY is the directory within the data directory where
+	// s3c stores its own state. It is never listed as a bucket.
+	SYSTEM_DIRECTORY string = ".s3c"
+	// METADATA_DIRECTORY is where object metadata sidecars are stored,
+	// relative to the system directory
+	METADATA_DIRECTORY string = "metadata"
+	// TMP_DIRECTORY is where files are staged before being atomically moved
+	// into place, relative to the system directory
+	TMP_DIRECTORY string = "tmp"
+)
+
+// objectMetadata is persisted in a sidecar file alongside each object
+type objectMetadata struct {
+	// ETag is a hex encoding of the hash of the object contents
+	ETag string `json:"etag,omitempty"`
+	// VersionID is the version ID of the object, which is empty if it was
+	// written before versioning was ever enabled on its bucket
+	VersionID string `json:"versionId,omitempty"`
+	// Metadata is the system and user metadata of the object
+	Metadata *s3object.Metadata `json:"metadata,omitempty"`
+	// PartSizes are the sizes of the parts of an object uploaded in parts,
+	// so that they can be read by part number
+	PartSizes []int64 `json:"partSizes,omitempty"`
+}
+
+// metadataStore persists object metadata as json sidecar files beneath the
+// system directory, mirroring the layout of buckets and objects
+type metadataStore struct {
+	dir    string
+	tmpDir string
+}
+
+func newMetadataStore(dataDir string) metadataStore {
+	return metadataStore{
+		dir:    filepath.Join(dataDir, SYSTEM_DIRECTORY, METADATA_DIRECTORY),
+		tmpDir: filepath.Join(dataDir, SYSTEM_DIRECTORY, TMP_DIRECTORY),
+	}
+}
+
+func (s metadataStore) path(bucket, key string) string {
+	return filepath.Join(s.dir, bucket, key+".json")
+}
+
+// get returns the metadata of an object. Objects without a sidecar have
+// empty metadata.
+func (s metadataStore) get(bucket, key string) (*objectMetadata, error) {
+	meta := &objectMetadata{}
+	payload, err := os.ReadFile(s.path(bucket, key))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return meta, nil
+		}
+		return nil, err
+	}
+	if err := json.Unmarshal(payload, meta); err != nil {
+		return nil, err
+	}
+	return meta, nil
+}
+
+// put atomically replaces the metadata of an object
+func (s metadataStore) put(bucket, key string, meta *objectMetadata) error {
+	payload, err := json.Marshal(meta)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(s.tmpDir, s.path(bucket, key), payload)
+}
+
+// delete removes the metadata of an object
+func (s metadataStore) delete(bucket, key string) error {
+	err := os.Remove(s.path(bucket, key))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// deleteBucket removes the metadata of every object in a bucket
+func (s metadataStore) deleteBucket(bucket string) error {
+	return os.RemoveAll(filepath.Join(s.dir, bucket))
+}
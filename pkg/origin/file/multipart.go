@@ -0,0 +1,439 @@
+package fileorigin
+
+import (
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	s3error "github.com/jakthom/s3c/pkg/s3/error"
+	s3multipart "github.com/jakthom/s3c/pkg/s3/multipart"
+	s3object "github.com/jakthom/s3c/pkg/s3/object"
+	s3util "github.com/jakthom/s3c/pkg/s3/util"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// MULTIPART_DIRECTORY is where in-progress multipart uploads are staged,
+	// relative to the system directory
+	MULTIPART_DIRECTORY string = "multipart"
+	// UPLOAD_FILE is the name of the file describing an upload within its
+	// staging directory
+	UPLOAD_FILE string = "upload.json"
+	// minPartSize is the minimum size of every part but the last
+	minPartSize = 5 * 1024 * 1024
+)
+
+// upload describes an in-progress multipart upload
+type upload struct {
+	Bucket    string             `json:"bucket"`
+	Key       string             `json:"key"`
+	Initiated time.Time          `json:"initiated"`
+	Metadata  *s3object.Metadata `json:"metadata,omitempty"`
+	// Checksum holds the algorithm and type of the checksum of the upload,
+	// if it has one
+	Checksum *s3util.Checksum `json:"checksum,omitempty"`
+}
+
+// part describes an uploaded part of a multipart upload
+type part struct {
+	ETag     string           `json:"etag"`
+	Size     int64            `json:"size"`
+	Checksum *s3util.Checksum `json:"checksum,omitempty"`
+}
+
+// FileOriginMultipartController stages the parts of multipart uploads on
+// disk, and assembles them into an object on completion.
+type FileOriginMultipartController struct {
+	dataDir   string
+	uploadDir string
+	tmpDir    string
+	versions  versionStore
+}
+
+func (c *FileOriginMultipartController) uploadPath(uploadID string) string {
+	return filepath.Join(c.uploadDir, uploadID)
+}
+
+func (c *FileOriginMultipartController) partPath(uploadID string, partNumber int) string {
+	return filepath.Join(c.uploadPath(uploadID), strconv.Itoa(partNumber))
+}
+
+// readUpload reads the description of an upload
+func (c *FileOriginMultipartController) readUpload(uploadID string) (*upload, error) {
+	payload, err := os.ReadFile(filepath.Join(c.uploadPath(uploadID), UPLOAD_FILE))
+	if err != nil {
+		return nil, err
+	}
+	u := &upload{}
+	if err := json.Unmarshal(payload, u); err != nil {
+		return nil, err
+	}
+	return u, nil
+}
+
+// getUpload reads an upload, ensuring it belongs to the given bucket and key
+func (c *FileOriginMultipartController) getUpload(r *http.Request, bucket, key, uploadID string) (*upload, error) {
+	if _, err := uuid.Parse(uploadID); err != nil {
+		return nil, s3error.NoSuchUploadError(r)
+	}
+	u, err := c.readUpload(uploadID)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, s3error.NoSuchUploadError(r)
+		}
+		return nil, err
+	}
+	if u.Bucket != bucket || u.Key != key {
+		return nil, s3error.NoSuchUploadError(r)
+	}
+	return u, nil
+}
+
+// getPart reads the description of an uploaded part
+func (c *FileOriginMultipartController) getPart(uploadID string, partNumber int) (*part, error) {
+	payload, err := os.ReadFile(c.partPath(uploadID, partNumber) + ".json")
+	if err != nil {
+		return nil, err
+	}
+	p := &part{}
+	if err := json.Unmarshal(payload, p); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// listParts returns the part numbers of an upload, in ascending order
+func (c *FileOriginMultipartController) listParts(uploadID string) ([]int, error) {
+	files, err := os.ReadDir(c.uploadPath(uploadID))
+	if err != nil {
+		return nil, err
+	}
+	var partNumbers []int
+	for _, file := range files {
+		name, ok := strings.CutSuffix(file.Name(), ".json")
+		if !ok {
+			continue
+		}
+		if partNumber, err := strconv.Atoi(name); err == nil {
+			partNumbers = append(partNumbers, partNumber)
+		}
+	}
+	sort.Ints(partNumbers)
+	return partNumbers, nil
+}
+
+func (c *FileOriginMultipartController) ListMultipart(r *http.Request, bucket, keyMarker, uploadIDMarker string, maxUploads int) (*s3multipart.ListMultipartResult, error) {
+	if _, err := requireBucket(r, c.dataDir, bucket); err != nil {
+		return nil, err
+	}
+	files, err := os.ReadDir(c.uploadDir)
+	if err != nil && !os.IsNotExist(err) {
+		log.Error().Err(err).Msg("Failed to list multipart uploads")
+		return nil, err
+	}
+	var uploads []*s3multipart.Upload
+	for _, file := range files {
+		u, err := c.readUpload(file.Name())
+		if err != nil || u.Bucket != bucket {
+			continue
+		}
+		if u.Key < keyMarker || (u.Key == keyMarker && file.Name() <= uploadIDMarker) {
+			continue
+		}
+		uploads = append(uploads, &s3multipart.Upload{
+			Key:          u.Key,
+			UploadID:     file.Name(),
+			StorageClass: "STANDARD",
+			Initiated:    u.Initiated,
+		})
+	}
+	sort.Slice(uploads, func(i, j int) bool {
+		if uploads[i].Key != uploads[j].Key {
+			return uploads[i].Key < uploads[j].Key
+		}
+		return uploads[i].UploadID < uploads[j].UploadID
+	})
+	result := s3multipart.ListMultipartResult{}
+	if len(uploads) > maxUploads {
+		uploads = uploads[:maxUploads]
+		result.IsTruncated = true
+	}
+	result.Uploads = uploads
+	return &result, nil
+}
+
+func (c *FileOriginMultipartController) InitMultipart(r *http.Request, bucket, key string) (string, error) {
+	if _, err := requireBucket(r, c.dataDir, bucket); err != nil {
+		return "", err
+	}
+	if _, err := objectPath(r, c.dataDir, bucket, key); err != nil {
+		return "", err
+	}
+	uploadID := uuid.New().String()
+	u := upload{
+		Bucket:    bucket,
+		Key:       key,
+		Initiated: time.Now(),
+		Metadata:  s3object.MetadataFromHeader(r.Header),
+	}
+	if algorithm := r.Header.Get("x-amz-checksum-algorithm"); algorithm != "" {
+		u.Checksum = &s3util.Checksum{
+			Algorithm: strings.ToUpper(algorithm),
+			Type:      r.Header.Get("x-amz-checksum-type"),
+		}
+	}
+	payload, err := json.Marshal(u)
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(c.uploadPath(uploadID), 0755); err != nil {
+		log.Error().Err(err).Msg("Failed to create multipart upload: " + uploadID)
+		return "", err
+	}
+	if err := writeFileAtomic(c.tmpDir, filepath.Join(c.uploadPath(uploadID), UPLOAD_FILE), payload); err != nil {
+		log.Error().Err(err).Msg("Failed to create multipart upload: " + uploadID)
+		return "", err
+	}
+	log.Info().Msg("Initialized multipart upload " + uploadID + " of: " + key)
+	return uploadID, nil
+}
+
+func (c *FileOriginMultipartController) AbortMultipart(r *http.Request, bucket, key, uploadID string) error {
+	if _, err := c.getUpload(r, bucket, key, uploadID); err != nil {
+		return err
+	}
+	log.Info().Msg("Aborting multipart upload: " + uploadID)
+	return os.RemoveAll(c.uploadPath(uploadID))
+}
+
+func (c *FileOriginMultipartController) CompleteMultipart(r *http.Request, bucket, key, uploadID string, parts []*s3multipart.Part) (*s3multipart.CompleteMultipartResult, error) {
+	if _, err := requireBucket(r, c.dataDir, bucket); err != nil {
+		return nil, err
+	}
+	u, err := c.getUpload(r, bucket, key, uploadID)
+	if err != nil {
+		return nil, err
+	}
+	condition, err := s3util.WriteConditionFromRequest(r)
+	if err != nil {
+		return nil, err
+	}
+	if err := c.versions.check(r, bucket, key, condition); err != nil {
+		return nil, err
+	}
+
+	// Validate every part before assembling anything
+	md5s := md5.New()
+	partSizes := make([]int64, len(parts))
+	var checksums hash.Hash
+	if u.Checksum != nil {
+		checksums = s3util.NewChecksum(u.Checksum.Algorithm)
+	}
+	for i, requested := range parts {
+		p, err := c.getPart(uploadID, requested.PartNumber)
+		if err != nil || s3util.StripETagQuotes(requested.ETag) != p.ETag {
+			return nil, s3error.InvalidPartError(r)
+		}
+		if i < len(parts)-1 && p.Size < minPartSize {
+			return nil, s3error.EntityTooSmallError(r)
+		}
+		partSizes[i] = p.Size
+		sum, err := hex.DecodeString(p.ETag)
+		if err != nil {
+			return nil, s3error.InvalidPartError(r)
+		}
+		md5s.Write(sum)
+		// Checksums of parts that are sent must match those they were
+		// uploaded with
+		if checksum := s3util.ChecksumFromFields(requested.ChecksumFields, ""); checksum != nil {
+			if p.Checksum == nil || p.Checksum.Algorithm != checksum.Algorithm || p.Checksum.Value != checksum.Value {
+				return nil, s3error.InvalidPartError(r)
+			}
+		}
+		if u.Checksum != nil && u.Checksum.Type == s3util.ChecksumTypeComposite {
+			if p.Checksum == nil || p.Checksum.Algorithm != u.Checksum.Algorithm {
+				return nil, s3error.InvalidPartError(r)
+			}
+			sum, err := base64.StdEncoding.DecodeString(p.Checksum.Value)
+			if err != nil {
+				return nil, s3error.InvalidPartError(r)
+			}
+			checksums.Write(sum)
+		}
+	}
+
+	tmp, err := createTemp(c.tmpDir)
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(tmp.Name())
+	// Full object checksums are computed while the parts are assembled
+	var w io.Writer = tmp
+	if u.Checksum != nil && u.Checksum.Type == s3util.ChecksumTypeFullObject {
+		w = io.MultiWriter(tmp, checksums)
+	}
+	for _, requested := range parts {
+		if err = appendFile(w, c.partPath(uploadID, requested.PartNumber)); err != nil {
+			break
+		}
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to assemble multipart upload: " + uploadID)
+		return nil, err
+	}
+
+	metadata := u.Metadata
+	if u.Checksum != nil {
+		checksum := &s3util.Checksum{
+			Algorithm: u.Checksum.Algorithm,
+			Value:     s3util.EncodeChecksum(checksums),
+			Type:      u.Checksum.Type,
+		}
+		if checksum.Type == s3util.ChecksumTypeComposite {
+			checksum.Value = fmt.Sprintf("%s-%d", checksum.Value, len(parts))
+		}
+		// The checksum of the object may be sent to be verified
+		if expected := s3util.ChecksumFromHeader(r.Header); expected != nil && (expected.Algorithm != checksum.Algorithm || expected.Value != checksum.Value) {
+			return nil, s3error.BadChecksumError(r, checksum.Algorithm)
+		}
+		if metadata == nil {
+			metadata = &s3object.Metadata{}
+		}
+		metadata.Checksum = checksum
+	}
+
+	etag := fmt.Sprintf("%x-%d", md5s.Sum(nil), len(parts))
+	versionID, err := c.versions.commit(r, bucket, key, tmp.Name(), &objectMetadata{ETag: etag, Metadata: metadata, PartSizes: partSizes}, condition)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to complete multipart upload: " + uploadID)
+		return nil, err
+	}
+	if err := os.RemoveAll(c.uploadPath(uploadID)); err != nil {
+		log.Error().Err(err).Msg("Failed to clean up multipart upload: " + uploadID)
+	}
+	log.Info().Msg("Completed multipart upload " + uploadID + " of: " + key)
+	var size int64
+	for _, partSize := range partSizes {
+		size += partSize
+	}
+	return &s3multipart.CompleteMultipartResult{
+		Location: location(r, bucket, key),
+		ETag:     etag,
+		Version:  versionID,
+		Checksum: metadata.Checksum,
+		Size:     size,
+	}, nil
+}
+
+func (c *FileOriginMultipartController) ListMultipartChunks(r *http.Request, bucket, key, uploadID string, partNumberMarker, maxParts int) (*s3multipart.ListMultipartChunksResult, error) {
+	if _, err := c.getUpload(r, bucket, key, uploadID); err != nil {
+		return nil, err
+	}
+	partNumbers, err := c.listParts(uploadID)
+	if err != nil {
+		return nil, err
+	}
+	result := s3multipart.ListMultipartChunksResult{
+		StorageClass: "STANDARD",
+	}
+	for _, partNumber := range partNumbers {
+		if partNumber <= partNumberMarker {
+			continue
+		}
+		if len(result.Parts) == maxParts {
+			result.IsTruncated = true
+			break
+		}
+		p, err := c.getPart(uploadID, partNumber)
+		if err != nil {
+			return nil, err
+		}
+		result.Parts = append(result.Parts, &s3multipart.Part{
+			PartNumber:     partNumber,
+			ETag:           p.ETag,
+			ChecksumFields: p.Checksum.Fields(),
+		})
+	}
+	return &result, nil
+}
+
+func (c *FileOriginMultipartController) UploadMultipartChunk(r *http.Request, bucket, key, uploadID string, partNumber int, reader io.Reader) (string, error) {
+	u, err := c.getUpload(r, bucket, key, uploadID)
+	if err != nil {
+		return "", err
+	}
+	// Parts of uploads with a checksum are checksummed with its algorithm,
+	// which s3c computes if the part is sent without a checksum
+	var checksum hash.Hash
+	if u.Checksum != nil {
+		algorithm := s3util.PayloadChecksumAlgorithm(reader)
+		if algorithm != "" && algorithm != u.Checksum.Algorithm {
+			return "", s3error.InvalidRequestError(r, "Checksum Type mismatch occurred, expected checksum Type: "+strings.ToLower(u.Checksum.Algorithm)+", actual checksum Type: "+strings.ToLower(algorithm))
+		}
+		if algorithm == "" {
+			checksum = s3util.NewChecksum(u.Checksum.Algorithm)
+		}
+	}
+	tmp, err := createTemp(c.tmpDir)
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(tmp.Name())
+	hash := md5.New()
+	writers := []io.Writer{tmp, hash}
+	if checksum != nil {
+		writers = append(writers, checksum)
+	}
+	size, err := io.Copy(io.MultiWriter(writers...), reader)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to upload part of multipart upload: " + uploadID)
+		return "", err
+	}
+	etag := hex.EncodeToString(hash.Sum(nil))
+	p := part{ETag: etag, Size: size, Checksum: s3util.PayloadChecksum(reader)}
+	if checksum != nil {
+		p.Checksum = &s3util.Checksum{
+			Algorithm: u.Checksum.Algorithm,
+			Value:     s3util.EncodeChecksum(checksum),
+			Type:      s3util.ChecksumTypeFullObject,
+		}
+	}
+	payload, err := json.Marshal(p)
+	if err != nil {
+		return "", err
+	}
+	if err := rename(tmp.Name(), c.partPath(uploadID, partNumber)); err != nil {
+		return "", err
+	}
+	if err := writeFileAtomic(c.tmpDir, c.partPath(uploadID, partNumber)+".json", payload); err != nil {
+		return "", err
+	}
+	return etag, nil
+}
+
+// location returns the url of an object
+func location(r *http.Request, bucket, key string) string {
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	return scheme + "://" + r.Host + "/" + bucket + "/" + key
+}
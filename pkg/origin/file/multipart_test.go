@@ -0,0 +1,242 @@
+package fileorigin
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	s3multipart "github.com/jakthom/s3c/pkg/s3/multipart"
+	s3util "github.com/jakthom/s3c/pkg/s3/util"
+)
+
+// uploadParts uploads parts to a new multipart upload, returning its id and
+// the parts to complete it with
+func uploadParts(t *testing.T, o *FileOrigin, bucket, key string, header http.Header, contents ...string) (string, []*s3multipart.Part) {
+	t.Helper()
+	multipart := o.MultipartController()
+	r := httptest.NewRequest(http.MethodPost, "/"+bucket+"/"+key+"?uploads", nil)
+	for name, values := range header {
+		r.Header[name] = values
+	}
+	uploadID, err := multipart.InitMultipart(r, bucket, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var parts []*s3multipart.Part
+	for i, content := range contents {
+		etag, err := multipart.UploadMultipartChunk(testRequest(), bucket, key, uploadID, i+1, strings.NewReader(content))
+		if err != nil {
+			t.Fatal(err)
+		}
+		parts = append(parts, &s3multipart.Part{PartNumber: i + 1, ETag: etag})
+	}
+	return uploadID, parts
+}
+
+func TestMultipart(t *testing.T) {
+	o, _ := newTestOrigin(t, "bucket")
+	multipart := o.MultipartController()
+	firstPart := strings.Repeat("a", minPartSize)
+
+	uploadID, parts := uploadParts(t, o, "bucket", "dir/key", http.Header{"Content-Type": {"text/plain"}}, firstPart, "tail")
+	if parts[0].ETag != "79b281060d337b9b2b84ccf390adcf74" || parts[1].ETag != "7aea2552dfe7eb84b9443b6fc9ba6e01" {
+		t.Errorf("part etags = %s, %s", parts[0].ETag, parts[1].ETag)
+	}
+	listed, err := multipart.ListMultipartChunks(testRequest(), "bucket", "dir/key", uploadID, 0, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(listed.Parts) != 1 || listed.Parts[0].PartNumber != 1 || !listed.IsTruncated {
+		t.Errorf("first page of parts = %+v", listed)
+	}
+	listed, err = multipart.ListMultipartChunks(testRequest(), "bucket", "dir/key", uploadID, 1, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(listed.Parts) != 1 || listed.Parts[0].PartNumber != 2 || listed.Parts[0].ETag != parts[1].ETag || listed.IsTruncated {
+		t.Errorf("second page of parts = %+v", listed)
+	}
+
+	// Uploads belong to their bucket and key
+	if _, err := multipart.ListMultipartChunks(testRequest(), "bucket", "other", uploadID, 0, 1000); errorCode(err) != "NoSuchUpload" {
+		t.Errorf("parts of another key: got %q, want NoSuchUpload", errorCode(err))
+	}
+	if _, err := multipart.UploadMultipartChunk(testRequest(), "bucket", "dir/key", "../../bucket", 1, strings.NewReader("part")); errorCode(err) != "NoSuchUpload" {
+		t.Errorf("part of an invalid upload: got %q, want NoSuchUpload", errorCode(err))
+	}
+
+	tests := []struct {
+		name  string
+		parts []*s3multipart.Part
+		code  string
+	}{
+		{"with an unknown part", []*s3multipart.Part{parts[0], {PartNumber: 3, ETag: parts[1].ETag}}, "InvalidPart"},
+		{"with a wrong etag", []*s3multipart.Part{parts[0], {PartNumber: 2, ETag: parts[0].ETag}}, "InvalidPart"},
+		{"with a small part before the last", []*s3multipart.Part{parts[1], parts[0]}, "EntityTooSmall"},
+	}
+	for _, tt := range tests {
+		if _, err := multipart.CompleteMultipart(testRequest(), "bucket", "dir/key", uploadID, tt.parts); errorCode(err) != tt.code {
+			t.Errorf("complete %s: got %q, want %q", tt.name, errorCode(err), tt.code)
+		}
+	}
+
+	// The etag of the object is the md5 of the md5s of its parts, suffixed
+	// with their number. Quoted part etags are accepted.
+	parts[1].ETag = `"` + parts[1].ETag + `"`
+	result, err := multipart.CompleteMultipart(testRequest(), "bucket", "dir/key", uploadID, parts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.ETag != "30dcfd3901d1c613b7fb532281748544-2" || result.Size != minPartSize+4 {
+		t.Errorf("completed upload = %+v", result)
+	}
+	head, err := o.ObjectController().HeadObject(testRequest(), "bucket", "dir/key", "", 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if head.ETag != result.ETag || head.Size != minPartSize+4 || head.Metadata.Headers["Content-Type"] != "text/plain" {
+		t.Errorf("head of the completed upload = %+v", head)
+	}
+	if head.Start != minPartSize || head.Length != 4 || head.PartsCount != 2 {
+		t.Errorf("second part spans %d+%d of %d parts", head.Start, head.Length, head.PartsCount)
+	}
+	// Completed uploads are gone
+	if _, err := multipart.CompleteMultipart(testRequest(), "bucket", "dir/key", uploadID, parts); errorCode(err) != "NoSuchUpload" {
+		t.Errorf("complete of a completed upload: got %q, want NoSuchUpload", errorCode(err))
+	}
+}
+
+func TestAbortMultipart(t *testing.T) {
+	o, _ := newTestOrigin(t, "bucket")
+	multipart := o.MultipartController()
+	uploadID, _ := uploadParts(t, o, "bucket", "key", nil, "part")
+
+	if err := multipart.AbortMultipart(testRequest(), "bucket", "other", uploadID); errorCode(err) != "NoSuchUpload" {
+		t.Errorf("abort of another key: got %q, want NoSuchUpload", errorCode(err))
+	}
+	if err := multipart.AbortMultipart(testRequest(), "bucket", "key", uploadID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := multipart.UploadMultipartChunk(testRequest(), "bucket", "key", uploadID, 2, strings.NewReader("part")); errorCode(err) != "NoSuchUpload" {
+		t.Errorf("part of an aborted upload: got %q, want NoSuchUpload", errorCode(err))
+	}
+	if _, err := multipart.ListMultipartChunks(testRequest(), "bucket", "key", uploadID, 0, 1000); errorCode(err) != "NoSuchUpload" {
+		t.Errorf("parts of an aborted upload: got %q, want NoSuchUpload", errorCode(err))
+	}
+	if err := multipart.AbortMultipart(testRequest(), "bucket", "key", uploadID); errorCode(err) != "NoSuchUpload" {
+		t.Errorf("abort of an aborted upload: got %q, want NoSuchUpload", errorCode(err))
+	}
+}
+
+func TestListMultipart(t *testing.T) {
+	o, _ := newTestOrigin(t, "bucket", "other")
+	multipart := o.MultipartController()
+	for _, key := range []string{"b", "a", "b"} {
+		uploadParts(t, o, "bucket", key, nil)
+	}
+	uploadParts(t, o, "other", "a", nil)
+
+	// Uploads are listed by key, then upload id
+	result, err := multipart.ListMultipart(testRequest(), "bucket", "", "", 1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var keys []string
+	for _, upload := range result.Uploads {
+		keys = append(keys, upload.Key)
+	}
+	if strings.Join(keys, ",") != "a,b,b" || result.IsTruncated {
+		t.Fatalf("listed uploads of %v, truncated %v", keys, result.IsTruncated)
+	}
+	if result.Uploads[1].UploadID > result.Uploads[2].UploadID {
+		t.Error("uploads of a key are not ordered by upload id")
+	}
+
+	first := result.Uploads[1]
+	page, err := multipart.ListMultipart(testRequest(), "bucket", first.Key, first.UploadID, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(page.Uploads) != 1 || page.Uploads[0].UploadID != result.Uploads[2].UploadID || page.IsTruncated {
+		t.Errorf("page after %s = %+v", first.UploadID, page.Uploads)
+	}
+	page, err = multipart.ListMultipart(testRequest(), "bucket", "", "", 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(page.Uploads) != 2 || !page.IsTruncated {
+		t.Errorf("first page of 2 = %d uploads, truncated %v", len(page.Uploads), page.IsTruncated)
+	}
+
+	if _, err := multipart.ListMultipart(testRequest(), "missing", "", "", 1000); errorCode(err) != "NoSuchBucket" {
+		t.Errorf("uploads of a missing bucket: got %q, want NoSuchBucket", errorCode(err))
+	}
+}
+
+func TestCompleteMultipartChecksums(t *testing.T) {
+	o, _ := newTestOrigin(t, "bucket")
+	multipart := o.MultipartController()
+	firstPart := strings.Repeat("a", minPartSize)
+
+	tests := []struct {
+		algorithm    string
+		checksumType string
+		partValues   []string
+		value        string
+	}{
+		// The CRC32 of the CRC32s of the parts, suffixed with their number
+		{"CRC32", s3util.ChecksumTypeComposite, []string{"r/zBbw==", "fDe0XQ=="}, "4fn9rQ==-2"},
+		// The CRC64NVME of the whole object
+		{"CRC64NVME", s3util.ChecksumTypeFullObject, nil, "b4bnuwQ4s4A="},
+	}
+	for _, tt := range tests {
+		header := http.Header{"X-Amz-Checksum-Algorithm": {tt.algorithm}, "X-Amz-Checksum-Type": {tt.checksumType}}
+		uploadID, parts := uploadParts(t, o, "bucket", tt.algorithm, header, firstPart, "tail")
+
+		listed, err := multipart.ListMultipartChunks(testRequest(), "bucket", tt.algorithm, uploadID, 0, 1000)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i, value := range tt.partValues {
+			if checksum := s3util.ChecksumFromFields(listed.Parts[i].ChecksumFields, ""); checksum == nil || checksum.Value != value {
+				t.Errorf("%s: checksum of part %d = %v, want %s", tt.algorithm, i+1, checksum, value)
+			}
+		}
+
+		result, err := multipart.CompleteMultipart(testRequest(), "bucket", tt.algorithm, uploadID, parts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := s3util.Checksum{Algorithm: tt.algorithm, Value: tt.value, Type: tt.checksumType}
+		if result.Checksum == nil || *result.Checksum != want {
+			t.Errorf("%s: checksum = %v, want %v", tt.algorithm, result.Checksum, want)
+		}
+		head, err := o.ObjectController().HeadObject(testRequest(), "bucket", tt.algorithm, "", 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if head.Metadata == nil || head.Metadata.Checksum == nil || *head.Metadata.Checksum != want {
+			t.Errorf("%s: stored metadata = %+v, want checksum %v", tt.algorithm, head.Metadata, want)
+		}
+	}
+
+	// Parts must be completed with the checksums they were uploaded with
+	uploadID, parts := uploadParts(t, o, "bucket", "key", http.Header{"X-Amz-Checksum-Algorithm": {"CRC32"}, "X-Amz-Checksum-Type": {s3util.ChecksumTypeComposite}}, firstPart, "tail")
+	parts[1].ChecksumCRC32 = "r/zBbw=="
+	if _, err := multipart.CompleteMultipart(testRequest(), "bucket", "key", uploadID, parts); errorCode(err) != "InvalidPart" {
+		t.Errorf("part with another checksum: got %q, want InvalidPart", errorCode(err))
+	}
+	parts[1].ChecksumCRC32 = "fDe0XQ=="
+
+	// The checksum of the object may be sent to be verified
+	r := httptest.NewRequest(http.MethodPost, "/bucket/key?uploadId="+uploadID, nil)
+	r.Header.Set("x-amz-checksum-crc32", "AAAAAA==-2")
+	if _, err := multipart.CompleteMultipart(r, "bucket", "key", uploadID, parts); errorCode(err) != "BadDigest" {
+		t.Errorf("mismatched object checksum: got %q, want BadDigest", errorCode(err))
+	}
+	r.Header.Set("x-amz-checksum-crc32", "4fn9rQ==-2")
+	if _, err := multipart.CompleteMultipart(r, "bucket", "key", uploadID, parts); err != nil {
+		t.Errorf("matching object checksum: %v", err)
+	}
+}
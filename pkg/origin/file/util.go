@@ -2,10 +2,51 @@ package fileorigin
 
 import (
 	"io"
+	"net/http"
 	"os"
 	"path/filepath"
+	"strings"
+
+	s3error "github.com/jakthom/s3c/pkg/s3/error"
+	s3object "github.com/jakthom/s3c/pkg/s3/object"
 )
 
+// bucketPath returns the directory of a bucket within the data directory.
+// The system directory shares the data directory with buckets, so its name
+// is reserved.
+func bucketPath(r *http.Request, dataDir, bucket string) (string, error) {
+	if bucket == "" || bucket == "." || bucket == ".." || bucket == SYSTEM_DIRECTORY || strings.ContainsAny(bucket, `/\`) {
+		return "", s3error.InvalidBucketNameError(r)
+	}
+	return filepath.Join(dataDir, bucket), nil
+}
+
+// requireBucket returns the directory of a bucket, checking that it exists
+func requireBucket(r *http.Request, dataDir, bucket string) (string, error) {
+	bucketDir, err := bucketPath(r, dataDir, bucket)
+	if err != nil {
+		return "", err
+	}
+	if _, err := os.Stat(bucketDir); err != nil {
+		return "", s3error.NoSuchBucketError(r)
+	}
+	return bucketDir, nil
+}
+
+// objectPath returns the path of an object within the data directory. Keys
+// are checked here as well as by handlers, so that no caller can reach
+// outside of the directory of a bucket.
+func objectPath(r *http.Request, dataDir, bucket, key string) (string, error) {
+	bucketDir, err := bucketPath(r, dataDir, bucket)
+	if err != nil {
+		return "", err
+	}
+	if !s3object.ValidKey(key) {
+		return "", s3error.InvalidArgumentError(r)
+	}
+	return filepath.Join(bucketDir, key), nil
+}
+
 func copyFile(srcpath string, dstpath string) error {
 	parent := filepath.Dir(dstpath)
 	r, err := os.Open(srcpath)
@@ -30,3 +71,49 @@ func copyFile(srcpath string, dstpath string) error {
 	_, err = io.Copy(w, r)
 	return err
 }
+
+// writeFileAtomic writes a file by staging it in `tmpDir` and renaming it
+// into place, creating parent directories as needed
+func writeFileAtomic(tmpDir string, path string, payload []byte) error {
+	tmp, err := createTemp(tmpDir)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	_, err = tmp.Write(payload)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	return rename(tmp.Name(), path)
+}
+
+// createTemp creates a temporary file in `tmpDir`, creating the directory if
+// it does not exist
+func createTemp(tmpDir string) (*os.File, error) {
+	if err := os.MkdirAll(tmpDir, os.ModePerm); err != nil {
+		return nil, err
+	}
+	return os.CreateTemp(tmpDir, "s3c-")
+}
+
+// rename moves a file into place, creating parent directories as needed
+func rename(srcpath string, dstpath string) error {
+	if err := os.MkdirAll(filepath.Dir(dstpath), os.ModePerm); err != nil {
+		return err
+	}
+	return os.Rename(srcpath, dstpath)
+}
+
+// appendFile appends the contents of the file at `srcpath` to `w`
+func appendFile(w io.Writer, srcpath string) error {
+	r, err := os.Open(srcpath)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	_, err = io.Copy(w, r)
+	return err
+}
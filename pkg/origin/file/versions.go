@@ -0,0 +1,672 @@
+package fileorigin
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	s3bucket "github.com/jakthom/s3c/pkg/s3/bucket"
+	s3error "github.com/jakthom/s3c/pkg/s3/error"
+	s3object "github.com/jakthom/s3c/pkg/s3/object"
+	s3util "github.com/jakthom/s3c/pkg/s3/util"
+)
+
+const (
+	// VERSIONS_DIRECTORY is where noncurrent object versions and delete
+	// markers are stored, relative to the system directory
+	VERSIONS_DIRECTORY string = "versions"
+	// NULL_VERSION is the version ID of objects written while versioning is
+	// not enabled
+	NULL_VERSION string = "null"
+)
+
+// version is a noncurrent version of an object, or a delete marker
+type version struct {
+	Key          string         `json:"key"`
+	ModTime      time.Time      `json:"modTime"`
+	Size         int64          `json:"size"`
+	DeleteMarker bool           `json:"deleteMarker,omitempty"`
+	Metadata     objectMetadata `json:"metadata"`
+}
+
+func (v *version) id() string {
+	return versionID(&v.Metadata)
+}
+
+// versionID returns the version ID of an object
+func versionID(meta *objectMetadata) string {
+	if meta.VersionID == "" {
+		return NULL_VERSION
+	}
+	return meta.VersionID
+}
+
+// newVersionID returns a unique version ID. IDs sort in reverse order of
+// creation, so the newest version of an object sorts first.
+func newVersionID() string {
+	suffix := strings.ReplaceAll(uuid.New().String(), "-", "")
+	return fmt.Sprintf("%016x%s", math.MaxInt64-time.Now().UnixNano(), suffix[:16])
+}
+
+// validVersionID returns whether an ID could have been given to a version.
+// IDs are part of the paths of stored versions, so requests for any other ID
+// must not reach the disk.
+func validVersionID(id string) bool {
+	if id == NULL_VERSION {
+		return true
+	}
+	if len(id) != 32 {
+		return false
+	}
+	_, err := hex.DecodeString(id)
+	return err == nil
+}
+
+// versionStore keeps the noncurrent versions and delete markers of objects.
+// The current version of an object always lives at its usual path in the
+// data directory, and is moved into the store when it is replaced or deleted
+// in a versioned bucket. The versions of a key are stored together, in a
+// directory named after the hash of the key.
+type versionStore struct {
+	dataDir  string
+	dir      string
+	tmpDir   string
+	metadata metadataStore
+	buckets  bucketConfigStore
+	// mu serializes changes to the current version of objects
+	mu *sync.Mutex
+}
+
+func newVersionStore(dataDir string, metadata metadataStore, buckets bucketConfigStore) versionStore {
+	return versionStore{
+		dataDir:  dataDir,
+		dir:      filepath.Join(dataDir, SYSTEM_DIRECTORY, VERSIONS_DIRECTORY),
+		tmpDir:   filepath.Join(dataDir, SYSTEM_DIRECTORY, TMP_DIRECTORY),
+		metadata: metadata,
+		buckets:  buckets,
+		mu:       &sync.Mutex{},
+	}
+}
+
+func (s versionStore) objectPath(bucket, key string) string {
+	return filepath.Join(s.dataDir, bucket, key)
+}
+
+func (s versionStore) keyDir(bucket, key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return filepath.Join(s.dir, bucket, hex.EncodeToString(sum[:]))
+}
+
+func (s versionStore) contentPath(bucket, key, id string) string {
+	return filepath.Join(s.keyDir(bucket, key), id)
+}
+
+func (s versionStore) recordPath(bucket, key, id string) string {
+	return s.contentPath(bucket, key, id) + ".json"
+}
+
+// status returns the versioning status of a bucket
+func (s versionStore) status(bucket string) (string, error) {
+	conf, err := s.buckets.get(bucket)
+	if err != nil {
+		return "", err
+	}
+	return conf.Versioning, nil
+}
+
+// readRecord reads a stored version
+func readRecord(path string) (*version, error) {
+	payload, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	v := &version{}
+	if err := json.Unmarshal(payload, v); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+// get returns a stored version of an object
+func (s versionStore) get(bucket, key, id string) (*version, error) {
+	return readRecord(s.recordPath(bucket, key, id))
+}
+
+// list returns the stored versions of an object, newest first
+func (s versionStore) list(bucket, key string) ([]*version, error) {
+	return s.listDir(s.keyDir(bucket, key))
+}
+
+func (s versionStore) listDir(dir string) ([]*version, error) {
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var versions []*version
+	for _, file := range files {
+		if !strings.HasSuffix(file.Name(), ".json") {
+			continue
+		}
+		v, err := readRecord(filepath.Join(dir, file.Name()))
+		if err != nil {
+			return nil, err
+		}
+		versions = append(versions, v)
+	}
+	sort.Slice(versions, func(i, j int) bool {
+		if !versions[i].ModTime.Equal(versions[j].ModTime) {
+			return versions[i].ModTime.After(versions[j].ModTime)
+		}
+		return versions[i].id() < versions[j].id()
+	})
+	return versions, nil
+}
+
+// listBucket returns the stored versions of every object in a bucket with
+// the given prefix, grouped by key
+func (s versionStore) listBucket(bucket, prefix string) (map[string][]*version, error) {
+	dirs, err := os.ReadDir(filepath.Join(s.dir, bucket))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return map[string][]*version{}, nil
+		}
+		return nil, err
+	}
+	versions := map[string][]*version{}
+	for _, dir := range dirs {
+		keyVersions, err := s.listDir(filepath.Join(s.dir, bucket, dir.Name()))
+		if err != nil {
+			return nil, err
+		}
+		if len(keyVersions) > 0 && strings.HasPrefix(keyVersions[0].Key, prefix) {
+			versions[keyVersions[0].Key] = keyVersions
+		}
+	}
+	return versions, nil
+}
+
+// put stores a version, moving its contents from `content` unless it is a
+// delete marker
+func (s versionStore) put(bucket string, v *version, content string) error {
+	if !v.DeleteMarker {
+		if err := rename(content, s.contentPath(bucket, v.Key, v.id())); err != nil {
+			return err
+		}
+	}
+	payload, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(s.tmpDir, s.recordPath(bucket, v.Key, v.id()), payload)
+}
+
+// remove deletes a stored version, if it exists
+func (s versionStore) remove(bucket, key, id string) error {
+	for _, path := range []string{s.contentPath(bucket, key, id), s.recordPath(bucket, key, id)} {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	// Clean up the directory of the key once its last version is removed
+	os.Remove(s.keyDir(bucket, key))
+	return nil
+}
+
+// hasVersions returns whether any version or delete marker is stored for an
+// object in a bucket
+func (s versionStore) hasVersions(bucket string) (bool, error) {
+	found, err := hasObjects(filepath.Join(s.dir, bucket))
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	return found, err
+}
+
+// deleteBucket removes the stored versions of every object in a bucket
+func (s versionStore) deleteBucket(bucket string) error {
+	return os.RemoveAll(filepath.Join(s.dir, bucket))
+}
+
+// archive moves the current version of an object into the store ahead of it
+// being replaced or deleted. When versioning is suspended null versions are
+// discarded rather than archived, since a new null version replaces them.
+// The caller must hold the lock.
+func (s versionStore) archive(bucket, key, status string) error {
+	if status == s3bucket.VersioningSuspended {
+		if err := s.remove(bucket, key, NULL_VERSION); err != nil {
+			return err
+		}
+	}
+	info, err := os.Stat(s.objectPath(bucket, key))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	meta, err := s.metadata.get(bucket, key)
+	if err != nil {
+		return err
+	}
+	if status == s3bucket.VersioningSuspended && versionID(meta) == NULL_VERSION {
+		return nil
+	}
+	v := &version{
+		Key:      key,
+		ModTime:  info.ModTime(),
+		Size:     info.Size(),
+		Metadata: *meta,
+	}
+	if err := s.put(bucket, v, s.objectPath(bucket, key)); err != nil {
+		return err
+	}
+	return s.metadata.delete(bucket, key)
+}
+
+// promote restores the newest stored version of an object as its current
+// version, if the object has no current version and the newest stored
+// version is not a delete marker. The caller must hold the lock.
+func (s versionStore) promote(bucket, key string) error {
+	if _, err := os.Stat(s.objectPath(bucket, key)); !os.IsNotExist(err) {
+		return err
+	}
+	versions, err := s.list(bucket, key)
+	if err != nil || len(versions) == 0 || versions[0].DeleteMarker {
+		return err
+	}
+	v := versions[0]
+	if err := rename(s.contentPath(bucket, key, v.id()), s.objectPath(bucket, key)); err != nil {
+		return err
+	}
+	if err := s.metadata.put(bucket, key, &v.Metadata); err != nil {
+		return err
+	}
+	return s.remove(bucket, key, v.id())
+}
+
+// check returns the error of a conditional write of an object, given its
+// current version
+func (s versionStore) check(r *http.Request, bucket, key string, condition *s3util.WriteCondition) error {
+	if condition == nil {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.checkLocked(r, bucket, key, condition)
+}
+
+// checkLocked returns the error of a conditional write of an object, like
+// check. The caller must hold the lock.
+func (s versionStore) checkLocked(r *http.Request, bucket, key string, condition *s3util.WriteCondition) error {
+	if condition == nil {
+		return nil
+	}
+	meta, err := s.currentLocked(bucket, key)
+	if err != nil {
+		return err
+	}
+	_, err = os.Stat(s.objectPath(bucket, key))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return condition.Check(r, err == nil, s3util.AddETagQuotes(meta.ETag))
+}
+
+// commit moves the file at `path` into place as the current version of an
+// object, archiving the version it replaces if the bucket is versioned. It
+// returns the ID of the new version, which is empty if versioning has never
+// been enabled on the bucket. Conditional writes are expected to have been
+// checked before their contents were staged, so a condition that no longer
+// holds means another write raced them.
+func (s versionStore) commit(r *http.Request, bucket, key, path string, meta *objectMetadata, condition *s3util.WriteCondition) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.checkLocked(r, bucket, key, condition); err != nil {
+		if _, ok := err.(*s3error.Error); ok {
+			return "", s3error.ConditionalRequestConflictError(r)
+		}
+		return "", err
+	}
+	status, err := s.status(bucket)
+	if err != nil {
+		return "", err
+	}
+	meta.VersionID = ""
+	if status != s3bucket.VersioningDisabled {
+		if err := s.archive(bucket, key, status); err != nil {
+			return "", err
+		}
+		meta.VersionID = NULL_VERSION
+		if status == s3bucket.VersioningEnabled {
+			meta.VersionID = newVersionID()
+		}
+	}
+	if err := rename(path, s.objectPath(bucket, key)); err != nil {
+		return "", err
+	}
+	if err := s.metadata.put(bucket, key, meta); err != nil {
+		return "", err
+	}
+	return meta.VersionID, nil
+}
+
+// current returns the metadata of the current version of an object. Objects
+// placed in the data directory by other means than s3c have no stored ETag,
+// so it is computed and stored on first use.
+func (s versionStore) current(bucket, key string) (*objectMetadata, error) {
+	meta, err := s.metadata.get(bucket, key)
+	if err != nil || meta.ETag != "" {
+		return meta, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	// The object may have been replaced while waiting for the lock
+	return s.currentLocked(bucket, key)
+}
+
+// currentLocked returns the metadata of the current version of an object,
+// like current. The caller must hold the lock.
+func (s versionStore) currentLocked(bucket, key string) (*objectMetadata, error) {
+	meta, err := s.metadata.get(bucket, key)
+	if err != nil || meta.ETag != "" {
+		return meta, err
+	}
+	file, err := os.Open(s.objectPath(bucket, key))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return meta, nil
+		}
+		return nil, err
+	}
+	defer file.Close()
+	if info, err := file.Stat(); err != nil || info.IsDir() {
+		// The directory of the keys prefixed by a key is not an object
+		return meta, err
+	}
+	hash := md5.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return nil, err
+	}
+	meta.ETag = hex.EncodeToString(hash.Sum(nil))
+	if err := s.metadata.put(bucket, key, meta); err != nil {
+		return nil, err
+	}
+	return meta, nil
+}
+
+// open opens a version of an object, or its current version if `id` is
+// empty, along with the sizes of its parts if it was uploaded in parts
+func (s versionStore) open(r *http.Request, bucket, key, id string) (*s3object.GetObjectResult, []int64, error) {
+	result, path, partSizes, err := s.locate(r, bucket, key, id)
+	if err != nil || result.DeleteMarker {
+		return result, nil, err
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	result.Content = file
+	return result, partSizes, nil
+}
+
+// stat describes a version of an object, or its current version if `id` is
+// empty, without opening its contents. If `partNumber` is positive, the
+// range of that part is described as well.
+func (s versionStore) stat(r *http.Request, bucket, key, id string, partNumber int) (*s3object.HeadObjectResult, error) {
+	result, path, partSizes, err := s.locate(r, bucket, key, id)
+	if err != nil {
+		return nil, err
+	}
+	head := &s3object.HeadObjectResult{GetObjectResult: *result}
+	if result.DeleteMarker {
+		return head, nil
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	head.Size = info.Size()
+	if partNumber > 0 {
+		if head.Start, head.Length, head.PartsCount, err = s3object.PartRange(r, head.Size, partNumber, partSizes); err != nil {
+			return nil, err
+		}
+	}
+	return head, nil
+}
+
+// locate returns the result of getting a version of an object, or its
+// current version if `id` is empty, without its contents, along with the path
+// of its contents and the sizes of its parts if it was uploaded in parts.
+// Delete markers have no contents.
+func (s versionStore) locate(r *http.Request, bucket, key, id string) (*s3object.GetObjectResult, string, []int64, error) {
+	if id != "" && !validVersionID(id) {
+		return nil, "", nil, s3error.NoSuchVersionError(r)
+	}
+	status, err := s.status(bucket)
+	if err != nil {
+		return nil, "", nil, err
+	}
+	meta, err := s.current(bucket, key)
+	if err != nil {
+		return nil, "", nil, err
+	}
+	path := s.objectPath(bucket, key)
+	info, err := os.Stat(path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, "", nil, err
+	}
+	if err == nil && !info.IsDir() && (id == "" || id == versionID(meta)) {
+		result := &s3object.GetObjectResult{
+			ETag:     meta.ETag,
+			ModTime:  info.ModTime(),
+			Metadata: meta.Metadata,
+		}
+		if status != s3bucket.VersioningDisabled || id != "" {
+			result.Version = versionID(meta)
+		}
+		return result, path, meta.PartSizes, nil
+	}
+
+	var v *version
+	if id == "" {
+		// Without a current version, the object is either deleted or absent
+		versions, err := s.list(bucket, key)
+		if err != nil {
+			return nil, "", nil, err
+		}
+		if len(versions) == 0 || !versions[0].DeleteMarker {
+			return nil, "", nil, s3error.NoSuchKeyError(r)
+		}
+		v = versions[0]
+	} else if v, err = s.get(bucket, key, id); err != nil {
+		if os.IsNotExist(err) {
+			return nil, "", nil, s3error.NoSuchVersionError(r)
+		}
+		return nil, "", nil, err
+	}
+	if v.DeleteMarker {
+		return &s3object.GetObjectResult{
+			Version:      v.id(),
+			DeleteMarker: true,
+			ModTime:      v.ModTime,
+		}, "", nil, nil
+	}
+	return &s3object.GetObjectResult{
+		ETag:     v.Metadata.ETag,
+		Version:  v.id(),
+		ModTime:  v.ModTime,
+		Metadata: v.Metadata.Metadata,
+	}, s.contentPath(bucket, key, v.id()), v.Metadata.PartSizes, nil
+}
+
+// tag replaces the tags of a version of an object, or of its current version
+// if `id` is empty, returning the version tagged
+func (s versionStore) tag(r *http.Request, bucket, key, id string, tags map[string]string) (string, error) {
+	if id != "" && !validVersionID(id) {
+		return "", s3error.NoSuchVersionError(r)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	status, err := s.status(bucket)
+	if err != nil {
+		return "", err
+	}
+	meta, err := s.currentLocked(bucket, key)
+	if err != nil {
+		return "", err
+	}
+	_, err = os.Stat(s.objectPath(bucket, key))
+	if err != nil && !os.IsNotExist(err) {
+		return "", err
+	}
+	if err == nil && (id == "" || id == versionID(meta)) {
+		if meta.Metadata == nil {
+			meta.Metadata = &s3object.Metadata{}
+		}
+		meta.Metadata.Tags = tags
+		meta.Metadata.TagCount = 0
+		if err := s.metadata.put(bucket, key, meta); err != nil {
+			return "", err
+		}
+		if status == s3bucket.VersioningDisabled && id == "" {
+			return "", nil
+		}
+		return versionID(meta), nil
+	}
+
+	if id == "" {
+		// Delete markers and absent objects have no tags
+		return "", s3error.NoSuchKeyError(r)
+	}
+	v, err := s.get(bucket, key, id)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return "", s3error.NoSuchVersionError(r)
+		}
+		return "", err
+	}
+	if v.DeleteMarker {
+		return "", s3error.MethodNotAllowedError(r)
+	}
+	if v.Metadata.Metadata == nil {
+		v.Metadata.Metadata = &s3object.Metadata{}
+	}
+	v.Metadata.Metadata.Tags = tags
+	v.Metadata.Metadata.TagCount = 0
+	payload, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	if err := writeFileAtomic(s.tmpDir, s.recordPath(bucket, key, id), payload); err != nil {
+		return "", err
+	}
+	return id, nil
+}
+
+// deleteObject deletes the current version of an object. In a versioned
+// bucket the current version is archived and a delete marker takes its
+// place.
+func (s versionStore) deleteObject(bucket, key string) (*s3object.DeleteObjectResult, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	status, err := s.status(bucket)
+	if err != nil {
+		return nil, err
+	}
+	if status == s3bucket.VersioningDisabled {
+		if err := os.Remove(s.objectPath(bucket, key)); err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+		if err := s.metadata.delete(bucket, key); err != nil {
+			return nil, err
+		}
+		return &s3object.DeleteObjectResult{}, nil
+	}
+
+	if err := s.archive(bucket, key, status); err != nil {
+		return nil, err
+	}
+	// Null versions are left in place by archive when versioning is
+	// suspended
+	if err := os.Remove(s.objectPath(bucket, key)); err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	if err := s.metadata.delete(bucket, key); err != nil {
+		return nil, err
+	}
+	id := NULL_VERSION
+	if status == s3bucket.VersioningEnabled {
+		id = newVersionID()
+	}
+	marker := &version{
+		Key:          key,
+		ModTime:      time.Now(),
+		DeleteMarker: true,
+		Metadata:     objectMetadata{VersionID: id},
+	}
+	if err := s.put(bucket, marker, ""); err != nil {
+		return nil, err
+	}
+	return &s3object.DeleteObjectResult{
+		Version:      id,
+		DeleteMarker: true,
+	}, nil
+}
+
+// deleteVersion permanently deletes a version of an object. If the current
+// version is deleted, the newest remaining version takes its place.
+func (s versionStore) deleteVersion(r *http.Request, bucket, key, id string) (*s3object.DeleteObjectResult, error) {
+	if !validVersionID(id) {
+		return nil, s3error.NoSuchVersionError(r)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	meta, err := s.metadata.get(bucket, key)
+	if err != nil {
+		return nil, err
+	}
+	_, err = os.Stat(s.objectPath(bucket, key))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	result := &s3object.DeleteObjectResult{Version: id}
+	if err == nil && versionID(meta) == id {
+		if err := os.Remove(s.objectPath(bucket, key)); err != nil {
+			return nil, err
+		}
+		if err := s.metadata.delete(bucket, key); err != nil {
+			return nil, err
+		}
+	} else {
+		v, err := s.get(bucket, key, id)
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil, s3error.NoSuchVersionError(r)
+			}
+			return nil, err
+		}
+		if err := s.remove(bucket, key, id); err != nil {
+			return nil, err
+		}
+		result.DeleteMarker = v.DeleteMarker
+	}
+	if err := s.promote(bucket, key); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
@@ -0,0 +1,256 @@
+package fileorigin
+
+import (
+	"io"
+	"strings"
+	"testing"
+
+	s3bucket "github.com/jakthom/s3c/pkg/s3/bucket"
+)
+
+// getVersion returns the contents of a version of an object, or of its
+// current version if `id` is empty
+func getVersion(t *testing.T, o *FileOrigin, bucket, key, id string) string {
+	t.Helper()
+	result, err := o.ObjectController().GetObject(testRequest(), bucket, key, id)
+	if err != nil {
+		t.Fatalf("get %s of %s: %v", id, key, err)
+	}
+	defer result.Close()
+	if result.DeleteMarker {
+		t.Fatalf("get %s of %s: got a delete marker", id, key)
+	}
+	content, err := io.ReadAll(result.Content)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(content)
+}
+
+// listVersions returns the IDs of the versions and delete markers of a key,
+// newest first, marking the latest with a star
+func listVersions(t *testing.T, o *FileOrigin, bucket, key string) (versions, deleteMarkers []string) {
+	t.Helper()
+	result, err := o.BucketController().ListObjectVersions(testRequest(), bucket, key, "", "", "", 1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, v := range result.Versions {
+		if v.IsLatest {
+			versions = append(versions, v.Version+"*")
+		} else {
+			versions = append(versions, v.Version)
+		}
+	}
+	for _, marker := range result.DeleteMarkers {
+		if marker.IsLatest {
+			deleteMarkers = append(deleteMarkers, marker.Version+"*")
+		} else {
+			deleteMarkers = append(deleteMarkers, marker.Version)
+		}
+	}
+	return versions, deleteMarkers
+}
+
+func TestVersioning(t *testing.T) {
+	o, _ := newTestOrigin(t, "bucket")
+	buckets := o.BucketController()
+	objects := o.ObjectController()
+
+	// Objects written before versioning is enabled are the null version
+	result, err := objects.PutObject(testRequest(), "bucket", "key", strings.NewReader("zero"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Version != "" {
+		t.Errorf("unversioned put returned version %q", result.Version)
+	}
+	if err := buckets.SetBucketVersioning(testRequest(), "bucket", s3bucket.VersioningEnabled); err != nil {
+		t.Fatal(err)
+	}
+	if err := buckets.SetBucketVersioning(testRequest(), "bucket", s3bucket.VersioningDisabled); errorCode(err) != "IllegalVersioningConfigurationException" {
+		t.Errorf("disabling versioning: got %q, want IllegalVersioningConfigurationException", errorCode(err))
+	}
+
+	var ids []string
+	for _, content := range []string{"one", "two"} {
+		result, err := objects.PutObject(testRequest(), "bucket", "key", strings.NewReader(content))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !validVersionID(result.Version) || result.Version == NULL_VERSION {
+			t.Fatalf("put returned version %q", result.Version)
+		}
+		ids = append(ids, result.Version)
+	}
+	one, two := ids[0], ids[1]
+	if one == two {
+		t.Fatal("puts returned the same version")
+	}
+
+	tests := []struct {
+		id      string
+		content string
+	}{
+		{"", "two"},
+		{two, "two"},
+		{one, "one"},
+		{NULL_VERSION, "zero"},
+	}
+	for _, tt := range tests {
+		if content := getVersion(t, o, "bucket", "key", tt.id); content != tt.content {
+			t.Errorf("version %q = %q, want %q", tt.id, content, tt.content)
+		}
+	}
+	for _, id := range []string{"../../key", strings.Repeat("0", 32)} {
+		if _, err := objects.GetObject(testRequest(), "bucket", "key", id); errorCode(err) != "NoSuchVersion" {
+			t.Errorf("version %q: got %q, want NoSuchVersion", id, errorCode(err))
+		}
+	}
+
+	// Deleting the object puts a delete marker in its place, keeping its
+	// versions
+	deleted, err := objects.DeleteObject(testRequest(), "bucket", "key", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !deleted.DeleteMarker || !validVersionID(deleted.Version) || deleted.Version == NULL_VERSION {
+		t.Fatalf("delete = %+v", deleted)
+	}
+	marker := deleted.Version
+	current, err := objects.GetObject(testRequest(), "bucket", "key", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !current.DeleteMarker || current.Version != marker {
+		t.Errorf("current version of a deleted object = %+v", current)
+	}
+	versions, deleteMarkers := listVersions(t, o, "bucket", "key")
+	if strings.Join(versions, ",") != strings.Join([]string{two, one, NULL_VERSION}, ",") || strings.Join(deleteMarkers, ",") != marker+"*" {
+		t.Errorf("versions = %v, delete markers = %v", versions, deleteMarkers)
+	}
+	if content := getVersion(t, o, "bucket", "key", one); content != "one" {
+		t.Errorf("version of a deleted object = %q", content)
+	}
+
+	// Deleting the delete marker restores the newest version
+	deleted, err = objects.DeleteObject(testRequest(), "bucket", "key", marker)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !deleted.DeleteMarker || deleted.Version != marker {
+		t.Errorf("delete of the delete marker = %+v", deleted)
+	}
+	if content := getVersion(t, o, "bucket", "key", ""); content != "two" {
+		t.Errorf("current version after deleting the delete marker = %q, want two", content)
+	}
+
+	// Deleting the current version restores the previous one
+	deleted, err = objects.DeleteObject(testRequest(), "bucket", "key", two)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if deleted.DeleteMarker || deleted.Version != two {
+		t.Errorf("delete of the current version = %+v", deleted)
+	}
+	if content := getVersion(t, o, "bucket", "key", ""); content != "one" {
+		t.Errorf("current version after deleting it = %q, want one", content)
+	}
+	if _, err := objects.GetObject(testRequest(), "bucket", "key", two); errorCode(err) != "NoSuchVersion" {
+		t.Errorf("deleted version: got %q, want NoSuchVersion", errorCode(err))
+	}
+	versions, deleteMarkers = listVersions(t, o, "bucket", "key")
+	if strings.Join(versions, ",") != one+"*,"+NULL_VERSION || len(deleteMarkers) != 0 {
+		t.Errorf("versions = %v, delete markers = %v", versions, deleteMarkers)
+	}
+	if _, err := objects.DeleteObject(testRequest(), "bucket", "key", two); errorCode(err) != "NoSuchVersion" {
+		t.Errorf("delete of a deleted version: got %q, want NoSuchVersion", errorCode(err))
+	}
+}
+
+func TestVersioningSuspended(t *testing.T) {
+	o, _ := newTestOrigin(t, "bucket")
+	buckets := o.BucketController()
+	objects := o.ObjectController()
+
+	if err := buckets.SetBucketVersioning(testRequest(), "bucket", s3bucket.VersioningEnabled); err != nil {
+		t.Fatal(err)
+	}
+	result, err := objects.PutObject(testRequest(), "bucket", "key", strings.NewReader("one"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	one := result.Version
+	if err := buckets.SetBucketVersioning(testRequest(), "bucket", s3bucket.VersioningSuspended); err != nil {
+		t.Fatal(err)
+	}
+
+	// While versioning is suspended, writes replace the null version and
+	// keep the others
+	for _, content := range []string{"two", "three"} {
+		result, err := objects.PutObject(testRequest(), "bucket", "key", strings.NewReader(content))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result.Version != NULL_VERSION {
+			t.Errorf("suspended put returned version %q, want %s", result.Version, NULL_VERSION)
+		}
+	}
+	versions, _ := listVersions(t, o, "bucket", "key")
+	if strings.Join(versions, ",") != NULL_VERSION+"*,"+one {
+		t.Errorf("versions = %v, want the null version and %s", versions, one)
+	}
+	if content := getVersion(t, o, "bucket", "key", NULL_VERSION); content != "three" {
+		t.Errorf("null version = %q, want three", content)
+	}
+
+	// So do deletes, with a null delete marker
+	deleted, err := objects.DeleteObject(testRequest(), "bucket", "key", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !deleted.DeleteMarker || deleted.Version != NULL_VERSION {
+		t.Errorf("suspended delete = %+v", deleted)
+	}
+	versions, deleteMarkers := listVersions(t, o, "bucket", "key")
+	if strings.Join(versions, ",") != one || strings.Join(deleteMarkers, ",") != NULL_VERSION+"*" {
+		t.Errorf("versions = %v, delete markers = %v", versions, deleteMarkers)
+	}
+	if content := getVersion(t, o, "bucket", "key", one); content != "one" {
+		t.Errorf("version %s = %q, want one", one, content)
+	}
+}
+
+func TestListObjectVersionsPages(t *testing.T) {
+	o, _ := newTestOrigin(t, "bucket")
+	if err := o.BucketController().SetBucketVersioning(testRequest(), "bucket", s3bucket.VersioningEnabled); err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range []string{"a", "b", "a", "dir/c"} {
+		putObject(t, o, "bucket", key, key)
+	}
+
+	// Keys are listed in order, each with its versions newest first, and
+	// listings continue from the version they were truncated at
+	var listed []string
+	keyMarker, versionMarker := "", ""
+	for {
+		result, err := o.BucketController().ListObjectVersions(testRequest(), "bucket", "", keyMarker, versionMarker, "/", 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, v := range result.Versions {
+			listed = append(listed, v.Key)
+		}
+		for _, prefix := range result.CommonPrefixes {
+			listed = append(listed, prefix.Prefix)
+		}
+		if !result.IsTruncated {
+			break
+		}
+		keyMarker, versionMarker = result.NextKeyMarker, result.NextVersionIDMarker
+	}
+	if strings.Join(listed, ",") != "a,a,b,dir/" {
+		t.Errorf("listed %v", listed)
+	}
+}
@@ -1,16 +1,116 @@
 package origin
 
-import "github.com/jakthom/s3c/pkg/config"
+import (
+	"fmt"
 
-// The future home of the origin interface
+	"github.com/jakthom/s3c/pkg/config"
+	fileorigin "github.com/jakthom/s3c/pkg/origin/file"
+	s3origin "github.com/jakthom/s3c/pkg/origin/s3"
+	s3bucket "github.com/jakthom/s3c/pkg/s3/bucket"
+	s3multipart "github.com/jakthom/s3c/pkg/s3/multipart"
+	s3object "github.com/jakthom/s3c/pkg/s3/object"
+	s3service "github.com/jakthom/s3c/pkg/s3/service"
+	"github.com/rs/zerolog/log"
+)
 
+const (
+	// DEFAULT_DATA_DIRECTORY is where the filesystem origin stores data if
+	// no directory is configured
+	DEFAULT_DATA_DIRECTORY string = "data"
+	// R2_ORIGIN_TYPE is the origin type of Cloudflare R2
+	R2_ORIGIN_TYPE string = "r2"
+	// GCS_ORIGIN_TYPE is the origin type of Google Cloud Storage, accessed
+	// through its s3-compatible XML api
+	GCS_ORIGIN_TYPE string = "gcs"
+	// GCS_ENDPOINT is the s3-compatible endpoint of Google Cloud Storage
+	GCS_ENDPOINT string = "https://storage.googleapis.com"
+)
+
+// Origin is a storage backend fronted by s3c. It bundles the controllers
+// required to serve the S3 api.
 type Origin interface {
+	// Type returns the origin type, as specified by `config.Origin.Type`
 	Type() string
-	Put() error
-	Get() error
-	List() error
+	// ServiceController returns the controller for service-level requests
+	ServiceController() s3service.ServiceController
+	// BucketController returns the controller for bucket-level requests
+	BucketController() s3bucket.BucketController
+	// ObjectController returns the controller for object-level requests
+	ObjectController() s3object.ObjectController
+	// MultipartController returns the controller for multipart uploads
+	MultipartController() s3multipart.MultipartController
+}
+
+// Constructor creates an origin from configuration
+type Constructor func(conf config.Origin) (Origin, error)
+
+// constructors is the registry of origin constructors, keyed on origin type
+var constructors = map[string]Constructor{
+	fileorigin.ORIGIN_TYPE: newFileOrigin,
+	s3origin.ORIGIN_TYPE:   newS3Origin,
+	R2_ORIGIN_TYPE:         newS3Origin,
+	GCS_ORIGIN_TYPE:        newS3Origin,
+}
+
+// Register adds an origin constructor to the registry. Registering a type
+// that already exists replaces the existing constructor.
+func Register(originType string, constructor Constructor) {
+	constructors[originType] = constructor
+}
+
+// NewOriginFromConfig creates the origin specified by `conf.Type`
+func NewOriginFromConfig(conf config.Origin) (Origin, error) {
+	constructor, ok := constructors[conf.Type]
+	if !ok {
+		return nil, fmt.Errorf("unsupported origin type: %q", conf.Type)
+	}
+	log.Info().Str("type", conf.Type).Msg("creating origin")
+	return constructor(conf)
+}
+
+func newFileOrigin(conf config.Origin) (Origin, error) {
+	directory := conf.Directory
+	if directory == "" {
+		directory = DEFAULT_DATA_DIRECTORY
+	}
+	fileOrigin, err := fileorigin.NewOrigin(directory)
+	if err != nil {
+		return nil, err
+	}
+	return fileOrigin, nil
 }
 
-func NewOriginFromConfig(config.Origin) Origin {
-	return nil
+func newS3Origin(conf config.Origin) (Origin, error) {
+	endpoint := conf.Endpoint
+	region := conf.Location
+	switch conf.Type {
+	case R2_ORIGIN_TYPE:
+		if endpoint == "" {
+			return nil, fmt.Errorf("an endpoint is required for %q origins", conf.Type)
+		}
+		if region == "" {
+			region = "auto"
+		}
+	case GCS_ORIGIN_TYPE:
+		if endpoint == "" {
+			endpoint = GCS_ENDPOINT
+		}
+		if region == "" {
+			region = "auto"
+		}
+	}
+	s3Origin, err := s3origin.NewOrigin(s3origin.Options{
+		Type:            conf.Type,
+		Endpoint:        endpoint,
+		Region:          region,
+		AccessKeyID:     conf.Auth.KeyID,
+		SecretAccessKey: conf.Auth.Secret,
+		Bucket:          conf.Bucket,
+		Prefix:          conf.Prefix,
+		StorageClass:    conf.StorageClass,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s3Origin, nil
 }
@@ -0,0 +1,218 @@
+package s3origin
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	s3auth "github.com/jakthom/s3c/pkg/s3/auth"
+	s3error "github.com/jakthom/s3c/pkg/s3/error"
+	s3util "github.com/jakthom/s3c/pkg/s3/util"
+	"github.com/rs/zerolog/log"
+)
+
+// upstreamRequest describes a request sent to the upstream endpoint
+type upstreamRequest struct {
+	method        string
+	bucket        string
+	key           string
+	query         url.Values
+	header        http.Header
+	body          io.Reader
+	contentLength int64
+}
+
+// client sends auth V4 signed requests to an s3-compatible endpoint
+type client struct {
+	endpoint   *url.URL
+	region     string
+	accessKey  string
+	secretKey  string
+	httpClient *http.Client
+}
+
+func newClient(endpoint, region, accessKey, secretKey string) (*client, error) {
+	endpointURL, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, err
+	}
+	if endpointURL.Scheme == "" || endpointURL.Host == "" {
+		return nil, fmt.Errorf("invalid s3 origin endpoint: %q", endpoint)
+	}
+	return &client{
+		endpoint:   endpointURL,
+		region:     region,
+		accessKey:  accessKey,
+		secretKey:  secretKey,
+		httpClient: http.DefaultClient,
+	}, nil
+}
+
+// do sends a request upstream on behalf of the incoming request `r`. Non-2xx
+// responses are converted into s3 errors.
+func (c *client) do(r *http.Request, u upstreamRequest) (*http.Response, error) {
+	path := "/"
+	if u.bucket != "" {
+		path += u.bucket
+		if u.key != "" {
+			path += "/" + u.key
+		}
+	}
+	target := *c.endpoint
+	target.Path = strings.TrimSuffix(target.Path, "/") + path
+	target.RawQuery = ""
+	req, err := http.NewRequestWithContext(r.Context(), u.method, target.String(), u.body)
+	if err != nil {
+		return nil, err
+	}
+	req.URL.RawQuery = s3util.NormQuery(u.query)
+	for key, values := range u.header {
+		req.Header[key] = values
+	}
+	if u.body != nil {
+		req.ContentLength = u.contentLength
+	}
+	s3auth.SignV4(req, c.accessKey, c.secretKey, c.region, time.Now())
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		log.Error().Err(err).Str("method", u.method).Str("url", req.URL.String()).Msg("Failed to reach s3 origin")
+		return nil, err
+	}
+	if resp.StatusCode >= 300 && resp.StatusCode != http.StatusNotModified {
+		defer resp.Body.Close()
+		return nil, upstreamError(r, resp)
+	}
+	return resp, nil
+}
+
+// doXML sends a request upstream and unmarshals the XML response body into
+// `payload`
+func (c *client) doXML(r *http.Request, u upstreamRequest, payload interface{}) (http.Header, error) {
+	resp, err := c.do(r, u)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	// Some operations, ie CompleteMultipartUpload, return errors with a 200
+	// status code
+	if err := bodyError(r, resp.StatusCode, body); err != nil {
+		return nil, err
+	}
+	if err := xml.Unmarshal(body, payload); err != nil {
+		return nil, err
+	}
+	return resp.Header, nil
+}
+
+// upstreamError converts an error response from upstream into an s3 error
+func upstreamError(r *http.Request, resp *http.Response) error {
+	body, _ := io.ReadAll(resp.Body)
+	if err := bodyError(r, resp.StatusCode, body); err != nil {
+		if resp.StatusCode < 300 {
+			err.HTTPStatus = http.StatusInternalServerError
+		} else {
+			err.HTTPStatus = resp.StatusCode
+		}
+		return err
+	}
+	// Responses to HEAD requests, amongst others, have no body
+	switch resp.StatusCode {
+	case http.StatusNotFound:
+		return s3error.NoSuchKeyError(r)
+	case http.StatusForbidden:
+		return s3error.AccessDeniedError(r)
+	case http.StatusPreconditionFailed:
+		return s3error.PreconditionFailedError(r)
+	default:
+		return s3error.NewError(r, resp.StatusCode, http.StatusText(resp.StatusCode), "The s3 origin returned an error")
+	}
+}
+
+// bodyError returns the s3 error contained in an XML body, if any
+func bodyError(r *http.Request, status int, body []byte) *s3error.Error {
+	upstreamErr := struct {
+		XMLName xml.Name `xml:"Error"`
+		Code    string   `xml:"Code"`
+		Message string   `xml:"Message"`
+	}{}
+	if err := xml.Unmarshal(body, &upstreamErr); err != nil || upstreamErr.Code == "" {
+		return nil
+	}
+	return s3error.NewError(r, status, upstreamErr.Code, upstreamErr.Message)
+}
+
+// requestBody returns the body of an incoming upload, along with its length.
+// Bodies of unknown length are spooled to a temporary file, since the
+// upstream requires a `Content-Length`, as are bodies whose checksum is only
+// known once they have been read, since the upstream requires it up front.
+// The returned cleanup func must be called once the body has been sent.
+func requestBody(r *http.Request, reader io.Reader) (io.Reader, int64, func(), error) {
+	computed := s3util.PayloadChecksumAlgorithm(reader) != "" && s3util.ChecksumFromHeader(r.Header) == nil
+	if length, ok := uploadLength(r); ok && !computed {
+		return reader, length, func() {}, nil
+	}
+
+	file, err := os.CreateTemp("", "s3c-upload-")
+	if err != nil {
+		return nil, 0, nil, err
+	}
+	cleanup := func() {
+		file.Close()
+		os.Remove(file.Name())
+	}
+	length, err := io.Copy(file, reader)
+	if err != nil {
+		cleanup()
+		return nil, 0, nil, err
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		cleanup()
+		return nil, 0, nil, err
+	}
+	return file, length, cleanup, nil
+}
+
+// uploadLength returns the length of the payload of an incoming upload, if
+// it is known
+func uploadLength(r *http.Request) (int64, bool) {
+	if decoded := r.Header.Get("x-amz-decoded-content-length"); decoded != "" {
+		length, err := strconv.ParseInt(decoded, 10, 64)
+		return length, err == nil
+	}
+	return r.ContentLength, r.ContentLength >= 0
+}
+
+// setChecksumHeader sets the checksum of an incoming upload on the headers
+// of the upstream request, so that the upstream verifies and stores it. It
+// must be called once the body has been returned by `requestBody`.
+func setChecksumHeader(header http.Header, r *http.Request, reader io.Reader) {
+	checksum := s3util.PayloadChecksum(reader)
+	if checksum == nil {
+		checksum = s3util.ChecksumFromHeader(r.Header)
+	}
+	if checksum != nil {
+		header.Set(checksum.Header(), checksum.Value)
+	}
+}
+
+// setConditionHeader sets the write condition of an incoming upload on the
+// headers of the upstream request, so that the upstream evaluates it
+// atomically
+func setConditionHeader(header http.Header, r *http.Request) {
+	for _, name := range []string{"If-None-Match", "If-Match"} {
+		if value := r.Header.Get(name); value != "" {
+			header.Set(name, value)
+		}
+	}
+}
@@ -0,0 +1,142 @@
+package s3origin
+
+import (
+	"encoding/xml"
+	"time"
+
+	s3user "github.com/jakthom/s3c/pkg/s3/user"
+	s3util "github.com/jakthom/s3c/pkg/s3/util"
+)
+
+// listAllMyBucketsResult is the upstream response to ListBuckets
+type listAllMyBucketsResult struct {
+	XMLName xml.Name `xml:"ListAllMyBucketsResult"`
+	Buckets []struct {
+		Name         string    `xml:"Name"`
+		CreationDate time.Time `xml:"CreationDate"`
+	} `xml:"Buckets>Bucket"`
+}
+
+// listBucketResult is the upstream response to ListObjects and ListObjectsV2
+type listBucketResult struct {
+	XMLName               xml.Name `xml:"ListBucketResult"`
+	IsTruncated           bool     `xml:"IsTruncated"`
+	NextMarker            string   `xml:"NextMarker"`
+	NextContinuationToken string   `xml:"NextContinuationToken"`
+	Contents              []struct {
+		Key          string       `xml:"Key"`
+		LastModified time.Time    `xml:"LastModified"`
+		ETag         string       `xml:"ETag"`
+		Size         uint64       `xml:"Size"`
+		StorageClass string       `xml:"StorageClass"`
+		Owner        *s3user.User `xml:"Owner"`
+	} `xml:"Contents"`
+	CommonPrefixes []struct {
+		Prefix string `xml:"Prefix"`
+	} `xml:"CommonPrefixes"`
+}
+
+// copyObjectResult is the upstream response to CopyObject
+type copyObjectResult struct {
+	XMLName      xml.Name  `xml:"CopyObjectResult"`
+	LastModified time.Time `xml:"LastModified"`
+	ETag         string    `xml:"ETag"`
+}
+
+// createBucketConfiguration is the request body of CreateBucket outside of
+// us-east-1
+type createBucketConfiguration struct {
+	XMLName            xml.Name `xml:"http://s3.amazonaws.com/doc/2006-03-01/ CreateBucketConfiguration"`
+	LocationConstraint string   `xml:"LocationConstraint"`
+}
+
+// initiateMultipartUploadResult is the upstream response to
+// CreateMultipartUpload
+type initiateMultipartUploadResult struct {
+	XMLName  xml.Name `xml:"InitiateMultipartUploadResult"`
+	UploadID string   `xml:"UploadId"`
+}
+
+// completeMultipartUpload is the request body of CompleteMultipartUpload
+type completeMultipartUpload struct {
+	XMLName xml.Name `xml:"http://s3.amazonaws.com/doc/2006-03-01/ CompleteMultipartUpload"`
+	Parts   []completedPart
+}
+
+// completedPart is a part listed in a CompleteMultipartUpload request body
+type completedPart struct {
+	XMLName    xml.Name `xml:"Part"`
+	PartNumber int      `xml:"PartNumber"`
+	ETag       string   `xml:"ETag"`
+	s3util.ChecksumFields
+}
+
+// completeMultipartUploadResult is the upstream response to
+// CompleteMultipartUpload
+type completeMultipartUploadResult struct {
+	XMLName  xml.Name `xml:"CompleteMultipartUploadResult"`
+	Location string   `xml:"Location"`
+	ETag     string   `xml:"ETag"`
+	s3util.ChecksumFields
+	ChecksumType string `xml:"ChecksumType"`
+}
+
+// listMultipartUploadsResult is the upstream response to
+// ListMultipartUploads
+type listMultipartUploadsResult struct {
+	XMLName     xml.Name `xml:"ListMultipartUploadsResult"`
+	IsTruncated bool     `xml:"IsTruncated"`
+	Uploads     []struct {
+		Key          string    `xml:"Key"`
+		UploadID     string    `xml:"UploadId"`
+		StorageClass string    `xml:"StorageClass"`
+		Initiated    time.Time `xml:"Initiated"`
+	} `xml:"Upload"`
+}
+
+// listPartsResult is the upstream response to ListParts
+type listPartsResult struct {
+	XMLName      xml.Name `xml:"ListPartsResult"`
+	StorageClass string   `xml:"StorageClass"`
+	IsTruncated  bool     `xml:"IsTruncated"`
+	Parts        []struct {
+		PartNumber int    `xml:"PartNumber"`
+		ETag       string `xml:"ETag"`
+		s3util.ChecksumFields
+	} `xml:"Part"`
+}
+
+// versioningConfiguration is the upstream response to GetBucketVersioning,
+// and the request body of PutBucketVersioning
+type versioningConfiguration struct {
+	XMLName xml.Name `xml:"http://s3.amazonaws.com/doc/2006-03-01/ VersioningConfiguration"`
+	Status  string   `xml:"Status,omitempty"`
+}
+
+// listVersionsResult is the upstream response to ListObjectVersions
+type listVersionsResult struct {
+	XMLName             xml.Name `xml:"ListVersionsResult"`
+	IsTruncated         bool     `xml:"IsTruncated"`
+	NextKeyMarker       string   `xml:"NextKeyMarker"`
+	NextVersionIDMarker string   `xml:"NextVersionIdMarker"`
+	Versions            []struct {
+		Key          string       `xml:"Key"`
+		VersionID    string       `xml:"VersionId"`
+		IsLatest     bool         `xml:"IsLatest"`
+		LastModified time.Time    `xml:"LastModified"`
+		ETag         string       `xml:"ETag"`
+		Size         uint64       `xml:"Size"`
+		StorageClass string       `xml:"StorageClass"`
+		Owner        *s3user.User `xml:"Owner"`
+	} `xml:"Version"`
+	DeleteMarkers []struct {
+		Key          string       `xml:"Key"`
+		VersionID    string       `xml:"VersionId"`
+		IsLatest     bool         `xml:"IsLatest"`
+		LastModified time.Time    `xml:"LastModified"`
+		Owner        *s3user.User `xml:"Owner"`
+	} `xml:"DeleteMarker"`
+	CommonPrefixes []struct {
+		Prefix string `xml:"Prefix"`
+	} `xml:"CommonPrefixes"`
+}
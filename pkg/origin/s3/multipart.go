@@ -0,0 +1,210 @@
+package s3origin
+
+import (
+	"bytes"
+	"encoding/xml"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	s3multipart "github.com/jakthom/s3c/pkg/s3/multipart"
+	s3object "github.com/jakthom/s3c/pkg/s3/object"
+	s3util "github.com/jakthom/s3c/pkg/s3/util"
+	"github.com/rs/zerolog/log"
+)
+
+type S3OriginMultipartController struct {
+	client       *client
+	locator      locator
+	storageClass string
+}
+
+func (c *S3OriginMultipartController) ListMultipart(r *http.Request, bucket, keyMarker, uploadIDMarker string, maxUploads int) (*s3multipart.ListMultipartResult, error) {
+	query := url.Values{}
+	query.Set("uploads", "")
+	query.Set("prefix", c.locator.bucketPrefix(bucket))
+	query.Set("max-uploads", strconv.Itoa(maxUploads))
+	if keyMarker != "" {
+		query.Set("key-marker", c.locator.upstreamKey(bucket, keyMarker))
+		if uploadIDMarker != "" {
+			query.Set("upload-id-marker", uploadIDMarker)
+		}
+	}
+	result := listMultipartUploadsResult{}
+	_, err := c.client.doXML(r, upstreamRequest{
+		method: http.MethodGet,
+		bucket: c.locator.upstreamBucket(bucket),
+		query:  query,
+	}, &result)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to list multipart uploads")
+		return nil, err
+	}
+	listMultipartResult := s3multipart.ListMultipartResult{
+		IsTruncated: result.IsTruncated,
+	}
+	for _, upload := range result.Uploads {
+		listMultipartResult.Uploads = append(listMultipartResult.Uploads, &s3multipart.Upload{
+			Key:          c.locator.localKey(bucket, upload.Key),
+			UploadID:     upload.UploadID,
+			StorageClass: upload.StorageClass,
+			Initiated:    upload.Initiated,
+		})
+	}
+	return &listMultipartResult, nil
+}
+
+func (c *S3OriginMultipartController) InitMultipart(r *http.Request, bucket, key string) (string, error) {
+	query := url.Values{}
+	query.Set("uploads", "")
+	header := http.Header{}
+	metadata := s3object.MetadataFromHeader(r.Header)
+	metadata.WriteHeader(header)
+	if len(metadata.Tags) > 0 {
+		header.Set("x-amz-tagging", s3util.EncodeTagging(metadata.Tags))
+	}
+	if algorithm := r.Header.Get("x-amz-checksum-algorithm"); algorithm != "" {
+		header.Set("x-amz-checksum-algorithm", strings.ToUpper(algorithm))
+		header.Set("x-amz-checksum-type", r.Header.Get("x-amz-checksum-type"))
+	}
+	if c.storageClass != "" {
+		header.Set("x-amz-storage-class", c.storageClass)
+	}
+	result := initiateMultipartUploadResult{}
+	_, err := c.client.doXML(r, upstreamRequest{
+		method: http.MethodPost,
+		bucket: c.locator.upstreamBucket(bucket),
+		key:    c.locator.upstreamKey(bucket, key),
+		query:  query,
+		header: header,
+		body:   http.NoBody,
+	}, &result)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to initialize multipart upload: " + key)
+		return "", err
+	}
+	return result.UploadID, nil
+}
+
+func (c *S3OriginMultipartController) AbortMultipart(r *http.Request, bucket, key, uploadID string) error {
+	query := url.Values{}
+	query.Set("uploadId", uploadID)
+	resp, err := c.client.do(r, upstreamRequest{
+		method: http.MethodDelete,
+		bucket: c.locator.upstreamBucket(bucket),
+		key:    c.locator.upstreamKey(bucket, key),
+		query:  query,
+	})
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to abort multipart upload: " + uploadID)
+		return err
+	}
+	return resp.Body.Close()
+}
+
+func (c *S3OriginMultipartController) CompleteMultipart(r *http.Request, bucket, key, uploadID string, parts []*s3multipart.Part) (*s3multipart.CompleteMultipartResult, error) {
+	payload := completeMultipartUpload{}
+	for _, part := range parts {
+		payload.Parts = append(payload.Parts, completedPart{
+			PartNumber:     part.PartNumber,
+			ETag:           s3util.AddETagQuotes(part.ETag),
+			ChecksumFields: part.ChecksumFields,
+		})
+	}
+	body, err := xml.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+	query := url.Values{}
+	query.Set("uploadId", uploadID)
+	// The checksum of the object may be sent to be verified
+	header := http.Header{}
+	if checksum := s3util.ChecksumFromHeader(r.Header); checksum != nil {
+		header.Set(checksum.Header(), checksum.Value)
+		header.Set("x-amz-checksum-type", checksum.Type)
+	}
+	setConditionHeader(header, r)
+	result := completeMultipartUploadResult{}
+	respHeader, err := c.client.doXML(r, upstreamRequest{
+		method:        http.MethodPost,
+		bucket:        c.locator.upstreamBucket(bucket),
+		key:           c.locator.upstreamKey(bucket, key),
+		query:         query,
+		header:        header,
+		body:          bytes.NewReader(body),
+		contentLength: int64(len(body)),
+	}, &result)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to complete multipart upload: " + uploadID)
+		return nil, err
+	}
+	return &s3multipart.CompleteMultipartResult{
+		Location: result.Location,
+		ETag:     s3util.StripETagQuotes(result.ETag),
+		Version:  respHeader.Get("x-amz-version-id"),
+		Checksum: s3util.ChecksumFromFields(result.ChecksumFields, result.ChecksumType),
+	}, nil
+}
+
+func (c *S3OriginMultipartController) ListMultipartChunks(r *http.Request, bucket, key, uploadID string, partNumberMarker, maxParts int) (*s3multipart.ListMultipartChunksResult, error) {
+	query := url.Values{}
+	query.Set("uploadId", uploadID)
+	query.Set("max-parts", strconv.Itoa(maxParts))
+	if partNumberMarker > 0 {
+		query.Set("part-number-marker", strconv.Itoa(partNumberMarker))
+	}
+	result := listPartsResult{}
+	_, err := c.client.doXML(r, upstreamRequest{
+		method: http.MethodGet,
+		bucket: c.locator.upstreamBucket(bucket),
+		key:    c.locator.upstreamKey(bucket, key),
+		query:  query,
+	}, &result)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to list multipart upload parts: " + uploadID)
+		return nil, err
+	}
+	listChunksResult := s3multipart.ListMultipartChunksResult{
+		StorageClass: result.StorageClass,
+		IsTruncated:  result.IsTruncated,
+	}
+	for _, part := range result.Parts {
+		listChunksResult.Parts = append(listChunksResult.Parts, &s3multipart.Part{
+			PartNumber:     part.PartNumber,
+			ETag:           s3util.StripETagQuotes(part.ETag),
+			ChecksumFields: part.ChecksumFields,
+		})
+	}
+	return &listChunksResult, nil
+}
+
+func (c *S3OriginMultipartController) UploadMultipartChunk(r *http.Request, bucket, key, uploadID string, partNumber int, reader io.Reader) (string, error) {
+	body, length, cleanup, err := requestBody(r, reader)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to read multipart upload part: " + uploadID)
+		return "", err
+	}
+	defer cleanup()
+	query := url.Values{}
+	query.Set("uploadId", uploadID)
+	query.Set("partNumber", strconv.Itoa(partNumber))
+	header := http.Header{}
+	setChecksumHeader(header, r, reader)
+	resp, err := c.client.do(r, upstreamRequest{
+		method:        http.MethodPut,
+		bucket:        c.locator.upstreamBucket(bucket),
+		key:           c.locator.upstreamKey(bucket, key),
+		query:         query,
+		header:        header,
+		body:          body,
+		contentLength: length,
+	})
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to upload multipart upload part: " + uploadID)
+		return "", err
+	}
+	resp.Body.Close()
+	return s3util.StripETagQuotes(resp.Header.Get("ETag")), nil
+}
@@ -0,0 +1,115 @@
+package s3origin
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// remoteReadSeeker is an `io.ReadSeeker` over an upstream object. Seeking is
+// free; reads from an offset other than that of the open response body issue
+// a new ranged GET upstream.
+type remoteReadSeeker struct {
+	fetch     func(offset int64) (io.ReadCloser, error)
+	size      int64
+	offset    int64
+	body      io.ReadCloser
+	bodyStart int64
+}
+
+func newRemoteReadSeeker(body io.ReadCloser, size int64, fetch func(offset int64) (io.ReadCloser, error)) *remoteReadSeeker {
+	return &remoteReadSeeker{
+		fetch: fetch,
+		size:  size,
+		body:  body,
+	}
+}
+
+func (s *remoteReadSeeker) Read(p []byte) (int, error) {
+	if s.offset >= s.size {
+		return 0, io.EOF
+	}
+	if s.body == nil || s.bodyStart != s.offset {
+		s.closeBody()
+		body, err := s.fetch(s.offset)
+		if err != nil {
+			return 0, err
+		}
+		s.body = body
+		s.bodyStart = s.offset
+	}
+	n, err := s.body.Read(p)
+	s.offset += int64(n)
+	s.bodyStart = s.offset
+	if err == io.EOF && s.offset < s.size {
+		err = io.ErrUnexpectedEOF
+	}
+	return n, err
+}
+
+func (s *remoteReadSeeker) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += s.offset
+	case io.SeekEnd:
+		offset += s.size
+	default:
+		return 0, errors.New("invalid whence")
+	}
+	if offset < 0 {
+		return 0, errors.New("negative position")
+	}
+	s.offset = offset
+	return offset, nil
+}
+
+func (s *remoteReadSeeker) Close() error {
+	return s.closeBody()
+}
+
+func (s *remoteReadSeeker) closeBody() error {
+	if s.body == nil {
+		return nil
+	}
+	err := s.body.Close()
+	s.body = nil
+	return err
+}
+
+// rangeHeader returns a `Range` header value for reading from `offset` to
+// `end`, or to the end of an object if `end` is negative
+func rangeHeader(offset, end int64) http.Header {
+	header := http.Header{}
+	if end < 0 {
+		header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+	} else {
+		header.Set("Range", fmt.Sprintf("bytes=%d-%d", offset, end))
+	}
+	return header
+}
+
+// rangedBody returns the body of a response to a GET of an object from
+// `offset`, skipping to the offset if the upstream ignored the range and
+// served the whole object
+func rangedBody(resp *http.Response, offset int64) (io.ReadCloser, error) {
+	if resp.StatusCode == http.StatusPartialContent || offset == 0 {
+		return resp.Body, nil
+	}
+	if _, err := io.CopyN(io.Discard, resp.Body, offset); err != nil {
+		resp.Body.Close()
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+// parseContentRange parses the offset, length and object size of a
+// `Content-Range` header value
+func parseContentRange(value string) (int64, int64, int64, bool) {
+	var start, end, size int64
+	if _, err := fmt.Sscanf(value, "bytes %d-%d/%d", &start, &end, &size); err != nil || end < start {
+		return 0, 0, 0, false
+	}
+	return start, end - start + 1, size, true
+}
@@ -0,0 +1,940 @@
+package s3origin
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	s3bucket "github.com/jakthom/s3c/pkg/s3/bucket"
+	s3error "github.com/jakthom/s3c/pkg/s3/error"
+	s3multipart "github.com/jakthom/s3c/pkg/s3/multipart"
+	s3object "github.com/jakthom/s3c/pkg/s3/object"
+	s3service "github.com/jakthom/s3c/pkg/s3/service"
+	s3util "github.com/jakthom/s3c/pkg/s3/util"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	ORIGIN_TYPE string = "s3"
+	// DEFAULT_REGION is the region used when no location is configured
+	DEFAULT_REGION string = "us-east-1"
+)
+
+// Options configures an S3Origin
+type Options struct {
+	// Type is the origin type, ie "s3" or "r2"
+	Type string
+	// Endpoint is the url of the s3-compatible endpoint
+	Endpoint string
+	// Region is the region requests are signed for
+	Region string
+	// AccessKeyID and SecretAccessKey are the credentials used to sign
+	// requests
+	AccessKeyID     string
+	SecretAccessKey string
+	// Bucket is the upstream bucket. If set, s3c buckets are stored as
+	// prefixes within it; otherwise s3c buckets map onto upstream buckets of
+	// the same name.
+	Bucket string
+	// Prefix is an optional key prefix prepended to every upstream key
+	Prefix string
+	// StorageClass is the storage class of objects written upstream
+	StorageClass string
+}
+
+// S3Origin is an origin that proxies requests to a remote s3-compatible
+// endpoint using auth V4 signed requests.
+type S3Origin struct {
+	originType          string
+	serviceController   *S3OriginServiceController
+	bucketController    *S3OriginBucketController
+	objectController    *S3OriginObjectController
+	multipartController *S3OriginMultipartController
+}
+
+func NewOrigin(opts Options) (*S3Origin, error) {
+	if opts.Region == "" {
+		opts.Region = DEFAULT_REGION
+	}
+	if opts.Endpoint == "" {
+		opts.Endpoint = "https://s3." + opts.Region + ".amazonaws.com"
+	}
+	if opts.Type == "" {
+		opts.Type = ORIGIN_TYPE
+	}
+	c, err := newClient(opts.Endpoint, opts.Region, opts.AccessKeyID, opts.SecretAccessKey)
+	if err != nil {
+		return nil, err
+	}
+	l := locator{
+		bucket: opts.Bucket,
+		prefix: normalizePrefix(opts.Prefix),
+	}
+	log.Info().Str("endpoint", opts.Endpoint).Str("bucket", opts.Bucket).Msg("Proxying to s3 origin")
+	return &S3Origin{
+		originType: opts.Type,
+		serviceController: &S3OriginServiceController{
+			client:  c,
+			locator: l,
+		},
+		bucketController: &S3OriginBucketController{
+			client:  c,
+			locator: l,
+		},
+		objectController: &S3OriginObjectController{
+			client:       c,
+			locator:      l,
+			storageClass: opts.StorageClass,
+		},
+		multipartController: &S3OriginMultipartController{
+			client:       c,
+			locator:      l,
+			storageClass: opts.StorageClass,
+		},
+	}, nil
+}
+
+func (o *S3Origin) Type() string {
+	return o.originType
+}
+
+func (o *S3Origin) ServiceController() s3service.ServiceController {
+	return o.serviceController
+}
+
+func (o *S3Origin) BucketController() s3bucket.BucketController {
+	return o.bucketController
+}
+
+func (o *S3Origin) ObjectController() s3object.ObjectController {
+	return o.objectController
+}
+
+func (o *S3Origin) MultipartController() s3multipart.MultipartController {
+	return o.multipartController
+}
+
+// locator maps s3c buckets and keys onto the upstream. If an upstream bucket
+// is configured, each s3c bucket is a prefix within it. Otherwise s3c buckets
+// map one-to-one onto upstream buckets.
+type locator struct {
+	bucket string
+	prefix string
+}
+
+// prefixed returns whether s3c buckets are prefixes of an upstream bucket
+func (l locator) prefixed() bool {
+	return l.bucket != ""
+}
+
+// upstreamBucket returns the upstream bucket backing an s3c bucket
+func (l locator) upstreamBucket(bucket string) string {
+	if l.prefixed() {
+		return l.bucket
+	}
+	return bucket
+}
+
+// bucketPrefix returns the upstream key prefix of an s3c bucket
+func (l locator) bucketPrefix(bucket string) string {
+	if l.prefixed() {
+		return l.prefix + bucket + "/"
+	}
+	return l.prefix
+}
+
+// upstreamKey returns the upstream key backing an s3c object
+func (l locator) upstreamKey(bucket, key string) string {
+	return l.bucketPrefix(bucket) + key
+}
+
+// localKey returns the s3c key of an upstream key
+func (l locator) localKey(bucket, upstreamKey string) string {
+	return strings.TrimPrefix(upstreamKey, l.bucketPrefix(bucket))
+}
+
+// normalizePrefix ensures a non-empty prefix ends with a single slash
+func normalizePrefix(prefix string) string {
+	prefix = strings.Trim(prefix, "/")
+	if prefix == "" {
+		return ""
+	}
+	return prefix + "/"
+}
+
+type S3OriginServiceController struct {
+	client  *client
+	locator locator
+}
+
+func (c *S3OriginServiceController) ListBuckets(r *http.Request) (*s3service.ListBucketsResult, error) {
+	var buckets []*s3bucket.Bucket
+	if !c.locator.prefixed() {
+		result := listAllMyBucketsResult{}
+		if _, err := c.client.doXML(r, upstreamRequest{method: http.MethodGet}, &result); err != nil {
+			log.Error().Err(err).Msg("Failed to list buckets")
+			return nil, err
+		}
+		for _, b := range result.Buckets {
+			buckets = append(buckets, &s3bucket.Bucket{
+				Name:         b.Name,
+				CreationDate: b.CreationDate,
+			})
+		}
+		return &s3service.ListBucketsResult{Buckets: buckets}, nil
+	}
+
+	// Each s3c bucket is a common prefix directly beneath the configured prefix
+	marker := ""
+	for {
+		result := listBucketResult{}
+		query := url.Values{}
+		query.Set("prefix", c.locator.prefix)
+		query.Set("delimiter", "/")
+		if marker != "" {
+			query.Set("marker", marker)
+		}
+		_, err := c.client.doXML(r, upstreamRequest{
+			method: http.MethodGet,
+			bucket: c.locator.bucket,
+			query:  query,
+		}, &result)
+		if err != nil {
+			log.Error().Err(err).Msg("Failed to list buckets")
+			return nil, err
+		}
+		for _, commonPrefix := range result.CommonPrefixes {
+			buckets = append(buckets, &s3bucket.Bucket{
+				Name: strings.TrimSuffix(strings.TrimPrefix(commonPrefix.Prefix, c.locator.prefix), "/"),
+			})
+			marker = commonPrefix.Prefix
+		}
+		if !result.IsTruncated {
+			break
+		}
+		if result.NextMarker != "" {
+			marker = result.NextMarker
+		}
+	}
+	return &s3service.ListBucketsResult{Buckets: buckets}, nil
+}
+
+type S3OriginBucketController struct {
+	client  *client
+	locator locator
+}
+
+func (c *S3OriginBucketController) GetLocation(r *http.Request, bucket string) (string, error) {
+	return c.client.region, nil
+}
+
+func (c *S3OriginBucketController) ListObjects(r *http.Request, bucket, prefix, marker, delimiter string, maxKeys int) (*s3bucket.ListObjectsResult, error) {
+	bucketPrefix := c.locator.bucketPrefix(bucket)
+	query := url.Values{}
+	query.Set("prefix", bucketPrefix+prefix)
+	query.Set("max-keys", strconv.Itoa(maxKeys))
+	if marker != "" {
+		query.Set("marker", bucketPrefix+marker)
+	}
+	if delimiter != "" {
+		query.Set("delimiter", delimiter)
+	}
+	result := listBucketResult{}
+	_, err := c.client.doXML(r, upstreamRequest{
+		method: http.MethodGet,
+		bucket: c.locator.upstreamBucket(bucket),
+		query:  query,
+	}, &result)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to list objects")
+		return nil, err
+	}
+
+	contents, commonPrefixes := c.localize(bucket, &result)
+	return &s3bucket.ListObjectsResult{
+		Contents:       contents,
+		CommonPrefixes: commonPrefixes,
+		IsTruncated:    result.IsTruncated,
+	}, nil
+}
+
+func (c *S3OriginBucketController) ListObjectsV2(r *http.Request, bucket, prefix, continuationToken, startAfter, delimiter string, maxKeys int, fetchOwner bool) (*s3bucket.ListObjectsV2Result, error) {
+	bucketPrefix := c.locator.bucketPrefix(bucket)
+	query := url.Values{}
+	query.Set("list-type", "2")
+	query.Set("prefix", bucketPrefix+prefix)
+	query.Set("max-keys", strconv.Itoa(maxKeys))
+	if continuationToken != "" {
+		query.Set("continuation-token", continuationToken)
+	}
+	if startAfter != "" {
+		query.Set("start-after", bucketPrefix+startAfter)
+	}
+	if delimiter != "" {
+		query.Set("delimiter", delimiter)
+	}
+	if fetchOwner {
+		query.Set("fetch-owner", "true")
+	}
+	result := listBucketResult{}
+	_, err := c.client.doXML(r, upstreamRequest{
+		method: http.MethodGet,
+		bucket: c.locator.upstreamBucket(bucket),
+		query:  query,
+	}, &result)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to list objects")
+		return nil, err
+	}
+
+	contents, commonPrefixes := c.localize(bucket, &result)
+	return &s3bucket.ListObjectsV2Result{
+		Contents:              contents,
+		CommonPrefixes:        commonPrefixes,
+		IsTruncated:           result.IsTruncated,
+		NextContinuationToken: result.NextContinuationToken,
+	}, nil
+}
+
+// localize converts an upstream listing to the objects and common prefixes
+// of a local bucket
+func (c *S3OriginBucketController) localize(bucket string, result *listBucketResult) ([]*s3object.Object, []*s3object.CommonPrefixes) {
+	var contents []*s3object.Object
+	for _, content := range result.Contents {
+		key := c.locator.localKey(bucket, content.Key)
+		if key == "" {
+			// The marker object of a prefixed bucket
+			continue
+		}
+		contents = append(contents, &s3object.Object{
+			Key:          key,
+			LastModified: content.LastModified,
+			ETag:         s3util.StripETagQuotes(content.ETag),
+			Size:         content.Size,
+			StorageClass: content.StorageClass,
+			Owner:        content.Owner,
+		})
+	}
+	var commonPrefixes []*s3object.CommonPrefixes
+	for _, commonPrefix := range result.CommonPrefixes {
+		commonPrefixes = append(commonPrefixes, &s3object.CommonPrefixes{
+			Prefix: c.locator.localKey(bucket, commonPrefix.Prefix),
+		})
+	}
+	return contents, commonPrefixes
+}
+
+func (c *S3OriginBucketController) CreateBucket(r *http.Request, bucket string) error {
+	if !c.locator.prefixed() {
+		var body []byte
+		if c.client.region != DEFAULT_REGION {
+			body, _ = xml.Marshal(createBucketConfiguration{LocationConstraint: c.client.region})
+		}
+		resp, err := c.client.do(r, upstreamRequest{
+			method:        http.MethodPut,
+			bucket:        bucket,
+			body:          bytes.NewReader(body),
+			contentLength: int64(len(body)),
+		})
+		if err != nil {
+			log.Error().Err(err).Msg("Failed to create bucket: " + bucket)
+			return err
+		}
+		return resp.Body.Close()
+	}
+
+	// Prefixed buckets are marked by an empty object at the bucket prefix
+	keyCount, err := c.countKeys(r, bucket, 1)
+	if err != nil {
+		return err
+	}
+	if keyCount > 0 {
+		return s3error.BucketAlreadyOwnedByYouError(r)
+	}
+	resp, err := c.client.do(r, upstreamRequest{
+		method: http.MethodPut,
+		bucket: c.locator.bucket,
+		key:    c.locator.bucketPrefix(bucket),
+		body:   http.NoBody,
+	})
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to create bucket: " + bucket)
+		return err
+	}
+	return resp.Body.Close()
+}
+
+func (c *S3OriginBucketController) DeleteBucket(r *http.Request, bucket string) error {
+	if !c.locator.prefixed() {
+		resp, err := c.client.do(r, upstreamRequest{
+			method: http.MethodDelete,
+			bucket: bucket,
+		})
+		if err != nil {
+			log.Error().Err(err).Msg("Failed to delete bucket: " + bucket)
+			return err
+		}
+		return resp.Body.Close()
+	}
+
+	keyCount, err := c.countKeys(r, bucket, 2)
+	if err != nil {
+		return err
+	}
+	if keyCount == 0 {
+		return s3error.NoSuchBucketError(r)
+	}
+	if keyCount > 1 {
+		return s3error.BucketNotEmptyError(r)
+	}
+	resp, err := c.client.do(r, upstreamRequest{
+		method: http.MethodDelete,
+		bucket: c.locator.bucket,
+		key:    c.locator.bucketPrefix(bucket),
+	})
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to delete bucket: " + bucket)
+		return err
+	}
+	return resp.Body.Close()
+}
+
+func (c *S3OriginBucketController) ListObjectVersions(r *http.Request, bucket, prefix, keyMarker, versionMarker string, delimiter string, maxKeys int) (*s3bucket.ListObjectVersionsResult, error) {
+	bucketPrefix := c.locator.bucketPrefix(bucket)
+	query := url.Values{}
+	query.Set("versions", "")
+	query.Set("prefix", bucketPrefix+prefix)
+	query.Set("max-keys", strconv.Itoa(maxKeys))
+	if keyMarker != "" {
+		query.Set("key-marker", bucketPrefix+keyMarker)
+	}
+	if versionMarker != "" {
+		query.Set("version-id-marker", versionMarker)
+	}
+	if delimiter != "" {
+		query.Set("delimiter", delimiter)
+	}
+	result := listVersionsResult{}
+	_, err := c.client.doXML(r, upstreamRequest{
+		method: http.MethodGet,
+		bucket: c.locator.upstreamBucket(bucket),
+		query:  query,
+	}, &result)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to list object versions")
+		return nil, err
+	}
+
+	listVersionsResult := s3bucket.ListObjectVersionsResult{
+		IsTruncated:         result.IsTruncated,
+		NextKeyMarker:       c.locator.localKey(bucket, result.NextKeyMarker),
+		NextVersionIDMarker: result.NextVersionIDMarker,
+	}
+	for _, v := range result.Versions {
+		key := c.locator.localKey(bucket, v.Key)
+		if key == "" {
+			// The marker object of a prefixed bucket
+			continue
+		}
+		listVersionsResult.Versions = append(listVersionsResult.Versions, &s3bucket.Version{
+			Key:          key,
+			Version:      v.VersionID,
+			IsLatest:     v.IsLatest,
+			LastModified: v.LastModified,
+			ETag:         s3util.StripETagQuotes(v.ETag),
+			Size:         v.Size,
+			StorageClass: v.StorageClass,
+			Owner:        v.Owner,
+		})
+	}
+	for _, deleteMarker := range result.DeleteMarkers {
+		listVersionsResult.DeleteMarkers = append(listVersionsResult.DeleteMarkers, &s3object.DeleteMarker{
+			Key:          c.locator.localKey(bucket, deleteMarker.Key),
+			Version:      deleteMarker.VersionID,
+			IsLatest:     deleteMarker.IsLatest,
+			LastModified: deleteMarker.LastModified,
+			Owner:        deleteMarker.Owner,
+		})
+	}
+	for _, commonPrefix := range result.CommonPrefixes {
+		listVersionsResult.CommonPrefixes = append(listVersionsResult.CommonPrefixes, &s3object.CommonPrefixes{
+			Prefix: c.locator.localKey(bucket, commonPrefix.Prefix),
+		})
+	}
+	return &listVersionsResult, nil
+}
+
+func (c *S3OriginBucketController) GetBucketVersioning(r *http.Request, bucket string) (string, error) {
+	query := url.Values{}
+	query.Set("versioning", "")
+	result := versioningConfiguration{}
+	_, err := c.client.doXML(r, upstreamRequest{
+		method: http.MethodGet,
+		bucket: c.locator.upstreamBucket(bucket),
+		query:  query,
+	}, &result)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to get versioning of bucket: " + bucket)
+		return "", err
+	}
+	return result.Status, nil
+}
+
+func (c *S3OriginBucketController) SetBucketVersioning(r *http.Request, bucket, status string) error {
+	// Prefixed buckets share the versioning of the upstream bucket, which
+	// can't be changed for just one of them
+	if c.locator.prefixed() {
+		return s3error.NotImplementedError(r)
+	}
+	query := url.Values{}
+	query.Set("versioning", "")
+	body, err := xml.Marshal(versioningConfiguration{Status: status})
+	if err != nil {
+		return err
+	}
+	resp, err := c.client.do(r, upstreamRequest{
+		method:        http.MethodPut,
+		bucket:        bucket,
+		query:         query,
+		body:          bytes.NewReader(body),
+		contentLength: int64(len(body)),
+	})
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to set versioning of bucket: " + bucket)
+		return err
+	}
+	return resp.Body.Close()
+}
+
+func (c *S3OriginBucketController) GetBucketTagging(r *http.Request, bucket string) (map[string]string, error) {
+	// Prefixed buckets share the tags of the upstream bucket, which can't
+	// be told apart
+	if c.locator.prefixed() {
+		return nil, s3error.NotImplementedError(r)
+	}
+	query := url.Values{}
+	query.Set("tagging", "")
+	result := s3util.Tagging{}
+	_, err := c.client.doXML(r, upstreamRequest{
+		method: http.MethodGet,
+		bucket: bucket,
+		query:  query,
+	}, &result)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to get tags of bucket: " + bucket)
+		return nil, err
+	}
+	tags := map[string]string{}
+	for _, tag := range result.TagSet {
+		tags[tag.Key] = tag.Value
+	}
+	return tags, nil
+}
+
+func (c *S3OriginBucketController) PutBucketTagging(r *http.Request, bucket string, tags map[string]string) error {
+	if c.locator.prefixed() {
+		return s3error.NotImplementedError(r)
+	}
+	resp, err := c.client.do(r, taggingRequest(bucket, "", "", tags))
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to put tags of bucket: " + bucket)
+		return err
+	}
+	return resp.Body.Close()
+}
+
+// countKeys counts up to `maxKeys` upstream keys beneath a prefixed bucket,
+// including its marker object
+func (c *S3OriginBucketController) countKeys(r *http.Request, bucket string, maxKeys int) (int, error) {
+	query := url.Values{}
+	query.Set("prefix", c.locator.bucketPrefix(bucket))
+	query.Set("max-keys", strconv.Itoa(maxKeys))
+	result := listBucketResult{}
+	_, err := c.client.doXML(r, upstreamRequest{
+		method: http.MethodGet,
+		bucket: c.locator.bucket,
+		query:  query,
+	}, &result)
+	if err != nil {
+		return 0, err
+	}
+	return len(result.Contents), nil
+}
+
+type S3OriginObjectController struct {
+	client       *client
+	locator      locator
+	storageClass string
+}
+
+func (c *S3OriginObjectController) GetObject(r *http.Request, bucket, key, version string) (*s3object.GetObjectResult, error) {
+	query := url.Values{}
+	if version != "" {
+		query.Set("versionId", version)
+	}
+	upstream := upstreamRequest{
+		method: http.MethodGet,
+		bucket: c.locator.upstreamBucket(bucket),
+		key:    c.locator.upstreamKey(bucket, key),
+		query:  query,
+	}
+	// The checksum of the object is kept with its metadata
+	checksummed := upstream
+	checksummed.header = http.Header{}
+	checksummed.header.Set("x-amz-checksum-mode", "ENABLED")
+	resp, err := c.client.do(r, checksummed)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to get object: " + key)
+		return nil, err
+	}
+	etag := resp.Header.Get("ETag")
+	modTime, _ := http.ParseTime(resp.Header.Get("Last-Modified"))
+	size, err := c.contentLength(r, upstream, resp)
+	if err != nil {
+		resp.Body.Close()
+		log.Error().Err(err).Msg("Failed to size object: " + key)
+		return nil, err
+	}
+	fetch := func(offset int64) (io.ReadCloser, error) {
+		// Pin subsequent reads to the version of the object first read
+		ranged := upstream
+		ranged.header = rangeHeader(offset, -1)
+		if etag != "" {
+			ranged.header.Set("If-Match", etag)
+		}
+		resp, err := c.client.do(r, ranged)
+		if err != nil {
+			return nil, err
+		}
+		return rangedBody(resp, offset)
+	}
+	return &s3object.GetObjectResult{
+		ETag:     s3util.StripETagQuotes(etag),
+		Version:  resp.Header.Get("x-amz-version-id"),
+		ModTime:  modTime,
+		Metadata: s3object.MetadataFromHeader(resp.Header),
+		Content:  newRemoteReadSeeker(resp.Body, size, fetch),
+	}, nil
+}
+
+func (c *S3OriginObjectController) GetObjectRange(r *http.Request, bucket, key, version string, rng s3object.ObjectRange) (*s3object.GetObjectRangeResult, error) {
+	query := url.Values{}
+	if version != "" {
+		query.Set("versionId", version)
+	}
+	upstream := upstreamRequest{
+		method: http.MethodGet,
+		bucket: c.locator.upstreamBucket(bucket),
+		key:    c.locator.upstreamKey(bucket, key),
+		query:  query,
+	}
+	// Parts are read by their number upstream, which knows their sizes
+	requested := upstream
+	requested.header = http.Header{}
+	if rng.PartNumber > 0 {
+		requested.query = url.Values{}
+		for name, values := range query {
+			requested.query[name] = values
+		}
+		requested.query.Set("partNumber", strconv.Itoa(rng.PartNumber))
+	} else {
+		requested.header.Set("Range", rng.Header())
+	}
+	resp, err := c.client.do(r, requested)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to get object range: " + key)
+		return nil, err
+	}
+	etag := resp.Header.Get("ETag")
+	modTime, _ := http.ParseTime(resp.Header.Get("Last-Modified"))
+	var start, length, size int64
+	if resp.StatusCode == http.StatusPartialContent {
+		var ok bool
+		if start, length, size, ok = parseContentRange(resp.Header.Get("Content-Range")); !ok {
+			resp.Body.Close()
+			return nil, errors.New("invalid Content-Range from s3 origin: " + resp.Header.Get("Content-Range"))
+		}
+	} else {
+		if length, err = c.contentLength(r, requested, resp); err != nil {
+			resp.Body.Close()
+			log.Error().Err(err).Msg("Failed to size object range: " + key)
+			return nil, err
+		}
+		size = length
+	}
+	partsCount, _ := strconv.Atoi(resp.Header.Get("x-amz-mp-parts-count"))
+	fetch := func(offset int64) (io.ReadCloser, error) {
+		// Pin subsequent reads to the version of the object first read
+		ranged := upstream
+		ranged.header = rangeHeader(start+offset, start+length-1)
+		if etag != "" {
+			ranged.header.Set("If-Match", etag)
+		}
+		resp, err := c.client.do(r, ranged)
+		if err != nil {
+			return nil, err
+		}
+		return rangedBody(resp, start+offset)
+	}
+	result := s3object.GetObjectResult{
+		ETag:     s3util.StripETagQuotes(etag),
+		Version:  resp.Header.Get("x-amz-version-id"),
+		ModTime:  modTime,
+		Metadata: s3object.MetadataFromHeader(resp.Header),
+		Content:  newRemoteReadSeeker(resp.Body, length, fetch),
+	}
+	if resp.StatusCode != http.StatusPartialContent && rng.PartNumber == 0 {
+		// The upstream ignored the range, so the whole object is sliced
+		return s3object.SliceObject(r, &result, rng, nil)
+	}
+	return &s3object.GetObjectRangeResult{
+		GetObjectResult: result,
+		Start:           start,
+		Length:          length,
+		Size:            size,
+		PartsCount:      partsCount,
+	}, nil
+}
+
+// contentLength returns the length of the body of an upstream GET. Bodies
+// streamed without a length are sized by a HEAD of the object they read,
+// pinned to its version by its ETag.
+func (c *S3OriginObjectController) contentLength(r *http.Request, upstream upstreamRequest, resp *http.Response) (int64, error) {
+	if resp.ContentLength >= 0 {
+		return resp.ContentLength, nil
+	}
+	head := upstream
+	head.method = http.MethodHead
+	head.header = http.Header{}
+	if etag := resp.Header.Get("ETag"); etag != "" {
+		head.header.Set("If-Match", etag)
+	}
+	headResp, err := c.client.do(r, head)
+	if err != nil {
+		return 0, err
+	}
+	headResp.Body.Close()
+	if headResp.ContentLength < 0 {
+		return 0, errors.New("s3 origin did not report the size of object: " + upstream.key)
+	}
+	return headResp.ContentLength, nil
+}
+
+func (c *S3OriginObjectController) HeadObject(r *http.Request, bucket, key, version string, partNumber int) (*s3object.HeadObjectResult, error) {
+	query := url.Values{}
+	if version != "" {
+		query.Set("versionId", version)
+	}
+	if partNumber > 0 {
+		query.Set("partNumber", strconv.Itoa(partNumber))
+	}
+	header := http.Header{}
+	header.Set("x-amz-checksum-mode", "ENABLED")
+	resp, err := c.client.do(r, upstreamRequest{
+		method: http.MethodHead,
+		bucket: c.locator.upstreamBucket(bucket),
+		key:    c.locator.upstreamKey(bucket, key),
+		query:  query,
+		header: header,
+	})
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to head object: " + key)
+		return nil, err
+	}
+	resp.Body.Close()
+	modTime, _ := http.ParseTime(resp.Header.Get("Last-Modified"))
+	result := &s3object.HeadObjectResult{
+		GetObjectResult: s3object.GetObjectResult{
+			ETag:     s3util.StripETagQuotes(resp.Header.Get("ETag")),
+			Version:  resp.Header.Get("x-amz-version-id"),
+			ModTime:  modTime,
+			Metadata: s3object.MetadataFromHeader(resp.Header),
+		},
+		Size: resp.ContentLength,
+	}
+	if partNumber > 0 {
+		result.Start, result.Length = 0, resp.ContentLength
+		if resp.StatusCode == http.StatusPartialContent {
+			var ok bool
+			if result.Start, result.Length, result.Size, ok = parseContentRange(resp.Header.Get("Content-Range")); !ok {
+				return nil, errors.New("invalid Content-Range from s3 origin: " + resp.Header.Get("Content-Range"))
+			}
+		}
+		result.PartsCount, _ = strconv.Atoi(resp.Header.Get("x-amz-mp-parts-count"))
+	}
+	return result, nil
+}
+
+func (c *S3OriginObjectController) CopyObject(r *http.Request, srcBucket, srcKey string, getResult *s3object.GetObjectResult, destBucket, destKey string) (*s3object.PutObjectResult, error) {
+	copySource := url.URL{Path: "/" + c.locator.upstreamBucket(srcBucket) + "/" + c.locator.upstreamKey(srcBucket, srcKey)}
+	if getResult.Version != "" {
+		copySource.RawQuery = "versionId=" + url.QueryEscape(getResult.Version)
+	}
+	header := http.Header{}
+	header.Set("x-amz-copy-source", copySource.String())
+	if r.Header.Get("x-amz-metadata-directive") == s3object.MetadataDirectiveReplace {
+		header.Set("x-amz-metadata-directive", s3object.MetadataDirectiveReplace)
+		getResult.Metadata.WriteHeader(header)
+	}
+	if r.Header.Get("x-amz-tagging-directive") == s3object.TaggingDirectiveReplace {
+		header.Set("x-amz-tagging-directive", s3object.TaggingDirectiveReplace)
+		header.Set("x-amz-tagging", s3util.EncodeTagging(getResult.Metadata.Tags))
+	}
+	if algorithm := r.Header.Get("x-amz-checksum-algorithm"); algorithm != "" {
+		header.Set("x-amz-checksum-algorithm", strings.ToUpper(algorithm))
+	}
+	if c.storageClass != "" {
+		header.Set("x-amz-storage-class", c.storageClass)
+	}
+	result := copyObjectResult{}
+	respHeader, err := c.client.doXML(r, upstreamRequest{
+		method: http.MethodPut,
+		bucket: c.locator.upstreamBucket(destBucket),
+		key:    c.locator.upstreamKey(destBucket, destKey),
+		header: header,
+		body:   http.NoBody,
+	}, &result)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to copy object from: " + srcKey + " to: " + destKey)
+		return nil, err
+	}
+	return &s3object.PutObjectResult{
+		ETag:     s3util.StripETagQuotes(result.ETag),
+		Version:  respHeader.Get("x-amz-version-id"),
+		ModTime:  result.LastModified,
+		Metadata: getResult.Metadata,
+	}, nil
+}
+
+func (c *S3OriginObjectController) PutObject(r *http.Request, bucket, key string, reader io.Reader) (*s3object.PutObjectResult, error) {
+	body, length, cleanup, err := requestBody(r, reader)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to read object: " + key)
+		return nil, err
+	}
+	defer cleanup()
+	metadata := s3object.MetadataFromHeader(r.Header)
+	header := http.Header{}
+	metadata.WriteHeader(header)
+	if len(metadata.Tags) > 0 {
+		header.Set("x-amz-tagging", s3util.EncodeTagging(metadata.Tags))
+	}
+	setChecksumHeader(header, r, reader)
+	setConditionHeader(header, r)
+	if c.storageClass != "" {
+		header.Set("x-amz-storage-class", c.storageClass)
+	}
+	resp, err := c.client.do(r, upstreamRequest{
+		method:        http.MethodPut,
+		bucket:        c.locator.upstreamBucket(bucket),
+		key:           c.locator.upstreamKey(bucket, key),
+		header:        header,
+		body:          body,
+		contentLength: length,
+	})
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to put object: " + key)
+		return nil, err
+	}
+	resp.Body.Close()
+	if checksum := s3util.PayloadChecksum(reader); checksum != nil {
+		metadata.Checksum = checksum
+	}
+	return &s3object.PutObjectResult{
+		ETag:     s3util.StripETagQuotes(resp.Header.Get("ETag")),
+		Version:  resp.Header.Get("x-amz-version-id"),
+		Metadata: metadata,
+	}, nil
+}
+
+func (c *S3OriginObjectController) GetObjectTagging(r *http.Request, bucket, key, version string) (*s3object.ObjectTaggingResult, error) {
+	query := url.Values{}
+	query.Set("tagging", "")
+	if version != "" {
+		query.Set("versionId", version)
+	}
+	result := s3util.Tagging{}
+	respHeader, err := c.client.doXML(r, upstreamRequest{
+		method: http.MethodGet,
+		bucket: c.locator.upstreamBucket(bucket),
+		key:    c.locator.upstreamKey(bucket, key),
+		query:  query,
+	}, &result)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to get tags of object: " + key)
+		return nil, err
+	}
+	tagging := &s3object.ObjectTaggingResult{
+		Version: respHeader.Get("x-amz-version-id"),
+		Tags:    map[string]string{},
+	}
+	for _, tag := range result.TagSet {
+		tagging.Tags[tag.Key] = tag.Value
+	}
+	return tagging, nil
+}
+
+func (c *S3OriginObjectController) PutObjectTagging(r *http.Request, bucket, key, version string, tags map[string]string) (string, error) {
+	resp, err := c.client.do(r, taggingRequest(c.locator.upstreamBucket(bucket), c.locator.upstreamKey(bucket, key), version, tags))
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to put tags of object: " + key)
+		return "", err
+	}
+	resp.Body.Close()
+	return resp.Header.Get("x-amz-version-id"), nil
+}
+
+// taggingRequest returns the upstream request replacing the tags of a bucket,
+// or of an object if `key` is set. An empty set of tags is deleted.
+func taggingRequest(bucket, key, version string, tags map[string]string) upstreamRequest {
+	query := url.Values{}
+	query.Set("tagging", "")
+	if version != "" {
+		query.Set("versionId", version)
+	}
+	if len(tags) == 0 {
+		return upstreamRequest{
+			method: http.MethodDelete,
+			bucket: bucket,
+			key:    key,
+			query:  query,
+		}
+	}
+	// Tagging only holds strings, so it always marshals
+	body, _ := xml.Marshal(s3util.NewTagging(tags))
+	return upstreamRequest{
+		method:        http.MethodPut,
+		bucket:        bucket,
+		key:           key,
+		query:         query,
+		body:          bytes.NewReader(body),
+		contentLength: int64(len(body)),
+	}
+}
+
+func (c *S3OriginObjectController) DeleteObject(r *http.Request, bucket, key, version string) (*s3object.DeleteObjectResult, error) {
+	query := url.Values{}
+	if version != "" {
+		query.Set("versionId", version)
+	}
+	resp, err := c.client.do(r, upstreamRequest{
+		method: http.MethodDelete,
+		bucket: c.locator.upstreamBucket(bucket),
+		key:    c.locator.upstreamKey(bucket, key),
+		query:  query,
+	})
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to delete object: " + key)
+		return nil, err
+	}
+	resp.Body.Close()
+	return &s3object.DeleteObjectResult{
+		Version:      resp.Header.Get("x-amz-version-id"),
+		DeleteMarker: resp.Header.Get("x-amz-delete-marker") == "true",
+	}, nil
+}
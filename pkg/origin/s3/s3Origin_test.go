@@ -0,0 +1,247 @@
+package s3origin
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	s3object "github.com/jakthom/s3c/pkg/s3/object"
+)
+
+const (
+	testContent = "0123456789abcdefghijklmnopqrstuvwxyz"
+	testETag    = `"0a1b2c3d4e5f"`
+)
+
+// upstream is a fake s3 origin serving a single object
+type upstream struct {
+	// chunked streams GET responses without a Content-Length
+	chunked bool
+	// ignoreRange serves the whole object to ranged GETs
+	ignoreRange bool
+
+	mu       sync.Mutex
+	requests []*http.Request
+}
+
+func (u *upstream) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	u.mu.Lock()
+	u.requests = append(u.requests, r.Clone(r.Context()))
+	u.mu.Unlock()
+
+	if r.URL.Path != "/bucket/key" {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	if match := r.Header.Get("If-Match"); match != "" && match != testETag {
+		w.WriteHeader(http.StatusPreconditionFailed)
+		return
+	}
+	w.Header().Set("ETag", testETag)
+	w.Header().Set("Last-Modified", "Mon, 02 Jan 2006 15:04:05 GMT")
+	w.Header().Set("Content-Type", "text/plain")
+	w.Header().Set("x-amz-meta-color", "blue")
+	if r.Method == http.MethodHead {
+		w.Header().Set("Content-Length", strconv.Itoa(len(testContent)))
+		return
+	}
+	content, status := testContent, http.StatusOK
+	if rng := r.Header.Get("Range"); rng != "" && !u.ignoreRange {
+		start, err := strconv.Atoi(strings.TrimSuffix(strings.TrimPrefix(rng, "bytes="), "-"))
+		if err != nil {
+			w.WriteHeader(http.StatusRequestedRangeNotSatisfiable)
+			return
+		}
+		content, status = testContent[start:], http.StatusPartialContent
+		w.Header().Set("Content-Range", "bytes "+strconv.Itoa(start)+"-"+strconv.Itoa(len(testContent)-1)+"/"+strconv.Itoa(len(testContent)))
+	}
+	if u.chunked {
+		w.WriteHeader(status)
+		w.(http.Flusher).Flush()
+	} else {
+		w.Header().Set("Content-Length", strconv.Itoa(len(content)))
+		w.WriteHeader(status)
+	}
+	io.WriteString(w, content)
+}
+
+func (u *upstream) received() []*http.Request {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	return append([]*http.Request(nil), u.requests...)
+}
+
+func newTestController(t *testing.T, u *upstream) s3object.ObjectController {
+	t.Helper()
+	srv := httptest.NewServer(u)
+	t.Cleanup(srv.Close)
+	o, err := NewOrigin(Options{
+		Endpoint:        srv.URL,
+		Region:          "us-east-1",
+		AccessKeyID:     "AKIDEXAMPLE",
+		SecretAccessKey: "secret",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return o.ObjectController()
+}
+
+func TestGetObject(t *testing.T) {
+	u := &upstream{}
+	c := newTestController(t, u)
+	result, err := c.GetObject(httptest.NewRequest(http.MethodGet, "/bucket/key", nil), "bucket", "key", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	content, err := io.ReadAll(result.Content)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(content) != testContent {
+		t.Errorf("content = %q, want %q", content, testContent)
+	}
+	if result.ETag != strings.Trim(testETag, `"`) {
+		t.Errorf("etag = %q, want it without quotes", result.ETag)
+	}
+	if result.ModTime.IsZero() {
+		t.Error("modification time was not parsed")
+	}
+	if got := result.Metadata.UserMetadata["color"]; got != "blue" {
+		t.Errorf("user metadata color = %q, want %q", got, "blue")
+	}
+
+	requests := u.received()
+	if len(requests) != 1 {
+		t.Fatalf("got %d upstream requests, want 1", len(requests))
+	}
+	auth := requests[0].Header.Get("Authorization")
+	if !strings.HasPrefix(auth, "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/") || !strings.Contains(auth, "/us-east-1/s3/aws4_request") {
+		t.Errorf("request was not signed for the origin: %q", auth)
+	}
+	if requests[0].Header.Get("x-amz-content-sha256") == "" || requests[0].Header.Get("x-amz-date") == "" {
+		t.Error("signed request is missing its payload hash or date")
+	}
+}
+
+func TestGetObjectRefetchesFromOffset(t *testing.T) {
+	u := &upstream{}
+	c := newTestController(t, u)
+	result, err := c.GetObject(httptest.NewRequest(http.MethodGet, "/bucket/key", nil), "bucket", "key", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := result.Content.Seek(10, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+	content, err := io.ReadAll(result.Content)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(content) != testContent[10:] {
+		t.Errorf("content = %q, want %q", content, testContent[10:])
+	}
+
+	requests := u.received()
+	if len(requests) != 2 {
+		t.Fatalf("got %d upstream requests, want 2", len(requests))
+	}
+	refetch := requests[1]
+	if got := refetch.Header.Get("Range"); got != "bytes=10-" {
+		t.Errorf("refetch range = %q, want %q", got, "bytes=10-")
+	}
+	if got := refetch.Header.Get("If-Match"); got != testETag {
+		t.Errorf("refetch If-Match = %q, want %q", got, testETag)
+	}
+}
+
+func TestGetObjectChunked(t *testing.T) {
+	u := &upstream{chunked: true}
+	c := newTestController(t, u)
+	result, err := c.GetObject(httptest.NewRequest(http.MethodGet, "/bucket/key", nil), "bucket", "key", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	size, err := result.Content.Seek(0, io.SeekEnd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if size != int64(len(testContent)) {
+		t.Errorf("size = %d, want %d", size, len(testContent))
+	}
+	if _, err := result.Content.Seek(0, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+	content, err := io.ReadAll(result.Content)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(content) != testContent {
+		t.Errorf("content = %q, want %q", content, testContent)
+	}
+
+	requests := u.received()
+	if len(requests) < 2 || requests[1].Method != http.MethodHead {
+		t.Fatal("chunked response was not sized with a HEAD")
+	}
+	if got := requests[1].Header.Get("If-Match"); got != testETag {
+		t.Errorf("HEAD If-Match = %q, want %q", got, testETag)
+	}
+}
+
+func TestGetObjectRangeChunkedWholeObject(t *testing.T) {
+	u := &upstream{chunked: true, ignoreRange: true}
+	c := newTestController(t, u)
+	rng := s3object.ObjectRange{Start: 5, End: 9}
+	result, err := c.GetObjectRange(httptest.NewRequest(http.MethodGet, "/bucket/key", nil), "bucket", "key", "", rng)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Start != 5 || result.Length != 5 || result.Size != int64(len(testContent)) {
+		t.Errorf("range = %d+%d of %d, want 5+5 of %d", result.Start, result.Length, result.Size, len(testContent))
+	}
+	content, err := io.ReadAll(result.Content)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(content) != testContent[5:10] {
+		t.Errorf("content = %q, want %q", content, testContent[5:10])
+	}
+}
+
+func TestLocator(t *testing.T) {
+	tests := []struct {
+		name     string
+		locator  locator
+		bucket   string
+		key      string
+		upstream string
+		prefix   string
+	}{
+		{"bucket per bucket", locator{}, "photos", "a/b.jpg", "photos", ""},
+		{"prefixed buckets", locator{bucket: "shared"}, "photos", "a/b.jpg", "shared", "photos/"},
+		{"prefixed buckets with prefix", locator{bucket: "shared", prefix: normalizePrefix("/s3c//")}, "photos", "a/b.jpg", "shared", "s3c/photos/"},
+		{"bucket per bucket with prefix", locator{prefix: normalizePrefix("s3c")}, "photos", "a/b.jpg", "photos", "s3c/"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.locator.upstreamBucket(tt.bucket); got != tt.upstream {
+				t.Errorf("upstreamBucket = %q, want %q", got, tt.upstream)
+			}
+			if got := tt.locator.bucketPrefix(tt.bucket); got != tt.prefix {
+				t.Errorf("bucketPrefix = %q, want %q", got, tt.prefix)
+			}
+			upstreamKey := tt.locator.upstreamKey(tt.bucket, tt.key)
+			if upstreamKey != tt.prefix+tt.key {
+				t.Errorf("upstreamKey = %q, want %q", upstreamKey, tt.prefix+tt.key)
+			}
+			if got := tt.locator.localKey(tt.bucket, upstreamKey); got != tt.key {
+				t.Errorf("localKey = %q, want %q", got, tt.key)
+			}
+		})
+	}
+}
@@ -1,22 +1,26 @@
 package s3auth
 
+import s3user "github.com/jakthom/s3c/pkg/s3/user"
+
+// DefaultRegion is the region requests are signed for
+const DefaultRegion string = "us-east-1"
+
 // AuthController is an interface defining authentication
 type AuthController interface {
-	// SecretKey is called when a request is made using AWS' auth V4. If
-	// the given access key exists, a non-nil secret key should be returned.
-	// Otherwise nil should be returned.
+	// SecretKey is called when a request is made using AWS' auth V4 or V2.
+	// If the given access key exists, is usable and may sign requests for the
+	// region, a non-empty secret key should be returned. Otherwise an empty
+	// string should be returned. The region of auth V2 requests is empty.
 	SecretKey(accessKey string, region string) (string, error)
-}
-
-type BasicAuthController struct {
-	Region          string
-	AccessKeyId     string
-	SecretAccessKey string
-}
-
-func (b *BasicAuthController) SecretKey(accessKeyId string, region string) (string, error) {
-	if accessKeyId == b.AccessKeyId && region == b.Region {
-		return b.SecretAccessKey, nil
-	}
-	return "", nil
+	// SessionSecretKey is called when a request is signed with temporary
+	// credentials. If the session token is valid for the access key and
+	// region, the secret key of the session should be returned. Invalid and
+	// expired tokens return ErrInvalidToken and ErrExpiredToken.
+	SessionSecretKey(accessKey string, sessionToken string, region string) (string, error)
+	// User returns the user an access key belongs to, or nil if the access
+	// key does not exist.
+	User(accessKey string) (*s3user.User, error)
+	// SessionUser returns the session of a session token, and the user it
+	// was issued to.
+	SessionUser(sessionToken string) (*s3user.User, *Session, error)
 }
@@ -0,0 +1,41 @@
+package s3auth
+
+import (
+	"context"
+	"net/http"
+
+	s3user "github.com/jakthom/s3c/pkg/s3/user"
+)
+
+// userContextKey is the context key of the user a request is authenticated as
+type userContextKey struct{}
+
+// WithUser returns a shallow copy of a request that is authenticated as the
+// given user
+func WithUser(r *http.Request, user *s3user.User) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), userContextKey{}, user))
+}
+
+// RequestUser returns the user a request is authenticated as, or nil if the
+// request is anonymous
+func RequestUser(r *http.Request) *s3user.User {
+	user, _ := r.Context().Value(userContextKey{}).(*s3user.User)
+	return user
+}
+
+// sessionContextKey is the context key of the session of a request made with
+// temporary credentials
+type sessionContextKey struct{}
+
+// WithSession returns a shallow copy of a request that is made with the
+// temporary credentials of the given session
+func WithSession(r *http.Request, session *Session) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), sessionContextKey{}, session))
+}
+
+// RequestSession returns the session of a request made with temporary
+// credentials, or nil if the request is not
+func RequestSession(r *http.Request) *Session {
+	session, _ := r.Context().Value(sessionContextKey{}).(*Session)
+	return session
+}
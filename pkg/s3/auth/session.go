@@ -0,0 +1,136 @@
+package s3auth
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+)
+
+const (
+	// SessionAccessKeyPrefix is the prefix of temporary access keys
+	SessionAccessKeyPrefix string = "ASIA"
+	// MinSessionDuration is the minimum duration of a session
+	MinSessionDuration = 15 * time.Minute
+	// DefaultRoleDuration is the default duration of, and the default maximum
+	// duration of, a role session
+	DefaultRoleDuration = time.Hour
+	// MaxRoleDuration is the maximum duration of a role session
+	MaxRoleDuration = 12 * time.Hour
+	// DefaultSessionTokenDuration is the default duration of a session from
+	// GetSessionToken
+	DefaultSessionTokenDuration = 12 * time.Hour
+	// MaxSessionTokenDuration is the maximum duration of a session from
+	// GetSessionToken
+	MaxSessionTokenDuration = 36 * time.Hour
+)
+
+var (
+	// base32Encoding encodes the random part of temporary access keys
+	base32Encoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+	// ErrInvalidToken is returned for session tokens that are malformed,
+	// forged, or issued for another access key
+	ErrInvalidToken = errors.New("invalid session token")
+	// ErrExpiredToken is returned for session tokens that have expired
+	ErrExpiredToken = errors.New("expired session token")
+)
+
+// Session is the identity and scope of temporary credentials. It is the
+// payload of their session token.
+type Session struct {
+	// AccessKey is the temporary access key of the session
+	AccessKey string `json:"k"`
+	// User is the name of the user the session was issued to
+	User string `json:"u"`
+	// SourceKey is the access key of the user the session was issued with,
+	// which must remain usable for the session to be. Sessions issued with
+	// the credentials of another session keep its source key.
+	SourceKey string `json:"s"`
+	// Role is the name of the role the session assumed, if any
+	Role string `json:"r,omitempty"`
+	// Name is the name of an assumed role session
+	Name string `json:"n,omitempty"`
+	// Policy is an optional policy document that scopes the session down
+	Policy string `json:"p,omitempty"`
+	// Expiration is when the session expires
+	Expiration time.Time `json:"e"`
+}
+
+// sessionSigner issues and verifies stateless session tokens. A token is its
+// session and an HMAC of it keyed by the server key. The secret key of a
+// session is derived from its token, so no state needs to be kept.
+type sessionSigner struct {
+	key []byte
+}
+
+// newSessionSigner creates a session signer from a server key. Without a key,
+// a random one is used, and sessions don't survive a restart.
+func newSessionSigner(key string) (*sessionSigner, error) {
+	if key != "" {
+		return &sessionSigner{key: []byte(key)}, nil
+	}
+	random := make([]byte, 32)
+	if _, err := rand.Read(random); err != nil {
+		return nil, err
+	}
+	return &sessionSigner{key: random}, nil
+}
+
+func (s *sessionSigner) mac(purpose string, payload []byte) []byte {
+	mac := hmac.New(sha256.New, s.key)
+	mac.Write([]byte(purpose))
+	mac.Write(payload)
+	return mac.Sum(nil)
+}
+
+// issue completes a session with a new access key, returning its secret key
+// and session token
+func (s *sessionSigner) issue(session *Session) (string, string, error) {
+	random := make([]byte, 10)
+	if _, err := rand.Read(random); err != nil {
+		return "", "", err
+	}
+	session.AccessKey = SessionAccessKeyPrefix + base32Encoding.EncodeToString(random)
+	payload, err := json.Marshal(session)
+	if err != nil {
+		return "", "", err
+	}
+	token := base64.RawURLEncoding.EncodeToString(payload) + "." + base64.RawURLEncoding.EncodeToString(s.mac("token", payload))
+	return s.secretKey(payload), token, nil
+}
+
+// verify returns the session of a token, and its secret key
+func (s *sessionSigner) verify(token string, now time.Time) (*Session, string, error) {
+	encodedPayload, encodedMAC, ok := strings.Cut(token, ".")
+	if !ok {
+		return nil, "", ErrInvalidToken
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(encodedPayload)
+	if err != nil {
+		return nil, "", ErrInvalidToken
+	}
+	mac, err := base64.RawURLEncoding.DecodeString(encodedMAC)
+	if err != nil || !hmac.Equal(mac, s.mac("token", payload)) {
+		return nil, "", ErrInvalidToken
+	}
+	session := &Session{}
+	decoder := json.NewDecoder(bytes.NewReader(payload))
+	if err := decoder.Decode(session); err != nil {
+		return nil, "", ErrInvalidToken
+	}
+	if !now.Before(session.Expiration) {
+		return nil, "", ErrExpiredToken
+	}
+	return session, s.secretKey(payload), nil
+}
+
+// secretKey derives the secret key of a session
+func (s *sessionSigner) secretKey(payload []byte) string {
+	return base64.StdEncoding.EncodeToString(s.mac("secret", payload))[:40]
+}
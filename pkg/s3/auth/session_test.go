@@ -0,0 +1,244 @@
+package s3auth
+
+import (
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/jakthom/s3c/pkg/config"
+)
+
+const (
+	testSessionKey = "0123456789abcdef0123456789abcdef"
+	// exampleSessionToken is the token of a session of alice, computed
+	// independently as the HMAC-SHA256 of "token" and its payload keyed by
+	// `testSessionKey`
+	exampleSessionToken = "eyJrIjoiQVNJQUVYQU1QTEVFWEFNUExFMDAiLCJ1IjoiYWxpY2UiLCJzIjoiQUtJQUFMSUNFIiwiZSI6IjIwMzAtMDEtMDFUMDA6MDA6MDBaIn0" +
+		".d1rwz7eVAVow-fvIuPe8IO99BNFTOtDJMyLq1_T5qY0"
+	// exampleSessionSecret is the secret key of the example session, the
+	// HMAC-SHA256 of "secret" and its payload
+	exampleSessionSecret = "UwfrTDJt06+13BNiQlIc/saX8bjRX3KmYXwGqotx"
+)
+
+func TestSessionSignerVerify(t *testing.T) {
+	signer, err := newSessionSigner(testSessionKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Date(2029, 1, 1, 0, 0, 0, 0, time.UTC)
+	session, secretKey, err := signer.verify(exampleSessionToken, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if secretKey != exampleSessionSecret {
+		t.Errorf("secret key = %s, want %s", secretKey, exampleSessionSecret)
+	}
+	want := Session{AccessKey: "ASIAEXAMPLEEXAMPLE00", User: "alice", SourceKey: "AKIAALICE", Expiration: time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)}
+	if *session != want {
+		t.Errorf("session = %+v, want %+v", *session, want)
+	}
+
+	payload, mac, _ := strings.Cut(exampleSessionToken, ".")
+	forged := base64.RawURLEncoding.EncodeToString([]byte(`{"k":"ASIAEXAMPLEEXAMPLE00","u":"admin","s":"AKIAALICE","e":"2030-01-01T00:00:00Z"}`))
+	otherSigner, err := newSessionSigner("another key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name   string
+		signer *sessionSigner
+		token  string
+		now    time.Time
+		err    error
+	}{
+		{"forged payload", signer, forged + "." + mac, now, ErrInvalidToken},
+		{"truncated mac", signer, payload + "." + mac[:20], now, ErrInvalidToken},
+		{"without mac", signer, payload, now, ErrInvalidToken},
+		{"not base64", signer, "!!." + mac, now, ErrInvalidToken},
+		{"signed with another key", otherSigner, exampleSessionToken, now, ErrInvalidToken},
+		{"at its expiration", signer, exampleSessionToken, want.Expiration, ErrExpiredToken},
+		{"after its expiration", signer, exampleSessionToken, want.Expiration.Add(time.Hour), ErrExpiredToken},
+	}
+	for _, tt := range tests {
+		if _, _, err := tt.signer.verify(tt.token, tt.now); err != tt.err {
+			t.Errorf("%s: got %v, want %v", tt.name, err, tt.err)
+		}
+	}
+}
+
+func TestSessionSignerIssue(t *testing.T) {
+	signer, err := newSessionSigner(testSessionKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expiration := time.Now().Add(time.Hour).UTC().Truncate(time.Second)
+	session := &Session{User: "alice", SourceKey: "AKIAALICE", Role: "reader", Name: "job", Policy: `{"Statement":[]}`, Expiration: expiration}
+	secretKey, token, err := signer.issue(session)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Temporary access keys look like AWS' own
+	if !strings.HasPrefix(session.AccessKey, SessionAccessKeyPrefix) || len(session.AccessKey) != 20 {
+		t.Errorf("access key = %s", session.AccessKey)
+	}
+	if len(secretKey) != 40 {
+		t.Errorf("secret key = %s", secretKey)
+	}
+	verified, verifiedSecretKey, err := signer.verify(token, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *verified != *session || verifiedSecretKey != secretKey {
+		t.Errorf("verified %+v with %s, want %+v with %s", *verified, verifiedSecretKey, *session, secretKey)
+	}
+
+	// Every session has its own access and secret key
+	other := &Session{User: "alice", SourceKey: "AKIAALICE", Expiration: expiration}
+	otherSecretKey, _, err := signer.issue(other)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if other.AccessKey == session.AccessKey || otherSecretKey == secretKey {
+		t.Error("sessions share keys")
+	}
+
+	// Without a configured key, sessions are signed with a random one
+	random, err := newSessionSigner("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := random.verify(token, time.Now()); err != ErrInvalidToken {
+		t.Errorf("token verified with a random key: %v", err)
+	}
+}
+
+func newTestCredentialStore(t *testing.T) *CredentialStore {
+	t.Helper()
+	store, err := NewCredentialStore(config.Authentication{
+		SessionKey: testSessionKey,
+		Users: []config.User{
+			{Name: "alice", Keys: []config.AccessKey{{KeyID: "AKIAALICE", Secret: "alice-secret"}, {KeyID: "AKIAALICE2", Secret: "alice-secret-2"}}},
+			{Name: "bob", Keys: []config.AccessKey{{KeyID: "AKIABOB", Secret: "bob-secret"}}},
+		},
+		Roles: []config.Role{
+			{Name: "reader", Policy: `{"Statement": [{"Effect": "Allow", "Action": "s3:Get*", "Resource": "*"}]}`},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return store
+}
+
+func TestCredentialStoreSessions(t *testing.T) {
+	store := newTestCredentialStore(t)
+	issue := func(session *Session) (string, string) {
+		t.Helper()
+		session.Expiration = time.Now().Add(time.Hour)
+		secretKey, token, err := store.IssueSession(session)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return secretKey, token
+	}
+
+	session := &Session{User: "alice", SourceKey: "AKIAALICE", Role: "reader"}
+	secretKey, token := issue(session)
+	if got, err := store.SessionSecretKey(session.AccessKey, token, DefaultRegion); err != nil || got != secretKey {
+		t.Errorf("session secret key = %q, %v", got, err)
+	}
+	user, verified, err := store.SessionUser(token)
+	if err != nil || user.ID != "alice" || verified.Role != "reader" {
+		t.Errorf("session user = %v, %v, %v", user, verified, err)
+	}
+	// Tokens only authenticate their own access key, in the configured
+	// regions
+	if _, err := store.SessionSecretKey("AKIAALICE", token, DefaultRegion); err != ErrInvalidToken {
+		t.Errorf("token of another access key: got %v", err)
+	}
+	if got, err := store.SessionSecretKey(session.AccessKey, token, "eu-west-1"); got != "" || err != nil {
+		t.Errorf("session secret key in another region = %q, %v", got, err)
+	}
+	// Session keys are not long lived keys
+	if got, _ := store.SecretKey(session.AccessKey, DefaultRegion); got != "" {
+		t.Errorf("session access key has a long lived secret key")
+	}
+
+	_, unknownRole := issue(&Session{User: "alice", SourceKey: "AKIAALICE", Role: "writer"})
+	_, foreignKey := issue(&Session{User: "bob", SourceKey: "AKIAALICE"})
+	_, unknownUser := issue(&Session{User: "carol", SourceKey: "AKIAALICE"})
+	for name, token := range map[string]string{"unknown role": unknownRole, "key of another user": foreignKey, "unknown user": unknownUser} {
+		if _, _, err := store.SessionUser(token); err != ErrInvalidToken {
+			t.Errorf("%s: got %v, want %v", name, err, ErrInvalidToken)
+		}
+	}
+
+	// Sessions end with the key they were issued with
+	store.users[0].Keys[0].Disabled = true
+	if err := store.reload(); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := store.SessionUser(token); err != ErrInvalidToken {
+		t.Errorf("session of a disabled key: got %v", err)
+	}
+	_, otherKey := issue(&Session{User: "alice", SourceKey: "AKIAALICE2"})
+	if _, _, err := store.SessionUser(otherKey); err != nil {
+		t.Errorf("session of an enabled key: %v", err)
+	}
+	store.users[0].Disabled = true
+	if err := store.reload(); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := store.SessionUser(otherKey); err != ErrInvalidToken {
+		t.Errorf("session of a disabled user: got %v", err)
+	}
+}
+
+func TestAuthV4Session(t *testing.T) {
+	store := newTestCredentialStore(t)
+	session := &Session{User: "alice", SourceKey: "AKIAALICE", Expiration: time.Now().Add(time.Hour)}
+	secretKey, token, err := store.IssueSession(session)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sign := func(token string) *http.Request {
+		req, err := http.NewRequest(http.MethodGet, "http://"+exampleHost+"/bucket/key", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("x-amz-content-sha256", emptyPayloadHash)
+		req.Header.Set("x-amz-security-token", token)
+		SignV4(req, session.AccessKey, secretKey, DefaultRegion, time.Now())
+		r := httptest.NewRequest(req.Method, req.URL.String(), nil)
+		r.Header = req.Header
+		return mux.SetURLVars(r, map[string]string{})
+	}
+
+	r := sign(token)
+	if err := AuthV4(httptest.NewRecorder(), r, store, r.Header.Get("Authorization")); err != nil {
+		t.Fatalf("request signed with session credentials was rejected: %v", err)
+	}
+	if got := mux.Vars(r)["authSessionToken"]; got != token {
+		t.Errorf("session token var = %q", got)
+	}
+
+	r = sign(token[:len(token)-2])
+	if err := AuthV4(httptest.NewRecorder(), r, store, r.Header.Get("Authorization")); errorCode(err) != "InvalidToken" {
+		t.Errorf("forged token: got %q, want InvalidToken", errorCode(err))
+	}
+
+	expired := &Session{User: "alice", SourceKey: "AKIAALICE", Expiration: time.Now().Add(-time.Second)}
+	expiredSecretKey, expiredToken, err := store.IssueSession(expired)
+	if err != nil {
+		t.Fatal(err)
+	}
+	session.AccessKey, secretKey = expired.AccessKey, expiredSecretKey
+	r = sign(expiredToken)
+	if err := AuthV4(httptest.NewRecorder(), r, store, r.Header.Get("Authorization")); errorCode(err) != "ExpiredToken" {
+		t.Errorf("expired token: got %q, want ExpiredToken", errorCode(err))
+	}
+}
@@ -0,0 +1,103 @@
+package s3auth
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	s3util "github.com/jakthom/s3c/pkg/s3/util"
+)
+
+// UnsignedPayload is the `x-amz-content-sha256` value used when the request
+// body is not part of the signature
+const UnsignedPayload string = "UNSIGNED-PAYLOAD"
+
+// SignV4 signs an outgoing request using AWS' auth V4, setting the
+// `Authorization` and `x-amz-date` headers. If the request does not set
+// `x-amz-content-sha256`, the payload is left unsigned.
+func SignV4(req *http.Request, accessKey, secretKey, region string, now time.Time) {
+	timestamp := s3util.FormatAWSTimestamp(now.UTC())
+	date := timestamp[:8]
+	req.Header.Set("x-amz-date", timestamp)
+	if req.Header.Get("x-amz-content-sha256") == "" {
+		req.Header.Set("x-amz-content-sha256", UnsignedPayload)
+	}
+
+	// step 1: build the canonical request
+	signedHeaderKeys := []string{"host"}
+	for key := range req.Header {
+		lowerKey := strings.ToLower(key)
+		if strings.HasPrefix(lowerKey, "x-amz-") || lowerKey == "content-type" || lowerKey == "content-md5" {
+			signedHeaderKeys = append(signedHeaderKeys, lowerKey)
+		}
+	}
+	sort.Strings(signedHeaderKeys)
+	var signedHeaders strings.Builder
+	for _, key := range signedHeaderKeys {
+		signedHeaders.WriteString(key)
+		signedHeaders.WriteString(":")
+		if key == "host" {
+			signedHeaders.WriteString(req.URL.Host)
+		} else {
+			signedHeaders.WriteString(strings.TrimSpace(req.Header.Get(key)))
+		}
+		signedHeaders.WriteString("\n")
+	}
+	req.URL.RawPath = s3util.NormURI(req.URL.Path)
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.RawPath,
+		s3util.NormQuery(req.URL.Query()),
+		signedHeaders.String(),
+		strings.Join(signedHeaderKeys, ";"),
+		req.Header.Get("x-amz-content-sha256"),
+	}, "\n")
+
+	// step 2: construct the string to sign
+	stringToSign := stringToSignV4(timestamp, date, region, "s3", canonicalRequest)
+
+	// step 3: calculate the signature
+	signature := s3util.HmacSHA256(signingKeyV4(secretKey, date, region, "s3"), stringToSign)
+
+	req.Header.Set("Authorization", fmt.Sprintf(
+		"AWS4-HMAC-SHA256 Credential=%s/%s/%s/s3/aws4_request, SignedHeaders=%s, Signature=%x",
+		accessKey,
+		date,
+		region,
+		strings.Join(signedHeaderKeys, ";"),
+		signature,
+	))
+}
+
+// PresignV4 presigns an outgoing request using AWS' auth V4 query
+// parameters, so its url can be used without credentials until it expires.
+// Only the host header and the url are signed, and the payload is left
+// unsigned.
+func PresignV4(req *http.Request, accessKey, secretKey, region string, now time.Time, expires time.Duration) {
+	timestamp := s3util.FormatAWSTimestamp(now.UTC())
+	date := timestamp[:8]
+	query := req.URL.Query()
+	query.Set("X-Amz-Algorithm", "AWS4-HMAC-SHA256")
+	query.Set("X-Amz-Credential", fmt.Sprintf("%s/%s/%s/s3/aws4_request", accessKey, date, region))
+	query.Set("X-Amz-Date", timestamp)
+	query.Set("X-Amz-Expires", strconv.Itoa(int(expires.Seconds())))
+	query.Set("X-Amz-SignedHeaders", "host")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		s3util.NormURI(req.URL.Path),
+		s3util.NormQuery(query),
+		"host:" + req.URL.Host + "\n",
+		"host",
+		UnsignedPayload,
+	}, "\n")
+	stringToSign := stringToSignV4(timestamp, date, region, "s3", canonicalRequest)
+	signature := s3util.HmacSHA256(signingKeyV4(secretKey, date, region, "s3"), stringToSign)
+
+	query.Set("X-Amz-Signature", fmt.Sprintf("%x", signature))
+	req.URL.RawPath = s3util.NormURI(req.URL.Path)
+	req.URL.RawQuery = s3util.NormQuery(query)
+}
@@ -0,0 +1,333 @@
+package s3auth
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/jakthom/s3c/pkg/config"
+	s3policy "github.com/jakthom/s3c/pkg/s3/policy"
+	s3user "github.com/jakthom/s3c/pkg/s3/user"
+	"github.com/rs/zerolog/log"
+)
+
+// credential is an access key, and the user it belongs to
+type credential struct {
+	secret   string
+	disabled bool
+	expires  time.Time
+	user     *s3user.User
+}
+
+// usable returns whether the credential may be used to authenticate at the
+// given time
+func (c *credential) usable(now time.Time) bool {
+	return !c.disabled && (c.expires.IsZero() || now.Before(c.expires))
+}
+
+// account is what the store knows of a user beyond their credentials
+type account struct {
+	user     *s3user.User
+	disabled bool
+	admin    bool
+	policy   *s3policy.Policy
+}
+
+// role is a role users may assume
+type role struct {
+	policy      *s3policy.Policy
+	maxDuration time.Duration
+}
+
+// CredentialStore is an AuthController backed by the users in s3c's
+// configuration and an optional credentials file, which is reloaded whenever
+// it changes.
+type CredentialStore struct {
+	regions         map[string]bool
+	users           []config.User
+	credentialsFile string
+	roles           map[string]*role
+	sessions        *sessionSigner
+
+	mu          sync.RWMutex
+	credentials map[string]*credential
+	accounts    map[string]*account
+	fileModTime time.Time
+}
+
+// NewCredentialStore creates a credential store from s3c's authentication
+// configuration
+func NewCredentialStore(conf config.Authentication) (*CredentialStore, error) {
+	s := &CredentialStore{
+		regions:         map[string]bool{},
+		users:           conf.Users,
+		credentialsFile: conf.CredentialsFile,
+	}
+	for _, region := range Regions(conf) {
+		s.regions[region] = true
+	}
+	var err error
+	if s.roles, err = buildRoles(conf.Roles); err != nil {
+		return nil, err
+	}
+	if s.sessions, err = newSessionSigner(conf.SessionKey); err != nil {
+		return nil, err
+	}
+	if conf.KeyID != "" {
+		// The single key of older configurations belongs to an administrator
+		// named after the key
+		s.users = append([]config.User{{
+			Name:  conf.KeyID,
+			Admin: true,
+			Keys:  []config.AccessKey{{KeyID: conf.KeyID, Secret: conf.Secret}},
+		}}, s.users...)
+	}
+	if err := s.reload(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Regions returns the regions requests may be signed for, the first of which
+// is the region s3c signs requests for itself
+func Regions(conf config.Authentication) []string {
+	if len(conf.Regions) == 0 {
+		return []string{DefaultRegion}
+	}
+	return conf.Regions
+}
+
+func (s *CredentialStore) SecretKey(accessKey string, region string) (string, error) {
+	// Auth V2 requests are not scoped to a region
+	if region != "" && !s.regions[region] {
+		return "", nil
+	}
+	c, err := s.credential(accessKey)
+	if err != nil || c == nil || !c.usable(time.Now()) {
+		return "", err
+	}
+	return c.secret, nil
+}
+
+func (s *CredentialStore) User(accessKey string) (*s3user.User, error) {
+	c, err := s.credential(accessKey)
+	if err != nil || c == nil {
+		return nil, err
+	}
+	return c.user, nil
+}
+
+func (s *CredentialStore) SessionSecretKey(accessKey, sessionToken, region string) (string, error) {
+	if region != "" && !s.regions[region] {
+		return "", nil
+	}
+	_, session, secretKey, err := s.session(sessionToken)
+	if err != nil {
+		return "", err
+	}
+	if session.AccessKey != accessKey {
+		return "", ErrInvalidToken
+	}
+	return secretKey, nil
+}
+
+func (s *CredentialStore) SessionUser(sessionToken string) (*s3user.User, *Session, error) {
+	user, session, _, err := s.session(sessionToken)
+	return user, session, err
+}
+
+// session verifies a session token, and that the user, access key and role
+// of its session may still be used
+func (s *CredentialStore) session(sessionToken string) (*s3user.User, *Session, string, error) {
+	now := time.Now()
+	session, secretKey, err := s.sessions.verify(sessionToken, now)
+	if err != nil {
+		return nil, nil, "", err
+	}
+	if session.Role != "" && s.roles[session.Role] == nil {
+		return nil, nil, "", ErrInvalidToken
+	}
+	// The user, or the key the session was issued with, may have been
+	// disabled or expired since
+	if err := s.reloadIfChanged(); err != nil {
+		return nil, nil, "", err
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	a, ok := s.accounts[session.User]
+	if !ok || a.disabled {
+		return nil, nil, "", ErrInvalidToken
+	}
+	c, ok := s.credentials[session.SourceKey]
+	if !ok || c.user != a.user || !c.usable(now) {
+		return nil, nil, "", ErrInvalidToken
+	}
+	return a.user, session, secretKey, nil
+}
+
+// IssueSession issues temporary credentials for a session, returning its
+// secret key and session token
+func (s *CredentialStore) IssueSession(session *Session) (string, string, error) {
+	return s.sessions.issue(session)
+}
+
+// RoleMaxDuration returns the maximum session duration of a role, and whether
+// the role exists
+func (s *CredentialStore) RoleMaxDuration(name string) (time.Duration, bool) {
+	r, ok := s.roles[name]
+	if !ok {
+		return 0, false
+	}
+	return r.maxDuration, true
+}
+
+func (s *CredentialStore) RolePolicy(name string) *s3policy.Policy {
+	if r, ok := s.roles[name]; ok {
+		return r.policy
+	}
+	return nil
+}
+
+func (s *CredentialStore) UserPolicy(user string) (bool, *s3policy.Policy) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	a, ok := s.accounts[user]
+	if !ok {
+		return false, nil
+	}
+	return a.admin, a.policy
+}
+
+// credential returns the credential of an access key, reloading the
+// credentials file first if it has changed
+func (s *CredentialStore) credential(accessKey string) (*credential, error) {
+	if err := s.reloadIfChanged(); err != nil {
+		return nil, err
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.credentials[accessKey], nil
+}
+
+// reloadIfChanged reloads the credentials file if it has changed since it
+// was last loaded
+func (s *CredentialStore) reloadIfChanged() error {
+	if s.credentialsFile == "" {
+		return nil
+	}
+	info, err := os.Stat(s.credentialsFile)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to read credentials file: " + s.credentialsFile)
+		return err
+	}
+	s.mu.RLock()
+	changed := !info.ModTime().Equal(s.fileModTime)
+	s.mu.RUnlock()
+	if changed {
+		if err := s.reload(); err != nil {
+			// Keep authenticating with the last valid credentials
+			log.Error().Err(err).Msg("Failed to reload credentials file: " + s.credentialsFile)
+		}
+	}
+	return nil
+}
+
+// reload rebuilds the credentials of the store from the configured users and
+// the credentials file
+func (s *CredentialStore) reload() error {
+	users := s.users
+	var modTime time.Time
+	if s.credentialsFile != "" {
+		info, err := os.Stat(s.credentialsFile)
+		if err != nil {
+			return err
+		}
+		modTime = info.ModTime()
+		fileUsers, err := config.ReadCredentialsFile(s.credentialsFile)
+		if err != nil {
+			return err
+		}
+		users = append(append([]config.User{}, users...), fileUsers...)
+	}
+	credentials, accounts, err := buildCredentials(users)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.credentials = credentials
+	s.accounts = accounts
+	s.fileModTime = modTime
+	return nil
+}
+
+// buildCredentials indexes the access keys of users by their id, and the
+// accounts of users by their name
+func buildCredentials(users []config.User) (map[string]*credential, map[string]*account, error) {
+	credentials := map[string]*credential{}
+	accounts := map[string]*account{}
+	for _, u := range users {
+		if u.Name == "" {
+			return nil, nil, errors.New("users must have a name")
+		}
+		if _, ok := accounts[u.Name]; ok {
+			return nil, nil, errors.New("duplicate user: " + u.Name)
+		}
+		user := &s3user.User{ID: u.Name, DisplayName: u.DisplayName}
+		if user.DisplayName == "" {
+			user.DisplayName = u.Name
+		}
+		a := &account{user: user, disabled: u.Disabled, admin: u.Admin}
+		if u.Policy != "" {
+			policy, err := s3policy.Parse([]byte(u.Policy), false)
+			if err != nil {
+				return nil, nil, fmt.Errorf("invalid policy of user %s: %w", u.Name, err)
+			}
+			a.policy = policy
+		}
+		accounts[u.Name] = a
+		for _, key := range u.Keys {
+			if key.KeyID == "" || key.Secret == "" {
+				return nil, nil, errors.New("access keys of user " + u.Name + " must have a key id and secret")
+			}
+			if _, ok := credentials[key.KeyID]; ok {
+				return nil, nil, errors.New("duplicate access key: " + key.KeyID)
+			}
+			credentials[key.KeyID] = &credential{
+				secret:   key.Secret,
+				disabled: u.Disabled || key.Disabled,
+				expires:  key.Expires,
+				user:     user,
+			}
+		}
+	}
+	return credentials, accounts, nil
+}
+
+// buildRoles parses the configured roles by their name
+func buildRoles(roles []config.Role) (map[string]*role, error) {
+	built := map[string]*role{}
+	for _, r := range roles {
+		if r.Name == "" {
+			return nil, errors.New("roles must have a name")
+		}
+		if _, ok := built[r.Name]; ok {
+			return nil, errors.New("duplicate role: " + r.Name)
+		}
+		policy, err := s3policy.Parse([]byte(r.Policy), false)
+		if err != nil {
+			return nil, fmt.Errorf("invalid policy of role %s: %w", r.Name, err)
+		}
+		maxDuration := r.MaxDuration
+		if maxDuration == 0 {
+			maxDuration = DefaultRoleDuration
+		}
+		if maxDuration < MinSessionDuration || maxDuration > MaxRoleDuration {
+			return nil, errors.New("the max duration of role " + r.Name + " must be between 15m and 12h")
+		}
+		built[r.Name] = &role{policy: policy, maxDuration: maxDuration}
+	}
+	return built, nil
+}
@@ -0,0 +1,162 @@
+package s3auth
+
+import (
+	"crypto/hmac"
+	"encoding/base64"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	s3error "github.com/jakthom/s3c/pkg/s3/error"
+	s3util "github.com/jakthom/s3c/pkg/s3/util"
+)
+
+// subresourcesV2 are the query parameters that are part of the canonical
+// resource of an auth V2 signature
+var subresourcesV2 = map[string]bool{
+	"acl": true, "cors": true, "delete": true, "lifecycle": true, "location": true,
+	"logging": true, "notification": true, "partNumber": true, "policy": true,
+	"requestPayment": true, "restore": true, "tagging": true, "torrent": true,
+	"uploadId": true, "uploads": true, "versionId": true, "versioning": true,
+	"versions": true, "website": true,
+	"response-cache-control": true, "response-content-disposition": true,
+	"response-content-encoding": true, "response-content-language": true,
+	"response-content-type": true, "response-expires": true,
+}
+
+// AuthV2 authenticates a request signed with AWS' legacy auth V2, which
+// carries the signature in an `Authorization: AWS <key>:<signature>` header
+func AuthV2(w http.ResponseWriter, r *http.Request, authController AuthController, authorizationHeader string) error {
+	accessKey, expectedSignature, ok := strings.Cut(strings.TrimPrefix(authorizationHeader, "AWS "), ":")
+	if !ok || accessKey == "" || expectedSignature == "" {
+		return s3error.AuthorizationHeaderMalformedError(r)
+	}
+	// Auth V2 is not scoped to a region
+	secretKey, err := authController.SecretKey(accessKey, "")
+	if secretKey == "" {
+		return s3error.InvalidAccessKeyIDError(r)
+	}
+	if err != nil {
+		return s3error.InternalError(r, err)
+	}
+	if _, err := s3util.ParseAWSTimestamp(r); err != nil {
+		return err
+	}
+
+	// The date is signed as an amz header instead if `x-amz-date` is set
+	date := r.Header.Get("Date")
+	if r.Header.Get("x-amz-date") != "" {
+		date = ""
+	}
+	if !verifyV2(secretKey, stringToSignV2(r, date), expectedSignature) {
+		return s3error.SignatureDoesNotMatchError(r)
+	}
+
+	vars := mux.Vars(r)
+	vars["authMethod"] = "v2"
+	vars["authAccessKey"] = accessKey
+	return nil
+}
+
+// AuthV2Query authenticates a request presigned with AWS' legacy auth V2,
+// which carries the signature in the `Signature` query parameter
+func AuthV2Query(w http.ResponseWriter, r *http.Request, authController AuthController) error {
+	query := r.URL.Query()
+	accessKey := query.Get("AWSAccessKeyId")
+	expectedSignature := query.Get("Signature")
+	expires := query.Get("Expires")
+	if accessKey == "" || expectedSignature == "" || expires == "" {
+		return s3error.AuthorizationQueryParametersError(r)
+	}
+	// The expiry of auth V2 presigned requests is absolute, in epoch seconds
+	expiresAt, err := strconv.ParseInt(expires, 10, 64)
+	if err != nil {
+		return s3error.AuthorizationQueryParametersError(r)
+	}
+	if timeNow().After(time.Unix(expiresAt, 0)) {
+		return s3error.ExpiredPresignedRequestError(r)
+	}
+
+	secretKey, err := authController.SecretKey(accessKey, "")
+	if secretKey == "" {
+		return s3error.InvalidAccessKeyIDError(r)
+	}
+	if err != nil {
+		return s3error.InternalError(r, err)
+	}
+
+	if !verifyV2(secretKey, stringToSignV2(r, expires), expectedSignature) {
+		return s3error.SignatureDoesNotMatchError(r)
+	}
+
+	vars := mux.Vars(r)
+	vars["authMethod"] = "v2-query"
+	vars["authAccessKey"] = accessKey
+	return nil
+}
+
+// verifyV2 checks an auth V2 signature of a string to sign
+func verifyV2(secretKey, stringToSign, expectedSignature string) bool {
+	signature := s3util.HmacSHA1([]byte(secretKey), stringToSign)
+	expected, err := base64.StdEncoding.DecodeString(expectedSignature)
+	if err != nil {
+		return false
+	}
+	return hmac.Equal(signature, expected)
+}
+
+// stringToSignV2 builds the auth V2 string to sign of a request, signed at
+// the given date or expiry
+func stringToSignV2(r *http.Request, date string) string {
+	var b strings.Builder
+	b.WriteString(r.Method + "\n")
+	b.WriteString(r.Header.Get("Content-Md5") + "\n")
+	b.WriteString(r.Header.Get("Content-Type") + "\n")
+	b.WriteString(date + "\n")
+
+	// step 1: canonicalize the amz headers
+	amzHeaders := map[string][]string{}
+	var amzHeaderKeys []string
+	for key, values := range r.Header {
+		lowerKey := strings.ToLower(key)
+		if !strings.HasPrefix(lowerKey, "x-amz-") {
+			continue
+		}
+		if _, ok := amzHeaders[lowerKey]; !ok {
+			amzHeaderKeys = append(amzHeaderKeys, lowerKey)
+		}
+		for _, value := range values {
+			amzHeaders[lowerKey] = append(amzHeaders[lowerKey], strings.TrimSpace(value))
+		}
+	}
+	sort.Strings(amzHeaderKeys)
+	for _, key := range amzHeaderKeys {
+		b.WriteString(key + ":" + strings.Join(amzHeaders[key], ",") + "\n")
+	}
+
+	// step 2: canonicalize the resource, which is the path and subresources
+	b.WriteString(r.URL.EscapedPath())
+	query := r.URL.Query()
+	var subresources []string
+	for key := range query {
+		if subresourcesV2[key] {
+			subresources = append(subresources, key)
+		}
+	}
+	sort.Strings(subresources)
+	for i, key := range subresources {
+		if i == 0 {
+			b.WriteString("?")
+		} else {
+			b.WriteString("&")
+		}
+		b.WriteString(key)
+		if value := query.Get(key); value != "" {
+			b.WriteString("=" + value)
+		}
+	}
+	return b.String()
+}
@@ -1,19 +1,42 @@
 package s3auth
 
 import (
+	"bytes"
 	"crypto/sha256"
+	"errors"
 	"fmt"
+	"io"
 	"net/http"
+	"net/url"
 	"regexp"
 	"sort"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/gorilla/mux"
 	s3error "github.com/jakthom/s3c/pkg/s3/error"
 	s3util "github.com/jakthom/s3c/pkg/s3/util"
 )
 
-var authV4HeaderValidator = regexp.MustCompile(`^AWS4-HMAC-SHA256 Credential=([^/]*)/([^/]*)/([^/]*)/s3/aws4_request, ?SignedHeaders=([^,]+), ?Signature=(.+)$`)
+const (
+	// awsTimeFormat specifies the time format of auth V4 timestamps
+	awsTimeFormat = "20060102T150405Z"
+	// MaxPresignExpiry specifies the maximum lifetime of a presigned request
+	// in seconds, which is seven days
+	MaxPresignExpiry = 7 * 24 * 60 * 60
+	// presignSkewTime specifies how far in the future the timestamp of a
+	// presigned request may be
+	presignSkewTime = 15 * time.Minute
+	// maxHashedPayloadSize specifies the maximum size of a payload whose hash
+	// is computed by s3c because the client didn't send it
+	maxHashedPayloadSize = 1 << 20
+)
+
+// timeNow returns the current time, against which presigned requests expire
+var timeNow = time.Now
+
+var authV4HeaderValidator = regexp.MustCompile(`^AWS4-HMAC-SHA256 Credential=([^/]*)/([^/]*)/([^/]*)/(s3|sts)/aws4_request, ?SignedHeaders=([^,]+), ?Signature=(.+)$`)
 
 func AuthV4(w http.ResponseWriter, r *http.Request, authController AuthController, authorizationHeader string) error {
 	// Ensure the Authorization header is well-formed
@@ -26,60 +49,36 @@ func AuthV4(w http.ResponseWriter, r *http.Request, authController AuthControlle
 	accessKey := match[1]
 	date := match[2]
 	region := match[3]
-	signedHeaderKeys := strings.Split(match[4], ";")
+	service := match[4]
+	signedHeaderKeys := strings.Split(match[5], ";")
 	sort.Strings(signedHeaderKeys)
-	expectedSignature := match[5]
+	expectedSignature := match[6]
 	// Get the expected secret key
-	secretKey, err := authController.SecretKey(accessKey, region)
-	// Short-circuit if the secret key is not found
-	// or if there is an error
-	if secretKey == "" {
-		return s3error.InvalidAccessKeyIDError(r)
-	}
+	secretKey, err := secretKeyV4(r, authController, accessKey, region, r.Header.Get("x-amz-security-token"))
 	if err != nil {
-		return s3error.InternalError(r, err)
-	}
-	// Build the canonical request
-	var signedHeaders strings.Builder
-	for _, key := range signedHeaderKeys {
-		signedHeaders.WriteString(key)
-		signedHeaders.WriteString(":")
-		if key == "host" {
-			signedHeaders.WriteString(r.Host)
-		} else {
-			signedHeaders.WriteString(strings.TrimSpace(r.Header.Get(key)))
-		}
-		signedHeaders.WriteString("\n")
+		return err
 	}
-	canonicalRequest := strings.Join([]string{
-		r.Method,
-		s3util.NormURI(r.URL.Path),
-		s3util.NormQuery(r.URL.Query()),
-		signedHeaders.String(),
-		strings.Join(signedHeaderKeys, ";"),
-		r.Header.Get("x-amz-content-sha256"),
-	}, "\n")
-
 	timestamp, err := s3util.ParseAWSTimestamp(r)
 	if err != nil {
 		return err
 	}
 	formattedTimestamp := s3util.FormatAWSTimestamp(timestamp)
 
-	// step 2: construct the string to sign
-	stringToSign := fmt.Sprintf(
-		"AWS4-HMAC-SHA256\n%s\n%s/%s/s3/aws4_request\n%x",
-		formattedTimestamp,
-		date,
-		region,
-		sha256.Sum256([]byte(canonicalRequest)),
-	)
+	// step 1 & 2: build the canonical request and construct the string to
+	// sign
+	payloadHash := r.Header.Get("x-amz-content-sha256")
+	if payloadHash == "" && service == "sts" {
+		// Unlike s3, sts clients don't send the hash of the payload they
+		// signed
+		if payloadHash, err = hashPayloadV4(r); err != nil {
+			return s3error.EntityTooLargeError(r)
+		}
+	}
+	canonicalRequest := canonicalRequestV4(r, signedHeaderKeys, r.URL.Query(), payloadHash)
+	stringToSign := stringToSignV4(formattedTimestamp, date, region, service, canonicalRequest)
 
 	// step 3: calculate the signing key
-	dateKey := s3util.HmacSHA256([]byte("AWS4"+secretKey), date)
-	dateRegionKey := s3util.HmacSHA256(dateKey, region)
-	dateRegionServiceKey := s3util.HmacSHA256(dateRegionKey, "s3")
-	signingKey := s3util.HmacSHA256(dateRegionServiceKey, "aws4_request")
+	signingKey := signingKeyV4(secretKey, date, region, service)
 
 	// step 4: construct & verify the signature
 	signature := s3util.HmacSHA256(signingKey, stringToSign)
@@ -92,6 +91,8 @@ func AuthV4(w http.ResponseWriter, r *http.Request, authController AuthControlle
 	vars["authMethod"] = "v4"
 	vars["authAccessKey"] = accessKey
 	vars["authRegion"] = region
+	vars["authService"] = service
+	vars["authSessionToken"] = r.Header.Get("x-amz-security-token")
 	// store signature data as vars, since it may be reused for verifying chunked uploads
 	vars["authSignature"] = expectedSignature
 	vars["authSignatureKey"] = string(signingKey)
@@ -100,3 +101,169 @@ func AuthV4(w http.ResponseWriter, r *http.Request, authController AuthControlle
 	vars["authSignatureRegion"] = region
 	return nil
 }
+
+// hashPayloadV4 returns the hex SHA256 hash of a request's body, leaving the
+// body readable by handlers
+func hashPayloadV4(r *http.Request) (string, error) {
+	if r.Body == nil {
+		return fmt.Sprintf("%x", sha256.Sum256(nil)), nil
+	}
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxHashedPayloadSize+1))
+	if err != nil {
+		return "", err
+	}
+	if len(body) > maxHashedPayloadSize {
+		return "", errors.New("payload too large")
+	}
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	return fmt.Sprintf("%x", sha256.Sum256(body)), nil
+}
+
+// AuthV4Query authenticates a presigned request, which carries its auth V4
+// signature in the query string rather than the Authorization header
+func AuthV4Query(w http.ResponseWriter, r *http.Request, authController AuthController) error {
+	query := r.URL.Query()
+	if query.Get("X-Amz-Algorithm") != "AWS4-HMAC-SHA256" {
+		return s3error.AuthorizationQueryParametersError(r)
+	}
+	credential := strings.Split(query.Get("X-Amz-Credential"), "/")
+	if len(credential) != 5 || credential[3] != "s3" || credential[4] != "aws4_request" {
+		return s3error.AuthorizationQueryParametersError(r)
+	}
+	accessKey := credential[0]
+	date := credential[1]
+	region := credential[2]
+	signedHeaderKeys := strings.Split(query.Get("X-Amz-SignedHeaders"), ";")
+	sort.Strings(signedHeaderKeys)
+	expectedSignature := query.Get("X-Amz-Signature")
+	if expectedSignature == "" || query.Get("X-Amz-SignedHeaders") == "" {
+		return s3error.AuthorizationQueryParametersError(r)
+	}
+
+	// Presigned requests are valid from their timestamp until they expire
+	timestamp, err := time.Parse(awsTimeFormat, query.Get("X-Amz-Date"))
+	if err != nil || !strings.HasPrefix(query.Get("X-Amz-Date"), date) {
+		return s3error.AuthorizationQueryParametersError(r)
+	}
+	expires, err := strconv.Atoi(query.Get("X-Amz-Expires"))
+	if err != nil || expires < 1 || expires > MaxPresignExpiry {
+		return s3error.AuthorizationQueryParametersError(r)
+	}
+	now := timeNow()
+	if timestamp.After(now.Add(presignSkewTime)) {
+		return s3error.AccessDeniedError(r)
+	}
+	if now.After(timestamp.Add(time.Duration(expires) * time.Second)) {
+		return s3error.ExpiredPresignedRequestError(r)
+	}
+
+	secretKey, err := secretKeyV4(r, authController, accessKey, region, query.Get("X-Amz-Security-Token"))
+	if err != nil {
+		return err
+	}
+
+	// The signature covers every query parameter but itself
+	query.Del("X-Amz-Signature")
+	payloadHash := query.Get("X-Amz-Content-Sha256")
+	if payloadHash == "" {
+		payloadHash = UnsignedPayload
+	}
+	formattedTimestamp := s3util.FormatAWSTimestamp(timestamp)
+	canonicalRequest := canonicalRequestV4(r, signedHeaderKeys, query, payloadHash)
+	stringToSign := stringToSignV4(formattedTimestamp, date, region, "s3", canonicalRequest)
+	signingKey := signingKeyV4(secretKey, date, region, "s3")
+	signature := s3util.HmacSHA256(signingKey, stringToSign)
+	if expectedSignature != fmt.Sprintf("%x", signature) {
+		return s3error.SignatureDoesNotMatchError(r)
+	}
+
+	vars := mux.Vars(r)
+	vars["authMethod"] = "v4-query"
+	vars["authAccessKey"] = accessKey
+	vars["authRegion"] = region
+	vars["authService"] = "s3"
+	vars["authSessionToken"] = query.Get("X-Amz-Security-Token")
+	return nil
+}
+
+// secretKeyV4 returns the secret key of an access key, which is either long
+// lived, or temporary if the request carries a session token
+func secretKeyV4(r *http.Request, authController AuthController, accessKey, region, sessionToken string) (string, error) {
+	var secretKey string
+	var err error
+	if sessionToken != "" {
+		secretKey, err = authController.SessionSecretKey(accessKey, sessionToken, region)
+		switch err {
+		case ErrExpiredToken:
+			return "", s3error.ExpiredTokenError(r)
+		case ErrInvalidToken:
+			return "", s3error.InvalidTokenError(r)
+		}
+	} else {
+		secretKey, err = authController.SecretKey(accessKey, region)
+	}
+	// Short-circuit if the secret key is not found
+	// or if there is an error
+	if err != nil {
+		return "", s3error.InternalError(r, err)
+	}
+	if secretKey == "" {
+		return "", s3error.InvalidAccessKeyIDError(r)
+	}
+	return secretKey, nil
+}
+
+// canonicalHeaderValue returns the canonical value of a signed header: its
+// values trimmed of surrounding and repeated spaces, and comma separated
+func canonicalHeaderValue(values []string) string {
+	trimmed := make([]string, len(values))
+	for i, value := range values {
+		trimmed[i] = strings.Join(strings.Fields(value), " ")
+	}
+	return strings.Join(trimmed, ",")
+}
+
+// canonicalRequestV4 builds the auth V4 canonical request of a request
+func canonicalRequestV4(r *http.Request, signedHeaderKeys []string, query url.Values, payloadHash string) string {
+	var signedHeaders strings.Builder
+	for _, key := range signedHeaderKeys {
+		signedHeaders.WriteString(key)
+		signedHeaders.WriteString(":")
+		if key == "host" {
+			signedHeaders.WriteString(r.Host)
+		} else {
+			signedHeaders.WriteString(canonicalHeaderValue(r.Header.Values(key)))
+		}
+		signedHeaders.WriteString("\n")
+	}
+	return strings.Join([]string{
+		r.Method,
+		s3util.NormURI(r.URL.Path),
+		s3util.NormQuery(query),
+		signedHeaders.String(),
+		strings.Join(signedHeaderKeys, ";"),
+		payloadHash,
+	}, "\n")
+}
+
+// stringToSignV4 constructs the auth V4 string to sign of a canonical
+// request
+func stringToSignV4(timestamp, date, region, service, canonicalRequest string) string {
+	return fmt.Sprintf(
+		"AWS4-HMAC-SHA256\n%s\n%s/%s/%s/aws4_request\n%x",
+		timestamp,
+		date,
+		region,
+		service,
+		sha256.Sum256([]byte(canonicalRequest)),
+	)
+}
+
+// signingKeyV4 derives the auth V4 signing key for a secret key, date,
+// region and service
+func signingKeyV4(secretKey, date, region, service string) []byte {
+	dateKey := s3util.HmacSHA256([]byte("AWS4"+secretKey), date)
+	dateRegionKey := s3util.HmacSHA256(dateKey, region)
+	dateRegionServiceKey := s3util.HmacSHA256(dateRegionKey, service)
+	return s3util.HmacSHA256(dateRegionServiceKey, "aws4_request")
+}
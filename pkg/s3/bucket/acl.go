@@ -0,0 +1,150 @@
+package s3bucket
+
+import (
+	"encoding/xml"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	s3auth "github.com/jakthom/s3c/pkg/s3/auth"
+	s3error "github.com/jakthom/s3c/pkg/s3/error"
+	s3policy "github.com/jakthom/s3c/pkg/s3/policy"
+	s3user "github.com/jakthom/s3c/pkg/s3/user"
+	s3util "github.com/jakthom/s3c/pkg/s3/util"
+)
+
+const (
+	// allUsersURI is the URI of the group of everyone, including anonymous
+	// users
+	allUsersURI string = "http://acs.amazonaws.com/groups/global/AllUsers"
+	// xsiNamespace is the namespace of the type attribute of grantees
+	xsiNamespace string = "http://www.w3.org/2001/XMLSchema-instance"
+)
+
+// Grantee is the user or group of a grant
+type Grantee struct {
+	XMLNSXsi    string `xml:"xmlns:xsi,attr,omitempty"`
+	Type        string `xml:"xsi:type,attr,omitempty"`
+	ID          string `xml:"ID,omitempty"`
+	DisplayName string `xml:"DisplayName,omitempty"`
+	URI         string `xml:"URI,omitempty"`
+}
+
+// Grant is a permission granted to a grantee
+type Grant struct {
+	Grantee    Grantee `xml:"Grantee"`
+	Permission string  `xml:"Permission"`
+}
+
+// AccessControlPolicy is the ACL of a bucket
+type AccessControlPolicy struct {
+	XMLName xml.Name     `xml:"http://s3.amazonaws.com/doc/2006-03-01/ AccessControlPolicy"`
+	Owner   *s3user.User `xml:"Owner"`
+	Grants  []Grant      `xml:"AccessControlList>Grant"`
+}
+
+func (h *BucketHandler) ACL(w http.ResponseWriter, r *http.Request) {
+	bucket := mux.Vars(r)["bucket"]
+	if err := h.requirePolicies(r, bucket); err != nil {
+		s3util.WriteError(w, r, err)
+		return
+	}
+
+	acl, err := h.Policies.GetBucketACL(r, bucket)
+	if err != nil {
+		s3util.WriteError(w, r, err)
+		return
+	}
+
+	owner := s3auth.RequestUser(r)
+	result := AccessControlPolicy{Owner: owner}
+	if owner != nil {
+		result.Grants = append(result.Grants, Grant{
+			Grantee:    Grantee{XMLNSXsi: xsiNamespace, Type: "CanonicalUser", ID: owner.ID, DisplayName: owner.DisplayName},
+			Permission: "FULL_CONTROL",
+		})
+	}
+	for _, permission := range aclPermissions(acl) {
+		result.Grants = append(result.Grants, Grant{
+			Grantee:    Grantee{XMLNSXsi: xsiNamespace, Type: "Group", URI: allUsersURI},
+			Permission: permission,
+		})
+	}
+
+	s3util.WriteXML(w, r, http.StatusOK, result)
+}
+
+func (h *BucketHandler) SetACL(w http.ResponseWriter, r *http.Request) {
+	bucket := mux.Vars(r)["bucket"]
+	if err := h.requirePolicies(r, bucket); err != nil {
+		s3util.WriteError(w, r, err)
+		return
+	}
+
+	// The ACL is either canned, or a list of grants to owner and everyone
+	acl := r.Header.Get("x-amz-acl")
+	if acl == "" {
+		payload := AccessControlPolicy{}
+		if err := s3util.ReadXMLBody(r, &payload); err != nil {
+			s3util.WriteError(w, r, err)
+			return
+		}
+		var err error
+		if acl, err = cannedACL(r, payload.Grants); err != nil {
+			s3util.WriteError(w, r, err)
+			return
+		}
+	} else if !s3policy.ValidACL(acl) {
+		s3util.WriteError(w, r, s3error.InvalidArgumentError(r))
+		return
+	}
+
+	if err := h.Policies.PutBucketACL(r, bucket, acl); err != nil {
+		s3util.WriteError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// aclPermissions returns the permissions a canned ACL grants to everyone
+func aclPermissions(acl string) []string {
+	switch acl {
+	case s3policy.ACLPublicRead:
+		return []string{"READ"}
+	case s3policy.ACLPublicReadWrite:
+		return []string{"READ", "WRITE"}
+	}
+	return nil
+}
+
+// cannedACL returns the canned ACL equivalent to a list of grants. Grants to
+// users are ignored, since authenticated users are authorized by policies.
+func cannedACL(r *http.Request, grants []Grant) (string, error) {
+	read, write := false, false
+	for _, grant := range grants {
+		if grant.Grantee.URI == "" {
+			continue
+		}
+		if grant.Grantee.URI != allUsersURI {
+			return "", s3error.NotImplementedError(r)
+		}
+		switch grant.Permission {
+		case "READ":
+			read = true
+		case "WRITE":
+			write = true
+		default:
+			return "", s3error.NotImplementedError(r)
+		}
+	}
+	switch {
+	case read && write:
+		return s3policy.ACLPublicReadWrite, nil
+	case read:
+		return s3policy.ACLPublicRead, nil
+	case write:
+		// Anonymous writes without reads have no canned equivalent
+		return "", s3error.NotImplementedError(r)
+	}
+	return s3policy.ACLPrivate, nil
+}
@@ -0,0 +1,59 @@
+package s3bucket
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	s3error "github.com/jakthom/s3c/pkg/s3/error"
+	s3policy "github.com/jakthom/s3c/pkg/s3/policy"
+)
+
+func TestCannedACL(t *testing.T) {
+	owner := Grant{Grantee: Grantee{Type: "CanonicalUser", ID: "owner"}, Permission: "FULL_CONTROL"}
+	allUsers := func(permission string) Grant {
+		return Grant{Grantee: Grantee{Type: "Group", URI: allUsersURI}, Permission: permission}
+	}
+	tests := []struct {
+		name   string
+		grants []Grant
+		acl    string
+		code   string
+	}{
+		{"no grants", nil, s3policy.ACLPrivate, ""},
+		{"owner only", []Grant{owner}, s3policy.ACLPrivate, ""},
+		{"read", []Grant{owner, allUsers("READ")}, s3policy.ACLPublicRead, ""},
+		{"read and write", []Grant{allUsers("WRITE"), owner, allUsers("READ")}, s3policy.ACLPublicReadWrite, ""},
+		{"write only", []Grant{allUsers("WRITE")}, "", "NotImplemented"},
+		{"read acp", []Grant{allUsers("READ_ACP")}, "", "NotImplemented"},
+		{"authenticated users", []Grant{{Grantee: Grantee{Type: "Group", URI: "http://acs.amazonaws.com/groups/global/AuthenticatedUsers"}, Permission: "READ"}}, "", "NotImplemented"},
+	}
+	for _, tt := range tests {
+		acl, err := cannedACL(httptest.NewRequest(http.MethodPut, "/bucket?acl", nil), tt.grants)
+		code := ""
+		if s3Err, ok := err.(*s3error.Error); ok {
+			code = s3Err.Code
+		}
+		if acl != tt.acl || code != tt.code {
+			t.Errorf("%s: got %q, %v, want %q, %q", tt.name, acl, code, tt.acl, tt.code)
+		}
+	}
+}
+
+// The grants of each canned ACL convert back to it
+func TestACLPermissions(t *testing.T) {
+	for _, acl := range []string{s3policy.ACLPrivate, s3policy.ACLPublicRead, s3policy.ACLPublicReadWrite} {
+		var grants []Grant
+		for _, permission := range aclPermissions(acl) {
+			grants = append(grants, Grant{Grantee: Grantee{Type: "Group", URI: allUsersURI}, Permission: permission})
+		}
+		converted, err := cannedACL(httptest.NewRequest(http.MethodPut, "/bucket?acl", nil), grants)
+		if err != nil || converted != acl {
+			t.Errorf("%s: converted to %q, %v", acl, converted, err)
+		}
+	}
+	if got := aclPermissions(s3policy.ACLPublicReadWrite); !reflect.DeepEqual(got, []string{"READ", "WRITE"}) {
+		t.Errorf("public-read-write permissions = %q", got)
+	}
+}
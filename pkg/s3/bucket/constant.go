@@ -10,4 +10,28 @@ const (
 	VersioningSuspended string = "Suspended"
 	// VersioningDisabled specifies that versioning is enabled on a bucket
 	VersioningEnabled string = "Enabled"
+	// MaxPolicySize specifies the maximum size of a bucket policy document
+	MaxPolicySize int64 = 20 * 1024
+	// MaxLifecycleRules specifies the maximum number of rules of a bucket
+	// lifecycle configuration
+	MaxLifecycleRules int = 1000
+	// maxLifecycleRuleIDLength specifies the maximum length of the ID of a
+	// lifecycle rule
+	maxLifecycleRuleIDLength int = 255
+	// maxNewerNoncurrentVersions specifies how many noncurrent versions a
+	// lifecycle rule may retain
+	maxNewerNoncurrentVersions int = 100
+	// MaxCORSRules specifies the maximum number of rules of a bucket CORS
+	// configuration
+	MaxCORSRules int = 100
+	// maxCORSRuleIDLength specifies the maximum length of the ID of a CORS
+	// rule
+	maxCORSRuleIDLength int = 255
+	// MaxWebsiteRoutingRules specifies the maximum number of routing rules of
+	// a bucket website configuration
+	MaxWebsiteRoutingRules int = 50
+	// LifecycleEnabled specifies that a lifecycle rule is applied
+	LifecycleEnabled string = "Enabled"
+	// LifecycleDisabled specifies that a lifecycle rule is not applied
+	LifecycleDisabled string = "Disabled"
 )
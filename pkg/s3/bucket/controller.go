@@ -7,14 +7,96 @@ type BucketController interface {
 	GetLocation(r *http.Request, bucket string) (string, error)
 	// ListObjects lists all objects within the bucket
 	ListObjects(r *http.Request, bucket, prefix, marker, delimiter string, maxKeys int) (*ListObjectsResult, error)
-	// // ListObjectVersions lists all object versions within the bucket
-	// ListObjectVersions(r *http.Request, bucket, prefix, keyMarker, versionMarker string, delimiter string, maxKeys int) (*ListObjectVersionsResult, error)
+	// ListObjectsV2 lists objects within the bucket, continuing from an
+	// opaque continuation token or after the `startAfter` key. Object
+	// owners are only returned if `fetchOwner` is set.
+	ListObjectsV2(r *http.Request, bucket, prefix, continuationToken, startAfter, delimiter string, maxKeys int, fetchOwner bool) (*ListObjectsV2Result, error)
+	// ListObjectVersions lists all object versions within the bucket
+	ListObjectVersions(r *http.Request, bucket, prefix, keyMarker, versionMarker string, delimiter string, maxKeys int) (*ListObjectVersionsResult, error)
 	// CreateBucket creates a new bucket
 	CreateBucket(r *http.Request, bucket string) error
 	// DeleteBucket deletes the bucket
 	DeleteBucket(r *http.Request, bucket string) error
-	// // GetBucketVersioning gets the state of version of the bucket
-	// GetBucketVersioning(r *http.Request, bucket string) (string, error)
-	// // SetBucketVersioning sets the state of versioning on the bucket
-	// SetBucketVersioning(r *http.Request, bucket, status string) error
+	// GetBucketVersioning gets the state of version of the bucket
+	GetBucketVersioning(r *http.Request, bucket string) (string, error)
+	// SetBucketVersioning sets the state of versioning on the bucket
+	SetBucketVersioning(r *http.Request, bucket, status string) error
+	// GetBucketTagging gets the tags of the bucket, failing with
+	// `NoSuchTagSet` if it has none
+	GetBucketTagging(r *http.Request, bucket string) (map[string]string, error)
+	// PutBucketTagging replaces the tags of the bucket. Tags are deleted by
+	// replacing them with none.
+	PutBucketTagging(r *http.Request, bucket string, tags map[string]string) error
+}
+
+// LifecycleController is an interface defining bucket lifecycle
+// configuration functionality
+type LifecycleController interface {
+	// GetBucketLifecycle gets the lifecycle configuration of the bucket,
+	// failing with `NoSuchLifecycleConfiguration` if it has none
+	GetBucketLifecycle(r *http.Request, bucket string) (*LifecycleConfiguration, error)
+	// PutBucketLifecycle sets the validated lifecycle configuration of the
+	// bucket
+	PutBucketLifecycle(r *http.Request, bucket string, config *LifecycleConfiguration) error
+	// DeleteBucketLifecycle deletes the lifecycle configuration of the bucket
+	DeleteBucketLifecycle(r *http.Request, bucket string) error
+}
+
+// CORSController is an interface defining bucket CORS configuration
+// functionality
+type CORSController interface {
+	// GetBucketCors gets the CORS configuration of the bucket, failing with
+	// `NoSuchCORSConfiguration` if it has none
+	GetBucketCors(r *http.Request, bucket string) (*CORSConfiguration, error)
+	// PutBucketCors sets the validated CORS configuration of the bucket
+	PutBucketCors(r *http.Request, bucket string, config *CORSConfiguration) error
+	// DeleteBucketCors deletes the CORS configuration of the bucket
+	DeleteBucketCors(r *http.Request, bucket string) error
+}
+
+// WebsiteController is an interface defining bucket website configuration
+// functionality
+type WebsiteController interface {
+	// GetBucketWebsite gets the website configuration of the bucket, failing
+	// with `NoSuchWebsiteConfiguration` if it has none
+	GetBucketWebsite(r *http.Request, bucket string) (*WebsiteConfiguration, error)
+	// PutBucketWebsite sets the validated website configuration of the bucket
+	PutBucketWebsite(r *http.Request, bucket string, config *WebsiteConfiguration) error
+	// DeleteBucketWebsite deletes the website configuration of the bucket
+	DeleteBucketWebsite(r *http.Request, bucket string) error
+}
+
+// NotificationController is an interface defining bucket notification
+// configuration functionality
+type NotificationController interface {
+	// GetBucketNotification gets the notification configuration of the
+	// bucket, which is empty if it has none
+	GetBucketNotification(r *http.Request, bucket string) (*NotificationConfiguration, error)
+	// PutBucketNotification sets the validated notification configuration of
+	// the bucket, failing if it refers to an unknown destination. An empty
+	// configuration turns notifications off.
+	PutBucketNotification(r *http.Request, bucket string, config *NotificationConfiguration) error
+	// DeleteBucketNotification deletes the notification configuration of the
+	// bucket
+	DeleteBucketNotification(r *http.Request, bucket string) error
+}
+
+// PolicyController is an interface defining bucket policy and ACL
+// functionality
+type PolicyController interface {
+	// GetBucketPolicy gets the policy document of the bucket
+	GetBucketPolicy(r *http.Request, bucket string) ([]byte, error)
+	// GetBucketPolicyStatus gets whether the policy of the bucket makes it
+	// public
+	GetBucketPolicyStatus(r *http.Request, bucket string) (bool, error)
+	// PutBucketPolicy validates and sets the policy document of the bucket
+	PutBucketPolicy(r *http.Request, bucket string, document []byte) error
+	// DeleteBucketPolicy deletes the policy of the bucket
+	DeleteBucketPolicy(r *http.Request, bucket string) error
+	// GetBucketACL gets the canned ACL of the bucket
+	GetBucketACL(r *http.Request, bucket string) (string, error)
+	// PutBucketACL sets the canned ACL of the bucket
+	PutBucketACL(r *http.Request, bucket string, acl string) error
+	// DeleteBucket forgets the policy and ACL of a deleted bucket
+	DeleteBucket(r *http.Request, bucket string) error
 }
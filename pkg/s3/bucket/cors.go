@@ -0,0 +1,197 @@
+package s3bucket
+
+import (
+	"encoding/xml"
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/mux"
+	s3error "github.com/jakthom/s3c/pkg/s3/error"
+	s3util "github.com/jakthom/s3c/pkg/s3/util"
+)
+
+// corsMethods are the methods CORS rules may allow
+var corsMethods = map[string]bool{
+	http.MethodGet:    true,
+	http.MethodPut:    true,
+	http.MethodPost:   true,
+	http.MethodDelete: true,
+	http.MethodHead:   true,
+}
+
+// CORSConfiguration is the XML marshallable CORS configuration of a bucket:
+// the rules by which browsers may make cross-origin requests to it
+type CORSConfiguration struct {
+	XMLName xml.Name   `xml:"http://s3.amazonaws.com/doc/2006-03-01/ CORSConfiguration"`
+	Rules   []CORSRule `xml:"CORSRule"`
+}
+
+// CORSRule allows requests from origins, with methods and headers, which may
+// contain a `*` wildcard
+type CORSRule struct {
+	ID             string   `xml:"ID,omitempty"`
+	AllowedHeaders []string `xml:"AllowedHeader"`
+	AllowedMethods []string `xml:"AllowedMethod"`
+	AllowedOrigins []string `xml:"AllowedOrigin"`
+	ExposeHeaders  []string `xml:"ExposeHeader"`
+	MaxAgeSeconds  *int     `xml:"MaxAgeSeconds,omitempty"`
+}
+
+// Match returns the first rule allowing a request from `origin` with
+// `method` and `headers`, or nil if none does
+func (c *CORSConfiguration) Match(origin, method string, headers []string) *CORSRule {
+	for i := range c.Rules {
+		rule := &c.Rules[i]
+		if rule.allows(origin, method, headers) {
+			return rule
+		}
+	}
+	return nil
+}
+
+func (rule *CORSRule) allows(origin, method string, headers []string) bool {
+	if !matchAny(rule.AllowedOrigins, origin, false) {
+		return false
+	}
+	allowed := false
+	for _, m := range rule.AllowedMethods {
+		if m == method {
+			allowed = true
+			break
+		}
+	}
+	if !allowed {
+		return false
+	}
+	for _, header := range headers {
+		if !matchAny(rule.AllowedHeaders, header, true) {
+			return false
+		}
+	}
+	return true
+}
+
+// matchAny returns whether any of the patterns, which may contain one `*`
+// wildcard, matches a value
+func matchAny(patterns []string, value string, ignoreCase bool) bool {
+	if ignoreCase {
+		value = strings.ToLower(value)
+	}
+	for _, pattern := range patterns {
+		if ignoreCase {
+			pattern = strings.ToLower(pattern)
+		}
+		prefix, suffix, wildcard := strings.Cut(pattern, "*")
+		if !wildcard {
+			if pattern == value {
+				return true
+			}
+			continue
+		}
+		if len(value) >= len(prefix)+len(suffix) && strings.HasPrefix(value, prefix) && strings.HasSuffix(value, suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// validate checks a CORS configuration against the limits of s3
+func (c *CORSConfiguration) validate(r *http.Request) error {
+	if len(c.Rules) == 0 || len(c.Rules) > MaxCORSRules {
+		return s3error.MalformedXMLError(r)
+	}
+	for _, rule := range c.Rules {
+		if len(rule.ID) > maxCORSRuleIDLength || len(rule.AllowedOrigins) == 0 || len(rule.AllowedMethods) == 0 {
+			return s3error.MalformedXMLError(r)
+		}
+		for _, method := range rule.AllowedMethods {
+			if !corsMethods[method] {
+				return s3error.InvalidRequestError(r, "Found unsupported HTTP method in CORS config. Unsupported method is "+method)
+			}
+		}
+		for _, origin := range rule.AllowedOrigins {
+			if strings.Count(origin, "*") > 1 {
+				return s3error.InvalidRequestError(r, "AllowedOrigin \""+origin+"\" can not have more than one wildcard.")
+			}
+		}
+		for _, header := range rule.AllowedHeaders {
+			if strings.Count(header, "*") > 1 {
+				return s3error.InvalidRequestError(r, "AllowedHeader \""+header+"\" can not have more than one wildcard.")
+			}
+		}
+		if rule.MaxAgeSeconds != nil && *rule.MaxAgeSeconds < 0 {
+			return s3error.InvalidArgumentError(r)
+		}
+	}
+	return nil
+}
+
+func (h *BucketHandler) CORS(w http.ResponseWriter, r *http.Request) {
+	bucket := mux.Vars(r)["bucket"]
+	if err := h.requireCORS(r, bucket); err != nil {
+		s3util.WriteError(w, r, err)
+		return
+	}
+
+	config, err := h.CORSConfigs.GetBucketCors(r, bucket)
+	if err != nil {
+		s3util.WriteError(w, r, err)
+		return
+	}
+
+	s3util.WriteXML(w, r, http.StatusOK, config)
+}
+
+func (h *BucketHandler) SetCORS(w http.ResponseWriter, r *http.Request) {
+	bucket := mux.Vars(r)["bucket"]
+	if err := h.requireCORS(r, bucket); err != nil {
+		s3util.WriteError(w, r, err)
+		return
+	}
+
+	payload := struct {
+		XMLName xml.Name   `xml:"CORSConfiguration"`
+		Rules   []CORSRule `xml:"CORSRule"`
+	}{}
+	if err := s3util.ReadXMLBody(r, &payload); err != nil {
+		s3util.WriteError(w, r, err)
+		return
+	}
+	config := &CORSConfiguration{Rules: payload.Rules}
+	if err := config.validate(r); err != nil {
+		s3util.WriteError(w, r, err)
+		return
+	}
+
+	if err := h.CORSConfigs.PutBucketCors(r, bucket, config); err != nil {
+		s3util.WriteError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+func (h *BucketHandler) DelCORS(w http.ResponseWriter, r *http.Request) {
+	bucket := mux.Vars(r)["bucket"]
+	if err := h.requireCORS(r, bucket); err != nil {
+		s3util.WriteError(w, r, err)
+		return
+	}
+
+	if err := h.CORSConfigs.DeleteBucketCors(r, bucket); err != nil {
+		s3util.WriteError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// requireCORS checks that CORS configurations are supported, and that the
+// bucket exists
+func (h *BucketHandler) requireCORS(r *http.Request, bucket string) error {
+	if h.CORSConfigs == nil {
+		return s3error.NotImplementedError(r)
+	}
+	_, err := h.Controller.GetBucketVersioning(r, bucket)
+	return err
+}
@@ -6,12 +6,27 @@ import (
 	"time"
 
 	"github.com/gorilla/mux"
+	s3error "github.com/jakthom/s3c/pkg/s3/error"
 	s3object "github.com/jakthom/s3c/pkg/s3/object"
+	s3policy "github.com/jakthom/s3c/pkg/s3/policy"
 	s3util "github.com/jakthom/s3c/pkg/s3/util"
+	"github.com/rs/zerolog/log"
 )
 
 type BucketHandler struct {
 	Controller BucketController
+	// Policies stores bucket policies, if they are supported
+	Policies PolicyController
+	// Lifecycles stores bucket lifecycle configurations, if they are
+	// supported
+	Lifecycles LifecycleController
+	// CORSConfigs stores bucket CORS configurations, if they are supported
+	CORSConfigs CORSController
+	// Websites stores bucket website configurations, if they are supported
+	Websites WebsiteController
+	// Notifications stores bucket notification configurations, if they are
+	// supported
+	Notifications NotificationController
 }
 
 func (h *BucketHandler) Location(w http.ResponseWriter, r *http.Request) {
@@ -105,15 +120,117 @@ func (h *BucketHandler) Get(w http.ResponseWriter, r *http.Request) {
 	s3util.WriteXML(w, r, http.StatusOK, marshallable)
 }
 
+func (h *BucketHandler) ListV2(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	bucket := vars["bucket"]
+
+	maxKeys, err := s3util.IntFormValue(r, "max-keys", 0, 5000, DefaultMaxKeys)
+	if err != nil {
+		s3util.WriteError(w, r, err)
+		return
+	}
+
+	encodingType := r.FormValue("encoding-type")
+	if encodingType != "" && encodingType != "url" {
+		s3util.WriteError(w, r, s3error.InvalidArgumentError(r))
+		return
+	}
+
+	prefix := r.FormValue("prefix")
+	continuationToken := r.FormValue("continuation-token")
+	startAfter := r.FormValue("start-after")
+	delimiter := r.FormValue("delimiter")
+	fetchOwner := r.FormValue("fetch-owner") == "true"
+
+	result, err := h.Controller.ListObjectsV2(r, bucket, prefix, continuationToken, startAfter, delimiter, maxKeys, fetchOwner)
+	if err != nil {
+		s3util.WriteError(w, r, err)
+		return
+	}
+
+	for _, c := range result.Contents {
+		// some clients (e.g. minio-python) can't handle sub-seconds in
+		// datetime output
+		c.LastModified = c.LastModified.UTC().Round(time.Second)
+		c.ETag = s3util.AddETagQuotes(c.ETag)
+		// Owners are only known to origins that track them
+		if !fetchOwner {
+			c.Owner = nil
+		}
+	}
+
+	if encodingType == "url" {
+		prefix = s3util.EncodeKey(prefix)
+		startAfter = s3util.EncodeKey(startAfter)
+		delimiter = s3util.EncodeKey(delimiter)
+		for _, c := range result.Contents {
+			c.Key = s3util.EncodeKey(c.Key)
+		}
+		for _, commonPrefix := range result.CommonPrefixes {
+			commonPrefix.Prefix = s3util.EncodeKey(commonPrefix.Prefix)
+		}
+	}
+
+	marshallable := struct {
+		XMLName               xml.Name                   `xml:"http://s3.amazonaws.com/doc/2006-03-01/ ListBucketResult"`
+		Name                  string                     `xml:"Name"`
+		Prefix                string                     `xml:"Prefix"`
+		Delimiter             string                     `xml:"Delimiter,omitempty"`
+		MaxKeys               int                        `xml:"MaxKeys"`
+		KeyCount              int                        `xml:"KeyCount"`
+		IsTruncated           bool                       `xml:"IsTruncated"`
+		ContinuationToken     string                     `xml:"ContinuationToken,omitempty"`
+		NextContinuationToken string                     `xml:"NextContinuationToken,omitempty"`
+		StartAfter            string                     `xml:"StartAfter,omitempty"`
+		EncodingType          string                     `xml:"EncodingType,omitempty"`
+		Contents              []*s3object.Object         `xml:"Contents"`
+		CommonPrefixes        []*s3object.CommonPrefixes `xml:"CommonPrefixes"`
+	}{
+		Name:                  bucket,
+		Prefix:                prefix,
+		Delimiter:             delimiter,
+		MaxKeys:               maxKeys,
+		KeyCount:              len(result.Contents) + len(result.CommonPrefixes),
+		IsTruncated:           result.IsTruncated,
+		ContinuationToken:     continuationToken,
+		NextContinuationToken: result.NextContinuationToken,
+		StartAfter:            startAfter,
+		EncodingType:          encodingType,
+		Contents:              result.Contents,
+		CommonPrefixes:        result.CommonPrefixes,
+	}
+
+	s3util.WriteXML(w, r, http.StatusOK, marshallable)
+}
+
 func (h *BucketHandler) Put(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	bucket := vars["bucket"]
 
+	acl := r.Header.Get("x-amz-acl")
+	if acl != "" {
+		if h.Policies == nil {
+			s3util.WriteError(w, r, s3error.NotImplementedError(r))
+			return
+		}
+		if !s3policy.ValidACL(acl) {
+			s3util.WriteError(w, r, s3error.InvalidArgumentError(r))
+			return
+		}
+	}
+
 	if err := h.Controller.CreateBucket(r, bucket); err != nil {
 		s3util.WriteError(w, r, err)
 		return
 	}
 
+	if acl != "" {
+		if err := h.Policies.PutBucketACL(r, bucket, acl); err != nil {
+			s3util.WriteError(w, r, err)
+			return
+		}
+	}
+
 	w.WriteHeader(http.StatusOK)
 }
 
@@ -125,139 +242,150 @@ func (h *BucketHandler) Del(w http.ResponseWriter, r *http.Request) {
 		s3util.WriteError(w, r, err)
 		return
 	}
+	// A bucket's policy and ACL don't outlive it, lest they apply to a new
+	// bucket of the same name
+	if h.Policies != nil {
+		if err := h.Policies.DeleteBucket(r, bucket); err != nil {
+			log.Error().Err(err).Msg("Failed to delete policy of deleted bucket: " + bucket)
+		}
+	}
+	if h.Lifecycles != nil {
+		if err := h.Lifecycles.DeleteBucketLifecycle(r, bucket); err != nil {
+			log.Error().Err(err).Msg("Failed to delete lifecycle of deleted bucket: " + bucket)
+		}
+	}
+	if h.CORSConfigs != nil {
+		if err := h.CORSConfigs.DeleteBucketCors(r, bucket); err != nil {
+			log.Error().Err(err).Msg("Failed to delete CORS configuration of deleted bucket: " + bucket)
+		}
+	}
+	if h.Websites != nil {
+		if err := h.Websites.DeleteBucketWebsite(r, bucket); err != nil {
+			log.Error().Err(err).Msg("Failed to delete website configuration of deleted bucket: " + bucket)
+		}
+	}
+	if h.Notifications != nil {
+		if err := h.Notifications.DeleteBucketNotification(r, bucket); err != nil {
+			log.Error().Err(err).Msg("Failed to delete notification configuration of deleted bucket: " + bucket)
+		}
+	}
 
 	w.WriteHeader(http.StatusNoContent)
 }
 
-// func (h *BucketHandler) versioning(w http.ResponseWriter, r *http.Request) {
-// 	vars := mux.Vars(r)
-// 	bucket := vars["bucket"]
-
-// 	status, err := h.controller.GetBucketVersioning(r, bucket)
-// 	if err != nil {
-// 		s3util.WriteError(w, r, err)
-// 		return
-// 	}
-
-// 	result := struct {
-// 		XMLName xml.Name `xml:"http://s3.amazonaws.com/doc/2006-03-01/ VersioningConfiguration"`
-// 		Status  string   `xml:"Status,omitempty"`
-// 	}{
-// 		Status: status,
-// 	}
-
-// 	s3util.WriteXML(w, r, http.StatusOK, result)
-// }
-
-// func (h *BucketHandler) setVersioning(w http.ResponseWriter, r *http.Request) {
-// 	vars := mux.Vars(r)
-// 	bucket := vars["bucket"]
-
-// 	payload := struct {
-// 		XMLName xml.Name `xml:"VersioningConfiguration"`
-// 		Status  string   `xml:"Status"`
-// 	}{}
-// 	if err := s3util.ReadXMLBody(r, &payload); err != nil {
-// 		s3util.WriteError(w, r, err)
-// 		return
-// 	}
-
-// 	if payload.Status != VersioningDisabled && payload.Status != VersioningSuspended && payload.Status != VersioningEnabled {
-// 		s3util.WriteError(w, r, s3error.IllegalVersioningConfigurationError(r))
-// 		return
-// 	}
-
-// 	err := h.controller.SetBucketVersioning(r, bucket, payload.Status)
-// 	if err != nil {
-// 		s3util.WriteError(w, r, err)
-// 		return
-// 	}
-
-// 	w.WriteHeader(http.StatusOK)
-// }
-
-// func (h *BucketHandler) listVersions(w http.ResponseWriter, r *http.Request) {
-// 	vars := mux.Vars(r)
-// 	bucket := vars["bucket"]
-
-// 	maxKeys, err := s3util.IntFormValue(r, "max-keys", 0, DefaultMaxKeys, DefaultMaxKeys)
-// 	if err != nil {
-// 		s3util.WriteError(w, r, err)
-// 		return
-// 	}
-
-// 	prefix := r.FormValue("prefix")
-// 	keyMarker := r.FormValue("key-marker")
-// 	versionIDMarker := r.FormValue("version-id-marker")
-// 	delimiter := r.FormValue("delimiter")
-
-// 	result, err := h.controller.ListObjectVersions(r, bucket, prefix, keyMarker, versionIDMarker, delimiter, maxKeys)
-// 	if err != nil {
-// 		s3util.WriteError(w, r, err)
-// 		return
-// 	}
-
-// 	// some clients (e.g. minio-python) can't handle sub-seconds in datetime
-// 	// output
-// 	for _, version := range result.Versions {
-// 		version.LastModified = version.LastModified.UTC().Round(time.Second)
-// 	}
-// 	for _, deleteMarker := range result.DeleteMarkers {
-// 		deleteMarker.LastModified = deleteMarker.LastModified.UTC().Round(time.Second)
-// 	}
-
-// 	for _, v := range result.Versions {
-// 		v.ETag = s3util.AddETagQuotes(v.ETag)
-// 	}
-
-// 	marshallable := struct {
-// 		XMLName             xml.Name                 `xml:"http://s3.amazonaws.com/doc/2006-03-01/ ListVersionsResult"`
-// 		Delimiter           string                   `xml:"Delimiter,omitempty"`
-// 		IsTruncated         bool                     `xml:"IsTruncated"`
-// 		KeyMarker           string                   `xml:"KeyMarker"`
-// 		NextKeyMarker       string                   `xml:"NextKeyMarker,omitempty"`
-// 		MaxKeys             int                      `xml:"MaxKeys"`
-// 		Name                string                   `xml:"Name"`
-// 		VersionIDMarker     string                   `xml:"VersionIdKeyMarker"`
-// 		NextVersionIDMarker string                   `xml:"NextVersionIdKeyMarker,omitempty"`
-// 		Prefix              string                   `xml:"Prefix"`
-// 		Versions            []*Version               `xml:"Version"`
-// 		DeleteMarkers       []*s3object.DeleteMarker `xml:"DeleteMarker"`
-// 	}{
-// 		IsTruncated:     result.IsTruncated,
-// 		KeyMarker:       keyMarker,
-// 		MaxKeys:         maxKeys,
-// 		Name:            bucket,
-// 		VersionIDMarker: versionIDMarker,
-// 		Prefix:          prefix,
-// 		Versions:        result.Versions,
-// 		DeleteMarkers:   result.DeleteMarkers,
-// 	}
-
-// 	if marshallable.IsTruncated {
-// 		highKey := ""
-// 		highVersion := ""
-
-// 		for _, version := range marshallable.Versions {
-// 			if version.Key > highKey {
-// 				highKey = version.Key
-// 			}
-// 			if version.Version > highVersion {
-// 				highVersion = version.Version
-// 			}
-// 		}
-// 		for _, deleteMarker := range marshallable.DeleteMarkers {
-// 			if deleteMarker.Key > highKey {
-// 				highKey = deleteMarker.Key
-// 			}
-// 			if deleteMarker.Version > highVersion {
-// 				highVersion = deleteMarker.Version
-// 			}
-// 		}
-
-// 		marshallable.NextKeyMarker = highKey
-// 		marshallable.NextVersionIDMarker = highVersion
-// 	}
-
-// 	s3util.WriteXML(w, r, http.StatusOK, marshallable)
-// }
+func (h *BucketHandler) Versioning(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	bucket := vars["bucket"]
+
+	status, err := h.Controller.GetBucketVersioning(r, bucket)
+	if err != nil {
+		s3util.WriteError(w, r, err)
+		return
+	}
+
+	result := struct {
+		XMLName xml.Name `xml:"http://s3.amazonaws.com/doc/2006-03-01/ VersioningConfiguration"`
+		Status  string   `xml:"Status,omitempty"`
+	}{
+		Status: status,
+	}
+
+	s3util.WriteXML(w, r, http.StatusOK, result)
+}
+
+func (h *BucketHandler) SetVersioning(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	bucket := vars["bucket"]
+
+	payload := struct {
+		XMLName xml.Name `xml:"VersioningConfiguration"`
+		Status  string   `xml:"Status"`
+	}{}
+	if err := s3util.ReadXMLBody(r, &payload); err != nil {
+		s3util.WriteError(w, r, err)
+		return
+	}
+
+	if payload.Status != VersioningDisabled && payload.Status != VersioningSuspended && payload.Status != VersioningEnabled {
+		s3util.WriteError(w, r, s3error.IllegalVersioningConfigurationError(r))
+		return
+	}
+
+	err := h.Controller.SetBucketVersioning(r, bucket, payload.Status)
+	if err != nil {
+		s3util.WriteError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+func (h *BucketHandler) ListVersions(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	bucket := vars["bucket"]
+
+	maxKeys, err := s3util.IntFormValue(r, "max-keys", 0, DefaultMaxKeys, DefaultMaxKeys)
+	if err != nil {
+		s3util.WriteError(w, r, err)
+		return
+	}
+
+	prefix := r.FormValue("prefix")
+	keyMarker := r.FormValue("key-marker")
+	versionIDMarker := r.FormValue("version-id-marker")
+	delimiter := r.FormValue("delimiter")
+
+	result, err := h.Controller.ListObjectVersions(r, bucket, prefix, keyMarker, versionIDMarker, delimiter, maxKeys)
+	if err != nil {
+		s3util.WriteError(w, r, err)
+		return
+	}
+
+	// some clients (e.g. minio-python) can't handle sub-seconds in datetime
+	// output
+	for _, version := range result.Versions {
+		version.LastModified = version.LastModified.UTC().Round(time.Second)
+	}
+	for _, deleteMarker := range result.DeleteMarkers {
+		deleteMarker.LastModified = deleteMarker.LastModified.UTC().Round(time.Second)
+	}
+
+	// Owners are only listed by origins that track them
+	for _, v := range result.Versions {
+		v.ETag = s3util.AddETagQuotes(v.ETag)
+	}
+
+	marshallable := struct {
+		XMLName             xml.Name                   `xml:"http://s3.amazonaws.com/doc/2006-03-01/ ListVersionsResult"`
+		Delimiter           string                     `xml:"Delimiter,omitempty"`
+		IsTruncated         bool                       `xml:"IsTruncated"`
+		KeyMarker           string                     `xml:"KeyMarker"`
+		NextKeyMarker       string                     `xml:"NextKeyMarker,omitempty"`
+		MaxKeys             int                        `xml:"MaxKeys"`
+		Name                string                     `xml:"Name"`
+		VersionIDMarker     string                     `xml:"VersionIdMarker"`
+		NextVersionIDMarker string                     `xml:"NextVersionIdMarker,omitempty"`
+		Prefix              string                     `xml:"Prefix"`
+		Versions            []*Version                 `xml:"Version"`
+		DeleteMarkers       []*s3object.DeleteMarker   `xml:"DeleteMarker"`
+		CommonPrefixes      []*s3object.CommonPrefixes `xml:"CommonPrefixes"`
+	}{
+		Delimiter:       delimiter,
+		IsTruncated:     result.IsTruncated,
+		KeyMarker:       keyMarker,
+		MaxKeys:         maxKeys,
+		Name:            bucket,
+		VersionIDMarker: versionIDMarker,
+		Prefix:          prefix,
+		Versions:        result.Versions,
+		DeleteMarkers:   result.DeleteMarkers,
+		CommonPrefixes:  result.CommonPrefixes,
+	}
+
+	if marshallable.IsTruncated {
+		marshallable.NextKeyMarker = result.NextKeyMarker
+		marshallable.NextVersionIDMarker = result.NextVersionIDMarker
+	}
+
+	s3util.WriteXML(w, r, http.StatusOK, marshallable)
+}
@@ -0,0 +1,326 @@
+package s3bucket
+
+import (
+	"encoding/xml"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	s3error "github.com/jakthom/s3c/pkg/s3/error"
+	s3util "github.com/jakthom/s3c/pkg/s3/util"
+)
+
+// LifecycleConfiguration is the XML marshallable lifecycle configuration of
+// a bucket: the rules by which its objects expire
+type LifecycleConfiguration struct {
+	XMLName xml.Name        `xml:"http://s3.amazonaws.com/doc/2006-03-01/ LifecycleConfiguration"`
+	Rules   []LifecycleRule `xml:"Rule"`
+}
+
+// LifecycleRule is a rule of a lifecycle configuration, which applies its
+// actions to the objects its filter matches
+type LifecycleRule struct {
+	ID string `xml:"ID,omitempty"`
+	// Prefix is the deprecated filter of rules on object key prefixes
+	Prefix                         *string                         `xml:"Prefix,omitempty"`
+	Filter                         *LifecycleFilter                `xml:"Filter,omitempty"`
+	Status                         string                          `xml:"Status"`
+	Expiration                     *LifecycleExpiration            `xml:"Expiration,omitempty"`
+	NoncurrentVersionExpiration    *NoncurrentVersionExpiration    `xml:"NoncurrentVersionExpiration,omitempty"`
+	AbortIncompleteMultipartUpload *AbortIncompleteMultipartUpload `xml:"AbortIncompleteMultipartUpload,omitempty"`
+	// Transitions between storage classes are not supported, and only
+	// decoded to be rejected
+	Transitions                  []struct{} `xml:"Transition"`
+	NoncurrentVersionTransitions []struct{} `xml:"NoncurrentVersionTransition"`
+}
+
+// LifecycleFilter selects the objects a lifecycle rule applies to, by one
+// criteria or, within `And`, several of them. An empty filter matches every
+// object.
+type LifecycleFilter struct {
+	Prefix                *string       `xml:"Prefix,omitempty"`
+	Tag                   *s3util.Tag   `xml:"Tag,omitempty"`
+	ObjectSizeGreaterThan *int64        `xml:"ObjectSizeGreaterThan,omitempty"`
+	ObjectSizeLessThan    *int64        `xml:"ObjectSizeLessThan,omitempty"`
+	And                   *LifecycleAnd `xml:"And,omitempty"`
+}
+
+// LifecycleAnd combines the criteria of a lifecycle filter
+type LifecycleAnd struct {
+	Prefix                string       `xml:"Prefix,omitempty"`
+	Tags                  []s3util.Tag `xml:"Tag"`
+	ObjectSizeGreaterThan int64        `xml:"ObjectSizeGreaterThan,omitempty"`
+	ObjectSizeLessThan    int64        `xml:"ObjectSizeLessThan,omitempty"`
+}
+
+// LifecycleExpiration expires the current version of objects a number of
+// days after they are written, or at a date. Alternatively, it removes delete
+// markers that no longer have any noncurrent versions.
+type LifecycleExpiration struct {
+	Days                      int    `xml:"Days,omitempty"`
+	Date                      string `xml:"Date,omitempty"`
+	ExpiredObjectDeleteMarker bool   `xml:"ExpiredObjectDeleteMarker,omitempty"`
+}
+
+// NoncurrentVersionExpiration permanently deletes noncurrent versions of
+// objects a number of days after they become noncurrent, retaining the
+// newest `NewerNoncurrentVersions` of them
+type NoncurrentVersionExpiration struct {
+	NoncurrentDays          int `xml:"NoncurrentDays"`
+	NewerNoncurrentVersions int `xml:"NewerNoncurrentVersions,omitempty"`
+}
+
+// AbortIncompleteMultipartUpload aborts multipart uploads a number of days
+// after they are initiated
+type AbortIncompleteMultipartUpload struct {
+	DaysAfterInitiation int `xml:"DaysAfterInitiation"`
+}
+
+// Criteria returns the prefix, tags and size bounds of the objects a rule
+// applies to. Size bounds are exclusive, and zero if unset.
+func (rule *LifecycleRule) Criteria() (prefix string, tags map[string]string, greaterThan, lessThan int64) {
+	tags = map[string]string{}
+	if rule.Prefix != nil {
+		prefix = *rule.Prefix
+	}
+	filter := rule.Filter
+	if filter == nil {
+		return prefix, tags, 0, 0
+	}
+	if filter.Prefix != nil {
+		prefix = *filter.Prefix
+	}
+	if filter.Tag != nil {
+		tags[filter.Tag.Key] = filter.Tag.Value
+	}
+	if filter.ObjectSizeGreaterThan != nil {
+		greaterThan = *filter.ObjectSizeGreaterThan
+	}
+	if filter.ObjectSizeLessThan != nil {
+		lessThan = *filter.ObjectSizeLessThan
+	}
+	if and := filter.And; and != nil {
+		prefix = and.Prefix
+		for _, tag := range and.Tags {
+			tags[tag.Key] = tag.Value
+		}
+		greaterThan, lessThan = and.ObjectSizeGreaterThan, and.ObjectSizeLessThan
+	}
+	return prefix, tags, greaterThan, lessThan
+}
+
+// ExpirationDate returns the date of an expiration rule, if it has one
+func (e *LifecycleExpiration) ExpirationDate() (time.Time, bool) {
+	if e == nil || e.Date == "" {
+		return time.Time{}, false
+	}
+	date, err := parseLifecycleDate(e.Date)
+	return date, err == nil
+}
+
+// parseLifecycleDate parses the ISO 8601 date of an expiration rule
+func parseLifecycleDate(date string) (time.Time, error) {
+	t, err := time.Parse(time.RFC3339, date)
+	if err != nil {
+		t, err = time.Parse("2006-01-02", date)
+	}
+	return t, err
+}
+
+// validate checks a lifecycle configuration against the schema and limits of
+// s3, giving an ID to rules without one
+func (c *LifecycleConfiguration) validate(r *http.Request) error {
+	if len(c.Rules) == 0 || len(c.Rules) > MaxLifecycleRules {
+		return s3error.MalformedXMLError(r)
+	}
+	ids := map[string]bool{}
+	for i := range c.Rules {
+		rule := &c.Rules[i]
+		if rule.ID == "" {
+			rule.ID = uuid.New().String()
+		}
+		if len(rule.ID) > maxLifecycleRuleIDLength {
+			return s3error.InvalidArgumentError(r)
+		}
+		if ids[rule.ID] {
+			return s3error.InvalidRequestError(r, "Rule ID must be unique. Found same ID for more than one rule")
+		}
+		ids[rule.ID] = true
+		if err := rule.validate(r); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (rule *LifecycleRule) validate(r *http.Request) error {
+	if rule.Status != LifecycleEnabled && rule.Status != LifecycleDisabled {
+		return s3error.MalformedXMLError(r)
+	}
+	if (rule.Prefix == nil) == (rule.Filter == nil) {
+		return s3error.MalformedXMLError(r)
+	}
+	if len(rule.Transitions) > 0 || len(rule.NoncurrentVersionTransitions) > 0 {
+		return s3error.NotImplementedError(r)
+	}
+	if err := rule.Filter.validate(r); err != nil {
+		return err
+	}
+	_, tags, _, _ := rule.Criteria()
+
+	if rule.Expiration == nil && rule.NoncurrentVersionExpiration == nil && rule.AbortIncompleteMultipartUpload == nil {
+		return s3error.InvalidRequestError(r, "At least one action needs to be specified in a rule")
+	}
+	if e := rule.Expiration; e != nil {
+		set := 0
+		for _, ok := range []bool{e.Days != 0, e.Date != "", e.ExpiredObjectDeleteMarker} {
+			if ok {
+				set++
+			}
+		}
+		if set != 1 {
+			return s3error.MalformedXMLError(r)
+		}
+		if e.Days < 0 {
+			return s3error.InvalidArgumentError(r)
+		}
+		if e.Date != "" {
+			date, err := parseLifecycleDate(e.Date)
+			if err != nil {
+				return s3error.InvalidArgumentError(r)
+			}
+			if !date.Equal(date.UTC().Truncate(24 * time.Hour)) {
+				return s3error.InvalidArgumentError(r)
+			}
+		}
+		if e.ExpiredObjectDeleteMarker && len(tags) > 0 {
+			return s3error.InvalidRequestError(r, "ExpiredObjectDeleteMarker cannot be specified with tags")
+		}
+	}
+	if e := rule.NoncurrentVersionExpiration; e != nil {
+		if e.NoncurrentDays <= 0 || e.NewerNoncurrentVersions < 0 || e.NewerNoncurrentVersions > maxNewerNoncurrentVersions {
+			return s3error.InvalidArgumentError(r)
+		}
+	}
+	if a := rule.AbortIncompleteMultipartUpload; a != nil {
+		if a.DaysAfterInitiation <= 0 {
+			return s3error.InvalidArgumentError(r)
+		}
+		if len(tags) > 0 {
+			return s3error.InvalidRequestError(r, "AbortIncompleteMultipartUpload cannot be specified with Tags")
+		}
+	}
+	return nil
+}
+
+func (f *LifecycleFilter) validate(r *http.Request) error {
+	if f == nil {
+		return nil
+	}
+	set := 0
+	for _, ok := range []bool{f.Prefix != nil, f.Tag != nil, f.ObjectSizeGreaterThan != nil, f.ObjectSizeLessThan != nil, f.And != nil} {
+		if ok {
+			set++
+		}
+	}
+	if set > 1 {
+		return s3error.MalformedXMLError(r)
+	}
+	var tags []s3util.Tag
+	var greaterThan, lessThan int64
+	if f.Tag != nil {
+		tags = append(tags, *f.Tag)
+	}
+	if f.ObjectSizeGreaterThan != nil {
+		greaterThan = *f.ObjectSizeGreaterThan
+	}
+	if f.ObjectSizeLessThan != nil {
+		lessThan = *f.ObjectSizeLessThan
+	}
+	if f.And != nil {
+		tags = f.And.Tags
+		greaterThan, lessThan = f.And.ObjectSizeGreaterThan, f.And.ObjectSizeLessThan
+	}
+	if greaterThan < 0 || lessThan < 0 || (lessThan > 0 && greaterThan >= lessThan) {
+		return s3error.InvalidArgumentError(r)
+	}
+	keys := map[string]string{}
+	for _, tag := range tags {
+		if _, ok := keys[tag.Key]; ok {
+			return s3error.InvalidRequestError(r, "Duplicate Tag Keys are not allowed")
+		}
+		keys[tag.Key] = tag.Value
+	}
+	return s3util.ValidateTags(r, keys, s3util.MaxObjectTags)
+}
+
+func (h *BucketHandler) Lifecycle(w http.ResponseWriter, r *http.Request) {
+	bucket := mux.Vars(r)["bucket"]
+	if err := h.requireLifecycle(r, bucket); err != nil {
+		s3util.WriteError(w, r, err)
+		return
+	}
+
+	config, err := h.Lifecycles.GetBucketLifecycle(r, bucket)
+	if err != nil {
+		s3util.WriteError(w, r, err)
+		return
+	}
+
+	s3util.WriteXML(w, r, http.StatusOK, config)
+}
+
+func (h *BucketHandler) SetLifecycle(w http.ResponseWriter, r *http.Request) {
+	bucket := mux.Vars(r)["bucket"]
+	if err := h.requireLifecycle(r, bucket); err != nil {
+		s3util.WriteError(w, r, err)
+		return
+	}
+
+	payload := struct {
+		XMLName xml.Name        `xml:"LifecycleConfiguration"`
+		Rules   []LifecycleRule `xml:"Rule"`
+	}{}
+	if err := s3util.ReadXMLBody(r, &payload); err != nil {
+		s3util.WriteError(w, r, err)
+		return
+	}
+	config := &LifecycleConfiguration{Rules: payload.Rules}
+	if err := config.validate(r); err != nil {
+		s3util.WriteError(w, r, err)
+		return
+	}
+
+	if err := h.Lifecycles.PutBucketLifecycle(r, bucket, config); err != nil {
+		s3util.WriteError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+func (h *BucketHandler) DelLifecycle(w http.ResponseWriter, r *http.Request) {
+	bucket := mux.Vars(r)["bucket"]
+	if err := h.requireLifecycle(r, bucket); err != nil {
+		s3util.WriteError(w, r, err)
+		return
+	}
+
+	if err := h.Lifecycles.DeleteBucketLifecycle(r, bucket); err != nil {
+		s3util.WriteError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// requireLifecycle checks that lifecycle configurations are supported, and
+// that the bucket exists
+func (h *BucketHandler) requireLifecycle(r *http.Request, bucket string) error {
+	if h.Lifecycles == nil {
+		return s3error.NotImplementedError(r)
+	}
+	_, err := h.Controller.GetBucketVersioning(r, bucket)
+	return err
+}
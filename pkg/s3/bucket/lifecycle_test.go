@@ -0,0 +1,132 @@
+package s3bucket
+
+import (
+	"encoding/xml"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	s3error "github.com/jakthom/s3c/pkg/s3/error"
+)
+
+// parseLifecycle decodes and validates a lifecycle configuration as it is
+// put, returning the code of the error rejecting it, if any
+func parseLifecycle(t *testing.T, document string) (*LifecycleConfiguration, string) {
+	t.Helper()
+	payload := struct {
+		XMLName xml.Name        `xml:"LifecycleConfiguration"`
+		Rules   []LifecycleRule `xml:"Rule"`
+	}{}
+	if err := xml.Unmarshal([]byte(document), &payload); err != nil {
+		t.Fatalf("invalid document %q: %v", document, err)
+	}
+	config := &LifecycleConfiguration{Rules: payload.Rules}
+	err := config.validate(httptest.NewRequest(http.MethodPut, "/bucket?lifecycle", nil))
+	if s3Err, ok := err.(*s3error.Error); ok {
+		return config, s3Err.Code
+	} else if err != nil {
+		t.Fatal(err)
+	}
+	return config, ""
+}
+
+// lifecycleRules wraps rules in a lifecycle configuration
+func lifecycleRules(rules ...string) string {
+	return `<LifecycleConfiguration xmlns="http://s3.amazonaws.com/doc/2006-03-01/">` + strings.Join(rules, "") + `</LifecycleConfiguration>`
+}
+
+func TestLifecycleValidate(t *testing.T) {
+	tests := []struct {
+		name string
+		rule string
+		code string
+	}{
+		// The examples of AWS' lifecycle configuration documentation
+		{"expiration of a prefix", `<Rule><ID>ExampleRule</ID><Filter><Prefix>documents/</Prefix></Filter><Status>Enabled</Status><Expiration><Days>365</Days></Expiration></Rule>`, ""},
+		{"expiration of tagged objects", `<Rule><ID>id</ID><Filter><And><Prefix>tax/</Prefix><Tag><Key>key1</Key><Value>value1</Value></Tag><Tag><Key>key2</Key><Value>value2</Value></Tag></And></Filter><Status>Enabled</Status><Expiration><Days>365</Days></Expiration></Rule>`, ""},
+		{"expiration of every object", `<Rule><Filter></Filter><Status>Disabled</Status><Expiration><Date>2030-01-01T00:00:00Z</Date></Expiration></Rule>`, ""},
+		{"noncurrent versions and delete markers", `<Rule><ID>id</ID><Filter><Prefix>logs/</Prefix></Filter><Status>Enabled</Status><Expiration><ExpiredObjectDeleteMarker>true</ExpiredObjectDeleteMarker></Expiration><NoncurrentVersionExpiration><NewerNoncurrentVersions>5</NewerNoncurrentVersions><NoncurrentDays>30</NoncurrentDays></NoncurrentVersionExpiration></Rule>`, ""},
+		{"incomplete uploads", `<Rule><ID>id</ID><Filter><Prefix>SomeKeyPrefix/</Prefix></Filter><Status>Enabled</Status><AbortIncompleteMultipartUpload><DaysAfterInitiation>7</DaysAfterInitiation></AbortIncompleteMultipartUpload></Rule>`, ""},
+		{"size bounds", `<Rule><ID>id</ID><Filter><And><Prefix>a/</Prefix><ObjectSizeGreaterThan>500</ObjectSizeGreaterThan><ObjectSizeLessThan>64000</ObjectSizeLessThan></And></Filter><Status>Enabled</Status><Expiration><Days>1</Days></Expiration></Rule>`, ""},
+		{"deprecated prefix", `<Rule><ID>id</ID><Prefix>logs/</Prefix><Status>Enabled</Status><Expiration><Days>1</Days></Expiration></Rule>`, ""},
+
+		{"invalid status", `<Rule><Filter/><Status>enabled</Status><Expiration><Days>1</Days></Expiration></Rule>`, "MalformedXML"},
+		{"without a filter", `<Rule><Status>Enabled</Status><Expiration><Days>1</Days></Expiration></Rule>`, "MalformedXML"},
+		{"with a prefix and a filter", `<Rule><Prefix>a</Prefix><Filter/><Status>Enabled</Status><Expiration><Days>1</Days></Expiration></Rule>`, "MalformedXML"},
+		{"with several criteria outside of and", `<Rule><Filter><Prefix>a</Prefix><Tag><Key>k</Key><Value>v</Value></Tag></Filter><Status>Enabled</Status><Expiration><Days>1</Days></Expiration></Rule>`, "MalformedXML"},
+		{"with a transition", `<Rule><Filter/><Status>Enabled</Status><Transition><Days>30</Days><StorageClass>GLACIER</StorageClass></Transition></Rule>`, "NotImplemented"},
+		{"without an action", `<Rule><Filter/><Status>Enabled</Status></Rule>`, "InvalidRequest"},
+		{"expiration by days and date", `<Rule><Filter/><Status>Enabled</Status><Expiration><Days>1</Days><Date>2030-01-01T00:00:00Z</Date></Expiration></Rule>`, "MalformedXML"},
+		{"expiration at a time of day", `<Rule><Filter/><Status>Enabled</Status><Expiration><Date>2030-01-01T12:00:00Z</Date></Expiration></Rule>`, "InvalidArgument"},
+		{"expiration at an invalid date", `<Rule><Filter/><Status>Enabled</Status><Expiration><Date>tomorrow</Date></Expiration></Rule>`, "InvalidArgument"},
+		{"negative expiration", `<Rule><Filter/><Status>Enabled</Status><Expiration><Days>-1</Days></Expiration></Rule>`, "InvalidArgument"},
+		{"delete markers of tagged objects", `<Rule><Filter><Tag><Key>k</Key><Value>v</Value></Tag></Filter><Status>Enabled</Status><Expiration><ExpiredObjectDeleteMarker>true</ExpiredObjectDeleteMarker></Expiration></Rule>`, "InvalidRequest"},
+		{"noncurrent versions without days", `<Rule><Filter/><Status>Enabled</Status><NoncurrentVersionExpiration><NoncurrentDays>0</NoncurrentDays></NoncurrentVersionExpiration></Rule>`, "InvalidArgument"},
+		{"too many newer noncurrent versions", `<Rule><Filter/><Status>Enabled</Status><NoncurrentVersionExpiration><NoncurrentDays>1</NoncurrentDays><NewerNoncurrentVersions>101</NewerNoncurrentVersions></NoncurrentVersionExpiration></Rule>`, "InvalidArgument"},
+		{"incomplete uploads of tagged objects", `<Rule><Filter><Tag><Key>k</Key><Value>v</Value></Tag></Filter><Status>Enabled</Status><AbortIncompleteMultipartUpload><DaysAfterInitiation>1</DaysAfterInitiation></AbortIncompleteMultipartUpload></Rule>`, "InvalidRequest"},
+		{"empty size bounds", `<Rule><Filter><And><ObjectSizeGreaterThan>100</ObjectSizeGreaterThan><ObjectSizeLessThan>100</ObjectSizeLessThan></And></Filter><Status>Enabled</Status><Expiration><Days>1</Days></Expiration></Rule>`, "InvalidArgument"},
+		{"duplicate tag keys", `<Rule><Filter><And><Tag><Key>k</Key><Value>1</Value></Tag><Tag><Key>k</Key><Value>2</Value></Tag></And></Filter><Status>Enabled</Status><Expiration><Days>1</Days></Expiration></Rule>`, "InvalidRequest"},
+		{"long id", `<Rule><ID>` + strings.Repeat("a", 256) + `</ID><Filter/><Status>Enabled</Status><Expiration><Days>1</Days></Expiration></Rule>`, "InvalidArgument"},
+	}
+	for _, tt := range tests {
+		if _, code := parseLifecycle(t, lifecycleRules(tt.rule)); code != tt.code {
+			t.Errorf("%s: got %q, want %q", tt.name, code, tt.code)
+		}
+	}
+
+	rule := `<Rule><ID>id</ID><Filter/><Status>Enabled</Status><Expiration><Days>1</Days></Expiration></Rule>`
+	if _, code := parseLifecycle(t, lifecycleRules()); code != "MalformedXML" {
+		t.Errorf("without rules: got %q, want MalformedXML", code)
+	}
+	if _, code := parseLifecycle(t, lifecycleRules(rule, rule)); code != "InvalidRequest" {
+		t.Errorf("duplicate rule ids: got %q, want InvalidRequest", code)
+	}
+	// Rules without an ID are given one
+	config, code := parseLifecycle(t, lifecycleRules(strings.Replace(rule, "<ID>id</ID>", "", 1), strings.Replace(rule, "<ID>id</ID>", "", 1)))
+	if code != "" || config.Rules[0].ID == "" || config.Rules[0].ID == config.Rules[1].ID {
+		t.Errorf("rules without ids: got %q, ids %q and %q", code, config.Rules[0].ID, config.Rules[1].ID)
+	}
+}
+
+func TestLifecycleCriteria(t *testing.T) {
+	tests := []struct {
+		name        string
+		rule        string
+		prefix      string
+		tags        map[string]string
+		greaterThan int64
+		lessThan    int64
+	}{
+		{"deprecated prefix", `<Rule><Prefix>logs/</Prefix></Rule>`, "logs/", map[string]string{}, 0, 0},
+		{"empty filter", `<Rule><Filter/></Rule>`, "", map[string]string{}, 0, 0},
+		{"prefix", `<Rule><Filter><Prefix>logs/</Prefix></Filter></Rule>`, "logs/", map[string]string{}, 0, 0},
+		{"tag", `<Rule><Filter><Tag><Key>k</Key><Value>v</Value></Tag></Filter></Rule>`, "", map[string]string{"k": "v"}, 0, 0},
+		{"minimum size", `<Rule><Filter><ObjectSizeGreaterThan>10</ObjectSizeGreaterThan></Filter></Rule>`, "", map[string]string{}, 10, 0},
+		{"and", `<Rule><Filter><And><Prefix>logs/</Prefix><Tag><Key>a</Key><Value>1</Value></Tag><Tag><Key>b</Key><Value>2</Value></Tag><ObjectSizeLessThan>20</ObjectSizeLessThan></And></Filter></Rule>`, "logs/", map[string]string{"a": "1", "b": "2"}, 0, 20},
+	}
+	for _, tt := range tests {
+		rule := LifecycleRule{}
+		if err := xml.Unmarshal([]byte(tt.rule), &rule); err != nil {
+			t.Fatal(err)
+		}
+		prefix, tags, greaterThan, lessThan := rule.Criteria()
+		if prefix != tt.prefix || !reflect.DeepEqual(tags, tt.tags) || greaterThan != tt.greaterThan || lessThan != tt.lessThan {
+			t.Errorf("%s: got %q, %v, %d, %d", tt.name, prefix, tags, greaterThan, lessThan)
+		}
+	}
+
+	for date, want := range map[string]time.Time{
+		"2030-01-01T00:00:00Z": time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC),
+		"2030-01-01":           time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC),
+	} {
+		if got, ok := (&LifecycleExpiration{Date: date}).ExpirationDate(); !ok || !got.Equal(want) {
+			t.Errorf("date of %s = %v, %v", date, got, ok)
+		}
+	}
+	if _, ok := (&LifecycleExpiration{Days: 1}).ExpirationDate(); ok {
+		t.Error("expiration by days has a date")
+	}
+}
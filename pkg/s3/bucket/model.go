@@ -1,10 +1,10 @@
 package s3bucket
 
 import (
-	"os/user"
 	"time"
 
 	s3object "github.com/jakthom/s3c/pkg/s3/object"
+	s3user "github.com/jakthom/s3c/pkg/s3/user"
 )
 
 // Bucket is an XML marshallable representation of a bucket
@@ -35,7 +35,7 @@ type Version struct {
 	// StorageClass specifies the storage class used for the object
 	StorageClass string `xml:"StorageClass"`
 	// Owner specifies the owner of the object
-	Owner user.User `xml:"Owner"`
+	Owner *s3user.User `xml:"Owner,omitempty"`
 }
 
 // ListObjectsResult is a response from a ListObjects call
@@ -48,12 +48,31 @@ type ListObjectsResult struct {
 	IsTruncated bool
 }
 
+// ListObjectsV2Result is a response from a ListObjectsV2 call
+type ListObjectsV2Result struct {
+	// Contents are the list of objects returned
+	Contents []*s3object.Object
+	// CommonPrefixes are the list of common prefixes returned
+	CommonPrefixes []*s3object.CommonPrefixes
+	// IsTruncated specifies whether this is the end of the list or not
+	IsTruncated bool
+	// NextContinuationToken is an opaque token from which the listing
+	// continues, if it is truncated
+	NextContinuationToken string
+}
+
 // ListObjectVersionsResult is a response from a ListObjectVersions call
 type ListObjectVersionsResult struct {
 	// Versions are the list of versions returned
 	Versions []*Version
 	// DeleteMarkers are the list of delete markers returned
 	DeleteMarkers []*s3object.DeleteMarker
+	// CommonPrefixes are the list of common prefixes returned
+	CommonPrefixes []*s3object.CommonPrefixes
 	// IsTruncated specifies whether this is the end of the list or not
 	IsTruncated bool
+	// NextKeyMarker and NextVersionIDMarker specify where the listing
+	// continues from, if it is truncated
+	NextKeyMarker       string
+	NextVersionIDMarker string
 }
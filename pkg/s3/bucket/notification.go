@@ -0,0 +1,190 @@
+package s3bucket
+
+import (
+	"encoding/xml"
+	"net/http"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	s3error "github.com/jakthom/s3c/pkg/s3/error"
+	s3event "github.com/jakthom/s3c/pkg/s3/event"
+	s3util "github.com/jakthom/s3c/pkg/s3/util"
+)
+
+// NotificationConfiguration is the XML marshallable notification
+// configuration of a bucket: the destinations notified of the events of its
+// objects
+type NotificationConfiguration struct {
+	XMLName             xml.Name             `xml:"http://s3.amazonaws.com/doc/2006-03-01/ NotificationConfiguration"`
+	QueueConfigurations []QueueConfiguration `xml:"QueueConfiguration"`
+}
+
+// QueueConfiguration notifies a queue, the ARN of an s3c notification
+// target, of the events of the objects matching a filter
+type QueueConfiguration struct {
+	ID     string              `xml:"Id,omitempty"`
+	Queue  string              `xml:"Queue"`
+	Events []string            `xml:"Event"`
+	Filter *NotificationFilter `xml:"Filter,omitempty"`
+}
+
+// NotificationFilter filters the objects notified of by the prefix and
+// suffix of their key
+type NotificationFilter struct {
+	Rules []FilterRule `xml:"S3Key>FilterRule"`
+}
+
+// FilterRule is a `prefix` or `suffix` rule of a notification filter
+type FilterRule struct {
+	Name  string `xml:"Name"`
+	Value string `xml:"Value"`
+}
+
+// Matches returns whether the configuration notifies of an event of an
+// object
+func (c *QueueConfiguration) Matches(event, key string) bool {
+	matched := false
+	for _, name := range c.Events {
+		name = strings.TrimPrefix(name, "s3:")
+		if name == event || (strings.HasSuffix(name, ":*") && strings.HasPrefix(event, strings.TrimSuffix(name, "*"))) {
+			matched = true
+			break
+		}
+	}
+	if !matched || c.Filter == nil {
+		return matched
+	}
+	for _, rule := range c.Filter.Rules {
+		switch strings.ToLower(rule.Name) {
+		case "prefix":
+			if !strings.HasPrefix(key, rule.Value) {
+				return false
+			}
+		case "suffix":
+			if !strings.HasSuffix(key, rule.Value) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// validate checks a notification configuration against the limits of s3,
+// generating the IDs of queue configurations that have none
+func (c *NotificationConfiguration) validate(r *http.Request) error {
+	ids := map[string]bool{}
+	for i := range c.QueueConfigurations {
+		queue := &c.QueueConfigurations[i]
+		if queue.ID == "" {
+			queue.ID = uuid.New().String()
+		}
+		if ids[queue.ID] {
+			return s3error.InvalidRequestError(r, "Configuration Id must be unique.")
+		}
+		ids[queue.ID] = true
+		if queue.Queue == "" || len(queue.Events) == 0 {
+			return s3error.MalformedXMLError(r)
+		}
+		for _, event := range queue.Events {
+			if !validEvent(event) {
+				return s3error.InvalidRequestError(r, "The event is not supported for notifications: "+event)
+			}
+		}
+		if queue.Filter == nil {
+			continue
+		}
+		names := map[string]bool{}
+		for _, rule := range queue.Filter.Rules {
+			name := strings.ToLower(rule.Name)
+			if name != "prefix" && name != "suffix" {
+				return s3error.InvalidRequestError(r, "filter rule name must be either prefix or suffix")
+			}
+			if names[name] {
+				return s3error.InvalidRequestError(r, "Cannot specify more than one "+name+" rule in a filter.")
+			}
+			names[name] = true
+		}
+	}
+	return nil
+}
+
+// validEvent returns whether an event may be notified of, as named in a
+// configuration: `s3:` followed by the name of an event, or by the type of
+// events and a `*` wildcard
+func validEvent(event string) bool {
+	if !strings.HasPrefix(event, "s3:") {
+		return false
+	}
+	event = strings.TrimPrefix(event, "s3:")
+	for _, name := range s3event.Names {
+		kind, _, _ := strings.Cut(name, ":")
+		if event == name || event == kind+":*" {
+			return true
+		}
+	}
+	return false
+}
+
+func (h *BucketHandler) Notification(w http.ResponseWriter, r *http.Request) {
+	bucket := mux.Vars(r)["bucket"]
+	if err := h.requireNotifications(r, bucket); err != nil {
+		s3util.WriteError(w, r, err)
+		return
+	}
+
+	config, err := h.Notifications.GetBucketNotification(r, bucket)
+	if err != nil {
+		s3util.WriteError(w, r, err)
+		return
+	}
+
+	s3util.WriteXML(w, r, http.StatusOK, config)
+}
+
+func (h *BucketHandler) SetNotification(w http.ResponseWriter, r *http.Request) {
+	bucket := mux.Vars(r)["bucket"]
+	if err := h.requireNotifications(r, bucket); err != nil {
+		s3util.WriteError(w, r, err)
+		return
+	}
+
+	payload := struct {
+		XMLName             xml.Name             `xml:"NotificationConfiguration"`
+		QueueConfigurations []QueueConfiguration `xml:"QueueConfiguration"`
+		// Topics, functions and EventBridge have no s3c equivalent
+		TopicConfigurations         []struct{} `xml:"TopicConfiguration"`
+		CloudFunctionConfigurations []struct{} `xml:"CloudFunctionConfiguration"`
+		EventBridgeConfiguration    *struct{}  `xml:"EventBridgeConfiguration"`
+	}{}
+	if err := s3util.ReadXMLBody(r, &payload); err != nil {
+		s3util.WriteError(w, r, err)
+		return
+	}
+	if len(payload.TopicConfigurations) > 0 || len(payload.CloudFunctionConfigurations) > 0 || payload.EventBridgeConfiguration != nil {
+		s3util.WriteError(w, r, s3error.InvalidRequestError(r, "Only QueueConfiguration destinations are supported."))
+		return
+	}
+	config := &NotificationConfiguration{QueueConfigurations: payload.QueueConfigurations}
+	if err := config.validate(r); err != nil {
+		s3util.WriteError(w, r, err)
+		return
+	}
+
+	if err := h.Notifications.PutBucketNotification(r, bucket, config); err != nil {
+		s3util.WriteError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// requireNotifications checks that notification configurations are
+// supported, and that the bucket exists
+func (h *BucketHandler) requireNotifications(r *http.Request, bucket string) error {
+	if h.Notifications == nil {
+		return s3error.NotImplementedError(r)
+	}
+	_, err := h.Controller.GetBucketVersioning(r, bucket)
+	return err
+}
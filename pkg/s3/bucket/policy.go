@@ -0,0 +1,111 @@
+package s3bucket
+
+import (
+	"encoding/xml"
+	"io"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	s3error "github.com/jakthom/s3c/pkg/s3/error"
+	s3util "github.com/jakthom/s3c/pkg/s3/util"
+)
+
+// PolicyStatus is the response of a GetBucketPolicyStatus call
+type PolicyStatus struct {
+	XMLName  xml.Name `xml:"http://s3.amazonaws.com/doc/2006-03-01/ PolicyStatus"`
+	IsPublic bool     `xml:"IsPublic"`
+}
+
+func (h *BucketHandler) Policy(w http.ResponseWriter, r *http.Request) {
+	bucket := mux.Vars(r)["bucket"]
+	if err := h.requirePolicies(r, bucket); err != nil {
+		s3util.WriteError(w, r, err)
+		return
+	}
+
+	document, err := h.Policies.GetBucketPolicy(r, bucket)
+	if err != nil {
+		s3util.WriteError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(document)
+}
+
+func (h *BucketHandler) PolicyStatus(w http.ResponseWriter, r *http.Request) {
+	bucket := mux.Vars(r)["bucket"]
+	if err := h.requirePolicies(r, bucket); err != nil {
+		s3util.WriteError(w, r, err)
+		return
+	}
+
+	isPublic, err := h.Policies.GetBucketPolicyStatus(r, bucket)
+	if err != nil {
+		s3util.WriteError(w, r, err)
+		return
+	}
+
+	s3util.WriteXML(w, r, http.StatusOK, PolicyStatus{IsPublic: isPublic})
+}
+
+func (h *BucketHandler) SetPolicy(w http.ResponseWriter, r *http.Request) {
+	bucket := mux.Vars(r)["bucket"]
+	if err := h.requirePolicies(r, bucket); err != nil {
+		s3util.WriteError(w, r, err)
+		return
+	}
+
+	document, err := io.ReadAll(io.LimitReader(r.Body, MaxPolicySize+1))
+	if err != nil {
+		s3util.WriteError(w, r, err)
+		return
+	}
+	if len(document) == 0 {
+		s3util.WriteError(w, r, s3error.MissingRequestBodyError(r))
+		return
+	}
+	if int64(len(document)) > MaxPolicySize {
+		s3util.WriteError(w, r, s3error.MalformedPolicyError(r, "Policies must be at most 20KB"))
+		return
+	}
+	if err := s3util.VerifyContentMD5(r, document); err != nil {
+		s3util.WriteError(w, r, err)
+		return
+	}
+
+	if err := h.Policies.PutBucketPolicy(r, bucket, document); err != nil {
+		s3util.WriteError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *BucketHandler) DelPolicy(w http.ResponseWriter, r *http.Request) {
+	bucket := mux.Vars(r)["bucket"]
+	if err := h.requirePolicies(r, bucket); err != nil {
+		s3util.WriteError(w, r, err)
+		return
+	}
+
+	if err := h.Policies.DeleteBucketPolicy(r, bucket); err != nil {
+		s3util.WriteError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// requirePolicies checks that bucket policies and ACLs are supported, and
+// that the bucket exists
+func (h *BucketHandler) requirePolicies(r *http.Request, bucket string) error {
+	if h.Policies == nil {
+		return s3error.NotImplementedError(r)
+	}
+	// Getting the versioning status of a bucket is the cheapest way for
+	// every origin to tell whether it exists
+	_, err := h.Controller.GetBucketVersioning(r, bucket)
+	return err
+}
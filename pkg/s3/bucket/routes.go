@@ -1,30 +1,57 @@
 package s3bucket
 
-import "github.com/gorilla/mux"
+import (
+	"github.com/gorilla/mux"
+	s3multipart "github.com/jakthom/s3c/pkg/s3/multipart"
+	s3object "github.com/jakthom/s3c/pkg/s3/object"
+)
 
 const (
 	Route              = `/{bucket:[a-zA-Z0-9\-_\.]{1,255}}`
 	trailingSlashRoute = `/{bucket:[a-zA-Z0-9\-_\.]{1,255}}/`
 )
 
-func AddSubrouter(router *mux.Router, handler *BucketHandler) error {
+func AddSubrouter(router *mux.Router, handler *BucketHandler, multipartHandler *s3multipart.MultipartHandler, objectHandler *s3object.ObjectHandler) error {
 	subrouter := router.PathPrefix(Route).Subrouter()
-	attachRoutes(subrouter, handler)
+	attachRoutes(subrouter, handler, multipartHandler, objectHandler)
 	trailingSlashSubrouter := router.PathPrefix(trailingSlashRoute).Subrouter()
-	attachRoutes(trailingSlashSubrouter, handler)
+	attachRoutes(trailingSlashSubrouter, handler, multipartHandler, objectHandler)
 	return nil
 }
 
-// AttachRoutes attaches the routes for the bucket handler to the router
+// AttachRoutes attaches the routes for the bucket handler to the router. Each
+// route is named after the s3 action that requests routed to it are
+// authorized for.
 // func attachBucketRoutes(router *mux.Router, handler *BucketHandler, multipartHandler *multipartHandler, objectHandler *objectHandler) {
-func attachRoutes(router *mux.Router, handler *BucketHandler) {
-	// router.Methods("GET").Queries("versioning", "").HandlerFunc(handler.versioning) // TODO
-	// router.Methods("PUT").Queries("versioning", "").HandlerFunc(handler.setVersioning) // TODO
-	// router.Methods("GET").Queries("versions", "").HandlerFunc(handler.listVersions) // TODO
-	// router.Methods("GET").Queries("uploads", "").HandlerFunc(multipartHandler.list) // TODO
-	router.Methods("GET").Queries("location", "").HandlerFunc(handler.Location)
-	router.Methods("GET", "HEAD").HandlerFunc(handler.Get)
-	router.Methods("PUT").HandlerFunc(handler.Put)
-	// router.Methods("POST").Queries("delete", "").HandlerFunc(objectHandler.post)
-	router.Methods("DELETE").HandlerFunc(handler.Del)
+func attachRoutes(router *mux.Router, handler *BucketHandler, multipartHandler *s3multipart.MultipartHandler, objectHandler *s3object.ObjectHandler) {
+	router.Methods("GET").Queries("versioning", "").HandlerFunc(handler.Versioning).Name("s3:GetBucketVersioning")
+	router.Methods("PUT").Queries("versioning", "").HandlerFunc(handler.SetVersioning).Name("s3:PutBucketVersioning")
+	router.Methods("GET").Queries("versions", "").HandlerFunc(handler.ListVersions).Name("s3:ListBucketVersions")
+	router.Methods("GET").Queries("policy", "").HandlerFunc(handler.Policy).Name("s3:GetBucketPolicy")
+	router.Methods("PUT").Queries("policy", "").HandlerFunc(handler.SetPolicy).Name("s3:PutBucketPolicy")
+	router.Methods("DELETE").Queries("policy", "").HandlerFunc(handler.DelPolicy).Name("s3:DeleteBucketPolicy")
+	router.Methods("GET").Queries("policyStatus", "").HandlerFunc(handler.PolicyStatus).Name("s3:GetBucketPolicyStatus")
+	router.Methods("GET").Queries("acl", "").HandlerFunc(handler.ACL).Name("s3:GetBucketAcl")
+	router.Methods("PUT").Queries("acl", "").HandlerFunc(handler.SetACL).Name("s3:PutBucketAcl")
+	router.Methods("GET").Queries("cors", "").HandlerFunc(handler.CORS).Name("s3:GetBucketCORS")
+	router.Methods("PUT").Queries("cors", "").HandlerFunc(handler.SetCORS).Name("s3:PutBucketCORS")
+	router.Methods("DELETE").Queries("cors", "").HandlerFunc(handler.DelCORS).Name("s3:PutBucketCORS")
+	router.Methods("GET").Queries("website", "").HandlerFunc(handler.Website).Name("s3:GetBucketWebsite")
+	router.Methods("PUT").Queries("website", "").HandlerFunc(handler.SetWebsite).Name("s3:PutBucketWebsite")
+	router.Methods("DELETE").Queries("website", "").HandlerFunc(handler.DelWebsite).Name("s3:DeleteBucketWebsite")
+	router.Methods("GET").Queries("notification", "").HandlerFunc(handler.Notification).Name("s3:GetBucketNotification")
+	router.Methods("PUT").Queries("notification", "").HandlerFunc(handler.SetNotification).Name("s3:PutBucketNotification")
+	router.Methods("GET").Queries("lifecycle", "").HandlerFunc(handler.Lifecycle).Name("s3:GetLifecycleConfiguration")
+	router.Methods("PUT").Queries("lifecycle", "").HandlerFunc(handler.SetLifecycle).Name("s3:PutLifecycleConfiguration")
+	router.Methods("DELETE").Queries("lifecycle", "").HandlerFunc(handler.DelLifecycle).Name("s3:PutLifecycleConfiguration")
+	router.Methods("GET").Queries("tagging", "").HandlerFunc(handler.Tagging).Name("s3:GetBucketTagging")
+	router.Methods("PUT").Queries("tagging", "").HandlerFunc(handler.SetTagging).Name("s3:PutBucketTagging")
+	router.Methods("DELETE").Queries("tagging", "").HandlerFunc(handler.DelTagging).Name("s3:PutBucketTagging")
+	router.Methods("GET").Queries("uploads", "").HandlerFunc(multipartHandler.List).Name("s3:ListBucketMultipartUploads")
+	router.Methods("GET").Queries("location", "").HandlerFunc(handler.Location).Name("s3:GetBucketLocation")
+	router.Methods("GET", "HEAD").Queries("list-type", "2").HandlerFunc(handler.ListV2).Name("s3:ListBucket")
+	router.Methods("GET", "HEAD").HandlerFunc(handler.Get).Name("s3:ListBucket")
+	router.Methods("PUT").HandlerFunc(handler.Put).Name("s3:CreateBucket")
+	router.Methods("POST").Queries("delete", "").HandlerFunc(objectHandler.Post).Name("s3:DeleteObject")
+	router.Methods("DELETE").HandlerFunc(handler.Del).Name("s3:DeleteBucket")
 }
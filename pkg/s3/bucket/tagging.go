@@ -0,0 +1,48 @@
+package s3bucket
+
+import (
+	"net/http"
+
+	"github.com/gorilla/mux"
+	s3util "github.com/jakthom/s3c/pkg/s3/util"
+)
+
+func (h *BucketHandler) Tagging(w http.ResponseWriter, r *http.Request) {
+	bucket := mux.Vars(r)["bucket"]
+
+	tags, err := h.Controller.GetBucketTagging(r, bucket)
+	if err != nil {
+		s3util.WriteError(w, r, err)
+		return
+	}
+
+	s3util.WriteXML(w, r, http.StatusOK, s3util.NewTagging(tags))
+}
+
+func (h *BucketHandler) SetTagging(w http.ResponseWriter, r *http.Request) {
+	bucket := mux.Vars(r)["bucket"]
+
+	tags, err := s3util.ReadTagging(r, s3util.MaxBucketTags)
+	if err != nil {
+		s3util.WriteError(w, r, err)
+		return
+	}
+
+	if err := h.Controller.PutBucketTagging(r, bucket, tags); err != nil {
+		s3util.WriteError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *BucketHandler) DelTagging(w http.ResponseWriter, r *http.Request) {
+	bucket := mux.Vars(r)["bucket"]
+
+	if err := h.Controller.PutBucketTagging(r, bucket, map[string]string{}); err != nil {
+		s3util.WriteError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
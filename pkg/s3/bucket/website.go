@@ -0,0 +1,242 @@
+package s3bucket
+
+import (
+	"encoding/xml"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+	s3error "github.com/jakthom/s3c/pkg/s3/error"
+	s3util "github.com/jakthom/s3c/pkg/s3/util"
+)
+
+// WebsiteConfiguration is the XML marshallable website configuration of a
+// bucket, by which its contents are served as a static website
+type WebsiteConfiguration struct {
+	XMLName               xml.Name               `xml:"http://s3.amazonaws.com/doc/2006-03-01/ WebsiteConfiguration"`
+	IndexDocument         *IndexDocument         `xml:"IndexDocument,omitempty"`
+	ErrorDocument         *ErrorDocument         `xml:"ErrorDocument,omitempty"`
+	RedirectAllRequestsTo *RedirectAllRequestsTo `xml:"RedirectAllRequestsTo,omitempty"`
+	RoutingRules          []RoutingRule          `xml:"RoutingRules>RoutingRule,omitempty"`
+}
+
+// IndexDocument is the suffix appended to requests for a directory, ie
+// `index.html`
+type IndexDocument struct {
+	Suffix string `xml:"Suffix"`
+}
+
+// ErrorDocument is the key of the object served when a request fails
+type ErrorDocument struct {
+	Key string `xml:"Key"`
+}
+
+// RedirectAllRequestsTo redirects every request to a website to another host
+type RedirectAllRequestsTo struct {
+	HostName string `xml:"HostName"`
+	Protocol string `xml:"Protocol,omitempty"`
+}
+
+// RoutingRule redirects the requests to a website meeting a condition
+type RoutingRule struct {
+	Condition *RoutingRuleCondition `xml:"Condition,omitempty"`
+	Redirect  Redirect              `xml:"Redirect"`
+}
+
+// RoutingRuleCondition is met by requests for keys with a prefix, whose
+// response has an error status, or both
+type RoutingRuleCondition struct {
+	KeyPrefixEquals             string `xml:"KeyPrefixEquals,omitempty"`
+	HttpErrorCodeReturnedEquals string `xml:"HttpErrorCodeReturnedEquals,omitempty"`
+}
+
+// Redirect is where a routing rule redirects requests to. Unset fields keep
+// those of the request.
+type Redirect struct {
+	HostName         string `xml:"HostName,omitempty"`
+	HttpRedirectCode string `xml:"HttpRedirectCode,omitempty"`
+	Protocol         string `xml:"Protocol,omitempty"`
+	// ReplaceKeyPrefixWith replaces the KeyPrefixEquals of the condition, and
+	// may be empty to remove it
+	ReplaceKeyPrefixWith *string `xml:"ReplaceKeyPrefixWith"`
+	ReplaceKeyWith       *string `xml:"ReplaceKeyWith"`
+}
+
+// RoutingRule returns the first routing rule redirecting a request for a
+// key, or nil if none does. `status` is the error status of the response to
+// the request, or 0 before it is known.
+func (c *WebsiteConfiguration) RoutingRule(key string, status int) *RoutingRule {
+	for i := range c.RoutingRules {
+		rule := &c.RoutingRules[i]
+		errorCode := ""
+		if rule.Condition != nil {
+			if !strings.HasPrefix(key, rule.Condition.KeyPrefixEquals) {
+				continue
+			}
+			errorCode = rule.Condition.HttpErrorCodeReturnedEquals
+		}
+		// Rules without an error condition apply before objects are read
+		if (errorCode == "" && status == 0) || (errorCode != "" && errorCode == strconv.Itoa(status)) {
+			return rule
+		}
+	}
+	return nil
+}
+
+// RedirectKey returns the key a routing rule redirects a request for a key to
+func (rule *RoutingRule) RedirectKey(key string) string {
+	if rule.Redirect.ReplaceKeyWith != nil {
+		return *rule.Redirect.ReplaceKeyWith
+	}
+	if rule.Redirect.ReplaceKeyPrefixWith != nil {
+		prefix := ""
+		if rule.Condition != nil {
+			prefix = rule.Condition.KeyPrefixEquals
+		}
+		return *rule.Redirect.ReplaceKeyPrefixWith + strings.TrimPrefix(key, prefix)
+	}
+	return key
+}
+
+// RedirectCode returns the status of the redirects of a routing rule
+func (rule *RoutingRule) RedirectCode() int {
+	if code, err := strconv.Atoi(rule.Redirect.HttpRedirectCode); err == nil {
+		return code
+	}
+	return http.StatusMovedPermanently
+}
+
+// validate checks a website configuration against the limits of s3
+func (c *WebsiteConfiguration) validate(r *http.Request) error {
+	if c.RedirectAllRequestsTo != nil {
+		if c.IndexDocument != nil || c.ErrorDocument != nil || len(c.RoutingRules) > 0 {
+			return s3error.InvalidRequestError(r, "RedirectAllRequestsTo cannot be provided in conjunction with other Routing Rules.")
+		}
+		if c.RedirectAllRequestsTo.HostName == "" {
+			return s3error.MalformedXMLError(r)
+		}
+		return validProtocol(r, c.RedirectAllRequestsTo.Protocol)
+	}
+	if c.IndexDocument == nil {
+		return s3error.InvalidRequestError(r, "A value for IndexDocument Suffix must be provided if RedirectAllRequestsTo is empty")
+	}
+	if c.IndexDocument.Suffix == "" || strings.Contains(c.IndexDocument.Suffix, "/") {
+		return s3error.InvalidRequestError(r, "The IndexDocument Suffix is not well formed")
+	}
+	if c.ErrorDocument != nil && c.ErrorDocument.Key == "" {
+		return s3error.InvalidRequestError(r, "The ErrorDocument Key is not well formed")
+	}
+	if len(c.RoutingRules) > MaxWebsiteRoutingRules {
+		return s3error.InvalidRequestError(r, "The number of routing rules must not exceed "+strconv.Itoa(MaxWebsiteRoutingRules))
+	}
+	for _, rule := range c.RoutingRules {
+		if condition := rule.Condition; condition != nil && condition.HttpErrorCodeReturnedEquals != "" {
+			code, err := strconv.Atoi(condition.HttpErrorCodeReturnedEquals)
+			if err != nil || code < 400 || code > 599 {
+				return s3error.InvalidRequestError(r, "The provided HTTP error code ("+condition.HttpErrorCodeReturnedEquals+") is not valid. Valid codes are 4XX or 5XX.")
+			}
+		}
+		redirect := rule.Redirect
+		if redirect.HttpRedirectCode != "" {
+			code, err := strconv.Atoi(redirect.HttpRedirectCode)
+			if err != nil || code < 301 || code > 399 {
+				return s3error.InvalidRequestError(r, "The provided HTTP redirect code ("+redirect.HttpRedirectCode+") is not valid. Valid codes are 3XX except 300.")
+			}
+		}
+		if redirect.ReplaceKeyPrefixWith != nil && redirect.ReplaceKeyWith != nil {
+			return s3error.InvalidRequestError(r, "You can only define ReplaceKeyPrefix or ReplaceKey but not both.")
+		}
+		if err := validProtocol(r, redirect.Protocol); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// validProtocol checks the protocol of a redirect, which is that of the
+// request if not set
+func validProtocol(r *http.Request, protocol string) error {
+	if protocol != "" && protocol != "http" && protocol != "https" {
+		return s3error.InvalidRequestError(r, "Invalid protocol, protocol can be http or https. If not defined the protocol will be selected automatically.")
+	}
+	return nil
+}
+
+func (h *BucketHandler) Website(w http.ResponseWriter, r *http.Request) {
+	bucket := mux.Vars(r)["bucket"]
+	if err := h.requireWebsites(r, bucket); err != nil {
+		s3util.WriteError(w, r, err)
+		return
+	}
+
+	config, err := h.Websites.GetBucketWebsite(r, bucket)
+	if err != nil {
+		s3util.WriteError(w, r, err)
+		return
+	}
+
+	s3util.WriteXML(w, r, http.StatusOK, config)
+}
+
+func (h *BucketHandler) SetWebsite(w http.ResponseWriter, r *http.Request) {
+	bucket := mux.Vars(r)["bucket"]
+	if err := h.requireWebsites(r, bucket); err != nil {
+		s3util.WriteError(w, r, err)
+		return
+	}
+
+	payload := struct {
+		XMLName               xml.Name               `xml:"WebsiteConfiguration"`
+		IndexDocument         *IndexDocument         `xml:"IndexDocument"`
+		ErrorDocument         *ErrorDocument         `xml:"ErrorDocument"`
+		RedirectAllRequestsTo *RedirectAllRequestsTo `xml:"RedirectAllRequestsTo"`
+		RoutingRules          []RoutingRule          `xml:"RoutingRules>RoutingRule"`
+	}{}
+	if err := s3util.ReadXMLBody(r, &payload); err != nil {
+		s3util.WriteError(w, r, err)
+		return
+	}
+	config := &WebsiteConfiguration{
+		IndexDocument:         payload.IndexDocument,
+		ErrorDocument:         payload.ErrorDocument,
+		RedirectAllRequestsTo: payload.RedirectAllRequestsTo,
+		RoutingRules:          payload.RoutingRules,
+	}
+	if err := config.validate(r); err != nil {
+		s3util.WriteError(w, r, err)
+		return
+	}
+
+	if err := h.Websites.PutBucketWebsite(r, bucket, config); err != nil {
+		s3util.WriteError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+func (h *BucketHandler) DelWebsite(w http.ResponseWriter, r *http.Request) {
+	bucket := mux.Vars(r)["bucket"]
+	if err := h.requireWebsites(r, bucket); err != nil {
+		s3util.WriteError(w, r, err)
+		return
+	}
+
+	if err := h.Websites.DeleteBucketWebsite(r, bucket); err != nil {
+		s3util.WriteError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// requireWebsites checks that website configurations are supported, and
+// that the bucket exists
+func (h *BucketHandler) requireWebsites(r *http.Request, bucket string) error {
+	if h.Websites == nil {
+		return s3error.NotImplementedError(r)
+	}
+	_, err := h.Controller.GetBucketVersioning(r, bucket)
+	return err
+}
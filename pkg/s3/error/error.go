@@ -54,17 +54,40 @@ func AccessDeniedError(r *http.Request) *Error {
 	return NewError(r, http.StatusForbidden, "AccessDenied", "Access Denied")
 }
 
+// AccessForbiddenError creates a new S3 error with a standard AccessForbidden
+// S3 code, as returned for disallowed CORS requests.
+func AccessForbiddenError(r *http.Request, message string) *Error {
+	return NewError(r, http.StatusForbidden, "AccessForbidden", message)
+}
+
 // AuthorizationHeaderMalformedError creates a new S3 error with a standard
 // AuthorizationHeaderMalformed S3 code.
 func AuthorizationHeaderMalformedError(r *http.Request) *Error {
 	return NewError(r, http.StatusBadRequest, "AuthorizationHeaderMalformed", "The authorization header you provided is invalid.")
 }
 
+// AuthorizationQueryParametersError creates a new S3 error with a standard
+// AuthorizationQueryParametersError S3 code.
+func AuthorizationQueryParametersError(r *http.Request) *Error {
+	return NewError(r, http.StatusBadRequest, "AuthorizationQueryParametersError", "The authorization query parameters you provided are invalid.")
+}
+
+// BadChecksumError creates a new S3 error with a standard BadDigest S3 code,
+// for payloads that do not match their checksum.
+func BadChecksumError(r *http.Request, algorithm string) *Error {
+	return NewError(r, http.StatusBadRequest, "BadDigest", "The "+algorithm+" you specified did not match the calculated checksum.")
+}
+
 // BadDigestError creates a new S3 error with a standard BadDigest S3 code.
 func BadDigestError(r *http.Request) *Error {
 	return NewError(r, http.StatusBadRequest, "BadDigest", "The Content-MD5 you specified did not match what we received.")
 }
 
+// BadRequestError creates a new S3 error with a standard BadRequest S3 code.
+func BadRequestError(r *http.Request, message string) *Error {
+	return NewError(r, http.StatusBadRequest, "BadRequest", message)
+}
+
 // BucketNotEmptyError creates a new S3 error with a standard BucketNotEmpty
 // S3 code.
 func BucketNotEmptyError(r *http.Request) *Error {
@@ -77,6 +100,12 @@ func BucketAlreadyOwnedByYouError(r *http.Request) *Error {
 	return NewError(r, http.StatusConflict, "BucketAlreadyOwnedByYou", "The bucket you tried to create already exists, and you own it.")
 }
 
+// ConditionalRequestConflictError creates a new S3 error with a standard
+// ConditionalRequestConflict S3 code.
+func ConditionalRequestConflictError(r *http.Request) *Error {
+	return NewError(r, http.StatusConflict, "ConditionalRequestConflict", "A conflicting operation occurred. If using PutObject you can retry the request. If using multipart upload you should initiate another CreateMultipartUpload request and re-upload each part.")
+}
+
 // EntityTooLargeError creates a new S3 error with a standard EntityTooLarge
 // S3 code.
 func EntityTooLargeError(r *http.Request) *Error {
@@ -89,6 +118,18 @@ func EntityTooSmallError(r *http.Request) *Error {
 	return NewError(r, http.StatusBadRequest, "EntityTooSmall", "Your proposed upload is smaller than the minimum allowed object size. Each part must be at least 5 MB in size, except the last part.")
 }
 
+// ExpiredPresignedRequestError creates a new S3 error with a standard
+// AccessDenied S3 code, for presigned requests that have expired.
+func ExpiredPresignedRequestError(r *http.Request) *Error {
+	return NewError(r, http.StatusForbidden, "AccessDenied", "Request has expired")
+}
+
+// ExpiredTokenError creates a new S3 error with a standard ExpiredToken S3
+// code.
+func ExpiredTokenError(r *http.Request) *Error {
+	return NewError(r, http.StatusBadRequest, "ExpiredToken", "The provided token has expired.")
+}
+
 // IllegalVersioningConfigurationError creates a new S3 error with a standard
 // IllegalVersioningConfigurationException S3 code.
 func IllegalVersioningConfigurationError(r *http.Request) *Error {
@@ -135,18 +176,53 @@ func InvalidPartError(r *http.Request) *Error {
 	return NewError(r, http.StatusBadRequest, "InvalidPart", "One or more of the specified parts could not be found. The part might not have been uploaded, or the specified entity tag might not have matched the part's entity tag.")
 }
 
+// InvalidPartNumberError creates a new S3 error with a standard
+// InvalidPartNumber S3 code.
+func InvalidPartNumberError(r *http.Request) *Error {
+	return NewError(r, http.StatusRequestedRangeNotSatisfiable, "InvalidPartNumber", "The requested partnumber is not satisfiable")
+}
+
 // InvalidPartOrderError creates a new S3 error with a standard
 // InvalidPartOrder S3 code.
 func InvalidPartOrderError(w http.ResponseWriter, r *http.Request) *Error {
 	return NewError(r, http.StatusBadRequest, "InvalidPartOrder", "The list of parts was not in ascending order. Parts list must be specified in order by part number.")
 }
 
+// InvalidRangeError creates a new S3 error with a standard InvalidRange S3
+// code.
+func InvalidRangeError(r *http.Request) *Error {
+	return NewError(r, http.StatusRequestedRangeNotSatisfiable, "InvalidRange", "The requested range is not satisfiable")
+}
+
 // InvalidRequestError creates a new S3 error with a standard
 // InvalidRequest S3 code.
 func InvalidRequestError(r *http.Request, message string) *Error {
 	return NewError(r, http.StatusBadRequest, "InvalidRequest", message)
 }
 
+// InvalidTagError creates a new S3 error with a standard InvalidTag S3 code.
+func InvalidTagError(r *http.Request, message string) *Error {
+	return NewError(r, http.StatusBadRequest, "InvalidTag", message)
+}
+
+// InvalidTokenError creates a new S3 error with a standard InvalidToken S3
+// code.
+func InvalidTokenError(r *http.Request) *Error {
+	return NewError(r, http.StatusBadRequest, "InvalidToken", "The provided token is malformed or otherwise invalid.")
+}
+
+// MalformedPolicyError creates a new S3 error with a standard
+// MalformedPolicy S3 code.
+func MalformedPolicyError(r *http.Request, message string) *Error {
+	return NewError(r, http.StatusBadRequest, "MalformedPolicy", message)
+}
+
+// MalformedTrailerError creates a new S3 error with a standard
+// MalformedTrailerError S3 code.
+func MalformedTrailerError(r *http.Request) *Error {
+	return NewError(r, http.StatusBadRequest, "MalformedTrailerError", "The request contained trailing data that was not well-formed or did not conform to our published schema.")
+}
+
 // MalformedXMLError creates a new S3 error with a standard MalformedXML S3
 // code.
 func MalformedXMLError(r *http.Request) *Error {
@@ -177,11 +253,35 @@ func NoSuchBucketError(r *http.Request) *Error {
 	return NewError(r, http.StatusNotFound, "NoSuchBucket", "The specified bucket does not exist.")
 }
 
+// NoSuchBucketPolicyError creates a new S3 error with a standard
+// NoSuchBucketPolicy S3 code.
+func NoSuchBucketPolicyError(r *http.Request) *Error {
+	return NewError(r, http.StatusNotFound, "NoSuchBucketPolicy", "The bucket policy does not exist")
+}
+
+// NoSuchCORSConfigurationError creates a new S3 error with a standard
+// NoSuchCORSConfiguration S3 code.
+func NoSuchCORSConfigurationError(r *http.Request) *Error {
+	return NewError(r, http.StatusNotFound, "NoSuchCORSConfiguration", "The CORS configuration does not exist")
+}
+
+// NoSuchLifecycleConfigurationError creates a new S3 error with a standard
+// NoSuchLifecycleConfiguration S3 code.
+func NoSuchLifecycleConfigurationError(r *http.Request) *Error {
+	return NewError(r, http.StatusNotFound, "NoSuchLifecycleConfiguration", "The lifecycle configuration does not exist")
+}
+
 // NoSuchKeyError creates a new S3 error with a standard NoSuchKey S3 code.
 func NoSuchKeyError(r *http.Request) *Error {
 	return NewError(r, http.StatusNotFound, "NoSuchKey", "The specified key does not exist.")
 }
 
+// NoSuchTagSetError creates a new S3 error with a standard NoSuchTagSet S3
+// code.
+func NoSuchTagSetError(r *http.Request) *Error {
+	return NewError(r, http.StatusNotFound, "NoSuchTagSet", "The TagSet does not exist")
+}
+
 // NoSuchVersionError creates a new S3 error with a standard NoSuchVersion S3
 // code.
 func NoSuchVersionError(r *http.Request) *Error {
@@ -194,6 +294,12 @@ func NoSuchUploadError(r *http.Request) *Error {
 	return NewError(r, http.StatusNotFound, "NoSuchUpload", "The specified multipart upload does not exist. The upload ID might be invalid, or the multipart upload might have been aborted or completed.")
 }
 
+// NoSuchWebsiteConfigurationError creates a new S3 error with a standard
+// NoSuchWebsiteConfiguration S3 code.
+func NoSuchWebsiteConfigurationError(r *http.Request) *Error {
+	return NewError(r, http.StatusNotFound, "NoSuchWebsiteConfiguration", "The specified bucket does not have a website configuration")
+}
+
 // NotImplementedError creates a new S3 error with a standard NotImplemented
 // S3 code.
 func NotImplementedError(r *http.Request) *Error {
@@ -223,3 +329,9 @@ func RequestTimeTooSkewedError(r *http.Request) *Error {
 func SignatureDoesNotMatchError(r *http.Request) *Error {
 	return NewError(r, http.StatusForbidden, "SignatureDoesNotMatch", "The request signature we calculated does not match the signature you provided. Check your auth credentials and signing method.")
 }
+
+// XAmzContentSHA256MismatchError creates a new S3 error with a standard
+// XAmzContentSHA256Mismatch S3 code.
+func XAmzContentSHA256MismatchError(r *http.Request) *Error {
+	return NewError(r, http.StatusBadRequest, "XAmzContentSHA256Mismatch", "The provided 'x-amz-content-sha256' header does not match what was computed.")
+}
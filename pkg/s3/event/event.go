@@ -0,0 +1,45 @@
+package s3event
+
+import "net/http"
+
+// Names of the events of objects, as in the `eventName` of notification
+// records. Notification configurations refer to them prefixed with `s3:`.
+const (
+	ObjectCreatedPut                     string = "ObjectCreated:Put"
+	ObjectCreatedCopy                    string = "ObjectCreated:Copy"
+	ObjectCreatedCompleteMultipartUpload string = "ObjectCreated:CompleteMultipartUpload"
+	ObjectRemovedDelete                  string = "ObjectRemoved:Delete"
+	ObjectRemovedDeleteMarkerCreated     string = "ObjectRemoved:DeleteMarkerCreated"
+)
+
+// Names lists the names of every event
+var Names = []string{
+	ObjectCreatedPut,
+	ObjectCreatedCopy,
+	ObjectCreatedCompleteMultipartUpload,
+	ObjectRemovedDelete,
+	ObjectRemovedDeleteMarkerCreated,
+}
+
+// Event is a change to an object, of which the bucket of the object may
+// notify
+type Event struct {
+	// Name is the name of the event, ie `ObjectCreated:Put`
+	Name   string
+	Bucket string
+	Key    string
+	// Size is the size of a created object, or 0 if it is not known
+	Size int64
+	// ETag is the ETag of a created object
+	ETag string
+	// Version is the version created or deleted, or an empty string if
+	// versioning is not enabled or supported
+	Version string
+}
+
+// Notifier is an interface notifying of the events of objects
+type Notifier interface {
+	// Notify queues the notifications of an event, once it happened. It
+	// never fails the request the event happened in.
+	Notify(r *http.Request, event Event)
+}
@@ -4,28 +4,64 @@ import (
 	"net/http"
 	"strings"
 
+	"github.com/gorilla/mux"
+
 	s3auth "github.com/jakthom/s3c/pkg/s3/auth"
 	s3error "github.com/jakthom/s3c/pkg/s3/error"
 	s3util "github.com/jakthom/s3c/pkg/s3/util"
 )
 
-func AuthenticationMiddleware(authController s3auth.AuthController) func(http.Handler) http.Handler {
+// AuthenticationMiddleware authenticates requests signed with AWS' auth V4,
+// and if `allowV2` is set, with its legacy auth V2
+func AuthenticationMiddleware(authController s3auth.AuthController, allowV2 bool) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			// Check if the request is authenticated
 			authorizationHeader := r.Header.Get("Authorization")
+			query := r.URL.Query()
+			isV2 := strings.HasPrefix(authorizationHeader, "AWS ") || (authorizationHeader == "" && query.Has("AWSAccessKeyId") && query.Has("Signature"))
+			var err error
 			if strings.HasPrefix(authorizationHeader, "AWS4-HMAC-SHA256 ") {
-				err := s3auth.AuthV4(w, r, authController, authorizationHeader)
+				err = s3auth.AuthV4(w, r, authController, authorizationHeader)
+			} else if query.Has("X-Amz-Signature") {
+				// Presigned requests carry their signature in the query
+				err = s3auth.AuthV4Query(w, r, authController)
+			} else if isV2 && !allowV2 {
+				err = s3error.InvalidRequestError(r, "The authorization mechanism you have provided is not supported. Please use AWS4-HMAC-SHA256.")
+			} else if strings.HasPrefix(authorizationHeader, "AWS ") {
+				err = s3auth.AuthV2(w, r, authController, authorizationHeader)
+			} else if isV2 {
+				err = s3auth.AuthV2Query(w, r, authController)
+			} else if authorizationHeader == "" {
+				// Unsigned requests are anonymous, and only authorized by
+				// public buckets and bucket policies
+				next.ServeHTTP(w, r)
+				return
+			} else {
+				// Return access denied if the request uses an unsupported
+				// kind of auth
+				err = s3error.AccessDeniedError(r)
+			}
+			if err != nil {
+				s3util.WriteError(w, r, err)
+				return
+			}
+			// Attach the authenticated user for handlers and origins
+			if sessionToken := mux.Vars(r)["authSessionToken"]; sessionToken != "" {
+				user, session, err := authController.SessionUser(sessionToken)
 				if err != nil {
-					s3util.WriteError(w, r, err)
+					s3util.WriteError(w, r, s3error.InvalidTokenError(r))
 					return
 				}
-			} else {
-				// Return access denied if the request doesn't use AWS auth V4
-				// TODO -> add custom auth
-				s3util.WriteError(w, r, s3error.AccessDeniedError(r))
+				next.ServeHTTP(w, s3auth.WithSession(s3auth.WithUser(r, user), session))
+				return
+			}
+			user, err := authController.User(mux.Vars(r)["authAccessKey"])
+			if err != nil {
+				s3util.WriteError(w, r, err)
+				return
 			}
-			next.ServeHTTP(w, r)
+			next.ServeHTTP(w, s3auth.WithUser(r, user))
 		})
 	}
 }
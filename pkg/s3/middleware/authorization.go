@@ -0,0 +1,56 @@
+package s3middleware
+
+import (
+	"net/http"
+
+	s3auth "github.com/jakthom/s3c/pkg/s3/auth"
+	s3error "github.com/jakthom/s3c/pkg/s3/error"
+	s3policy "github.com/jakthom/s3c/pkg/s3/policy"
+	s3util "github.com/jakthom/s3c/pkg/s3/util"
+)
+
+// AuthorizationMiddleware authorizes the action of an authenticated request
+// against the policies of its user and bucket. It must follow the
+// AuthenticationMiddleware.
+func AuthorizationMiddleware(authorizer *s3policy.Authorizer) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			scope, err := sessionScope(r)
+			if err != nil {
+				s3util.WriteError(w, r, err)
+				return
+			}
+			if err := s3policy.CheckSubresources(r); err != nil {
+				s3util.WriteError(w, r, err)
+				return
+			}
+			r = authorizer.Attach(r, s3auth.RequestUser(r), scope)
+			action, resource := s3policy.Action(r)
+			if action == "" || resource != "" {
+				if err := s3policy.Authorize(r, action, resource); err != nil {
+					s3util.WriteError(w, r, err)
+					return
+				}
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// sessionScope returns the scope of a request made with temporary
+// credentials, or nil if the request is not
+func sessionScope(r *http.Request) (*s3policy.Scope, error) {
+	session := s3auth.RequestSession(r)
+	if session == nil {
+		return nil, nil
+	}
+	scope := &s3policy.Scope{Role: session.Role}
+	if session.Policy != "" {
+		policy, err := s3policy.Parse([]byte(session.Policy), false)
+		if err != nil {
+			return nil, s3error.InvalidTokenError(r)
+		}
+		scope.Policy = policy
+	}
+	return scope, nil
+}
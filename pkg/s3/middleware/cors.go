@@ -0,0 +1,110 @@
+package s3middleware
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	s3bucket "github.com/jakthom/s3c/pkg/s3/bucket"
+	s3error "github.com/jakthom/s3c/pkg/s3/error"
+	s3util "github.com/jakthom/s3c/pkg/s3/util"
+)
+
+// CORSMiddleware answers the OPTIONS preflight requests of browsers by the
+// CORS configuration of the requested bucket, and decorates the responses to
+// allowed cross-origin requests with `Access-Control-*` headers. Preflights
+// are never signed, so it must precede the AuthenticationMiddleware.
+func CORSMiddleware(configs s3bucket.CORSController) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			origin := r.Header.Get("Origin")
+			if r.Method == http.MethodOptions {
+				preflight(w, r, configs, origin)
+				return
+			}
+			if origin != "" {
+				// Actual requests are only matched by origin and method
+				if config := corsConfiguration(r, configs); config != nil {
+					if rule := config.Match(origin, r.Method, nil); rule != nil {
+						writeCORSHeader(w.Header(), rule, origin)
+					}
+				}
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// preflight answers an OPTIONS request, which asks whether a cross-origin
+// request may be made with a method and headers
+func preflight(w http.ResponseWriter, r *http.Request, configs s3bucket.CORSController, origin string) {
+	method := r.Header.Get("Access-Control-Request-Method")
+	if origin == "" || method == "" {
+		s3util.WriteError(w, r, s3error.BadRequestError(r, "Insufficient information. Origin request header needed."))
+		return
+	}
+	var headers []string
+	for _, header := range strings.Split(r.Header.Get("Access-Control-Request-Headers"), ",") {
+		if header = strings.TrimSpace(header); header != "" {
+			headers = append(headers, header)
+		}
+	}
+	config := corsConfiguration(r, configs)
+	if config == nil {
+		s3util.WriteError(w, r, s3error.AccessForbiddenError(r, "CORSResponse: CORS is not enabled for this bucket."))
+		return
+	}
+	rule := config.Match(origin, method, headers)
+	if rule == nil {
+		s3util.WriteError(w, r, s3error.AccessForbiddenError(r, "CORSResponse: This CORS request is not allowed. This is usually because the evalution of Origin, request method / Access-Control-Request-Method or Access-Control-Request-Headers are not whitelisted by the resource's CORS spec."))
+		return
+	}
+	writeCORSHeader(w.Header(), rule, origin)
+	w.Header().Set("Access-Control-Allow-Methods", strings.Join(rule.AllowedMethods, ", "))
+	if len(headers) > 0 {
+		w.Header().Set("Access-Control-Allow-Headers", strings.Join(headers, ", "))
+	}
+	if rule.MaxAgeSeconds != nil {
+		w.Header().Set("Access-Control-Max-Age", strconv.Itoa(*rule.MaxAgeSeconds))
+	}
+	w.Header().Add("Vary", "Access-Control-Request-Headers")
+	w.Header().Add("Vary", "Access-Control-Request-Method")
+	w.WriteHeader(http.StatusOK)
+}
+
+// writeCORSHeader sets the origin and exposed headers a matching rule allows.
+// Responses to any origin are not sent credentials, those to a listed origin
+// are.
+func writeCORSHeader(header http.Header, rule *s3bucket.CORSRule, origin string) {
+	wildcard := false
+	for _, allowed := range rule.AllowedOrigins {
+		if allowed == "*" {
+			wildcard = true
+			break
+		}
+	}
+	if wildcard {
+		header.Set("Access-Control-Allow-Origin", "*")
+	} else {
+		header.Set("Access-Control-Allow-Origin", origin)
+		header.Set("Access-Control-Allow-Credentials", "true")
+	}
+	if len(rule.ExposeHeaders) > 0 {
+		header.Set("Access-Control-Expose-Headers", strings.Join(rule.ExposeHeaders, ", "))
+	}
+	header.Add("Vary", "Origin")
+}
+
+// corsConfiguration returns the CORS configuration of the bucket a request
+// is made to, the first segment of its path, or nil if it has none
+func corsConfiguration(r *http.Request, configs s3bucket.CORSController) *s3bucket.CORSConfiguration {
+	bucket, _, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	if bucket == "" {
+		return nil
+	}
+	config, err := configs.GetBucketCors(r, bucket)
+	if err != nil {
+		return nil
+	}
+	return config
+}
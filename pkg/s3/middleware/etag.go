@@ -8,6 +8,8 @@ import (
 )
 
 // EtagMiddleware iterates over a request's headers and quotes unquoted Entity Tags headers.
+// The `*` wildcard of conditional headers is not an entity tag and is left as is. As the
+// headers may be signed, it must run after authentication.
 // ref: https://developer.mozilla.org/en-US/docs/Web/HTTP/Headers/ETag
 func EtagMiddleware(next http.Handler) http.Handler {
 	etagHeaders := [3]string{"ETag", "If-Match", "If-None-Match"}
@@ -15,7 +17,7 @@ func EtagMiddleware(next http.Handler) http.Handler {
 		log.Debug().Interface("headers", r.Header).Msg("Headers before ETagMiddleware")
 		for _, key := range etagHeaders {
 			value := r.Header.Get(key)
-			if value != "" {
+			if value != "" && value != "*" {
 				r.Header.Set(key, header.AddETagQuotes(value))
 			}
 		}
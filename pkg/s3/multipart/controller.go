@@ -3,6 +3,8 @@ package s3multipart
 import (
 	"io"
 	"net/http"
+
+	s3error "github.com/jakthom/s3c/pkg/s3/error"
 )
 
 // MultipartController is an interface that specifies multipart-related
@@ -14,7 +16,8 @@ type MultipartController interface {
 	InitMultipart(r *http.Request, bucket, key string) (string, error)
 	// AbortMultipart aborts an in-progress multipart upload
 	AbortMultipart(r *http.Request, bucket, key, uploadID string) error
-	// CompleteMultipart finishes a multipart upload
+	// CompleteMultipart finishes a multipart upload. Like PutObject, it must
+	// atomically honor the write condition of the request.
 	CompleteMultipart(r *http.Request, bucket, key, uploadID string, parts []*Part) (*CompleteMultipartResult, error)
 	// ListMultipartChunks lists the constituent chunks of an in-progress
 	// multipart upload
@@ -22,3 +25,39 @@ type MultipartController interface {
 	// UploadMultipartChunk uploads a chunk of an in-progress multipart upload
 	UploadMultipartChunk(r *http.Request, bucket, key, uploadID string, partNumber int, reader io.Reader) (string, error)
 }
+
+// UnimplementedMultipartController is a multipart controller that returns
+// `NotImplementedError`s for all functionality. It is used by origins that
+// do not support multipart uploads.
+type UnimplementedMultipartController struct{}
+
+// ListMultipart lists in-progress multipart uploads in a bucket
+func (c UnimplementedMultipartController) ListMultipart(r *http.Request, bucket, keyMarker, uploadIDMarker string, maxUploads int) (*ListMultipartResult, error) {
+	return nil, s3error.NotImplementedError(r)
+}
+
+// InitMultipart initializes a new multipart upload
+func (c UnimplementedMultipartController) InitMultipart(r *http.Request, bucket, key string) (string, error) {
+	return "", s3error.NotImplementedError(r)
+}
+
+// AbortMultipart aborts an in-progress multipart upload
+func (c UnimplementedMultipartController) AbortMultipart(r *http.Request, bucket, key, uploadID string) error {
+	return s3error.NotImplementedError(r)
+}
+
+// CompleteMultipart finishes a multipart upload
+func (c UnimplementedMultipartController) CompleteMultipart(r *http.Request, bucket, key, uploadID string, parts []*Part) (*CompleteMultipartResult, error) {
+	return nil, s3error.NotImplementedError(r)
+}
+
+// ListMultipartChunks lists the constituent chunks of an in-progress
+// multipart upload
+func (c UnimplementedMultipartController) ListMultipartChunks(r *http.Request, bucket, key, uploadID string, partNumberMarker, maxParts int) (*ListMultipartChunksResult, error) {
+	return nil, s3error.NotImplementedError(r)
+}
+
+// UploadMultipartChunk uploads a chunk of an in-progress multipart upload
+func (c UnimplementedMultipartController) UploadMultipartChunk(r *http.Request, bucket, key, uploadID string, partNumber int, reader io.Reader) (string, error) {
+	return "", s3error.NotImplementedError(r)
+}
@@ -5,19 +5,24 @@ import (
 	"fmt"
 	"net/http"
 	"sort"
+	"strings"
 	"time"
 
 	"github.com/gorilla/mux"
 	s3error "github.com/jakthom/s3c/pkg/s3/error"
+	s3event "github.com/jakthom/s3c/pkg/s3/event"
 	s3user "github.com/jakthom/s3c/pkg/s3/user"
 	s3util "github.com/jakthom/s3c/pkg/s3/util"
 )
 
-type multipartHandler struct {
-	controller MultipartController
+type MultipartHandler struct {
+	Controller MultipartController
+	// Notifier is notified of the objects completed, if bucket notifications
+	// are supported
+	Notifier s3event.Notifier
 }
 
-func (h *multipartHandler) list(w http.ResponseWriter, r *http.Request) {
+func (h *MultipartHandler) List(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	bucket := vars["bucket"]
 
@@ -33,7 +38,7 @@ func (h *multipartHandler) list(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	result, err := h.controller.ListMultipart(r, bucket, keyMarker, uploadIDMarker, maxUploads)
+	result, err := h.Controller.ListMultipart(r, bucket, keyMarker, uploadIDMarker, maxUploads)
 	if err != nil {
 		s3util.WriteError(w, r, err)
 		return
@@ -84,7 +89,7 @@ func (h *multipartHandler) list(w http.ResponseWriter, r *http.Request) {
 	s3util.WriteXML(w, r, http.StatusOK, marshallable)
 }
 
-func (h *multipartHandler) listChunks(w http.ResponseWriter, r *http.Request) {
+func (h *MultipartHandler) ListChunks(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	bucket := vars["bucket"]
 	key := vars["key"]
@@ -103,7 +108,7 @@ func (h *multipartHandler) listChunks(w http.ResponseWriter, r *http.Request) {
 
 	uploadID := r.FormValue("uploadId")
 
-	result, err := h.controller.ListMultipartChunks(r, bucket, key, uploadID, partNumberMarker, maxParts)
+	result, err := h.Controller.ListMultipartChunks(r, bucket, key, uploadID, partNumberMarker, maxParts)
 	if err != nil {
 		s3util.WriteError(w, r, err)
 		return
@@ -150,17 +155,48 @@ func (h *multipartHandler) listChunks(w http.ResponseWriter, r *http.Request) {
 	s3util.WriteXML(w, r, http.StatusOK, marshallable)
 }
 
-func (h *multipartHandler) init(w http.ResponseWriter, r *http.Request) {
+func (h *MultipartHandler) Init(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	bucket := vars["bucket"]
 	key := vars["key"]
 
-	uploadID, err := h.controller.InitMultipart(r, bucket, key)
+	// Parts are uploaded with checksums of the algorithm of the upload, and
+	// combined into a checksum of its type
+	checksumAlgorithm := r.Header.Get("x-amz-checksum-algorithm")
+	checksumType := r.Header.Get("x-amz-checksum-type")
+	if checksumAlgorithm != "" {
+		if !s3util.ValidChecksumAlgorithm(checksumAlgorithm) {
+			s3util.WriteError(w, r, s3error.InvalidRequestError(r, "Checksum algorithm provided is unsupported. Please try again with any of the valid types: [CRC32, CRC32C, CRC64NVME, SHA1, SHA256]"))
+			return
+		}
+		if checksumType == "" {
+			checksumType = s3util.DefaultChecksumType(checksumAlgorithm)
+			r.Header.Set("x-amz-checksum-type", checksumType)
+		}
+		if !s3util.ValidChecksumType(checksumAlgorithm, checksumType) {
+			s3util.WriteError(w, r, s3error.InvalidRequestError(r, "The "+strings.ToUpper(checksumAlgorithm)+" algorithm does not support the "+checksumType+" checksum type."))
+			return
+		}
+	} else if checksumType != "" {
+		s3util.WriteError(w, r, s3error.InvalidRequestError(r, "The x-amz-checksum-type header can only be used with the x-amz-checksum-algorithm header."))
+		return
+	}
+	if _, err := s3util.TaggingFromHeader(r); err != nil {
+		s3util.WriteError(w, r, err)
+		return
+	}
+
+	uploadID, err := h.Controller.InitMultipart(r, bucket, key)
 	if err != nil {
 		s3util.WriteError(w, r, err)
 		return
 	}
 
+	if checksumAlgorithm != "" {
+		w.Header().Set("x-amz-checksum-algorithm", strings.ToUpper(checksumAlgorithm))
+		w.Header().Set("x-amz-checksum-type", checksumType)
+	}
+
 	marshallable := struct {
 		XMLName  xml.Name `xml:"http://s3.amazonaws.com/doc/2006-03-01/ InitiateMultipartUploadResult"`
 		Bucket   string   `xml:"Bucket"`
@@ -175,7 +211,7 @@ func (h *multipartHandler) init(w http.ResponseWriter, r *http.Request) {
 	s3util.WriteXML(w, r, http.StatusOK, marshallable)
 }
 
-func (h *multipartHandler) complete(w http.ResponseWriter, r *http.Request) {
+func (h *MultipartHandler) Complete(w http.ResponseWriter, r *http.Request) {
 	if err := s3util.RequireContentLength(r); err != nil {
 		s3util.WriteError(w, r, err)
 		return
@@ -186,6 +222,10 @@ func (h *multipartHandler) complete(w http.ResponseWriter, r *http.Request) {
 	key := vars["key"]
 
 	uploadID := r.FormValue("uploadId")
+	if _, err := s3util.WriteConditionFromRequest(r); err != nil {
+		s3util.WriteError(w, r, err)
+		return
+	}
 
 	payload := struct {
 		XMLName xml.Name `xml:"CompleteMultipartUpload"`
@@ -215,7 +255,7 @@ func (h *multipartHandler) complete(w http.ResponseWriter, r *http.Request) {
 	})
 
 	go func() {
-		result, err := h.controller.CompleteMultipart(r, bucket, key, uploadID, payload.Parts)
+		result, err := h.Controller.CompleteMultipart(r, bucket, key, uploadID, payload.Parts)
 		ch <- struct {
 			result *CompleteMultipartResult
 			err    error
@@ -239,17 +279,33 @@ func (h *multipartHandler) complete(w http.ResponseWriter, r *http.Request) {
 					s3util.WriteError(w, r, s3Error)
 				}
 			} else {
+				if h.Notifier != nil {
+					h.Notifier.Notify(r, s3event.Event{
+						Name:    s3event.ObjectCreatedCompleteMultipartUpload,
+						Bucket:  bucket,
+						Key:     key,
+						Size:    value.result.Size,
+						ETag:    value.result.ETag,
+						Version: value.result.Version,
+					})
+				}
 				marshallable := struct {
 					XMLName  xml.Name `xml:"http://s3.amazonaws.com/doc/2006-03-01/ CompleteMultipartUploadResult"`
 					Location string   `xml:"Location"`
 					Bucket   string   `xml:"Bucket"`
 					Key      string   `xml:"Key"`
 					ETag     string   `xml:"ETag"`
+					s3util.ChecksumFields
+					ChecksumType string `xml:"ChecksumType,omitempty"`
 				}{
-					Bucket:   bucket,
-					Key:      key,
-					Location: value.result.Location,
-					ETag:     s3util.AddETagQuotes(value.result.ETag),
+					Bucket:         bucket,
+					Key:            key,
+					Location:       value.result.Location,
+					ETag:           s3util.AddETagQuotes(value.result.ETag),
+					ChecksumFields: value.result.Checksum.Fields(),
+				}
+				if value.result.Checksum != nil {
+					marshallable.ChecksumType = value.result.Checksum.Type
 				}
 
 				if value.result.Version != "" {
@@ -274,39 +330,48 @@ func (h *multipartHandler) complete(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-func (h *multipartHandler) put(w http.ResponseWriter, r *http.Request) {
+func (h *MultipartHandler) Put(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	bucket := vars["bucket"]
 	key := vars["key"]
 
 	uploadID := r.FormValue("uploadId")
-	partNumber, err := s3util.IntFormValue(r, "partNumber", 0, maxPartsAllowed, 0)
+	partNumber, err := s3util.IntFormValue(r, "partNumber", 1, maxPartsAllowed, 0)
 	if err != nil {
 		s3util.WriteError(w, r, err)
 		return
 	}
 
-	etag, err := h.controller.UploadMultipartChunk(r, bucket, key, uploadID, partNumber, r.Body)
+	body, err := s3util.RequestBody(r)
 	if err != nil {
 		s3util.WriteError(w, r, err)
 		return
 	}
 
+	etag, err := h.Controller.UploadMultipartChunk(r, bucket, key, uploadID, partNumber, body)
+	if err != nil {
+		s3util.WriteError(w, r, s3util.PayloadError(r, err))
+		return
+	}
+
 	if etag != "" {
 		w.Header().Set("ETag", s3util.AddETagQuotes(etag))
 	}
+	if checksum := s3util.PayloadChecksum(body); checksum != nil {
+		w.Header().Set(checksum.Header(), checksum.Value)
+	}
 
 	w.WriteHeader(http.StatusOK)
 }
 
-func (h *multipartHandler) del(w http.ResponseWriter, r *http.Request) {
+func (h *MultipartHandler) Del(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	bucket := vars["bucket"]
 	key := vars["key"]
 
 	uploadID := r.FormValue("uploadId")
 
-	if err := h.controller.AbortMultipart(r, bucket, key, uploadID); err != nil {
+	if err := h.Controller.AbortMultipart(r, bucket, key, uploadID); err != nil {
 		s3util.WriteError(w, r, err)
 		return
 	}
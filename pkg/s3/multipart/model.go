@@ -4,6 +4,7 @@ import (
 	"time"
 
 	s3user "github.com/jakthom/s3c/pkg/s3/user"
+	s3util "github.com/jakthom/s3c/pkg/s3/util"
 )
 
 // Upload is an XML marshallable representation of an in-progress multipart
@@ -32,6 +33,8 @@ type Part struct {
 	// ETag is a hex encoding of the hash of the object contents, with or
 	// without surrounding quotes.
 	ETag string `xml:"ETag"`
+	// The checksum of the part, if it was uploaded with one
+	s3util.ChecksumFields
 }
 
 // ListMultipartResult is a response from a ListMultipart call
@@ -52,6 +55,10 @@ type CompleteMultipartResult struct {
 	// Version is the version of the object, or an empty string if versioning
 	// is not enabled or supported.
 	Version string
+	// Checksum is the checksum of the object, or nil if the upload has none
+	Checksum *s3util.Checksum
+	// Size is the size of the object, or 0 if the origin does not know it
+	Size int64
 }
 
 // ListMultipartChunksResult is a response from a ListMultipartChunks call
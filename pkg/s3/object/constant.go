@@ -0,0 +1,37 @@
+package s3object
+
+const (
+	// MaxDeleteObjects specifies the maximum number of objects that can be
+	// deleted by a single DeleteObjects request
+	MaxDeleteObjects int = 1000
+	// deleteObjectsConcurrency specifies how many objects of a DeleteObjects
+	// request are deleted at once
+	deleteObjectsConcurrency int = 16
+	// MetadataDirectiveCopy specifies that a copy keeps the metadata of its
+	// source
+	MetadataDirectiveCopy string = "COPY"
+	// MetadataDirectiveReplace specifies that a copy takes the metadata of
+	// the request instead of its source
+	MetadataDirectiveReplace string = "REPLACE"
+	// TaggingDirectiveCopy specifies that a copy keeps the tags of its source
+	TaggingDirectiveCopy string = "COPY"
+	// TaggingDirectiveReplace specifies that a copy takes the tags of the
+	// request instead of its source
+	TaggingDirectiveReplace string = "REPLACE"
+	// maxPartNumber is the highest part number of objects uploaded in parts
+	maxPartNumber int = 10000
+	// maxRanges specifies how many ranges of an object a single read may
+	// request. Reads of more ranges are served the whole object.
+	maxRanges int = 100
+	// defaultContentType is the content type of objects stored without one
+	defaultContentType string = "binary/octet-stream"
+)
+
+// objectAttributes are the attributes GetObjectAttributes can return
+var objectAttributes = map[string]bool{
+	"ETag":         true,
+	"Checksum":     true,
+	"ObjectParts":  true,
+	"StorageClass": true,
+	"ObjectSize":   true,
+}
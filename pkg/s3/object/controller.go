@@ -9,10 +9,26 @@ import (
 type ObjectController interface {
 	// GetObject gets an object
 	GetObject(r *http.Request, bucket, key, version string) (*GetObjectResult, error)
-	// CopyObject copies an object
-	CopyObject(r *http.Request, srcBucket, srcKey string, getResult *GetObjectResult, destBucket, destKey string) (string, error)
-	// // PutObject sets an object
+	// GetObjectRange gets a range or part of an object, reading only the
+	// contents requested. Unsatisfiable ranges are `InvalidRange` errors.
+	GetObjectRange(r *http.Request, bucket, key, version string, rng ObjectRange) (*GetObjectRangeResult, error)
+	// HeadObject gets the metadata and size of an object, or of one of its
+	// parts if `partNumber` is positive, without reading its contents
+	HeadObject(r *http.Request, bucket, key, version string, partNumber int) (*HeadObjectResult, error)
+	// CopyObject copies an object, returning the result of writing the copy.
+	// The metadata of `getResult` is stored with the copy.
+	CopyObject(r *http.Request, srcBucket, srcKey string, getResult *GetObjectResult, destBucket, destKey string) (*PutObjectResult, error)
+	// PutObject sets an object, along with the metadata in the request. It
+	// must atomically honor the write condition of the request (see
+	// s3util.WriteConditionFromRequest): a condition that does not hold
+	// fails with `PreconditionFailed`, and one invalidated by a concurrent
+	// write with `ConditionalRequestConflict`.
 	PutObject(r *http.Request, bucket, key string, reader io.Reader) (*PutObjectResult, error)
+	// GetObjectTagging gets the tags of an object
+	GetObjectTagging(r *http.Request, bucket, key, version string) (*ObjectTaggingResult, error)
+	// PutObjectTagging replaces the tags of an object, returning the version
+	// tagged. Tags are deleted by replacing them with none.
+	PutObjectTagging(r *http.Request, bucket, key, version string, tags map[string]string) (string, error)
 	// // DeleteObject deletes an object
 	DeleteObject(r *http.Request, bucket, key, version string) (*DeleteObjectResult, error)
 }
@@ -2,20 +2,39 @@ package s3object
 
 import (
 	"encoding/xml"
+	"errors"
 	"io"
+	"mime"
+	"mime/multipart"
 	"net/http"
+	"net/textproto"
 	"net/url"
+	"path"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/gorilla/mux"
 	s3error "github.com/jakthom/s3c/pkg/s3/error"
+	s3event "github.com/jakthom/s3c/pkg/s3/event"
+	s3policy "github.com/jakthom/s3c/pkg/s3/policy"
 	s3util "github.com/jakthom/s3c/pkg/s3/util"
 	"github.com/rs/zerolog/log"
 )
 
 type ObjectHandler struct {
 	Controller ObjectController
+	// Notifier is notified of the objects created and deleted, if bucket
+	// notifications are supported
+	Notifier s3event.Notifier
+}
+
+// notify notifies of an event of an object, if notifications are supported
+func (h *ObjectHandler) notify(r *http.Request, event s3event.Event) {
+	if h.Notifier != nil {
+		h.Notifier.Notify(r, event)
+	}
 }
 
 func (h *ObjectHandler) Get(w http.ResponseWriter, r *http.Request) {
@@ -25,26 +44,253 @@ func (h *ObjectHandler) Get(w http.ResponseWriter, r *http.Request) {
 	versionId := r.FormValue("versionId")
 	log.Info().Msg("Getting object: " + key + " in bucket: " + bucket)
 
+	ranges, err := requestRanges(r)
+	if err != nil {
+		s3util.WriteError(w, r, err)
+		return
+	}
+	if len(ranges) > 0 && h.getRanges(w, r, bucket, key, versionId, ranges) {
+		return
+	}
+
 	result, err := h.Controller.GetObject(r, bucket, key, versionId)
 	if err != nil {
-		log.Error().Err(err).Msg("Failed to get object")
-		s3util.WriteError(w, r, s3error.NoSuchKeyError(r))
+		s3util.WriteError(w, r, getError(r, err))
+		return
+	}
+	defer result.Close()
+	if !writeObjectHeader(w, r, result, key, versionId) {
 		return
 	}
+	size, err := result.Content.Seek(0, io.SeekEnd)
+	if err == nil {
+		_, err = result.Content.Seek(0, io.SeekStart)
+	}
+	if err != nil {
+		s3util.WriteError(w, r, err)
+		return
+	}
+	if checksumMode(r) && result.Metadata != nil {
+		result.Metadata.Checksum.WriteHeader(w.Header())
+	}
+	w.Header().Set("Content-Length", strconv.FormatInt(size, 10))
+	w.WriteHeader(http.StatusOK)
+	writeContent(w, key, result.Content)
+}
 
-	if result.ETag != "" {
-		w.Header().Set("ETag", s3util.AddETagQuotes(result.ETag))
+// getRanges serves the ranges or part of an object a read requests. If the
+// object no longer matches the `If-Range` of the request, nothing is written
+// and false is returned so that the whole object is served instead.
+func (h *ObjectHandler) getRanges(w http.ResponseWriter, r *http.Request, bucket, key, versionId string, ranges []ObjectRange) bool {
+	var results []*GetObjectRangeResult
+	defer func() {
+		for _, result := range results {
+			result.Close()
+		}
+	}()
+	// Unsatisfiable ranges are left out of reads of several ranges, which
+	// only fail if none is satisfiable
+	var rangeErr error
+	for _, rng := range ranges {
+		result, err := h.Controller.GetObjectRange(r, bucket, key, versionId, rng)
+		if err != nil {
+			var s3Err *s3error.Error
+			if len(ranges) > 1 && errors.As(err, &s3Err) && s3Err.Code == "InvalidRange" {
+				rangeErr = err
+				continue
+			}
+			s3util.WriteError(w, r, getError(r, err))
+			return true
+		}
+		results = append(results, result)
+		if result.DeleteMarker {
+			break
+		}
+		if result.ETag != results[0].ETag {
+			// The object was replaced while its ranges were read
+			s3util.WriteError(w, r, s3error.PreconditionFailedError(r))
+			return true
+		}
+	}
+	if len(results) == 0 {
+		s3util.WriteError(w, r, rangeErr)
+		return true
+	}
+
+	first := results[0]
+	if !first.DeleteMarker && !s3util.CheckIfRange(r, s3util.AddETagQuotes(first.ETag), first.ModTime) {
+		return false
+	}
+	if !writeObjectHeader(w, r, &first.GetObjectResult, key, versionId) {
+		return true
+	}
+	if first.PartsCount > 0 {
+		w.Header().Set("x-amz-mp-parts-count", strconv.Itoa(first.PartsCount))
+	}
+
+	if len(results) == 1 {
+		w.Header().Set("Content-Range", first.ContentRange())
+		w.Header().Set("Content-Length", strconv.FormatInt(first.Length, 10))
+		w.WriteHeader(http.StatusPartialContent)
+		writeContent(w, key, first.Content)
+		return true
+	}
+
+	// Several ranges are served as a multipart/byteranges body
+	contentType := w.Header().Get("Content-Type")
+	mw := multipart.NewWriter(w)
+	w.Header().Set("Content-Type", "multipart/byteranges; boundary="+mw.Boundary())
+	w.WriteHeader(http.StatusPartialContent)
+	for _, result := range results {
+		part, err := mw.CreatePart(textproto.MIMEHeader{
+			"Content-Type":  {contentType},
+			"Content-Range": {result.ContentRange()},
+		})
+		if err != nil {
+			return true
+		}
+		writeContent(part, key, result.Content)
+	}
+	mw.Close()
+	return true
+}
+
+// Head serves the headers a GET of an object would, without reading its
+// contents
+func (h *ObjectHandler) Head(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	bucket := vars["bucket"]
+	key := vars["key"]
+	versionId := r.FormValue("versionId")
+
+	ranges, err := requestRanges(r)
+	if err != nil {
+		s3util.WriteError(w, r, err)
+		return
+	}
+	partNumber := 0
+	if len(ranges) == 1 {
+		partNumber = ranges[0].PartNumber
+	}
+
+	result, err := h.Controller.HeadObject(r, bucket, key, versionId, partNumber)
+	if err != nil {
+		s3util.WriteError(w, r, getError(r, err))
+		return
+	}
+	if !writeObjectHeader(w, r, &result.GetObjectResult, key, versionId) {
+		return
+	}
+
+	if partNumber > 0 {
+		if result.PartsCount > 0 {
+			w.Header().Set("x-amz-mp-parts-count", strconv.Itoa(result.PartsCount))
+		}
+		rangeResult := GetObjectRangeResult{Start: result.Start, Length: result.Length, Size: result.Size}
+		w.Header().Set("Content-Range", rangeResult.ContentRange())
+		w.Header().Set("Content-Length", strconv.FormatInt(result.Length, 10))
+		w.WriteHeader(http.StatusPartialContent)
+		return
+	}
+	// Only a single byte range is described; the headers of a GET of several
+	// ranges depend on the multipart body it would serve
+	if len(ranges) == 1 && s3util.CheckIfRange(r, s3util.AddETagQuotes(result.ETag), result.ModTime) {
+		start, length, ok := ranges[0].Resolve(result.Size)
+		if !ok {
+			s3util.WriteError(w, r, s3error.InvalidRangeError(r))
+			return
+		}
+		rangeResult := GetObjectRangeResult{Start: start, Length: length, Size: result.Size}
+		w.Header().Set("Content-Range", rangeResult.ContentRange())
+		w.Header().Set("Content-Length", strconv.FormatInt(length, 10))
+		w.WriteHeader(http.StatusPartialContent)
+		return
+	}
+	if checksumMode(r) && result.Metadata != nil {
+		result.Metadata.Checksum.WriteHeader(w.Header())
+	}
+	w.Header().Set("Content-Length", strconv.FormatInt(result.Size, 10))
+	w.WriteHeader(http.StatusOK)
+}
+
+// GetAttributes serves GetObjectAttributes, which returns the attributes
+// named in `x-amz-object-attributes` without the contents of an object
+func (h *ObjectHandler) GetAttributes(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	bucket := vars["bucket"]
+	key := vars["key"]
+	versionId := r.FormValue("versionId")
+
+	attributes := map[string]bool{}
+	for _, header := range r.Header.Values("x-amz-object-attributes") {
+		for _, attribute := range strings.Split(header, ",") {
+			attribute = strings.TrimSpace(attribute)
+			if !objectAttributes[attribute] {
+				s3util.WriteError(w, r, s3error.InvalidArgumentError(r))
+				return
+			}
+			attributes[attribute] = true
+		}
+	}
+	if len(attributes) == 0 {
+		s3util.WriteError(w, r, s3error.InvalidRequestError(r, "The x-amz-object-attributes header specifying the attributes to be retrieved is either missing or empty"))
+		return
+	}
+
+	// Checksums are stored with the metadata of objects, so none of the
+	// attributes require reading their contents
+	result, err := h.Controller.HeadObject(r, bucket, key, versionId, 0)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to get object attributes")
+		if _, ok := err.(*s3error.Error); !ok {
+			err = s3error.NoSuchKeyError(r)
+		}
+		s3util.WriteError(w, r, err)
+		return
 	}
+
 	if result.Version != "" {
 		w.Header().Set("x-amz-version-id", result.Version)
 	}
-
 	if result.DeleteMarker {
 		w.Header().Set("x-amz-delete-marker", "true")
-		s3util.WriteError(w, r, s3error.NoSuchKeyError(r))
+		if versionId != "" {
+			s3util.WriteError(w, r, s3error.MethodNotAllowedError(r))
+		} else {
+			s3util.WriteError(w, r, s3error.NoSuchKeyError(r))
+		}
 		return
 	}
-	http.ServeContent(w, r, key, result.ModTime, result.Content)
+	if !result.ModTime.IsZero() {
+		w.Header().Set("Last-Modified", result.ModTime.UTC().Format(http.TimeFormat))
+	}
+
+	marshallable := GetObjectAttributesResult{}
+	if attributes["ETag"] {
+		marshallable.ETag = s3util.StripETagQuotes(result.ETag)
+	}
+	if attributes["Checksum"] && result.Metadata != nil && result.Metadata.Checksum != nil {
+		marshallable.Checksum = &ObjectChecksum{
+			ChecksumFields: result.Metadata.Checksum.Fields(),
+			ChecksumType:   result.Metadata.Checksum.Type,
+		}
+	}
+	if attributes["ObjectParts"] {
+		// The number of parts of multipart uploads is the suffix of their ETag
+		if _, count, ok := strings.Cut(s3util.StripETagQuotes(result.ETag), "-"); ok {
+			if total, err := strconv.Atoi(count); err == nil {
+				marshallable.ObjectParts = &ObjectParts{TotalPartsCount: total}
+			}
+		}
+	}
+	if attributes["StorageClass"] {
+		marshallable.StorageClass = "STANDARD"
+	}
+	if attributes["ObjectSize"] {
+		marshallable.ObjectSize = &result.Size
+	}
+
+	s3util.WriteXML(w, r, http.StatusOK, marshallable)
 }
 
 func (h *ObjectHandler) Copy(w http.ResponseWriter, r *http.Request) {
@@ -59,6 +305,8 @@ func (h *ObjectHandler) Copy(w http.ResponseWriter, r *http.Request) {
 		s3util.WriteError(w, r, s3error.InvalidArgumentError(r))
 		return
 	}
+	// The copy source may be specified with or without a leading slash
+	srcURL.Path = strings.TrimPrefix(srcURL.Path, "/")
 	srcPath := strings.SplitN(srcURL.Path, "/", 3)
 	srcBucket = srcPath[0]
 	srcKey = strings.Replace(srcURL.Path, srcBucket+"/", "", 1)
@@ -76,10 +324,33 @@ func (h *ObjectHandler) Copy(w http.ResponseWriter, r *http.Request) {
 		s3util.WriteError(w, r, s3error.NoSuchKeyError(r))
 		return
 	}
-	if srcBucket == destBucket && srcKey == destKey && srcVersionID == "" {
-		// If we ever add support for object metadata, this error should not
-		// trigger in the case where metadata is changed, since it is a valid
-		// way to alter the metadata of an object
+	if !ValidKey(srcKey) {
+		s3util.WriteError(w, r, s3error.InvalidArgumentError(r))
+		return
+	}
+	checksumAlgorithm := r.Header.Get("x-amz-checksum-algorithm")
+	if checksumAlgorithm != "" && !s3util.ValidChecksumAlgorithm(checksumAlgorithm) {
+		s3util.WriteError(w, r, s3error.InvalidRequestError(r, "Checksum algorithm provided is unsupported. Please try again with any of the valid types: [CRC32, CRC32C, CRC64NVME, SHA1, SHA256]"))
+		return
+	}
+	directive := r.Header.Get("x-amz-metadata-directive")
+	if directive != "" && directive != MetadataDirectiveCopy && directive != MetadataDirectiveReplace {
+		s3util.WriteError(w, r, s3error.InvalidArgumentError(r))
+		return
+	}
+	taggingDirective := r.Header.Get("x-amz-tagging-directive")
+	if taggingDirective != "" && taggingDirective != TaggingDirectiveCopy && taggingDirective != TaggingDirectiveReplace {
+		s3util.WriteError(w, r, s3error.InvalidArgumentError(r))
+		return
+	}
+	tags, err := s3util.TaggingFromHeader(r)
+	if err != nil {
+		s3util.WriteError(w, r, err)
+		return
+	}
+	// Copying an object onto itself is only a valid way to replace its
+	// metadata or tags
+	if srcBucket == destBucket && srcKey == destKey && srcVersionID == "" && directive != MetadataDirectiveReplace && taggingDirective != TaggingDirectiveReplace {
 		s3util.WriteError(w, r, s3error.InvalidRequestError(r, "source and destination are the same"))
 		return
 	}
@@ -89,11 +360,22 @@ func (h *ObjectHandler) Copy(w http.ResponseWriter, r *http.Request) {
 	ifUnmodifiedSince := r.Header.Get("x-amz-copy-source-if-unmodified-since")
 	ifModifiedSince := r.Header.Get("x-amz-copy-source-if-modified-since")
 
+	// Copying reads the source as well as writing the destination
+	srcAction := "s3:GetObject"
+	if srcVersionID != "" {
+		srcAction = "s3:GetObjectVersion"
+	}
+	if err := s3policy.Authorize(r, srcAction, s3policy.ObjectResource(srcBucket, srcKey)); err != nil {
+		s3util.WriteError(w, r, err)
+		return
+	}
+
 	getResult, err := h.Controller.GetObject(r, srcBucket, srcKey, srcVersionID)
 	if err != nil {
 		s3util.WriteError(w, r, err)
 		return
 	}
+	defer getResult.Close()
 	if getResult.DeleteMarker {
 		s3util.WriteError(w, r, s3error.NoSuchKeyError(r))
 		return
@@ -119,27 +401,79 @@ func (h *ObjectHandler) Copy(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	destVersionID, err := h.Controller.CopyObject(r, srcBucket, srcKey, getResult, destBucket, destKey)
+	// The contents of the copy are those of the source, and so is its
+	// checksum unless another algorithm is requested
+	var checksum *s3util.Checksum
+	// The tags of the copy are those of the source too, unless replaced
+	var srcTags map[string]string
+	var srcTagCount int
+	if getResult.Metadata != nil {
+		checksum = getResult.Metadata.Checksum
+		srcTags = getResult.Metadata.Tags
+		srcTagCount = getResult.Metadata.TagCount
+	}
+	if directive == MetadataDirectiveReplace {
+		getResult.Metadata = MetadataFromHeader(r.Header)
+	} else if getResult.Metadata != nil {
+		copied := *getResult.Metadata
+		getResult.Metadata = &copied
+	} else {
+		getResult.Metadata = &Metadata{}
+	}
+	if taggingDirective == TaggingDirectiveReplace {
+		getResult.Metadata.Tags = tags
+		getResult.Metadata.TagCount = 0
+	} else {
+		getResult.Metadata.Tags = srcTags
+		getResult.Metadata.TagCount = srcTagCount
+	}
+	if checksumAlgorithm != "" && (checksum == nil || !strings.EqualFold(checksum.Algorithm, checksumAlgorithm) || checksum.Type != s3util.ChecksumTypeFullObject) {
+		if checksum, err = contentChecksum(getResult.Content, checksumAlgorithm); err != nil {
+			s3util.WriteError(w, r, err)
+			return
+		}
+	}
+	getResult.Metadata.Checksum = checksum
+
+	copyResult, err := h.Controller.CopyObject(r, srcBucket, srcKey, getResult, destBucket, destKey)
 	if err != nil {
 		s3util.WriteError(w, r, err)
 		return
 	}
+	if copyResult.ModTime.IsZero() {
+		copyResult.ModTime = time.Now()
+	}
+	size, _ := getResult.Content.Seek(0, io.SeekEnd)
+	h.notify(r, s3event.Event{
+		Name:    s3event.ObjectCreatedCopy,
+		Bucket:  destBucket,
+		Key:     destKey,
+		Size:    size,
+		ETag:    copyResult.ETag,
+		Version: copyResult.Version,
+	})
 
 	if getResult.Version != "" {
 		w.Header().Set("x-amz-copy-source-version-id", getResult.Version)
 	}
 
-	if destVersionID != "" {
-		w.Header().Set("x-amz-version-id", srcVersionID)
+	if copyResult.Version != "" {
+		w.Header().Set("x-amz-version-id", copyResult.Version)
 	}
 
 	marshallable := struct {
 		XMLName      xml.Name  `xml:"http://s3.amazonaws.com/doc/2006-03-01/ CopyObjectResult"`
 		LastModified time.Time `xml:"LastModified"`
 		ETag         string    `xml:"ETag"`
+		s3util.ChecksumFields
+		ChecksumType string `xml:"ChecksumType,omitempty"`
 	}{
-		LastModified: getResult.ModTime,
-		ETag:         getResult.ETag,
+		LastModified:   copyResult.ModTime,
+		ETag:           s3util.AddETagQuotes(copyResult.ETag),
+		ChecksumFields: checksum.Fields(),
+	}
+	if checksum != nil {
+		marshallable.ChecksumType = checksum.Type
 	}
 
 	s3util.WriteXML(w, r, http.StatusOK, marshallable)
@@ -163,29 +497,37 @@ func (h *ObjectHandler) Put(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	bucket := vars["bucket"]
 	key := vars["key"]
-	chunked := r.Header.Get("X-Amz-Content-Sha256") == "STREAMING-AWS4-HMAC-SHA256-PAYLOAD"
-
-	var body io.ReadCloser
-	if chunked {
-		signingKey := []byte(vars["authSignatureKey"])
-		seedSignature := vars["authSignature"]
-		timestamp := vars["authSignatureTimestamp"]
-		date := vars["authSignatureDate"]
-		region := vars["authSignatureRegion"]
-		body = s3util.NewChunkedReader(r.Body, signingKey, seedSignature, timestamp, date, region)
-	} else {
-		body = r.Body
+
+	if _, err := s3util.WriteConditionFromRequest(r); err != nil {
+		s3util.WriteError(w, r, err)
+		return
+	}
+	if _, err := s3util.TaggingFromHeader(r); err != nil {
+		s3util.WriteError(w, r, err)
+		return
+	}
+	body, err := s3util.RequestBody(r)
+	if err != nil {
+		s3util.WriteError(w, r, err)
+		return
 	}
 
 	result, err := h.Controller.PutObject(r, bucket, key, body)
 	if err != nil {
-		if err == s3util.InvalidChunk {
-			s3util.WriteError(w, r, s3error.SignatureDoesNotMatchError(r))
-		} else {
-			s3util.WriteError(w, r, err)
-		}
+		s3util.WriteError(w, r, s3util.PayloadError(r, err))
 		return
 	}
+	h.notify(r, s3event.Event{
+		Name:    s3event.ObjectCreatedPut,
+		Bucket:  bucket,
+		Key:     key,
+		Size:    s3util.PayloadLength(body),
+		ETag:    result.ETag,
+		Version: result.Version,
+	})
+	if result.Metadata != nil {
+		result.Metadata.Checksum.WriteHeader(w.Header())
+	}
 
 	if result.ETag != "" {
 		w.Header().Set("ETag", s3util.AddETagQuotes(result.ETag))
@@ -207,6 +549,7 @@ func (h *ObjectHandler) Del(w http.ResponseWriter, r *http.Request) {
 		s3util.WriteError(w, r, err)
 		return
 	}
+	h.notify(r, deleteEvent(bucket, key, versionId, result))
 
 	if result.Version != "" {
 		w.Header().Set("x-amz-version-id", result.Version)
@@ -217,85 +560,233 @@ func (h *ObjectHandler) Del(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusNoContent)
 }
 
-// func (h *objectHandler) post(w http.ResponseWriter, r *http.Request) {
-// 	vars := mux.Vars(r)
-// 	bucket := vars["bucket"]
-
-// 	payload := struct {
-// 		XMLName xml.Name `xml:"Delete"`
-// 		Quiet   bool     `xml:"Quiet"`
-// 		Objects []struct {
-// 			Key     string `xml:"Key"`
-// 			Version string `xml:"VersionId"`
-// 		} `xml:"Object"`
-// 	}{}
-// 	if err := s3util.ReadXMLBody(r, &payload); err != nil {
-// 		s3util.WriteError(w, r, err)
-// 		return
-// 	}
-
-// 	marshallable := struct {
-// 		XMLName xml.Name `xml:"http://s3.amazonaws.com/doc/2006-03-01/ DeleteResult"`
-// 		Deleted []struct {
-// 			Key                 string `xml:"Key"`
-// 			Version             string `xml:"Version,omitempty"`
-// 			DeleteMarker        bool   `xml:"Code,omitempty"`
-// 			DeleteMarkerVersion string `xml:"DeleteMarkerVersionId,omitempty"`
-// 		} `xml:"Deleted"`
-// 		Errors []struct {
-// 			Key     string `xml:"Key"`
-// 			Code    string `xml:"Code"`
-// 			Message string `xml:"Message"`
-// 		} `xml:"Error"`
-// 	}{
-// 		Deleted: []struct {
-// 			Key                 string `xml:"Key"`
-// 			Version             string `xml:"Version,omitempty"`
-// 			DeleteMarker        bool   `xml:"Code,omitempty"`
-// 			DeleteMarkerVersion string `xml:"DeleteMarkerVersionId,omitempty"`
-// 		}{},
-// 		Errors: []struct {
-// 			Key     string `xml:"Key"`
-// 			Code    string `xml:"Code"`
-// 			Message string `xml:"Message"`
-// 		}{},
-// 	}
-
-// 	for _, object := range payload.Objects {
-// 		result, err := h.controller.DeleteObject(r, bucket, object.Key, object.Version)
-// 		if err != nil {
-// 			s3Err := s3error.NewGenericError(r, err)
-
-// 			marshallable.Errors = append(marshallable.Errors, struct {
-// 				Key     string `xml:"Key"`
-// 				Code    string `xml:"Code"`
-// 				Message string `xml:"Message"`
-// 			}{
-// 				Key:     object.Key,
-// 				Code:    s3Err.Code,
-// 				Message: s3Err.Message,
-// 			})
-// 		} else {
-// 			deleteMarkerVersion := ""
-// 			if result.DeleteMarker {
-// 				deleteMarkerVersion = result.Version
-// 			}
-
-// 			if !payload.Quiet {
-// 				marshallable.Deleted = append(marshallable.Deleted, struct {
-// 					Key                 string `xml:"Key"`
-// 					Version             string `xml:"Version,omitempty"`
-// 					DeleteMarker        bool   `xml:"Code,omitempty"`
-// 					DeleteMarkerVersion string `xml:"DeleteMarkerVersionId,omitempty"`
-// 				}{
-// 					Key:                 object.Key,
-// 					Version:             object.Version,
-// 					DeleteMarker:        result.DeleteMarker,
-// 					DeleteMarkerVersion: deleteMarkerVersion,
-// 				})
-// 			}
-// 		}
-// 	}
-
-// 	s3util.WriteXML(w, r, http.StatusOK, marshallable)
-// }
+// deleteEvent returns the event of the deletion of an object, or of a
+// version of it if `versionId` is set
+func deleteEvent(bucket, key, versionId string, result *DeleteObjectResult) s3event.Event {
+	name := s3event.ObjectRemovedDelete
+	// Deleting a delete marker by its version does not create one
+	if result.DeleteMarker && versionId == "" {
+		name = s3event.ObjectRemovedDeleteMarkerCreated
+	}
+	return s3event.Event{
+		Name:    name,
+		Bucket:  bucket,
+		Key:     key,
+		Version: result.Version,
+	}
+}
+
+// getError returns the error of a failure to get an object. Errors that
+// are not s3 errors are reported as the object not existing.
+func getError(r *http.Request, err error) error {
+	log.Error().Err(err).Msg("Failed to get object")
+	if _, ok := err.(*s3error.Error); !ok {
+		return s3error.NoSuchKeyError(r)
+	}
+	return err
+}
+
+// requestRanges returns the ranges of an object a read requests, from its
+// `partNumber` or `Range` header, or none if it reads the whole object
+func requestRanges(r *http.Request) ([]ObjectRange, error) {
+	header := r.Header.Get("Range")
+	if r.URL.Query().Has("partNumber") {
+		if header != "" {
+			return nil, s3error.InvalidRequestError(r, "Cannot specify both Range header and partNumber query parameter")
+		}
+		partNumber, err := s3util.IntFormValue(r, "partNumber", 1, maxPartNumber, 0)
+		if err != nil {
+			return nil, err
+		}
+		return []ObjectRange{{PartNumber: partNumber}}, nil
+	}
+	ranges, ok := parseRange(header)
+	if !ok || len(ranges) > maxRanges {
+		return nil, nil
+	}
+	return ranges, nil
+}
+
+// writeObjectHeader sets the headers of a response serving an object, and
+// returns whether its contents are to be served. Otherwise, the response has
+// been written: the object is a delete marker, or a condition of the
+// request did not hold.
+func writeObjectHeader(w http.ResponseWriter, r *http.Request, result *GetObjectResult, key, versionId string) bool {
+	if result.ETag != "" {
+		w.Header().Set("ETag", s3util.AddETagQuotes(result.ETag))
+	}
+	if result.Version != "" {
+		w.Header().Set("x-amz-version-id", result.Version)
+	}
+	if result.DeleteMarker {
+		w.Header().Set("x-amz-delete-marker", "true")
+		// Delete markers have no contents to get
+		if versionId != "" {
+			s3util.WriteError(w, r, s3error.MethodNotAllowedError(r))
+		} else {
+			s3util.WriteError(w, r, s3error.NoSuchKeyError(r))
+		}
+		return false
+	}
+	if !result.ModTime.IsZero() {
+		w.Header().Set("Last-Modified", result.ModTime.UTC().Format(http.TimeFormat))
+	}
+	switch s3util.CheckPreconditions(r, s3util.AddETagQuotes(result.ETag), result.ModTime) {
+	case http.StatusPreconditionFailed:
+		s3util.WriteError(w, r, s3error.PreconditionFailedError(r))
+		return false
+	case http.StatusNotModified:
+		w.WriteHeader(http.StatusNotModified)
+		return false
+	}
+	result.Metadata.WriteHeader(w.Header())
+	if w.Header().Get("Content-Type") == "" {
+		contentType := mime.TypeByExtension(path.Ext(key))
+		if contentType == "" {
+			contentType = defaultContentType
+		}
+		w.Header().Set("Content-Type", contentType)
+	}
+	if count := result.Metadata.TaggingCount(); count > 0 {
+		w.Header().Set("x-amz-tagging-count", strconv.Itoa(count))
+	}
+	w.Header().Set("Accept-Ranges", "bytes")
+	w.Header().Set("x-amz-storage-class", "STANDARD")
+	return true
+}
+
+// writeContent writes the contents of an object to a response
+func writeContent(w io.Writer, key string, content io.Reader) {
+	if _, err := io.Copy(w, content); err != nil {
+		// The response has been partially written, so the error can only
+		// be logged
+		log.Error().Err(err).Msg("Failed to write object: " + key)
+	}
+}
+
+// checksumMode returns whether a request asks for the checksums of objects
+func checksumMode(r *http.Request) bool {
+	return strings.EqualFold(r.Header.Get("x-amz-checksum-mode"), "ENABLED")
+}
+
+// contentChecksum computes the checksum of the contents of an object, and
+// rewinds them
+func contentChecksum(content io.ReadSeeker, algorithm string) (*s3util.Checksum, error) {
+	h := s3util.NewChecksum(algorithm)
+	if _, err := io.Copy(h, content); err != nil {
+		return nil, err
+	}
+	if _, err := content.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	return &s3util.Checksum{
+		Algorithm: strings.ToUpper(algorithm),
+		Value:     s3util.EncodeChecksum(h),
+		Type:      s3util.ChecksumTypeFullObject,
+	}, nil
+}
+
+// Post deletes multiple objects of a bucket at once
+func (h *ObjectHandler) Post(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	bucket := vars["bucket"]
+
+	payload := struct {
+		XMLName xml.Name `xml:"Delete"`
+		Quiet   bool     `xml:"Quiet"`
+		Objects []struct {
+			Key     string `xml:"Key"`
+			Version string `xml:"VersionId"`
+		} `xml:"Object"`
+	}{}
+	if err := s3util.ReadXMLBody(r, &payload); err != nil {
+		s3util.WriteError(w, r, err)
+		return
+	}
+	if len(payload.Objects) == 0 || len(payload.Objects) > MaxDeleteObjects {
+		s3util.WriteError(w, r, s3error.MalformedXMLError(r))
+		return
+	}
+
+	// Delete concurrently, keeping the results in request order
+	results := make([]*DeleteObjectResult, len(payload.Objects))
+	errs := make([]error, len(payload.Objects))
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+	for i := 0; i < deleteObjectsConcurrency && i < len(payload.Objects); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				object := payload.Objects[i]
+				if !ValidKey(object.Key) {
+					errs[i] = s3error.InvalidArgumentError(r)
+					continue
+				}
+				// Each object is authorized as if it were deleted by itself
+				action := "s3:DeleteObject"
+				if object.Version != "" {
+					action = "s3:DeleteObjectVersion"
+				}
+				if errs[i] = s3policy.Authorize(r, action, s3policy.ObjectResource(bucket, object.Key)); errs[i] != nil {
+					continue
+				}
+				results[i], errs[i] = h.Controller.DeleteObject(r, bucket, object.Key, object.Version)
+			}
+		}()
+	}
+	for i := range payload.Objects {
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
+
+	type deleted struct {
+		Key                 string `xml:"Key"`
+		Version             string `xml:"VersionId,omitempty"`
+		DeleteMarker        bool   `xml:"DeleteMarker,omitempty"`
+		DeleteMarkerVersion string `xml:"DeleteMarkerVersionId,omitempty"`
+	}
+	type deleteError struct {
+		Key     string `xml:"Key"`
+		Version string `xml:"VersionId,omitempty"`
+		Code    string `xml:"Code"`
+		Message string `xml:"Message"`
+	}
+	marshallable := struct {
+		XMLName xml.Name      `xml:"http://s3.amazonaws.com/doc/2006-03-01/ DeleteResult"`
+		Deleted []deleted     `xml:"Deleted"`
+		Errors  []deleteError `xml:"Error"`
+	}{}
+
+	for i, object := range payload.Objects {
+		if errs[i] != nil {
+			log.Error().Err(errs[i]).Msg("Failed to delete object: " + object.Key)
+			s3Err := s3error.NewGenericError(r, errs[i])
+			marshallable.Errors = append(marshallable.Errors, deleteError{
+				Key:     object.Key,
+				Version: object.Version,
+				Code:    s3Err.Code,
+				Message: s3Err.Message,
+			})
+			continue
+		}
+		h.notify(r, deleteEvent(bucket, object.Key, object.Version, results[i]))
+		// Only errors are reported in quiet mode
+		if payload.Quiet {
+			continue
+		}
+		result := results[i]
+		d := deleted{
+			Key:          object.Key,
+			Version:      object.Version,
+			DeleteMarker: result.DeleteMarker,
+		}
+		if result.DeleteMarker {
+			d.DeleteMarkerVersion = result.Version
+		}
+		marshallable.Deleted = append(marshallable.Deleted, d)
+	}
+
+	s3util.WriteXML(w, r, http.StatusOK, marshallable)
+}
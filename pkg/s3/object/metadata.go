@@ -0,0 +1,116 @@
+package s3object
+
+import (
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	s3util "github.com/jakthom/s3c/pkg/s3/util"
+)
+
+// userMetadataPrefix is the prefix of headers carrying user-defined metadata
+const userMetadataPrefix = "x-amz-meta-"
+
+// systemHeaders are the standard headers stored with an object, and returned
+// when it is read
+var systemHeaders = []string{
+	"Content-Type",
+	"Content-Encoding",
+	"Content-Disposition",
+	"Content-Language",
+	"Cache-Control",
+	"Expires",
+}
+
+// Metadata is the metadata stored with an object
+type Metadata struct {
+	// Headers are the system headers of the object, ie `Content-Type`,
+	// keyed by their canonical name
+	Headers map[string]string `json:"headers,omitempty"`
+	// UserMetadata is the user-defined metadata of the object, keyed by
+	// lowercase name without the `x-amz-meta-` prefix
+	UserMetadata map[string]string `json:"userMetadata,omitempty"`
+	// Checksum is the flexible checksum of the object, if any. It is only
+	// returned when requested with `x-amz-checksum-mode`.
+	Checksum *s3util.Checksum `json:"checksum,omitempty"`
+	// Tags are the tags of the object, set with `x-amz-tagging` as it is
+	// uploaded
+	Tags map[string]string `json:"tags,omitempty"`
+	// TagCount is the number of tags of an object whose tags are not known,
+	// as when it is read from an upstream reporting `x-amz-tagging-count`
+	TagCount int `json:"tagCount,omitempty"`
+}
+
+// MetadataFromHeader reads the metadata of an object from the headers of a
+// request writing it
+func MetadataFromHeader(header http.Header) *Metadata {
+	metadata := &Metadata{
+		Headers:      map[string]string{},
+		UserMetadata: map[string]string{},
+	}
+	for _, name := range systemHeaders {
+		if value := header.Get(name); value != "" {
+			metadata.Headers[name] = value
+		}
+	}
+	metadata.Checksum = s3util.ChecksumFromHeader(header)
+	// Tags are validated by handlers before the metadata is read
+	if tagging := header.Get("x-amz-tagging"); tagging != "" {
+		if query, err := url.ParseQuery(tagging); err == nil {
+			metadata.Tags = map[string]string{}
+			for key := range query {
+				metadata.Tags[key] = query.Get(key)
+			}
+		}
+	}
+	metadata.TagCount, _ = strconv.Atoi(header.Get("x-amz-tagging-count"))
+	// aws-chunked is the encoding of the upload, not of the object
+	if encoding := withoutAWSChunked(metadata.Headers["Content-Encoding"]); encoding != "" {
+		metadata.Headers["Content-Encoding"] = encoding
+	} else {
+		delete(metadata.Headers, "Content-Encoding")
+	}
+	for name, values := range header {
+		lower := strings.ToLower(name)
+		if strings.HasPrefix(lower, userMetadataPrefix) && len(values) > 0 {
+			metadata.UserMetadata[strings.TrimPrefix(lower, userMetadataPrefix)] = strings.Join(values, ",")
+		}
+	}
+	return metadata
+}
+
+// withoutAWSChunked removes aws-chunked from a Content-Encoding header
+func withoutAWSChunked(encoding string) string {
+	var encodings []string
+	for _, e := range strings.Split(encoding, ",") {
+		if e = strings.TrimSpace(e); e != "" && !strings.EqualFold(e, "aws-chunked") {
+			encodings = append(encodings, e)
+		}
+	}
+	return strings.Join(encodings, ",")
+}
+
+// TaggingCount returns the number of tags of an object
+func (m *Metadata) TaggingCount() int {
+	if m == nil {
+		return 0
+	}
+	if len(m.Tags) > 0 {
+		return len(m.Tags)
+	}
+	return m.TagCount
+}
+
+// WriteHeader sets the headers of a response from the metadata of an object
+func (m *Metadata) WriteHeader(header http.Header) {
+	if m == nil {
+		return
+	}
+	for name, value := range m.Headers {
+		header.Set(name, value)
+	}
+	for name, value := range m.UserMetadata {
+		header[http.CanonicalHeaderKey(userMetadataPrefix+name)] = []string{value}
+	}
+}
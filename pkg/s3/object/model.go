@@ -1,9 +1,13 @@
 package s3object
 
 import (
+	"encoding/xml"
 	"io"
-	"os/user"
+	"strings"
 	"time"
+
+	s3user "github.com/jakthom/s3c/pkg/s3/user"
+	s3util "github.com/jakthom/s3c/pkg/s3/util"
 )
 
 // Object is an individual file/object
@@ -20,7 +24,22 @@ type Object struct {
 	// StorageClass specifies the storage class used for the object
 	StorageClass string `xml:"StorageClass"`
 	// Owner specifies the owner of the object
-	Owner user.User `xml:"Owner"`
+	Owner *s3user.User `xml:"Owner,omitempty"`
+}
+
+// ValidKey returns whether a key names an object within its bucket. The keys
+// of request paths are cleaned by the router, but those read from request
+// bodies and headers are not, so they are checked before use.
+func ValidKey(key string) bool {
+	if key == "" || strings.HasPrefix(key, "/") {
+		return false
+	}
+	for _, segment := range strings.Split(key, "/") {
+		if segment == ".." {
+			return false
+		}
+	}
+	return true
 }
 
 // DeleteMarker specifies an object that has been deleted from a
@@ -36,7 +55,7 @@ type DeleteMarker struct {
 	// LastModified specifies when the object was last modified
 	LastModified time.Time `xml:"LastModified"`
 	// Owner specifies the owner of the object
-	Owner user.User `xml:"Owner"`
+	Owner *s3user.User `xml:"Owner,omitempty"`
 }
 
 // CommonPrefixes specifies a common prefix of S3 keys. This is akin to a
@@ -44,8 +63,6 @@ type DeleteMarker struct {
 type CommonPrefixes struct {
 	// Prefix specifies the common prefix value.
 	Prefix string `xml:"Prefix"`
-	// Owner specifies the owner of the object
-	Owner user.User `xml:"Owner"`
 }
 
 // GetObjectResult is a response from a GetObject call
@@ -61,10 +78,51 @@ type GetObjectResult struct {
 	DeleteMarker bool
 	// ModTime specifies when the object was modified.
 	ModTime time.Time
+	// Metadata is the metadata stored with the object, if any.
+	Metadata *Metadata
 	// Content is the contents of the object.
 	Content io.ReadSeeker
 }
 
+// Close closes the contents of the result, if the origin returned closeable
+// contents
+func (r *GetObjectResult) Close() error {
+	if closer, ok := r.Content.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+// GetObjectRangeResult is a response from a GetObjectRange call. Its
+// contents are those of the range only.
+type GetObjectRangeResult struct {
+	GetObjectResult
+	// Start is the offset of the range within the object
+	Start int64
+	// Length is the length of the range
+	Length int64
+	// Size is the size of the whole object
+	Size int64
+	// PartsCount is the number of parts of an object uploaded in parts, when
+	// a part of it is requested, or 0 if it is unknown
+	PartsCount int
+}
+
+// HeadObjectResult is a response from a HeadObject call. It describes an
+// object without opening its contents, so its `Content` is always nil.
+type HeadObjectResult struct {
+	GetObjectResult
+	// Size is the size of the whole object
+	Size int64
+	// Start and Length are the offset and length of the requested part
+	// within the object, if a part is requested
+	Start  int64
+	Length int64
+	// PartsCount is the number of parts of an object uploaded in parts, when
+	// a part of it is requested, or 0 if it is unknown
+	PartsCount int
+}
+
 // PutObjectResult is a response from a PutObject call
 type PutObjectResult struct {
 	// ETag is a hex encoding of the hash of the object contents, with or
@@ -73,6 +131,11 @@ type PutObjectResult struct {
 	// Version is the version of the object, or an empty string if versioning
 	// is not enabled or supported.
 	Version string
+	// ModTime is when the object was written, or the zero time if the origin
+	// does not report it.
+	ModTime time.Time
+	// Metadata is the metadata stored with the object.
+	Metadata *Metadata
 }
 
 // DeleteObjectResult is a response from a DeleteObject call
@@ -84,3 +147,44 @@ type DeleteObjectResult struct {
 	// object.
 	DeleteMarker bool
 }
+
+// ObjectTaggingResult is a response from a GetObjectTagging call
+type ObjectTaggingResult struct {
+	// Version is the version of the object, or an empty string if versioning
+	// is not enabled or supported.
+	Version string
+	// Tags are the tags of the object
+	Tags map[string]string
+}
+
+// GetObjectAttributesResult is an XML marshallable response to a
+// GetObjectAttributes call. Only the requested attributes are set.
+type GetObjectAttributesResult struct {
+	XMLName xml.Name `xml:"http://s3.amazonaws.com/doc/2006-03-01/ GetObjectAttributesResponse"`
+	// ETag is a hex encoding of the hash of the object contents, without
+	// surrounding quotes.
+	ETag string `xml:"ETag,omitempty"`
+	// Checksum is the checksum of the object, if it has one
+	Checksum *ObjectChecksum `xml:"Checksum,omitempty"`
+	// ObjectParts describes the parts of objects uploaded in parts
+	ObjectParts *ObjectParts `xml:"ObjectParts,omitempty"`
+	// StorageClass specifies the storage class used for the object
+	StorageClass string `xml:"StorageClass,omitempty"`
+	// ObjectSize specifies the size of the object
+	ObjectSize *int64 `xml:"ObjectSize,omitempty"`
+}
+
+// ObjectChecksum is an XML marshallable representation of the checksum of
+// an object
+type ObjectChecksum struct {
+	s3util.ChecksumFields
+	// ChecksumType is either FULL_OBJECT or COMPOSITE
+	ChecksumType string `xml:"ChecksumType,omitempty"`
+}
+
+// ObjectParts is an XML marshallable representation of the parts of an
+// object
+type ObjectParts struct {
+	// TotalPartsCount is the number of parts the object was uploaded in
+	TotalPartsCount int `xml:"PartsCount"`
+}
@@ -0,0 +1,223 @@
+package s3object
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	s3error "github.com/jakthom/s3c/pkg/s3/error"
+)
+
+// ObjectRange selects the contents to get of an object: either a byte range,
+// as in a `Range` header, or a part of an object uploaded in parts.
+type ObjectRange struct {
+	// Start is the offset of the first byte of the range, or -1 for a range
+	// of the last `End` bytes of the object
+	Start int64
+	// End is the offset of the last byte of the range, or -1 if the range
+	// extends to the end of the object
+	End int64
+	// PartNumber selects a part of the object instead of a byte range, if
+	// positive
+	PartNumber int
+}
+
+// parseRange parses the byte ranges of a `Range` header. Headers that are
+// not well-formed byte ranges are ignored, as they are by s3.
+func parseRange(header string) ([]ObjectRange, bool) {
+	spec, ok := strings.CutPrefix(strings.TrimSpace(header), "bytes=")
+	if !ok {
+		return nil, false
+	}
+	var ranges []ObjectRange
+	for _, part := range strings.Split(spec, ",") {
+		first, last, ok := strings.Cut(strings.TrimSpace(part), "-")
+		if !ok {
+			return nil, false
+		}
+		rng := ObjectRange{Start: -1, End: -1}
+		if first == "" {
+			// A suffix range, ie `bytes=-500`
+			length, err := strconv.ParseInt(last, 10, 64)
+			if err != nil || length < 0 {
+				return nil, false
+			}
+			rng.End = length
+		} else {
+			start, err := strconv.ParseInt(first, 10, 64)
+			if err != nil || start < 0 {
+				return nil, false
+			}
+			rng.Start = start
+			if last != "" {
+				end, err := strconv.ParseInt(last, 10, 64)
+				if err != nil || end < start {
+					return nil, false
+				}
+				rng.End = end
+			}
+		}
+		ranges = append(ranges, rng)
+	}
+	return ranges, len(ranges) > 0
+}
+
+// Header returns the `Range` header value of a byte range
+func (o ObjectRange) Header() string {
+	switch {
+	case o.Start < 0:
+		return fmt.Sprintf("bytes=-%d", o.End)
+	case o.End < 0:
+		return fmt.Sprintf("bytes=%d-", o.Start)
+	default:
+		return fmt.Sprintf("bytes=%d-%d", o.Start, o.End)
+	}
+}
+
+// Resolve returns the offset and length of the bytes of a byte range within
+// an object of `size` bytes, and whether the range is satisfiable
+func (o ObjectRange) Resolve(size int64) (int64, int64, bool) {
+	if o.Start < 0 {
+		length := min(o.End, size)
+		return size - length, length, length > 0
+	}
+	if o.Start >= size {
+		return 0, 0, false
+	}
+	end := o.End
+	if end < 0 || end >= size {
+		end = size - 1
+	}
+	return o.Start, end - o.Start + 1, true
+}
+
+// ContentRange returns the `Content-Range` header value of a range result
+func (r *GetObjectRangeResult) ContentRange() string {
+	if r.Length == 0 {
+		return fmt.Sprintf("bytes */%d", r.Size)
+	}
+	return fmt.Sprintf("bytes %d-%d/%d", r.Start, r.Start+r.Length-1, r.Size)
+}
+
+// PartRange returns the offset and length of a part of an object of `size`
+// bytes, along with its number of parts. `partSizes` are the sizes of the
+// parts of objects uploaded in parts, if known; other objects are a single
+// part, and their number of parts is reported as 0.
+func PartRange(r *http.Request, size int64, partNumber int, partSizes []int64) (int64, int64, int, error) {
+	partsCount := len(partSizes)
+	if partsCount == 0 {
+		partSizes = []int64{size}
+	}
+	if partNumber > len(partSizes) {
+		return 0, 0, 0, s3error.InvalidPartNumberError(r)
+	}
+	var start int64
+	for _, partSize := range partSizes[:partNumber-1] {
+		start += partSize
+	}
+	return start, partSizes[partNumber-1], partsCount, nil
+}
+
+// SliceObject returns the result of getting a range of an object from the
+// result of getting all of it, whose contents are read from the range only.
+// `partSizes` are the sizes of the parts of objects uploaded in parts, if
+// known; other objects are a single part. The contents of the result are
+// closed if the range is not satisfiable.
+func SliceObject(r *http.Request, result *GetObjectResult, rng ObjectRange, partSizes []int64) (*GetObjectRangeResult, error) {
+	if result.DeleteMarker {
+		return &GetObjectRangeResult{GetObjectResult: *result}, nil
+	}
+	size, err := result.Content.Seek(0, io.SeekEnd)
+	if err != nil {
+		result.Close()
+		return nil, err
+	}
+
+	var start, length int64
+	partsCount := 0
+	if rng.PartNumber > 0 {
+		if start, length, partsCount, err = PartRange(r, size, rng.PartNumber, partSizes); err != nil {
+			result.Close()
+			return nil, err
+		}
+	} else {
+		var ok bool
+		if start, length, ok = rng.Resolve(size); !ok {
+			result.Close()
+			return nil, s3error.InvalidRangeError(r)
+		}
+	}
+
+	sliced := &GetObjectRangeResult{
+		GetObjectResult: *result,
+		Start:           start,
+		Length:          length,
+		Size:            size,
+		PartsCount:      partsCount,
+	}
+	sliced.Content = &contentSection{
+		content: result.Content,
+		start:   start,
+		length:  length,
+	}
+	return sliced, nil
+}
+
+// contentSection reads a section of the contents of an object
+type contentSection struct {
+	content io.ReadSeeker
+	start   int64
+	length  int64
+	offset  int64
+	// positioned is set while the contents are positioned at the offset
+	positioned bool
+}
+
+func (s *contentSection) Read(p []byte) (int, error) {
+	if s.offset >= s.length {
+		return 0, io.EOF
+	}
+	if !s.positioned {
+		if _, err := s.content.Seek(s.start+s.offset, io.SeekStart); err != nil {
+			return 0, err
+		}
+		s.positioned = true
+	}
+	if remaining := s.length - s.offset; int64(len(p)) > remaining {
+		p = p[:remaining]
+	}
+	n, err := s.content.Read(p)
+	s.offset += int64(n)
+	if err == io.EOF && s.offset < s.length {
+		err = io.ErrUnexpectedEOF
+	}
+	return n, err
+}
+
+func (s *contentSection) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += s.offset
+	case io.SeekEnd:
+		offset += s.length
+	default:
+		return 0, errors.New("invalid whence")
+	}
+	if offset < 0 {
+		return 0, errors.New("negative position")
+	}
+	s.offset = offset
+	s.positioned = false
+	return offset, nil
+}
+
+func (s *contentSection) Close() error {
+	if closer, ok := s.content.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
@@ -1,26 +1,36 @@
 package s3object
 
-import "github.com/gorilla/mux"
+import (
+	"github.com/gorilla/mux"
+	s3multipart "github.com/jakthom/s3c/pkg/s3/multipart"
+)
 
 const (
 	Route = `/{bucket:[a-zA-Z0-9\-_\.]{1,255}}/{key:.+}`
 )
 
-func AddSubrouter(router *mux.Router, handler *ObjectHandler) error {
+func AddSubrouter(router *mux.Router, handler *ObjectHandler, multipartHandler *s3multipart.MultipartHandler) error {
 	subrouter := router.PathPrefix(Route).Subrouter()
-	attachRoutes(subrouter, handler)
+	attachRoutes(subrouter, handler, multipartHandler)
 	return nil
 }
 
-func attachRoutes(router *mux.Router, handler *ObjectHandler) {
-	// router.Methods("GET").Queries("uploadId", "").HandlerFunc(multipartHandler.listChunks)
-	// router.Methods("POST").Queries("uploads", "").HandlerFunc(multipartHandler.init)
-	// router.Methods("POST").Queries("uploadId", "").HandlerFunc(multipartHandler.complete)
-	// router.Methods("PUT").Queries("uploadId", "").HandlerFunc(multipartHandler.put)
-	// router.Methods("DELETE").Queries("uploadId", "").HandlerFunc(multipartHandler.del)
-	// router.Methods("HEAD").HandlerFunc(handler.Head)
-	router.Methods("GET", "HEAD").HandlerFunc(handler.Get)
-	router.Methods("PUT").Headers("x-amz-copy-source", "").HandlerFunc(handler.Copy)
-	router.Methods("PUT").HandlerFunc(handler.Put)
-	router.Methods("DELETE").HandlerFunc(handler.Del)
+// attachRoutes attaches the routes for the object handler to the router. Each
+// route is named after the s3 action that requests routed to it are
+// authorized for.
+func attachRoutes(router *mux.Router, handler *ObjectHandler, multipartHandler *s3multipart.MultipartHandler) {
+	router.Methods("GET").Queries("uploadId", "").HandlerFunc(multipartHandler.ListChunks).Name("s3:ListMultipartUploadParts")
+	router.Methods("POST").Queries("uploads", "").HandlerFunc(multipartHandler.Init).Name("s3:PutObject")
+	router.Methods("POST").Queries("uploadId", "").HandlerFunc(multipartHandler.Complete).Name("s3:PutObject")
+	router.Methods("PUT").Queries("uploadId", "").HandlerFunc(multipartHandler.Put).Name("s3:PutObject")
+	router.Methods("DELETE").Queries("uploadId", "").HandlerFunc(multipartHandler.Del).Name("s3:AbortMultipartUpload")
+	router.Methods("GET").Queries("attributes", "").HandlerFunc(handler.GetAttributes).Name("s3:GetObjectAttributes")
+	router.Methods("GET").Queries("tagging", "").HandlerFunc(handler.GetTagging).Name("s3:GetObjectTagging")
+	router.Methods("PUT").Queries("tagging", "").HandlerFunc(handler.PutTagging).Name("s3:PutObjectTagging")
+	router.Methods("DELETE").Queries("tagging", "").HandlerFunc(handler.DelTagging).Name("s3:DeleteObjectTagging")
+	router.Methods("HEAD").HandlerFunc(handler.Head).Name("s3:GetObject")
+	router.Methods("GET").HandlerFunc(handler.Get).Name("s3:GetObject")
+	router.Methods("PUT").Headers("x-amz-copy-source", "").HandlerFunc(handler.Copy).Name("s3:PutObject")
+	router.Methods("PUT").HandlerFunc(handler.Put).Name("s3:PutObject")
+	router.Methods("DELETE").HandlerFunc(handler.Del).Name("s3:DeleteObject")
 }
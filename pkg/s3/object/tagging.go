@@ -0,0 +1,58 @@
+package s3object
+
+import (
+	"net/http"
+
+	"github.com/gorilla/mux"
+	s3util "github.com/jakthom/s3c/pkg/s3/util"
+)
+
+// GetTagging serves GetObjectTagging
+func (h *ObjectHandler) GetTagging(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	bucket := vars["bucket"]
+	key := vars["key"]
+	versionId := r.FormValue("versionId")
+
+	result, err := h.Controller.GetObjectTagging(r, bucket, key, versionId)
+	if err != nil {
+		s3util.WriteError(w, r, err)
+		return
+	}
+	if result.Version != "" {
+		w.Header().Set("x-amz-version-id", result.Version)
+	}
+	s3util.WriteXML(w, r, http.StatusOK, s3util.NewTagging(result.Tags))
+}
+
+// PutTagging serves PutObjectTagging, which replaces the tags of an object
+func (h *ObjectHandler) PutTagging(w http.ResponseWriter, r *http.Request) {
+	tags, err := s3util.ReadTagging(r, s3util.MaxObjectTags)
+	if err != nil {
+		s3util.WriteError(w, r, err)
+		return
+	}
+	h.putTagging(w, r, tags, http.StatusOK)
+}
+
+// DelTagging serves DeleteObjectTagging, which removes the tags of an object
+func (h *ObjectHandler) DelTagging(w http.ResponseWriter, r *http.Request) {
+	h.putTagging(w, r, map[string]string{}, http.StatusNoContent)
+}
+
+func (h *ObjectHandler) putTagging(w http.ResponseWriter, r *http.Request, tags map[string]string, status int) {
+	vars := mux.Vars(r)
+	bucket := vars["bucket"]
+	key := vars["key"]
+	versionId := r.FormValue("versionId")
+
+	version, err := h.Controller.PutObjectTagging(r, bucket, key, versionId, tags)
+	if err != nil {
+		s3util.WriteError(w, r, err)
+		return
+	}
+	if version != "" {
+		w.Header().Set("x-amz-version-id", version)
+	}
+	w.WriteHeader(status)
+}
@@ -0,0 +1,57 @@
+package s3policy
+
+const (
+	// ACLPrivate grants no access beyond what policies grant
+	ACLPrivate string = "private"
+	// ACLPublicRead lets anyone list a bucket and read its objects
+	ACLPublicRead string = "public-read"
+	// ACLPublicReadWrite lets anyone list, read, write and delete the
+	// objects of a bucket
+	ACLPublicReadWrite string = "public-read-write"
+)
+
+// readActions are the actions a public-read bucket grants to anyone
+var readActions = []string{
+	"s3:ListBucket",
+	"s3:ListBucketVersions",
+	"s3:GetObject",
+	"s3:GetObjectVersion",
+}
+
+// writeActions are the actions a public-read-write bucket grants to anyone,
+// in addition to its read actions
+var writeActions = []string{
+	"s3:PutObject",
+	"s3:DeleteObject",
+	"s3:DeleteObjectVersion",
+	"s3:ListBucketMultipartUploads",
+	"s3:ListMultipartUploadParts",
+	"s3:AbortMultipartUpload",
+}
+
+// ValidACL returns whether a canned ACL is supported
+func ValidACL(acl string) bool {
+	return acl == ACLPrivate || acl == ACLPublicRead || acl == ACLPublicReadWrite
+}
+
+// aclPolicy returns the bucket policy equivalent to the canned ACL of a
+// bucket, or nil if the ACL grants nothing
+func aclPolicy(bucket, acl string) *Policy {
+	var actions []string
+	switch acl {
+	case ACLPublicRead:
+		actions = readActions
+	case ACLPublicReadWrite:
+		actions = append(append([]string{}, readActions...), writeActions...)
+	default:
+		return nil
+	}
+	return &Policy{
+		Statement: []Statement{{
+			Effect:    EffectAllow,
+			Principal: &Principal{AWS: stringList{"*"}},
+			Action:    actions,
+			Resource:  stringList{BucketResource(bucket), ObjectResource(bucket, "*")},
+		}},
+	}
+}
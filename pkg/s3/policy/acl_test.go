@@ -0,0 +1,163 @@
+package s3policy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	s3user "github.com/jakthom/s3c/pkg/s3/user"
+)
+
+func TestACLPolicy(t *testing.T) {
+	readActions := []string{"s3:ListBucket", "s3:ListBucketVersions", "s3:GetObject", "s3:GetObjectVersion"}
+	writeActions := []string{"s3:PutObject", "s3:DeleteObject", "s3:DeleteObjectVersion", "s3:AbortMultipartUpload"}
+	adminActions := []string{"s3:DeleteBucket", "s3:PutBucketPolicy", "s3:PutBucketAcl", "s3:GetBucketAcl", "s3:PutObjectTagging"}
+
+	tests := []struct {
+		acl     string
+		allowed []string
+		denied  []string
+	}{
+		{ACLPrivate, nil, append(append(append([]string{}, readActions...), writeActions...), adminActions...)},
+		{ACLPublicRead, readActions, append(append([]string{}, writeActions...), adminActions...)},
+		{ACLPublicReadWrite, append(append([]string{}, readActions...), writeActions...), adminActions},
+	}
+	for _, tt := range tests {
+		policy := aclPolicy("bucket", tt.acl)
+		decide := func(action, resource string) decision {
+			if policy == nil {
+				return decisionNone
+			}
+			return policy.evaluate(&Request{Action: action, Resource: resource})
+		}
+		for _, action := range tt.allowed {
+			for _, resource := range []string{BucketResource("bucket"), ObjectResource("bucket", "dir/key")} {
+				if decide(action, resource) != decisionAllow {
+					t.Errorf("%s: %s on %s is not allowed", tt.acl, action, resource)
+				}
+			}
+			// ACLs only apply to their own bucket
+			if decide(action, ObjectResource("other", "key")) != decisionNone {
+				t.Errorf("%s: %s is allowed on another bucket", tt.acl, action)
+			}
+		}
+		for _, action := range tt.denied {
+			if decide(action, ObjectResource("bucket", "key")) == decisionAllow {
+				t.Errorf("%s: %s is allowed", tt.acl, action)
+			}
+		}
+	}
+}
+
+func TestValidACL(t *testing.T) {
+	for _, acl := range []string{ACLPrivate, ACLPublicRead, ACLPublicReadWrite} {
+		if !ValidACL(acl) {
+			t.Errorf("%s is not valid", acl)
+		}
+	}
+	for _, acl := range []string{"", "authenticated-read", "bucket-owner-full-control", "Public-Read"} {
+		if ValidACL(acl) {
+			t.Errorf("%q is valid", acl)
+		}
+	}
+}
+
+func TestStoreACLs(t *testing.T) {
+	if _, err := NewStore(t.TempDir(), map[string]string{"bucket": "world-writable"}); err == nil {
+		t.Error("invalid default acl was accepted")
+	}
+
+	dir := t.TempDir()
+	defaults := map[string]string{"public": ACLPublicRead}
+	store, err := NewStore(dir, defaults)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := httptest.NewRequest(http.MethodPut, "/", nil)
+	acl := func(bucket string) string {
+		t.Helper()
+		acl, err := store.GetBucketACL(r, bucket)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return acl
+	}
+	if acl("private") != ACLPrivate || acl("public") != ACLPublicRead {
+		t.Errorf("default acls are %q and %q", acl("private"), acl("public"))
+	}
+	if err := store.PutBucketACL(r, "private", "authenticated-read"); err == nil {
+		t.Error("unsupported acl was accepted")
+	}
+	if err := store.PutBucketACL(r, "private", ACLPublicReadWrite); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.PutBucketACL(r, "public", ACLPrivate); err != nil {
+		t.Fatal(err)
+	}
+
+	// Stored ACLs persist, and override the defaults
+	store, err = NewStore(dir, defaults)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if acl("private") != ACLPublicReadWrite || acl("public") != ACLPrivate {
+		t.Errorf("stored acls are %q and %q", acl("private"), acl("public"))
+	}
+
+	// Deleting a bucket resets its ACL to its default
+	if err := store.DeleteBucket(r, "public"); err != nil {
+		t.Fatal(err)
+	}
+	if acl("public") != ACLPublicRead {
+		t.Errorf("acl of a deleted bucket is %q", acl("public"))
+	}
+}
+
+func TestAuthorizeACL(t *testing.T) {
+	store, err := NewStore(t.TempDir(), map[string]string{"public": ACLPublicRead})
+	if err != nil {
+		t.Fatal(err)
+	}
+	users := &testUserPolicies{users: map[string]*Policy{}}
+	authorizer := NewAuthorizer(users, store)
+	authorize := func(user *s3user.User, scope *Scope, action, resource string) bool {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		return Authorize(authorizer.Attach(r, user, scope), action, resource) == nil
+	}
+	bob := &s3user.User{ID: "bob"}
+
+	// Public buckets are readable by anyone, including users whose own
+	// policies grant them nothing
+	if !authorize(nil, nil, "s3:GetObject", ObjectResource("public", "key")) {
+		t.Error("anonymous read of a public-read bucket was denied")
+	}
+	if !authorize(bob, nil, "s3:ListBucket", BucketResource("public")) {
+		t.Error("listing of a public-read bucket was denied")
+	}
+	if authorize(nil, nil, "s3:PutObject", ObjectResource("public", "key")) {
+		t.Error("anonymous write to a public-read bucket was allowed")
+	}
+	if authorize(nil, nil, "s3:GetObject", ObjectResource("private", "key")) {
+		t.Error("anonymous read of a private bucket was allowed")
+	}
+
+	// Explicit denies of policies override ACLs
+	users.users["bob"] = mustParse(t, `{"Statement": [{"Effect": "Deny", "Action": "s3:GetObject", "Resource": "arn:aws:s3:::public/secret/*"}]}`, false)
+	if authorize(bob, nil, "s3:GetObject", ObjectResource("public", "secret/key")) {
+		t.Error("read of a public-read bucket denied by a user policy was allowed")
+	}
+	if !authorize(bob, nil, "s3:GetObject", ObjectResource("public", "key")) {
+		t.Error("read of a public-read bucket not denied by a user policy was denied")
+	}
+
+	r := httptest.NewRequest(http.MethodPut, "/", nil)
+	if err := store.PutBucketACL(r, "private", ACLPublicReadWrite); err != nil {
+		t.Fatal(err)
+	}
+	if !authorize(nil, nil, "s3:DeleteObject", ObjectResource("private", "key")) {
+		t.Error("anonymous delete from a public-read-write bucket was denied")
+	}
+	if authorize(nil, nil, "s3:PutBucketAcl", BucketResource("private")) {
+		t.Error("anonymous change of the acl of a public-read-write bucket was allowed")
+	}
+}
@@ -0,0 +1,104 @@
+package s3policy
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/mux"
+	s3error "github.com/jakthom/s3c/pkg/s3/error"
+)
+
+// subresources are the subresources of buckets and objects that s3c routes
+var subresources = []string{
+	"versioning",
+	"versions",
+	"policy",
+	"policyStatus",
+	"acl",
+	"cors",
+	"website",
+	"notification",
+	"lifecycle",
+	"tagging",
+	"uploads",
+	"location",
+	"delete",
+	"uploadId",
+	"attributes",
+}
+
+// CheckSubresources rejects requests naming more than one subresource, whose
+// action would otherwise depend on which of them is routed
+func CheckSubresources(r *http.Request) error {
+	query := r.URL.Query()
+	var named []string
+	for _, subresource := range subresources {
+		if query.Has(subresource) {
+			named = append(named, subresource)
+		}
+	}
+	if len(named) > 1 {
+		return s3error.InvalidRequestError(r, "Conflicting query string parameters: "+strings.Join(named, ", "))
+	}
+	return nil
+}
+
+// Action returns the s3 action and resource of a routed request. The action
+// is that named by the route the request matched, and is empty if the
+// request is not a known s3 action. The resource is empty if the handler
+// authorizes each resource the request acts on instead, as when deleting
+// several objects.
+func Action(r *http.Request) (string, string) {
+	vars := mux.Vars(r)
+	bucket, key := vars["bucket"], vars["key"]
+
+	if bucket == "" {
+		method := r.Method
+		if method == http.MethodHead {
+			method = http.MethodGet
+		}
+		if r.URL.Path == "/" && method == http.MethodGet {
+			return "s3:ListAllMyBuckets", ResourcePrefix + "*"
+		}
+		if r.URL.Path == "/" && method == http.MethodPost {
+			return stsAction(r)
+		}
+		return "", ""
+	}
+
+	route := mux.CurrentRoute(r)
+	if route == nil || route.GetName() == "" {
+		return "", ""
+	}
+	action := route.GetName()
+	if key == "" {
+		// Deleting several objects is authorized by the handler, object by
+		// object
+		if action == "s3:DeleteObject" {
+			return action, ""
+		}
+		return action, BucketResource(bucket)
+	}
+
+	// Versions of objects are acted on by actions of their own
+	if r.URL.Query().Get("versionId") != "" {
+		switch action {
+		case "s3:GetObject", "s3:DeleteObject":
+			action += "Version"
+		case "s3:GetObjectTagging", "s3:PutObjectTagging", "s3:DeleteObjectTagging":
+			action = strings.Replace(action, "ObjectTagging", "ObjectVersionTagging", 1)
+		}
+	}
+	return action, ObjectResource(bucket, key)
+}
+
+// stsAction returns the sts action of a request to the sts endpoint. Its
+// resource is empty since the handler authorizes the action, so that errors
+// are written in the shape sts clients expect.
+func stsAction(r *http.Request) (string, string) {
+	switch action := r.FormValue("Action"); action {
+	case "AssumeRole", "GetSessionToken":
+		return "sts:" + action, ""
+	}
+	return "", ""
+}
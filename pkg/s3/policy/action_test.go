@@ -0,0 +1,118 @@
+package s3policy_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+	s3bucket "github.com/jakthom/s3c/pkg/s3/bucket"
+	s3object "github.com/jakthom/s3c/pkg/s3/object"
+	s3policy "github.com/jakthom/s3c/pkg/s3/policy"
+)
+
+// actionRouter routes requests as s3c does, recording the action and
+// resource of each instead of serving it
+type actionRouter struct {
+	router   *mux.Router
+	action   string
+	resource string
+}
+
+func newActionRouter() *actionRouter {
+	a := &actionRouter{router: mux.NewRouter()}
+	a.router.Use(func(http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			a.action, a.resource = s3policy.Action(r)
+		})
+	})
+	s3object.AddSubrouter(a.router, nil, nil)
+	s3bucket.AddSubrouter(a.router, nil, nil, nil)
+	return a
+}
+
+func (a *actionRouter) route(method, target string, header http.Header) (string, string) {
+	a.action, a.resource = "", ""
+	r := httptest.NewRequest(method, target, nil)
+	for name, values := range header {
+		r.Header[name] = values
+	}
+	a.router.ServeHTTP(httptest.NewRecorder(), r)
+	return a.action, a.resource
+}
+
+func TestAction(t *testing.T) {
+	tests := []struct {
+		method   string
+		target   string
+		header   http.Header
+		action   string
+		resource string
+	}{
+		{http.MethodGet, "/bucket", nil, "s3:ListBucket", "arn:aws:s3:::bucket"},
+		{http.MethodHead, "/bucket/", nil, "s3:ListBucket", "arn:aws:s3:::bucket"},
+		{http.MethodGet, "/bucket?list-type=2", nil, "s3:ListBucket", "arn:aws:s3:::bucket"},
+		{http.MethodPut, "/bucket", nil, "s3:CreateBucket", "arn:aws:s3:::bucket"},
+		{http.MethodDelete, "/bucket", nil, "s3:DeleteBucket", "arn:aws:s3:::bucket"},
+		{http.MethodPost, "/bucket?delete", nil, "s3:DeleteObject", ""},
+		{http.MethodGet, "/bucket/?versioning", nil, "s3:GetBucketVersioning", "arn:aws:s3:::bucket"},
+		{http.MethodPut, "/bucket?policy", nil, "s3:PutBucketPolicy", "arn:aws:s3:::bucket"},
+		{http.MethodDelete, "/bucket?policy", nil, "s3:DeleteBucketPolicy", "arn:aws:s3:::bucket"},
+		{http.MethodPut, "/bucket?tagging", nil, "s3:PutBucketTagging", "arn:aws:s3:::bucket"},
+		{http.MethodDelete, "/bucket?cors", nil, "s3:PutBucketCORS", "arn:aws:s3:::bucket"},
+		{http.MethodGet, "/bucket?uploads", nil, "s3:ListBucketMultipartUploads", "arn:aws:s3:::bucket"},
+		{http.MethodGet, "/bucket/dir/key", nil, "s3:GetObject", "arn:aws:s3:::bucket/dir/key"},
+		{http.MethodHead, "/bucket/key?versionId=v1", nil, "s3:GetObjectVersion", "arn:aws:s3:::bucket/key"},
+		{http.MethodPut, "/bucket/key", nil, "s3:PutObject", "arn:aws:s3:::bucket/key"},
+		{http.MethodPut, "/bucket/key", http.Header{"X-Amz-Copy-Source": {"src/key"}}, "s3:PutObject", "arn:aws:s3:::bucket/key"},
+		{http.MethodDelete, "/bucket/key?versionId=v1", nil, "s3:DeleteObjectVersion", "arn:aws:s3:::bucket/key"},
+		{http.MethodGet, "/bucket/key?attributes", nil, "s3:GetObjectAttributes", "arn:aws:s3:::bucket/key"},
+		{http.MethodPut, "/bucket/key?tagging", nil, "s3:PutObjectTagging", "arn:aws:s3:::bucket/key"},
+		{http.MethodDelete, "/bucket/key?tagging&versionId=v1", nil, "s3:DeleteObjectVersionTagging", "arn:aws:s3:::bucket/key"},
+		{http.MethodPost, "/bucket/key?uploads", nil, "s3:PutObject", "arn:aws:s3:::bucket/key"},
+		{http.MethodGet, "/bucket/key?uploadId=u1", nil, "s3:ListMultipartUploadParts", "arn:aws:s3:::bucket/key"},
+		{http.MethodDelete, "/bucket/key?uploadId=u1", nil, "s3:AbortMultipartUpload", "arn:aws:s3:::bucket/key"},
+		// The action of a request naming several subresources is that of the
+		// route it is served by
+		{http.MethodPut, "/bucket?policy&tagging", nil, "s3:PutBucketPolicy", "arn:aws:s3:::bucket"},
+		{http.MethodPut, "/bucket?tagging&acl", nil, "s3:PutBucketAcl", "arn:aws:s3:::bucket"},
+		{http.MethodPut, "/bucket/key?uploadId=u1&tagging", nil, "s3:PutObject", "arn:aws:s3:::bucket/key"},
+		{http.MethodDelete, "/bucket/key?tagging&uploadId=u1", nil, "s3:AbortMultipartUpload", "arn:aws:s3:::bucket/key"},
+	}
+	router := newActionRouter()
+	for _, tt := range tests {
+		t.Run(tt.method+" "+tt.target, func(t *testing.T) {
+			// Routing must decide the action, however often it is asked
+			for i := 0; i < 50; i++ {
+				action, resource := router.route(tt.method, tt.target, tt.header)
+				if action != tt.action || resource != tt.resource {
+					t.Fatalf("got %q on %q, want %q on %q", action, resource, tt.action, tt.resource)
+				}
+			}
+		})
+	}
+}
+
+func TestCheckSubresources(t *testing.T) {
+	tests := []struct {
+		target string
+		ok     bool
+	}{
+		{"/bucket", true},
+		{"/bucket?list-type=2&prefix=a", true},
+		{"/bucket?policy", true},
+		{"/bucket/key?tagging&versionId=v1", true},
+		{"/bucket/key?uploadId=u1&partNumber=1", true},
+		{"/bucket?policy&tagging", false},
+		{"/bucket?acl&policyStatus", false},
+		{"/bucket/key?uploadId=u1&tagging", false},
+		{"/bucket/key?uploads&uploadId=u1", false},
+		{"/bucket?delete&versioning", false},
+	}
+	for _, tt := range tests {
+		err := s3policy.CheckSubresources(httptest.NewRequest(http.MethodPut, tt.target, nil))
+		if (err == nil) != tt.ok {
+			t.Errorf("%s: got error %v, want ok %v", tt.target, err, tt.ok)
+		}
+	}
+}
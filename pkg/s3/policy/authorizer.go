@@ -0,0 +1,191 @@
+package s3policy
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	s3error "github.com/jakthom/s3c/pkg/s3/error"
+	s3user "github.com/jakthom/s3c/pkg/s3/user"
+)
+
+// UserPolicies is an interface providing the policies of users and roles
+type UserPolicies interface {
+	// UserPolicy returns whether a user is an administrator, who may perform
+	// any action a bucket policy does not deny, and the policy of the user,
+	// which may be nil.
+	UserPolicy(user string) (bool, *Policy)
+	// RolePolicy returns the policy of a role, or nil if it does not exist
+	RolePolicy(role string) *Policy
+}
+
+// Scope is the scope of a request made with temporary credentials
+type Scope struct {
+	// Role is the role the credentials assumed, whose policy replaces the
+	// policy of the user, if any
+	Role string
+	// Policy is a policy that must also allow every action, if any
+	Policy *Policy
+}
+
+// Authorizer authorizes the actions of users with their user policies and
+// the policies of the buckets they act on
+type Authorizer struct {
+	users   UserPolicies
+	buckets *Store
+}
+
+func NewAuthorizer(users UserPolicies, buckets *Store) *Authorizer {
+	return &Authorizer{users: users, buckets: buckets}
+}
+
+// authorizeFunc authorizes an action of the user of a request
+type authorizeFunc func(action, resource string) error
+
+// authorizeContextKey is the context key of a request's authorizeFunc
+type authorizeContextKey struct{}
+
+// Attach returns a shallow copy of a request through which the actions of
+// the given user, optionally scoped by temporary credentials, can be
+// authorized with `Authorize`
+func (a *Authorizer) Attach(r *http.Request, user *s3user.User, scope *Scope) *http.Request {
+	authorize := authorizeFunc(func(action, resource string) error {
+		return a.authorize(r, user, scope, action, resource)
+	})
+	return r.WithContext(context.WithValue(r.Context(), authorizeContextKey{}, authorize))
+}
+
+// Authorize checks that the user of a request may perform an action on a
+// resource, returning AccessDenied if not. Handlers use it for resources
+// beyond the one a request is routed to, such as the source of a copy.
+// Requests without an authorizer are always authorized.
+func Authorize(r *http.Request, action, resource string) error {
+	authorize, ok := r.Context().Value(authorizeContextKey{}).(authorizeFunc)
+	if !ok {
+		return nil
+	}
+	return authorize(action, resource)
+}
+
+func (a *Authorizer) authorize(r *http.Request, user *s3user.User, scope *Scope, action, resource string) error {
+	admin := false
+	var identityPolicy *Policy
+	if scope != nil && scope.Role != "" {
+		identityPolicy = a.users.RolePolicy(scope.Role)
+	} else if user != nil {
+		admin, identityPolicy = a.users.UserPolicy(user.ID)
+	}
+	// Only administrators may perform actions unknown to policies
+	if action == "" {
+		if admin && (scope == nil || scope.Policy == nil) {
+			return nil
+		}
+		return s3error.AccessDeniedError(r)
+	}
+
+	req := &Request{
+		Action:     action,
+		Resource:   resource,
+		User:       user,
+		Conditions: requestConditions(r, user),
+	}
+	if scope != nil {
+		req.Role = scope.Role
+	}
+	var bucketPolicy, aclPolicy *Policy
+	if bucket := resourceBucket(resource); bucket != "" {
+		bucketPolicy, aclPolicy = a.buckets.bucketPolicies(bucket)
+	}
+
+	allowed := admin
+	for _, policy := range []*Policy{identityPolicy, bucketPolicy} {
+		if policy == nil {
+			continue
+		}
+		switch policy.evaluate(req) {
+		case decisionDeny:
+			return s3error.AccessDeniedError(r)
+		case decisionAllow:
+			allowed = true
+		}
+	}
+	// Temporary credentials may only do what their session policy allows
+	if allowed && scope != nil && scope.Policy != nil && scope.Policy.evaluate(req) != decisionAllow {
+		allowed = false
+	}
+	// Public buckets are accessible regardless of credentials
+	if !allowed && aclPolicy != nil && aclPolicy.evaluate(req) == decisionAllow {
+		allowed = true
+	}
+	if !allowed {
+		return s3error.AccessDeniedError(r)
+	}
+	return nil
+}
+
+// resourceBucket returns the bucket of a bucket or object ARN
+func resourceBucket(resource string) string {
+	if !strings.HasPrefix(resource, ResourcePrefix) {
+		return ""
+	}
+	bucket, _, _ := strings.Cut(strings.TrimPrefix(resource, ResourcePrefix), "/")
+	if bucket == "*" {
+		return ""
+	}
+	return bucket
+}
+
+// requestConditions returns the values of the condition keys of a request
+func requestConditions(r *http.Request, user *s3user.User) map[string]string {
+	now := time.Now().UTC()
+	conditions := map[string]string{
+		"aws:CurrentTime":     now.Format(time.RFC3339),
+		"aws:EpochTime":       strconv.FormatInt(now.Unix(), 10),
+		"aws:SecureTransport": strconv.FormatBool(r.TLS != nil),
+		"aws:UserAgent":       r.UserAgent(),
+	}
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		conditions["aws:SourceIp"] = host
+	}
+	if referer := r.Referer(); referer != "" {
+		conditions["aws:Referer"] = referer
+	}
+	if user != nil {
+		conditions["aws:username"] = user.ID
+		conditions["aws:userid"] = user.ID
+	}
+
+	query := r.URL.Query()
+	for _, param := range []string{"prefix", "delimiter", "max-keys"} {
+		if query.Has(param) {
+			conditions["s3:"+param] = query.Get(param)
+		}
+	}
+	if versionID := query.Get("versionId"); versionID != "" {
+		conditions["s3:versionid"] = versionID
+	}
+	for _, header := range []string{"x-amz-copy-source", "x-amz-metadata-directive", "x-amz-storage-class", "x-amz-content-sha256"} {
+		if value := r.Header.Get(header); value != "" {
+			conditions["s3:"+header] = value
+		}
+	}
+	switch mux.Vars(r)["authMethod"] {
+	case "v4":
+		conditions["s3:authType"] = "REST-HEADER"
+		conditions["s3:signatureversion"] = "AWS4-HMAC-SHA256"
+	case "v4-query":
+		conditions["s3:authType"] = "REST-QUERY-STRING"
+		conditions["s3:signatureversion"] = "AWS4-HMAC-SHA256"
+	case "v2":
+		conditions["s3:authType"] = "REST-HEADER"
+		conditions["s3:signatureversion"] = "AWS"
+	case "v2-query":
+		conditions["s3:authType"] = "REST-QUERY-STRING"
+		conditions["s3:signatureversion"] = "AWS"
+	}
+	return conditions
+}
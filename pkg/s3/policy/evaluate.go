@@ -0,0 +1,329 @@
+package s3policy
+
+import (
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	s3user "github.com/jakthom/s3c/pkg/s3/user"
+)
+
+// decision is the outcome of evaluating a policy
+type decision int
+
+const (
+	// decisionNone means no statement applies
+	decisionNone decision = iota
+	// decisionAllow means a statement allows the request
+	decisionAllow
+	// decisionDeny means a statement explicitly denies the request
+	decisionDeny
+)
+
+// Request is an action on a resource that is being authorized
+type Request struct {
+	// Action is the s3 action, ie "s3:GetObject"
+	Action string
+	// Resource is the ARN of the bucket or object acted on
+	Resource string
+	// User is the user making the request, or nil if it is anonymous
+	User *s3user.User
+	// Role is the role the user assumed to make the request, if any
+	Role string
+	// Conditions are the values of the condition keys of the request
+	Conditions map[string]string
+}
+
+// evaluate returns whether a policy allows or denies a request
+func (p *Policy) evaluate(req *Request) decision {
+	result := decisionNone
+	for i := range p.Statement {
+		statement := &p.Statement[i]
+		if !statement.applies(req) {
+			continue
+		}
+		if statement.Effect == EffectDeny {
+			return decisionDeny
+		}
+		result = decisionAllow
+	}
+	return result
+}
+
+// applies returns whether a statement applies to a request
+func (s *Statement) applies(req *Request) bool {
+	if s.Principal != nil && !s.Principal.matches(req) {
+		return false
+	}
+	if s.NotPrincipal != nil && s.NotPrincipal.matches(req) {
+		return false
+	}
+	if len(s.Action) > 0 && !matchAny(s.Action, req.Action, true, req) {
+		return false
+	}
+	if len(s.NotAction) > 0 && matchAny(s.NotAction, req.Action, true, req) {
+		return false
+	}
+	if len(s.Resource) > 0 && !matchAny(s.Resource, req.Resource, false, req) {
+		return false
+	}
+	if len(s.NotResource) > 0 && matchAny(s.NotResource, req.Resource, false, req) {
+		return false
+	}
+	for operator, keys := range s.Condition {
+		for key, values := range keys {
+			if !evaluateCondition(operator, key, values, req) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// matches returns whether a principal includes the user of a request. Users
+// are named either by their name, or by an ARN ending in `:user/<name>`.
+// Users acting in a role are instead named by an ARN ending in
+// `:role/<name>`.
+func (p *Principal) matches(req *Request) bool {
+	for _, principal := range p.AWS {
+		if principal == "*" {
+			return true
+		}
+		if req.Role != "" {
+			if strings.HasSuffix(principal, ":role/"+req.Role) {
+				return true
+			}
+			continue
+		}
+		if req.User != nil && (principal == req.User.ID || strings.HasSuffix(principal, ":user/"+req.User.ID)) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchAny returns whether a value matches any of a list of wildcard
+// patterns, after substituting policy variables
+func matchAny(patterns []string, value string, ignoreCase bool, req *Request) bool {
+	for _, pattern := range patterns {
+		pattern, ok := substitute(pattern, req, true)
+		if !ok {
+			continue
+		}
+		if ignoreCase {
+			if wildcardMatch(strings.ToLower(pattern), strings.ToLower(value)) {
+				return true
+			}
+		} else if wildcardMatch(pattern, value) {
+			return true
+		}
+	}
+	return false
+}
+
+// substitute replaces the policy variables of a pattern, ie
+// `${aws:username}`, with the values of the request's condition keys,
+// returning false if any variable has no value, since the pattern then never
+// matches. For patterns matched with `wildcardMatch`, the substituted values
+// and escaped wildcards are escaped so that they match literally.
+func substitute(pattern string, req *Request, wildcards bool) (string, bool) {
+	if !strings.Contains(pattern, "${") && (!wildcards || !strings.Contains(pattern, `\`)) {
+		return pattern, true
+	}
+	literal := func(s string) string {
+		if !wildcards {
+			return s
+		}
+		return wildcardEscaper.Replace(s)
+	}
+	var b strings.Builder
+	for {
+		start := strings.Index(pattern, "${")
+		if start < 0 {
+			break
+		}
+		end := strings.Index(pattern[start:], "}")
+		if end < 0 {
+			break
+		}
+		name := pattern[start+2 : start+end]
+		b.WriteString(strings.ReplaceAll(pattern[:start], `\`, literal(`\`)))
+		switch name {
+		case "*", "?", "$":
+			// escaped wildcards are written literally
+			b.WriteString(literal(name))
+		default:
+			value, ok := req.Conditions[name]
+			if !ok {
+				return "", false
+			}
+			b.WriteString(literal(value))
+		}
+		pattern = pattern[start+end+1:]
+	}
+	b.WriteString(strings.ReplaceAll(pattern, `\`, literal(`\`)))
+	return b.String(), true
+}
+
+// wildcardEscaper escapes the characters `wildcardMatch` does not match
+// literally
+var wildcardEscaper = strings.NewReplacer(`\`, `\\`, "*", `\*`, "?", `\?`)
+
+// wildcardMatch matches a value against a pattern in which `*` matches any
+// sequence of characters and `?` matches any single character, unless
+// escaped by a backslash
+func wildcardMatch(pattern, value string) bool {
+	p, v := 0, 0
+	star, match := -1, 0
+	for v < len(value) {
+		if p+1 < len(pattern) && pattern[p] == '\\' {
+			if pattern[p+1] == value[v] {
+				p += 2
+				v++
+				continue
+			}
+		} else if p < len(pattern) && (pattern[p] == '?' || pattern[p] == value[v]) {
+			p++
+			v++
+			continue
+		}
+		if p < len(pattern) && pattern[p] == '*' {
+			star, match = p, v
+			p++
+		} else if star >= 0 {
+			p = star + 1
+			match++
+			v = match
+		} else {
+			return false
+		}
+	}
+	for p < len(pattern) && pattern[p] == '*' {
+		p++
+	}
+	return p == len(pattern)
+}
+
+// conditionOperator splits a condition operator into its base operator and
+// whether it is satisfied by a missing key, ie `StringEqualsIfExists`
+func conditionOperator(operator string) (string, bool, bool) {
+	ifExists := strings.HasSuffix(operator, "IfExists")
+	base := strings.TrimSuffix(operator, "IfExists")
+	switch base {
+	case "StringEquals", "StringNotEquals", "StringEqualsIgnoreCase", "StringNotEqualsIgnoreCase",
+		"StringLike", "StringNotLike",
+		"NumericEquals", "NumericNotEquals", "NumericLessThan", "NumericLessThanEquals", "NumericGreaterThan", "NumericGreaterThanEquals",
+		"DateEquals", "DateNotEquals", "DateLessThan", "DateLessThanEquals", "DateGreaterThan", "DateGreaterThanEquals",
+		"Bool", "IpAddress", "NotIpAddress":
+		return base, ifExists, true
+	case "Null":
+		return base, false, !ifExists
+	}
+	return "", false, false
+}
+
+// evaluateCondition returns whether a condition key of a request satisfies
+// a condition. A condition is satisfied if any of its values matches, or for
+// negated operators, if none of them do.
+func evaluateCondition(operator, key string, values []string, req *Request) bool {
+	base, ifExists, _ := conditionOperator(operator)
+	actual, ok := req.Conditions[key]
+	if base == "Null" {
+		return len(values) > 0 && strconv.FormatBool(!ok) == strings.ToLower(values[0])
+	}
+	negated := strings.Contains(base, "Not")
+	if !ok {
+		return ifExists || negated
+	}
+	if negated {
+		base = strings.Replace(base, "Not", "", 1)
+	}
+	matched := false
+	for _, value := range values {
+		value, ok := substitute(value, req, base == "StringLike")
+		if ok && compare(base, actual, value) {
+			matched = true
+			break
+		}
+	}
+	return matched != negated
+}
+
+// compare compares the actual value of a condition key with a value of a
+// condition using a non-negated operator
+func compare(operator, actual, value string) bool {
+	switch operator {
+	case "StringEquals":
+		return actual == value
+	case "StringEqualsIgnoreCase":
+		return strings.EqualFold(actual, value)
+	case "StringLike":
+		return wildcardMatch(value, actual)
+	case "Bool":
+		return strings.EqualFold(actual, value)
+	case "IpAddress":
+		ip := net.ParseIP(actual)
+		if ip == nil {
+			return false
+		}
+		if !strings.Contains(value, "/") {
+			return ip.Equal(net.ParseIP(value))
+		}
+		_, network, err := net.ParseCIDR(value)
+		return err == nil && network.Contains(ip)
+	}
+	if strings.HasPrefix(operator, "Numeric") {
+		a, err := strconv.ParseFloat(actual, 64)
+		if err != nil {
+			return false
+		}
+		v, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return false
+		}
+		return compareOrdered(strings.TrimPrefix(operator, "Numeric"), a, v)
+	}
+	if strings.HasPrefix(operator, "Date") {
+		a, err := parseDate(actual)
+		if err != nil {
+			return false
+		}
+		v, err := parseDate(value)
+		if err != nil {
+			return false
+		}
+		return compareOrdered(strings.TrimPrefix(operator, "Date"), float64(a.UnixNano()), float64(v.UnixNano()))
+	}
+	return false
+}
+
+// compareOrdered compares two ordered values by the suffix of a numeric or
+// date operator
+func compareOrdered(comparison string, a, b float64) bool {
+	switch comparison {
+	case "Equals":
+		return a == b
+	case "LessThan":
+		return a < b
+	case "LessThanEquals":
+		return a <= b
+	case "GreaterThan":
+		return a > b
+	case "GreaterThanEquals":
+		return a >= b
+	}
+	return false
+}
+
+// parseDate parses a date condition value, given either as an ISO 8601 date
+// or as epoch seconds
+func parseDate(value string) (time.Time, error) {
+	if epoch, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return time.Unix(epoch, 0), nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	return time.Parse("2006-01-02", value)
+}
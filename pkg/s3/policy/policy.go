@@ -0,0 +1,206 @@
+package s3policy
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+const (
+	// EffectAllow allows the actions of a statement
+	EffectAllow string = "Allow"
+	// EffectDeny denies the actions of a statement, overriding any allow
+	EffectDeny string = "Deny"
+	// ResourcePrefix is the prefix of the ARNs of buckets and objects
+	ResourcePrefix string = "arn:aws:s3:::"
+	// AccountID is the account id of the ARNs s3c issues for users and roles
+	AccountID string = "000000000000"
+	// IAMResourcePrefix is the prefix of the ARNs of users and roles
+	IAMResourcePrefix string = "arn:aws:iam::"
+	// RoleResourcePrefix is the prefix of the ARNs of roles
+	RoleResourcePrefix string = IAMResourcePrefix + AccountID + ":role/"
+)
+
+// versions are the supported versions of the policy language
+var versions = map[string]bool{"": true, "2012-10-17": true, "2008-10-17": true}
+
+// Policy is an AWS-style JSON policy document
+type Policy struct {
+	Version   string      `json:"Version,omitempty"`
+	ID        string      `json:"Id,omitempty"`
+	Statement []Statement `json:"Statement"`
+}
+
+// Statement is a single rule of a policy
+type Statement struct {
+	Sid          string                `json:"Sid,omitempty"`
+	Effect       string                `json:"Effect"`
+	Principal    *Principal            `json:"Principal,omitempty"`
+	NotPrincipal *Principal            `json:"NotPrincipal,omitempty"`
+	Action       stringList            `json:"Action,omitempty"`
+	NotAction    stringList            `json:"NotAction,omitempty"`
+	Resource     stringList            `json:"Resource,omitempty"`
+	NotResource  stringList            `json:"NotResource,omitempty"`
+	Condition    map[string]conditions `json:"Condition,omitempty"`
+}
+
+// Principal is the users a statement of a bucket policy applies to, either
+// everyone as "*" or a list of user names or user ARNs
+type Principal struct {
+	AWS stringList `json:"AWS,omitempty"`
+}
+
+func (p *Principal) UnmarshalJSON(data []byte) error {
+	var wildcard string
+	if err := json.Unmarshal(data, &wildcard); err == nil {
+		if wildcard != "*" {
+			return errors.New("invalid principal: " + wildcard)
+		}
+		p.AWS = stringList{"*"}
+		return nil
+	}
+	type principal Principal
+	return json.Unmarshal(data, (*principal)(p))
+}
+
+// stringList is a list of strings that may be written as a single string
+type stringList []string
+
+func (l *stringList) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err == nil {
+		*l = stringList{s}
+		return nil
+	}
+	var list []string
+	if err := json.Unmarshal(data, &list); err != nil {
+		return err
+	}
+	*l = list
+	return nil
+}
+
+// conditions maps condition keys to the values they are compared with
+type conditions map[string]stringList
+
+func (c *conditions) UnmarshalJSON(data []byte) error {
+	var raw map[string]interface{}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	*c = conditions{}
+	for key, value := range raw {
+		var values []interface{}
+		if list, ok := value.([]interface{}); ok {
+			values = list
+		} else {
+			values = []interface{}{value}
+		}
+		for _, v := range values {
+			switch v := v.(type) {
+			case string:
+				(*c)[key] = append((*c)[key], v)
+			case bool, float64:
+				(*c)[key] = append((*c)[key], fmt.Sprint(v))
+			default:
+				return fmt.Errorf("invalid value of condition key %s", key)
+			}
+		}
+	}
+	return nil
+}
+
+// Parse parses and validates a policy document. Bucket policies must name the
+// principals of each statement, while user policies may not.
+func Parse(document []byte, bucketPolicy bool) (*Policy, error) {
+	if !bytes.HasPrefix(bytes.TrimSpace(document), []byte("{")) {
+		return nil, errors.New("policies must be a json object")
+	}
+	policy := &Policy{}
+	decoder := json.NewDecoder(bytes.NewReader(document))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(policy); err != nil {
+		return nil, err
+	}
+	if !versions[policy.Version] {
+		return nil, errors.New("unsupported policy version: " + policy.Version)
+	}
+	if len(policy.Statement) == 0 {
+		return nil, errors.New("policies must have at least one statement")
+	}
+	for i, statement := range policy.Statement {
+		if err := statement.validate(bucketPolicy); err != nil {
+			return nil, fmt.Errorf("statement %d: %w", i, err)
+		}
+	}
+	return policy, nil
+}
+
+func (s *Statement) validate(bucketPolicy bool) error {
+	if s.Effect != EffectAllow && s.Effect != EffectDeny {
+		return errors.New("invalid effect: " + s.Effect)
+	}
+	hasPrincipal := s.Principal != nil || s.NotPrincipal != nil
+	if bucketPolicy && !hasPrincipal {
+		return errors.New("missing principal")
+	}
+	if !bucketPolicy && hasPrincipal {
+		return errors.New("user policies cannot have a principal")
+	}
+	if (len(s.Action) == 0) == (len(s.NotAction) == 0) {
+		return errors.New("exactly one of Action or NotAction is required")
+	}
+	for _, action := range append(s.Action, s.NotAction...) {
+		lower := strings.ToLower(action)
+		if action != "*" && !strings.HasPrefix(lower, "s3:") && !strings.HasPrefix(lower, "sts:") {
+			return errors.New("unsupported action: " + action)
+		}
+	}
+	if (len(s.Resource) == 0) == (len(s.NotResource) == 0) {
+		return errors.New("exactly one of Resource or NotResource is required")
+	}
+	for _, resource := range append(s.Resource, s.NotResource...) {
+		if resource != "*" && !strings.HasPrefix(resource, ResourcePrefix) && !strings.HasPrefix(resource, IAMResourcePrefix) {
+			return errors.New("invalid resource: " + resource)
+		}
+	}
+	for operator := range s.Condition {
+		if _, _, ok := conditionOperator(operator); !ok {
+			return errors.New("unsupported condition operator: " + operator)
+		}
+	}
+	return nil
+}
+
+// IsPublic returns whether a bucket policy allows anyone to access the bucket
+// without further conditions
+func (p *Policy) IsPublic() bool {
+	for _, statement := range p.Statement {
+		if statement.Effect != EffectAllow || statement.Principal == nil || len(statement.Condition) > 0 {
+			continue
+		}
+		for _, principal := range statement.Principal.AWS {
+			if principal == "*" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// BucketResource returns the ARN of a bucket
+func BucketResource(bucket string) string {
+	return ResourcePrefix + bucket
+}
+
+// RoleResource returns the ARN of a role
+func RoleResource(role string) string {
+	return RoleResourcePrefix + role
+}
+
+// ObjectResource returns the ARN of an object
+func ObjectResource(bucket, key string) string {
+	return ResourcePrefix + bucket + "/" + key
+}
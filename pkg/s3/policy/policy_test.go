@@ -0,0 +1,516 @@
+package s3policy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	s3user "github.com/jakthom/s3c/pkg/s3/user"
+)
+
+// The example policies of AWS' s3 documentation
+const (
+	publicReadPolicy = `{
+		"Version": "2012-10-17",
+		"Statement": [{
+			"Sid": "PublicRead",
+			"Effect": "Allow",
+			"Principal": "*",
+			"Action": ["s3:GetObject", "s3:GetObjectVersion"],
+			"Resource": ["arn:aws:s3:::examplebucket/*"]
+		}]
+	}`
+	sourceIPPolicy = `{
+		"Version": "2012-10-17",
+		"Id": "S3PolicyId1",
+		"Statement": [{
+			"Sid": "IPAllow",
+			"Effect": "Deny",
+			"Principal": "*",
+			"Action": "s3:*",
+			"Resource": ["arn:aws:s3:::examplebucket", "arn:aws:s3:::examplebucket/*"],
+			"Condition": {"NotIpAddress": {"aws:SourceIp": "192.0.2.0/24"}}
+		}]
+	}`
+	homeFolderPolicy = `{
+		"Version": "2012-10-17",
+		"Statement": [
+			{
+				"Sid": "AllowListingOfUserFolder",
+				"Effect": "Allow",
+				"Action": "s3:ListBucket",
+				"Resource": "arn:aws:s3:::examplebucket",
+				"Condition": {"StringLike": {"s3:prefix": ["home/${aws:username}/*", "home/${aws:username}/"]}}
+			},
+			{
+				"Sid": "AllowAllS3ActionsInUserFolder",
+				"Effect": "Allow",
+				"Action": "s3:*Object",
+				"Resource": "arn:aws:s3:::examplebucket/home/${aws:username}/*"
+			}
+		]
+	}`
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name         string
+		document     string
+		bucketPolicy bool
+		ok           bool
+	}{
+		{"public read", publicReadPolicy, true, true},
+		{"source ip", sourceIPPolicy, true, true},
+		{"home folder", homeFolderPolicy, false, true},
+		{"user principals", `{"Statement": [{"Effect": "Allow", "Principal": {"AWS": ["arn:aws:iam::000000000000:user/alice", "bob"]}, "Action": "s3:GetObject", "Resource": "arn:aws:s3:::b/*"}]}`, true, true},
+		{"old version", `{"Version": "2008-10-17", "Statement": [{"Effect": "Deny", "NotAction": "s3:GetObject", "NotResource": "*"}]}`, false, true},
+		{"numeric condition", `{"Statement": [{"Effect": "Allow", "Action": "s3:ListBucket", "Resource": "*", "Condition": {"NumericLessThanEquals": {"s3:max-keys": 10}}}]}`, false, true},
+		{"not an object", `[]`, false, false},
+		{"unknown version", `{"Version": "2020-01-01", "Statement": [{"Effect": "Allow", "Action": "*", "Resource": "*"}]}`, false, false},
+		{"no statements", `{"Version": "2012-10-17", "Statement": []}`, false, false},
+		{"unknown field", `{"Statement": [{"Effect": "Allow", "Action": "*", "Resource": "*", "Actions": "*"}]}`, false, false},
+		{"invalid effect", `{"Statement": [{"Effect": "Permit", "Action": "*", "Resource": "*"}]}`, false, false},
+		{"bucket policy without principal", `{"Statement": [{"Effect": "Allow", "Action": "*", "Resource": "*"}]}`, true, false},
+		{"user policy with principal", publicReadPolicy, false, false},
+		{"invalid principal", `{"Statement": [{"Effect": "Allow", "Principal": "alice", "Action": "*", "Resource": "*"}]}`, true, false},
+		{"action and not action", `{"Statement": [{"Effect": "Allow", "Action": "*", "NotAction": "s3:GetObject", "Resource": "*"}]}`, false, false},
+		{"no action", `{"Statement": [{"Effect": "Allow", "Resource": "*"}]}`, false, false},
+		{"foreign action", `{"Statement": [{"Effect": "Allow", "Action": "ec2:RunInstances", "Resource": "*"}]}`, false, false},
+		{"no resource", `{"Statement": [{"Effect": "Allow", "Action": "*"}]}`, false, false},
+		{"foreign resource", `{"Statement": [{"Effect": "Allow", "Action": "*", "Resource": "arn:aws:ec2:::instance/i-1"}]}`, false, false},
+		{"unknown operator", `{"Statement": [{"Effect": "Allow", "Action": "*", "Resource": "*", "Condition": {"StringMatches": {"aws:username": "a"}}}]}`, false, false},
+		{"null if exists", `{"Statement": [{"Effect": "Allow", "Action": "*", "Resource": "*", "Condition": {"NullIfExists": {"aws:username": "true"}}}]}`, false, false},
+		{"object condition value", `{"Statement": [{"Effect": "Allow", "Action": "*", "Resource": "*", "Condition": {"StringEquals": {"aws:username": {"a": "b"}}}}]}`, false, false},
+	}
+	for _, tt := range tests {
+		_, err := Parse([]byte(tt.document), tt.bucketPolicy)
+		if (err == nil) != tt.ok {
+			t.Errorf("%s: got error %v, want ok %v", tt.name, err, tt.ok)
+		}
+	}
+}
+
+func TestParseLists(t *testing.T) {
+	policy, err := Parse([]byte(sourceIPPolicy), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	statement := policy.Statement[0]
+	if policy.ID != "S3PolicyId1" || statement.Sid != "IPAllow" {
+		t.Errorf("id %q, sid %q", policy.ID, statement.Sid)
+	}
+	if len(statement.Action) != 1 || statement.Action[0] != "s3:*" {
+		t.Errorf("actions = %q", statement.Action)
+	}
+	if len(statement.Resource) != 2 {
+		t.Errorf("resources = %q", statement.Resource)
+	}
+	if values := statement.Condition["NotIpAddress"]["aws:SourceIp"]; len(values) != 1 || values[0] != "192.0.2.0/24" {
+		t.Errorf("condition values = %q", values)
+	}
+	if len(statement.Principal.AWS) != 1 || statement.Principal.AWS[0] != "*" {
+		t.Errorf("principal = %q", statement.Principal.AWS)
+	}
+}
+
+func TestIsPublic(t *testing.T) {
+	tests := []struct {
+		document string
+		public   bool
+	}{
+		{publicReadPolicy, true},
+		{sourceIPPolicy, false},
+		{`{"Statement": [{"Effect": "Allow", "Principal": {"AWS": "*"}, "Action": "s3:GetObject", "Resource": "arn:aws:s3:::b/*", "Condition": {"Bool": {"aws:SecureTransport": "true"}}}]}`, false},
+		{`{"Statement": [{"Effect": "Allow", "Principal": {"AWS": "alice"}, "Action": "s3:GetObject", "Resource": "arn:aws:s3:::b/*"}]}`, false},
+	}
+	for _, tt := range tests {
+		policy, err := Parse([]byte(tt.document), true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if policy.IsPublic() != tt.public {
+			t.Errorf("%s: public = %v, want %v", tt.document, !tt.public, tt.public)
+		}
+	}
+}
+
+func mustParse(t *testing.T, document string, bucketPolicy bool) *Policy {
+	t.Helper()
+	policy, err := Parse([]byte(document), bucketPolicy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return policy
+}
+
+func TestEvaluate(t *testing.T) {
+	alice := &s3user.User{ID: "alice"}
+	bob := &s3user.User{ID: "bob"}
+	userConditions := func(user *s3user.User, conditions map[string]string) map[string]string {
+		if conditions == nil {
+			conditions = map[string]string{}
+		}
+		conditions["aws:username"] = user.ID
+		return conditions
+	}
+
+	tests := []struct {
+		name     string
+		policy   *Policy
+		req      Request
+		decision decision
+	}{
+		{
+			name:     "public object",
+			policy:   mustParse(t, publicReadPolicy, true),
+			req:      Request{Action: "s3:GetObject", Resource: "arn:aws:s3:::examplebucket/dir/key"},
+			decision: decisionAllow,
+		},
+		{
+			name:     "actions match case insensitively",
+			policy:   mustParse(t, publicReadPolicy, true),
+			req:      Request{Action: "s3:getobjectversion", Resource: "arn:aws:s3:::examplebucket/key"},
+			decision: decisionAllow,
+		},
+		{
+			name:     "unlisted action",
+			policy:   mustParse(t, publicReadPolicy, true),
+			req:      Request{Action: "s3:PutObject", Resource: "arn:aws:s3:::examplebucket/key"},
+			decision: decisionNone,
+		},
+		{
+			name:     "bucket outside of an object resource",
+			policy:   mustParse(t, publicReadPolicy, true),
+			req:      Request{Action: "s3:GetObject", Resource: "arn:aws:s3:::examplebucket"},
+			decision: decisionNone,
+		},
+		{
+			name:     "resources match case sensitively",
+			policy:   mustParse(t, publicReadPolicy, true),
+			req:      Request{Action: "s3:GetObject", Resource: "arn:aws:s3:::ExampleBucket/key"},
+			decision: decisionNone,
+		},
+		{
+			name:     "source ip within the range",
+			policy:   mustParse(t, sourceIPPolicy, true),
+			req:      Request{Action: "s3:GetObject", Resource: "arn:aws:s3:::examplebucket/key", Conditions: map[string]string{"aws:SourceIp": "192.0.2.17"}},
+			decision: decisionNone,
+		},
+		{
+			name:     "source ip outside of the range",
+			policy:   mustParse(t, sourceIPPolicy, true),
+			req:      Request{Action: "s3:GetObject", Resource: "arn:aws:s3:::examplebucket/key", Conditions: map[string]string{"aws:SourceIp": "203.0.113.1"}},
+			decision: decisionDeny,
+		},
+		{
+			name:     "own home folder",
+			policy:   mustParse(t, homeFolderPolicy, false),
+			req:      Request{Action: "s3:PutObject", Resource: "arn:aws:s3:::examplebucket/home/alice/notes.txt", User: alice, Conditions: userConditions(alice, nil)},
+			decision: decisionAllow,
+		},
+		{
+			name:     "another's home folder",
+			policy:   mustParse(t, homeFolderPolicy, false),
+			req:      Request{Action: "s3:GetObject", Resource: "arn:aws:s3:::examplebucket/home/alice/notes.txt", User: bob, Conditions: userConditions(bob, nil)},
+			decision: decisionNone,
+		},
+		{
+			name:     "listing of the own home folder",
+			policy:   mustParse(t, homeFolderPolicy, false),
+			req:      Request{Action: "s3:ListBucket", Resource: "arn:aws:s3:::examplebucket", User: alice, Conditions: userConditions(alice, map[string]string{"s3:prefix": "home/alice/"})},
+			decision: decisionAllow,
+		},
+		{
+			name:     "listing of the bucket",
+			policy:   mustParse(t, homeFolderPolicy, false),
+			req:      Request{Action: "s3:ListBucket", Resource: "arn:aws:s3:::examplebucket", User: alice, Conditions: userConditions(alice, map[string]string{"s3:prefix": ""})},
+			decision: decisionNone,
+		},
+		{
+			name:     "variables without a value never match",
+			policy:   mustParse(t, homeFolderPolicy, false),
+			req:      Request{Action: "s3:GetObject", Resource: "arn:aws:s3:::examplebucket/home/${aws:username}/key"},
+			decision: decisionNone,
+		},
+		{
+			name: "deny overrides allow",
+			policy: mustParse(t, `{"Statement": [
+				{"Effect": "Allow", "Action": "s3:*", "Resource": "*"},
+				{"Effect": "Deny", "Action": "s3:Delete*", "Resource": "arn:aws:s3:::b/*"}
+			]}`, false),
+			req:      Request{Action: "s3:DeleteObject", Resource: "arn:aws:s3:::b/key"},
+			decision: decisionDeny,
+		},
+		{
+			name:     "not action",
+			policy:   mustParse(t, `{"Statement": [{"Effect": "Allow", "NotAction": "s3:Delete*", "Resource": "*"}]}`, false),
+			req:      Request{Action: "s3:DeleteObjectVersion", Resource: "arn:aws:s3:::b/key"},
+			decision: decisionNone,
+		},
+		{
+			name:     "not resource",
+			policy:   mustParse(t, `{"Statement": [{"Effect": "Allow", "Action": "*", "NotResource": "arn:aws:s3:::b/private/*"}]}`, false),
+			req:      Request{Action: "s3:GetObject", Resource: "arn:aws:s3:::b/public/key"},
+			decision: decisionAllow,
+		},
+		{
+			name:     "single character wildcard",
+			policy:   mustParse(t, `{"Statement": [{"Effect": "Allow", "Action": "*", "Resource": "arn:aws:s3:::b/log-????.txt"}]}`, false),
+			req:      Request{Action: "s3:GetObject", Resource: "arn:aws:s3:::b/log-2024.txt"},
+			decision: decisionAllow,
+		},
+		{
+			name:     "escaped wildcard",
+			policy:   mustParse(t, `{"Statement": [{"Effect": "Allow", "Action": "*", "Resource": "arn:aws:s3:::b/${*}"}]}`, false),
+			req:      Request{Action: "s3:GetObject", Resource: "arn:aws:s3:::b/key"},
+			decision: decisionNone,
+		},
+		{
+			name:     "escaped wildcard matching itself",
+			policy:   mustParse(t, `{"Statement": [{"Effect": "Allow", "Action": "*", "Resource": "arn:aws:s3:::b/${*}"}]}`, false),
+			req:      Request{Action: "s3:GetObject", Resource: "arn:aws:s3:::b/*"},
+			decision: decisionAllow,
+		},
+		{
+			name:     "wildcards within variables match literally",
+			policy:   mustParse(t, homeFolderPolicy, false),
+			req:      Request{Action: "s3:GetObject", Resource: "arn:aws:s3:::examplebucket/home/alice/key", Conditions: map[string]string{"aws:username": "*"}},
+			decision: decisionNone,
+		},
+		{
+			name:     "backslashes match literally",
+			policy:   mustParse(t, `{"Statement": [{"Effect": "Allow", "Action": "*", "Resource": "arn:aws:s3:::b/a\\${aws:username}"}]}`, false),
+			req:      Request{Action: "s3:GetObject", Resource: `arn:aws:s3:::b/a\alice`, Conditions: map[string]string{"aws:username": "alice"}},
+			decision: decisionAllow,
+		},
+		{
+			name:     "user principal by arn",
+			policy:   mustParse(t, `{"Statement": [{"Effect": "Allow", "Principal": {"AWS": "arn:aws:iam::000000000000:user/alice"}, "Action": "*", "Resource": "*"}]}`, true),
+			req:      Request{Action: "s3:GetObject", Resource: "arn:aws:s3:::b/key", User: alice},
+			decision: decisionAllow,
+		},
+		{
+			name:     "another user's principal",
+			policy:   mustParse(t, `{"Statement": [{"Effect": "Allow", "Principal": {"AWS": "alice"}, "Action": "*", "Resource": "*"}]}`, true),
+			req:      Request{Action: "s3:GetObject", Resource: "arn:aws:s3:::b/key", User: bob},
+			decision: decisionNone,
+		},
+		{
+			name:     "anonymous user",
+			policy:   mustParse(t, `{"Statement": [{"Effect": "Allow", "Principal": {"AWS": "alice"}, "Action": "*", "Resource": "*"}]}`, true),
+			req:      Request{Action: "s3:GetObject", Resource: "arn:aws:s3:::b/key"},
+			decision: decisionNone,
+		},
+		{
+			name:     "user acting in a role",
+			policy:   mustParse(t, `{"Statement": [{"Effect": "Allow", "Principal": {"AWS": "alice"}, "Action": "*", "Resource": "*"}]}`, true),
+			req:      Request{Action: "s3:GetObject", Resource: "arn:aws:s3:::b/key", User: alice, Role: "reader"},
+			decision: decisionNone,
+		},
+		{
+			name:     "role principal",
+			policy:   mustParse(t, `{"Statement": [{"Effect": "Allow", "Principal": {"AWS": "arn:aws:iam::000000000000:role/reader"}, "Action": "*", "Resource": "*"}]}`, true),
+			req:      Request{Action: "s3:GetObject", Resource: "arn:aws:s3:::b/key", User: alice, Role: "reader"},
+			decision: decisionAllow,
+		},
+		{
+			name:     "not principal",
+			policy:   mustParse(t, `{"Statement": [{"Effect": "Deny", "NotPrincipal": {"AWS": "alice"}, "Action": "*", "Resource": "*"}]}`, true),
+			req:      Request{Action: "s3:GetObject", Resource: "arn:aws:s3:::b/key", User: alice},
+			decision: decisionNone,
+		},
+	}
+	for _, tt := range tests {
+		if decision := tt.policy.evaluate(&tt.req); decision != tt.decision {
+			t.Errorf("%s: decision %d, want %d", tt.name, decision, tt.decision)
+		}
+	}
+}
+
+func TestEvaluateCondition(t *testing.T) {
+	conditions := map[string]string{
+		"aws:username":        "alice",
+		"aws:SecureTransport": "false",
+		"aws:SourceIp":        "2001:db8::1",
+		"aws:CurrentTime":     "2024-06-01T12:00:00Z",
+		"aws:EpochTime":       "1717243200",
+		"s3:max-keys":         "100",
+		"s3:prefix":           "home/alice/",
+	}
+	tests := []struct {
+		operator string
+		key      string
+		values   []string
+		ok       bool
+	}{
+		{"StringEquals", "aws:username", []string{"bob", "alice"}, true},
+		{"StringEquals", "aws:username", []string{"Alice"}, false},
+		{"StringEqualsIgnoreCase", "aws:username", []string{"Alice"}, true},
+		{"StringNotEquals", "aws:username", []string{"bob", "alice"}, false},
+		{"StringNotEquals", "aws:username", []string{"bob"}, true},
+		{"StringNotEqualsIgnoreCase", "aws:username", []string{"ALICE"}, false},
+		{"StringLike", "s3:prefix", []string{"home/${aws:username}/*"}, true},
+		{"StringNotLike", "s3:prefix", []string{"home/bob/*"}, true},
+		{"StringLike", "s3:prefix", []string{"home/${aws:userid}/*"}, false},
+		{"StringEquals", "s3:prefix", []string{"home/${aws:username}/"}, true},
+		{"StringEquals", "s3:delimiter", []string{"/"}, false},
+		{"StringEqualsIfExists", "s3:delimiter", []string{"/"}, true},
+		{"StringNotEquals", "s3:delimiter", []string{"/"}, true},
+		{"NumericLessThanEquals", "s3:max-keys", []string{"100"}, true},
+		{"NumericLessThan", "s3:max-keys", []string{"100"}, false},
+		{"NumericGreaterThan", "s3:max-keys", []string{"10.5"}, true},
+		{"NumericNotEquals", "s3:max-keys", []string{"100"}, false},
+		{"NumericEquals", "s3:max-keys", []string{"many"}, false},
+		{"DateGreaterThan", "aws:CurrentTime", []string{"2024-01-01T00:00:00Z"}, true},
+		{"DateLessThan", "aws:CurrentTime", []string{"2024-06-01"}, false},
+		{"DateEquals", "aws:EpochTime", []string{"2024-06-01T12:00:00Z"}, true},
+		{"DateLessThanEquals", "aws:CurrentTime", []string{"1717243200"}, true},
+		{"Bool", "aws:SecureTransport", []string{"false"}, true},
+		{"Bool", "aws:SecureTransport", []string{"true"}, false},
+		{"IpAddress", "aws:SourceIp", []string{"2001:db8::/32"}, true},
+		{"IpAddress", "aws:SourceIp", []string{"2001:db8::1"}, true},
+		{"NotIpAddress", "aws:SourceIp", []string{"192.0.2.0/24"}, true},
+		{"Null", "s3:delimiter", []string{"true"}, true},
+		{"Null", "aws:username", []string{"true"}, false},
+		{"Null", "aws:username", []string{"false"}, true},
+	}
+	req := &Request{Conditions: conditions}
+	for _, tt := range tests {
+		if ok := evaluateCondition(tt.operator, tt.key, tt.values, req); ok != tt.ok {
+			t.Errorf("%s %s %q: got %v, want %v", tt.operator, tt.key, tt.values, ok, tt.ok)
+		}
+	}
+}
+
+// testUserPolicies are the policies of administrators, users and roles
+type testUserPolicies struct {
+	admins map[string]bool
+	users  map[string]*Policy
+	roles  map[string]*Policy
+}
+
+func (p *testUserPolicies) UserPolicy(user string) (bool, *Policy) {
+	return p.admins[user], p.users[user]
+}
+
+func (p *testUserPolicies) RolePolicy(role string) *Policy {
+	return p.roles[role]
+}
+
+func TestAuthorize(t *testing.T) {
+	store, err := NewStore(t.TempDir(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	users := &testUserPolicies{
+		admins: map[string]bool{"admin": true},
+		users: map[string]*Policy{
+			"alice": mustParse(t, homeFolderPolicy, false),
+		},
+		roles: map[string]*Policy{
+			"reader": mustParse(t, `{"Statement": [{"Effect": "Allow", "Action": "s3:Get*", "Resource": "*"}]}`, false),
+		},
+	}
+	authorizer := NewAuthorizer(users, store)
+	put := func(document string) {
+		t.Helper()
+		if err := store.PutBucketPolicy(httptest.NewRequest(http.MethodPut, "/examplebucket?policy", nil), "examplebucket", []byte(document)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	authorize := func(user string, scope *Scope, action, resource string) bool {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		var u *s3user.User
+		if user != "" {
+			u = &s3user.User{ID: user}
+		}
+		return Authorize(authorizer.Attach(r, u, scope), action, resource) == nil
+	}
+	readOnly := mustParse(t, `{"Statement": [{"Effect": "Allow", "Action": "s3:GetObject", "Resource": "*"}]}`, false)
+
+	tests := []struct {
+		name     string
+		user     string
+		scope    *Scope
+		action   string
+		resource string
+		allowed  bool
+	}{
+		{"administrator", "admin", nil, "s3:DeleteBucket", "arn:aws:s3:::examplebucket", true},
+		{"administrator, unknown action", "admin", nil, "", "", true},
+		{"user, unknown action", "alice", nil, "", "", false},
+		{"user policy", "alice", nil, "s3:GetObject", "arn:aws:s3:::examplebucket/home/alice/key", true},
+		{"outside of the user policy", "alice", nil, "s3:GetObject", "arn:aws:s3:::examplebucket/key", false},
+		{"user without a policy", "bob", nil, "s3:GetObject", "arn:aws:s3:::examplebucket/key", false},
+		{"anonymous", "", nil, "s3:GetObject", "arn:aws:s3:::examplebucket/key", false},
+		{"role", "bob", &Scope{Role: "reader"}, "s3:GetObject", "arn:aws:s3:::examplebucket/key", true},
+		{"outside of the role", "bob", &Scope{Role: "reader"}, "s3:PutObject", "arn:aws:s3:::examplebucket/key", false},
+		{"administrator in a role", "admin", &Scope{Role: "reader"}, "s3:PutObject", "arn:aws:s3:::examplebucket/key", false},
+		{"session policy", "admin", &Scope{Policy: readOnly}, "s3:GetObject", "arn:aws:s3:::examplebucket/key", true},
+		{"outside of the session policy", "admin", &Scope{Policy: readOnly}, "s3:PutObject", "arn:aws:s3:::examplebucket/key", false},
+		{"administrator with a session policy, unknown action", "admin", &Scope{Policy: readOnly}, "", "", false},
+	}
+	for _, tt := range tests {
+		if allowed := authorize(tt.user, tt.scope, tt.action, tt.resource); allowed != tt.allowed {
+			t.Errorf("%s: allowed %v, want %v", tt.name, allowed, tt.allowed)
+		}
+	}
+
+	// Bucket policies allow anyone they name, and deny even administrators
+	put(publicReadPolicy)
+	if !authorize("", nil, "s3:GetObject", "arn:aws:s3:::examplebucket/key") {
+		t.Error("public read policy does not allow anonymous reads")
+	}
+	if authorize("", nil, "s3:PutObject", "arn:aws:s3:::examplebucket/key") {
+		t.Error("public read policy allows anonymous writes")
+	}
+	if !authorize("bob", nil, "s3:GetObject", "arn:aws:s3:::examplebucket/key") {
+		t.Error("public read policy does not allow reads of users without a policy")
+	}
+	put(sourceIPPolicy)
+	if !authorize("admin", nil, "s3:GetObject", "arn:aws:s3:::examplebucket/key") {
+		t.Error("source ip policy denies a request from within its range")
+	}
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.RemoteAddr = "203.0.113.1:1234"
+	if Authorize(authorizer.Attach(r, &s3user.User{ID: "admin"}, nil), "s3:GetObject", "arn:aws:s3:::examplebucket/key") == nil {
+		t.Error("source ip policy allows an administrator's request from outside of its range")
+	}
+}
+
+func TestPutBucketPolicy(t *testing.T) {
+	dir := t.TempDir()
+	store, err := NewStore(dir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := httptest.NewRequest(http.MethodPut, "/", nil)
+	if err := store.PutBucketPolicy(r, "otherbucket", []byte(publicReadPolicy)); err == nil {
+		t.Error("policy of another bucket was accepted")
+	}
+	if err := store.PutBucketPolicy(r, "examplebucket", []byte(`{"Statement": []}`)); err == nil {
+		t.Error("invalid policy was accepted")
+	}
+	if err := store.PutBucketPolicy(r, "examplebucket", []byte(publicReadPolicy)); err != nil {
+		t.Fatal(err)
+	}
+
+	// Policies persist as written
+	store, err = NewStore(dir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	document, err := store.GetBucketPolicy(r, "examplebucket")
+	if err != nil || string(document) != publicReadPolicy {
+		t.Errorf("stored policy = %q, %v", document, err)
+	}
+	if public, err := store.GetBucketPolicyStatus(r, "examplebucket"); err != nil || !public {
+		t.Errorf("policy status = %v, %v", public, err)
+	}
+	if err := store.DeleteBucketPolicy(r, "examplebucket"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.GetBucketPolicy(r, "examplebucket"); err == nil {
+		t.Error("deleted policy remains")
+	}
+}
@@ -0,0 +1,217 @@
+package s3policy
+
+import (
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	s3error "github.com/jakthom/s3c/pkg/s3/error"
+	"github.com/rs/zerolog/log"
+)
+
+// storedPolicy is a bucket policy as it was written, and as parsed
+type storedPolicy struct {
+	document []byte
+	policy   *Policy
+}
+
+// Store persists bucket policies as json files, and the canned ACLs of
+// buckets as text files, within a directory. Both are kept in memory since
+// every request is authorized against them.
+type Store struct {
+	dir         string
+	defaultACLs map[string]string
+	mu          sync.RWMutex
+	policies    map[string]*storedPolicy
+	acls        map[string]string
+}
+
+// NewStore creates a store of the bucket policies and ACLs in a directory.
+// Buckets without a stored ACL have their default ACL, or are private.
+func NewStore(dir string, defaultACLs map[string]string) (*Store, error) {
+	for bucket, acl := range defaultACLs {
+		if !ValidACL(acl) {
+			return nil, errors.New("invalid access of bucket " + bucket + ": " + acl)
+		}
+	}
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return nil, err
+	}
+	s := &Store{
+		dir:         dir,
+		defaultACLs: defaultACLs,
+		policies:    map[string]*storedPolicy{},
+		acls:        map[string]string{},
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		content, err := os.ReadFile(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+		switch filepath.Ext(entry.Name()) {
+		case ".json":
+			bucket := strings.TrimSuffix(entry.Name(), ".json")
+			policy, err := Parse(content, true)
+			if err != nil {
+				log.Error().Err(err).Msg("Ignoring invalid bucket policy: " + bucket)
+				continue
+			}
+			s.policies[bucket] = &storedPolicy{document: content, policy: policy}
+		case ".acl":
+			bucket := strings.TrimSuffix(entry.Name(), ".acl")
+			acl := strings.TrimSpace(string(content))
+			if !ValidACL(acl) {
+				log.Error().Msg("Ignoring invalid bucket acl: " + bucket)
+				continue
+			}
+			s.acls[bucket] = acl
+		}
+	}
+	return s, nil
+}
+
+func (s *Store) path(bucket string) string {
+	return filepath.Join(s.dir, bucket+".json")
+}
+
+func (s *Store) aclPath(bucket string) string {
+	return filepath.Join(s.dir, bucket+".acl")
+}
+
+// acl returns the canned ACL of a bucket
+func (s *Store) acl(bucket string) string {
+	if acl, ok := s.acls[bucket]; ok {
+		return acl
+	}
+	if acl, ok := s.defaultACLs[bucket]; ok {
+		return acl
+	}
+	return ACLPrivate
+}
+
+// bucketPolicies returns the parsed policy of a bucket and the policy its
+// ACL is equivalent to, either of which may be nil
+func (s *Store) bucketPolicies(bucket string) (*Policy, *Policy) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var policy *Policy
+	if stored, ok := s.policies[bucket]; ok {
+		policy = stored.policy
+	}
+	return policy, aclPolicy(bucket, s.acl(bucket))
+}
+
+func (s *Store) GetBucketPolicy(r *http.Request, bucket string) ([]byte, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	stored, ok := s.policies[bucket]
+	if !ok {
+		return nil, s3error.NoSuchBucketPolicyError(r)
+	}
+	return stored.document, nil
+}
+
+func (s *Store) GetBucketPolicyStatus(r *http.Request, bucket string) (bool, error) {
+	policy, _ := s.bucketPolicies(bucket)
+	if policy == nil {
+		return false, s3error.NoSuchBucketPolicyError(r)
+	}
+	return policy.IsPublic(), nil
+}
+
+func (s *Store) PutBucketPolicy(r *http.Request, bucket string, document []byte) error {
+	policy, err := Parse(document, true)
+	if err != nil {
+		return s3error.MalformedPolicyError(r, err.Error())
+	}
+	// Bucket policies may only grant access to the bucket and its objects
+	for _, statement := range policy.Statement {
+		for _, resource := range append(statement.Resource, statement.NotResource...) {
+			if resource != BucketResource(bucket) && !strings.HasPrefix(resource, BucketResource(bucket)+"/") {
+				return s3error.MalformedPolicyError(r, "Policy has invalid resource")
+			}
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := writeFileAtomic(s.path(bucket), document); err != nil {
+		log.Error().Err(err).Msg("Failed to write bucket policy: " + bucket)
+		return err
+	}
+	s.policies[bucket] = &storedPolicy{document: document, policy: policy}
+	return nil
+}
+
+func (s *Store) DeleteBucketPolicy(r *http.Request, bucket string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := os.Remove(s.path(bucket)); err != nil && !os.IsNotExist(err) {
+		log.Error().Err(err).Msg("Failed to delete bucket policy: " + bucket)
+		return err
+	}
+	delete(s.policies, bucket)
+	return nil
+}
+
+func (s *Store) GetBucketACL(r *http.Request, bucket string) (string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.acl(bucket), nil
+}
+
+func (s *Store) PutBucketACL(r *http.Request, bucket string, acl string) error {
+	if !ValidACL(acl) {
+		return s3error.InvalidArgumentError(r)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := writeFileAtomic(s.aclPath(bucket), []byte(acl)); err != nil {
+		log.Error().Err(err).Msg("Failed to write bucket acl: " + bucket)
+		return err
+	}
+	s.acls[bucket] = acl
+	return nil
+}
+
+func (s *Store) DeleteBucket(r *http.Request, bucket string) error {
+	if err := s.DeleteBucketPolicy(r, bucket); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := os.Remove(s.aclPath(bucket)); err != nil && !os.IsNotExist(err) {
+		log.Error().Err(err).Msg("Failed to delete bucket acl: " + bucket)
+		return err
+	}
+	delete(s.acls, bucket)
+	return nil
+}
+
+// writeFileAtomic writes a file by renaming a temporary file over it, so
+// that readers never see a partially written file
+func writeFileAtomic(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".tmp-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
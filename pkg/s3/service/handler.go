@@ -4,6 +4,7 @@ import (
 	"net/http"
 	"time"
 
+	s3auth "github.com/jakthom/s3c/pkg/s3/auth"
 	s3util "github.com/jakthom/s3c/pkg/s3/util"
 )
 
@@ -18,6 +19,12 @@ func (h *ServiceHandler) Get(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// buckets are owned by whoever s3c authenticates, so the requester is
+	// their owner unless the origin knows better
+	if result.Owner == nil {
+		result.Owner = s3auth.RequestUser(r)
+	}
+
 	// some clients (e.g. minio-python) can't handle sub-seconds in datetime
 	// output
 	for _, bucket := range result.Buckets {
@@ -0,0 +1,18 @@
+package s3sts
+
+import (
+	"time"
+
+	s3auth "github.com/jakthom/s3c/pkg/s3/auth"
+)
+
+// SessionController is an interface defining the functionality needed to
+// issue temporary credentials
+type SessionController interface {
+	// IssueSession issues temporary credentials for a session, returning
+	// their secret key and session token
+	IssueSession(session *s3auth.Session) (string, string, error)
+	// RoleMaxDuration returns the maximum session duration of a role, and
+	// whether the role exists
+	RoleMaxDuration(role string) (time.Duration, bool)
+}
@@ -0,0 +1,222 @@
+package s3sts
+
+import (
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	s3auth "github.com/jakthom/s3c/pkg/s3/auth"
+	s3error "github.com/jakthom/s3c/pkg/s3/error"
+	s3policy "github.com/jakthom/s3c/pkg/s3/policy"
+	s3util "github.com/jakthom/s3c/pkg/s3/util"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// MaxSessionPolicySize is the maximum size of a session policy
+	MaxSessionPolicySize = 2048
+	// maxChainedRoleDuration is the maximum duration of a role session
+	// assumed with the credentials of another session
+	maxChainedRoleDuration = time.Hour
+)
+
+var roleSessionNameValidator = regexp.MustCompile(`^[\w+=,.@-]{2,64}$`)
+
+// STSHandler issues temporary credentials through a subset of the AWS
+// Security Token Service's query API
+type STSHandler struct {
+	Controller SessionController
+}
+
+func (h *STSHandler) Post(w http.ResponseWriter, r *http.Request) {
+	switch action := r.FormValue("Action"); action {
+	case "AssumeRole":
+		h.assumeRole(w, r)
+	case "GetSessionToken":
+		h.getSessionToken(w, r)
+	default:
+		writeError(w, r, s3error.NewError(r, http.StatusBadRequest, "InvalidAction", "Could not find operation "+action))
+	}
+}
+
+func (h *STSHandler) assumeRole(w http.ResponseWriter, r *http.Request) {
+	user := s3auth.RequestUser(r)
+	if user == nil {
+		writeError(w, r, s3error.AccessDeniedError(r))
+		return
+	}
+	_, role, ok := strings.Cut(r.FormValue("RoleArn"), ":role/")
+	if !ok || role == "" {
+		writeError(w, r, validationError(r, "RoleArn is not a valid role ARN"))
+		return
+	}
+	sessionName := r.FormValue("RoleSessionName")
+	if !roleSessionNameValidator.MatchString(sessionName) {
+		writeError(w, r, validationError(r, "RoleSessionName must be 2 to 64 characters of [\\w+=,.@-]"))
+		return
+	}
+	if err := s3policy.Authorize(r, "sts:AssumeRole", s3policy.RoleResource(role)); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	maxDuration, ok := h.Controller.RoleMaxDuration(role)
+	if !ok {
+		writeError(w, r, s3error.AccessDeniedError(r))
+		return
+	}
+	// Like AWS, sessions that assume roles are limited to an hour
+	if s3auth.RequestSession(r) != nil && maxDuration > maxChainedRoleDuration {
+		maxDuration = maxChainedRoleDuration
+	}
+	duration, err := sessionDuration(r, s3auth.DefaultRoleDuration, maxDuration)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	policy, err := sessionPolicy(r)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	session := &s3auth.Session{
+		User:       user.ID,
+		SourceKey:  sourceKey(r),
+		Role:       role,
+		Name:       sessionName,
+		Policy:     policy,
+		Expiration: time.Now().Add(duration).UTC().Truncate(time.Second),
+	}
+	credentials, err := h.issue(r, session)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	response := &AssumeRoleResponse{
+		ResponseMetadata: responseMetadata(r),
+	}
+	response.Result.Credentials = *credentials
+	response.Result.AssumedRoleUser = AssumedRoleUser{
+		AssumedRoleID: role + ":" + sessionName,
+		Arn:           "arn:aws:sts::" + s3policy.AccountID + ":assumed-role/" + role + "/" + sessionName,
+	}
+	s3util.WriteXML(w, r, http.StatusOK, response)
+}
+
+func (h *STSHandler) getSessionToken(w http.ResponseWriter, r *http.Request) {
+	user := s3auth.RequestUser(r)
+	if user == nil {
+		writeError(w, r, s3error.AccessDeniedError(r))
+		return
+	}
+	if s3auth.RequestSession(r) != nil {
+		writeError(w, r, s3error.NewError(r, http.StatusForbidden, "AccessDenied", "Cannot call GetSessionToken with session credentials"))
+		return
+	}
+	duration, err := sessionDuration(r, s3auth.DefaultSessionTokenDuration, s3auth.MaxSessionTokenDuration)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	session := &s3auth.Session{
+		User:       user.ID,
+		SourceKey:  sourceKey(r),
+		Expiration: time.Now().Add(duration).UTC().Truncate(time.Second),
+	}
+	credentials, err := h.issue(r, session)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	response := &GetSessionTokenResponse{
+		ResponseMetadata: responseMetadata(r),
+	}
+	response.Result.Credentials = *credentials
+	s3util.WriteXML(w, r, http.StatusOK, response)
+}
+
+// issue issues the temporary credentials of a session
+func (h *STSHandler) issue(r *http.Request, session *s3auth.Session) (*Credentials, error) {
+	secretKey, sessionToken, err := h.Controller.IssueSession(session)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to issue session for user: " + session.User)
+		return nil, s3error.InternalError(r, err)
+	}
+	log.Info().Msg("Issued session " + session.AccessKey + " for user: " + session.User)
+	return &Credentials{
+		AccessKeyID:     session.AccessKey,
+		SecretAccessKey: secretKey,
+		SessionToken:    sessionToken,
+		Expiration:      session.Expiration,
+	}, nil
+}
+
+// sourceKey returns the access key a session requested by a request is
+// issued with: that of the request, or the source key of its own session
+func sourceKey(r *http.Request) string {
+	if session := s3auth.RequestSession(r); session != nil {
+		return session.SourceKey
+	}
+	return mux.Vars(r)["authAccessKey"]
+}
+
+// sessionDuration returns the requested duration of a session
+func sessionDuration(r *http.Request, defaultDuration, maxDuration time.Duration) (time.Duration, error) {
+	value := r.FormValue("DurationSeconds")
+	if value == "" {
+		if defaultDuration > maxDuration {
+			return maxDuration, nil
+		}
+		return defaultDuration, nil
+	}
+	seconds, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, validationError(r, "DurationSeconds must be an integer")
+	}
+	duration := time.Duration(seconds) * time.Second
+	if duration < s3auth.MinSessionDuration || duration > maxDuration {
+		return 0, validationError(r, "DurationSeconds must be between "+strconv.Itoa(int(s3auth.MinSessionDuration.Seconds()))+" and "+strconv.Itoa(int(maxDuration.Seconds())))
+	}
+	return duration, nil
+}
+
+// sessionPolicy returns the requested session policy, after checking that it
+// is valid
+func sessionPolicy(r *http.Request) (string, error) {
+	policy := r.FormValue("Policy")
+	if policy == "" {
+		return "", nil
+	}
+	if len(policy) > MaxSessionPolicySize {
+		return "", s3error.NewError(r, http.StatusBadRequest, "PackedPolicyTooLarge", "The session policy is too large")
+	}
+	if _, err := s3policy.Parse([]byte(policy), false); err != nil {
+		return "", s3error.NewError(r, http.StatusBadRequest, "MalformedPolicyDocument", err.Error())
+	}
+	return policy, nil
+}
+
+func validationError(r *http.Request, message string) *s3error.Error {
+	return s3error.NewError(r, http.StatusBadRequest, "ValidationError", message)
+}
+
+func responseMetadata(r *http.Request) ResponseMetadata {
+	return ResponseMetadata{RequestID: mux.Vars(r)["requestID"]}
+}
+
+// writeError serializes an error to a response in the shape of sts errors
+func writeError(w http.ResponseWriter, r *http.Request, err error) {
+	s3Err := s3error.NewGenericError(r, err)
+	response := &ErrorResponse{RequestID: s3Err.RequestID}
+	response.Error.Type = "Sender"
+	if s3Err.HTTPStatus >= http.StatusInternalServerError {
+		response.Error.Type = "Receiver"
+	}
+	response.Error.Code = s3Err.Code
+	response.Error.Message = s3Err.Message
+	s3util.WriteXML(w, r, s3Err.HTTPStatus, response)
+}
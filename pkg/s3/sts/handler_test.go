@@ -0,0 +1,195 @@
+package s3sts
+
+import (
+	"encoding/xml"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/jakthom/s3c/pkg/config"
+	s3auth "github.com/jakthom/s3c/pkg/s3/auth"
+	s3user "github.com/jakthom/s3c/pkg/s3/user"
+)
+
+func newTestHandler(t *testing.T) (*STSHandler, *s3auth.CredentialStore) {
+	t.Helper()
+	store, err := s3auth.NewCredentialStore(config.Authentication{
+		SessionKey: "0123456789abcdef0123456789abcdef",
+		Users: []config.User{
+			{Name: "alice", Keys: []config.AccessKey{{KeyID: "AKIAALICE", Secret: "alice-secret"}}},
+		},
+		Roles: []config.Role{
+			{Name: "reader", Policy: `{"Statement": [{"Effect": "Allow", "Action": "s3:Get*", "Resource": "*"}]}`},
+			{Name: "batch", Policy: `{"Statement": [{"Effect": "Allow", "Action": "s3:*", "Resource": "*"}]}`, MaxDuration: 12 * time.Hour},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &STSHandler{Controller: store}, store
+}
+
+// stsRequest makes an sts call as a user, authenticated with either a long
+// lived access key or a session
+func stsRequest(handler *STSHandler, user *s3user.User, session *s3auth.Session, form url.Values) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(form.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	accessKey := "AKIAALICE"
+	if session != nil {
+		accessKey = session.AccessKey
+	}
+	r = mux.SetURLVars(r, map[string]string{"authAccessKey": accessKey, "requestID": "request"})
+	if user != nil {
+		r = s3auth.WithUser(r, user)
+	}
+	if session != nil {
+		r = s3auth.WithSession(r, session)
+	}
+	w := httptest.NewRecorder()
+	handler.Post(w, r)
+	return w
+}
+
+func stsErrorCode(t *testing.T, w *httptest.ResponseRecorder) string {
+	t.Helper()
+	if w.Code == http.StatusOK {
+		return ""
+	}
+	response := ErrorResponse{}
+	if err := xml.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatalf("invalid error response %q: %v", w.Body.String(), err)
+	}
+	return response.Error.Code
+}
+
+func TestGetSessionToken(t *testing.T) {
+	handler, store := newTestHandler(t)
+	alice := &s3user.User{ID: "alice"}
+
+	before := time.Now()
+	w := stsRequest(handler, alice, nil, url.Values{"Action": {"GetSessionToken"}})
+	if w.Code != http.StatusOK {
+		t.Fatalf("got %d: %s", w.Code, w.Body.String())
+	}
+	response := GetSessionTokenResponse{}
+	if err := xml.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatal(err)
+	}
+	credentials := response.Result.Credentials
+	if response.ResponseMetadata.RequestID != "request" {
+		t.Errorf("request id = %q", response.ResponseMetadata.RequestID)
+	}
+	if expiration := credentials.Expiration.Sub(before); expiration < s3auth.DefaultSessionTokenDuration-time.Second || expiration > s3auth.DefaultSessionTokenDuration+time.Second {
+		t.Errorf("session expires after %v", expiration)
+	}
+
+	// The credentials authenticate as the user, through the key they were
+	// issued with
+	secretKey, err := store.SessionSecretKey(credentials.AccessKeyID, credentials.SessionToken, s3auth.DefaultRegion)
+	if err != nil || secretKey != credentials.SecretAccessKey {
+		t.Errorf("issued secret key %q does not verify: %q, %v", credentials.SecretAccessKey, secretKey, err)
+	}
+	user, session, err := store.SessionUser(credentials.SessionToken)
+	if err != nil || user.ID != "alice" || session.SourceKey != "AKIAALICE" || session.Role != "" {
+		t.Errorf("session of %v: %+v, %v", user, session, err)
+	}
+
+	tests := []struct {
+		name    string
+		user    *s3user.User
+		session *s3auth.Session
+		form    url.Values
+		code    string
+	}{
+		{"minimum duration", alice, nil, url.Values{"DurationSeconds": {"900"}}, ""},
+		{"maximum duration", alice, nil, url.Values{"DurationSeconds": {"129600"}}, ""},
+		{"too short", alice, nil, url.Values{"DurationSeconds": {"899"}}, "ValidationError"},
+		{"too long", alice, nil, url.Values{"DurationSeconds": {"129601"}}, "ValidationError"},
+		{"invalid duration", alice, nil, url.Values{"DurationSeconds": {"1h"}}, "ValidationError"},
+		{"anonymous", nil, nil, url.Values{}, "AccessDenied"},
+		{"with session credentials", alice, session, url.Values{}, "AccessDenied"},
+	}
+	for _, tt := range tests {
+		tt.form.Set("Action", "GetSessionToken")
+		if code := stsErrorCode(t, stsRequest(handler, tt.user, tt.session, tt.form)); code != tt.code {
+			t.Errorf("%s: got %q, want %q", tt.name, code, tt.code)
+		}
+	}
+}
+
+func TestAssumeRole(t *testing.T) {
+	handler, store := newTestHandler(t)
+	alice := &s3user.User{ID: "alice"}
+	assumeRole := func(session *s3auth.Session, form url.Values) *httptest.ResponseRecorder {
+		form.Set("Action", "AssumeRole")
+		if !form.Has("RoleSessionName") {
+			form.Set("RoleSessionName", "job")
+		}
+		return stsRequest(handler, alice, session, form)
+	}
+
+	before := time.Now()
+	w := assumeRole(nil, url.Values{"RoleArn": {"arn:aws:iam::000000000000:role/reader"}, "Policy": {`{"Statement": [{"Effect": "Allow", "Action": "s3:GetObject", "Resource": "*"}]}`}})
+	if w.Code != http.StatusOK {
+		t.Fatalf("got %d: %s", w.Code, w.Body.String())
+	}
+	response := AssumeRoleResponse{}
+	if err := xml.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatal(err)
+	}
+	if user := response.Result.AssumedRoleUser; user.AssumedRoleID != "reader:job" || user.Arn != "arn:aws:sts::000000000000:assumed-role/reader/job" {
+		t.Errorf("assumed role user = %+v", user)
+	}
+	credentials := response.Result.Credentials
+	if expiration := credentials.Expiration.Sub(before); expiration < s3auth.DefaultRoleDuration-time.Second || expiration > s3auth.DefaultRoleDuration+time.Second {
+		t.Errorf("session expires after %v", expiration)
+	}
+	_, session, err := store.SessionUser(credentials.SessionToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if session.Role != "reader" || session.Name != "job" || session.SourceKey != "AKIAALICE" || !strings.Contains(session.Policy, "s3:GetObject") {
+		t.Errorf("session = %+v", session)
+	}
+
+	tests := []struct {
+		name    string
+		session *s3auth.Session
+		form    url.Values
+		code    string
+	}{
+		{"role duration", nil, url.Values{"RoleArn": {"arn:aws:iam::000000000000:role/batch"}, "DurationSeconds": {"43200"}}, ""},
+		{"beyond the role duration", nil, url.Values{"RoleArn": {"arn:aws:iam::000000000000:role/reader"}, "DurationSeconds": {"3601"}}, "ValidationError"},
+		{"chained beyond an hour", session, url.Values{"RoleArn": {"arn:aws:iam::000000000000:role/batch"}, "DurationSeconds": {"3601"}}, "ValidationError"},
+		{"chained within an hour", session, url.Values{"RoleArn": {"arn:aws:iam::000000000000:role/batch"}, "DurationSeconds": {"3600"}}, ""},
+		{"unknown role", nil, url.Values{"RoleArn": {"arn:aws:iam::000000000000:role/writer"}}, "AccessDenied"},
+		{"invalid role arn", nil, url.Values{"RoleArn": {"reader"}}, "ValidationError"},
+		{"invalid session name", nil, url.Values{"RoleArn": {"arn:aws:iam::000000000000:role/reader"}, "RoleSessionName": {"a job"}}, "ValidationError"},
+		{"malformed policy", nil, url.Values{"RoleArn": {"arn:aws:iam::000000000000:role/reader"}, "Policy": {`{"Statement": []}`}}, "MalformedPolicyDocument"},
+		{"policy too large", nil, url.Values{"RoleArn": {"arn:aws:iam::000000000000:role/reader"}, "Policy": {strings.Repeat(" ", MaxSessionPolicySize+1)}}, "PackedPolicyTooLarge"},
+	}
+	for _, tt := range tests {
+		if code := stsErrorCode(t, assumeRole(tt.session, tt.form)); code != tt.code {
+			t.Errorf("%s: got %q, want %q", tt.name, code, tt.code)
+		}
+	}
+
+	// Chained sessions keep the source key of the session they were issued
+	// with
+	w = assumeRole(session, url.Values{"RoleArn": {"arn:aws:iam::000000000000:role/batch"}})
+	if err := xml.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatal(err)
+	}
+	_, chained, err := store.SessionUser(response.Result.Credentials.SessionToken)
+	if err != nil || chained.SourceKey != "AKIAALICE" || chained.Role != "batch" {
+		t.Errorf("chained session = %+v, %v", chained, err)
+	}
+
+	if code := stsErrorCode(t, stsRequest(handler, alice, nil, url.Values{"Action": {"GetCallerIdentity"}})); code != "InvalidAction" {
+		t.Errorf("unsupported action: got %q, want InvalidAction", code)
+	}
+}
@@ -0,0 +1,64 @@
+package s3sts
+
+import (
+	"encoding/xml"
+	"time"
+)
+
+// Credentials are temporary credentials
+type Credentials struct {
+	AccessKeyID     string    `xml:"AccessKeyId"`
+	SecretAccessKey string    `xml:"SecretAccessKey"`
+	SessionToken    string    `xml:"SessionToken"`
+	Expiration      time.Time `xml:"Expiration"`
+}
+
+// AssumedRoleUser is the identity of a role session
+type AssumedRoleUser struct {
+	AssumedRoleID string `xml:"AssumedRoleId"`
+	Arn           string `xml:"Arn"`
+}
+
+// ResponseMetadata is the metadata of every sts response
+type ResponseMetadata struct {
+	RequestID string `xml:"RequestId"`
+}
+
+// AssumeRoleResponse is a response from an AssumeRole call
+type AssumeRoleResponse struct {
+	XMLName          xml.Name `xml:"https://sts.amazonaws.com/doc/2011-06-15/ AssumeRoleResponse"`
+	Result           AssumeRoleResult
+	ResponseMetadata ResponseMetadata
+}
+
+// AssumeRoleResult is the result of an AssumeRole call
+type AssumeRoleResult struct {
+	XMLName         xml.Name `xml:"AssumeRoleResult"`
+	Credentials     Credentials
+	AssumedRoleUser AssumedRoleUser
+}
+
+// GetSessionTokenResponse is a response from a GetSessionToken call
+type GetSessionTokenResponse struct {
+	XMLName          xml.Name `xml:"https://sts.amazonaws.com/doc/2011-06-15/ GetSessionTokenResponse"`
+	Result           GetSessionTokenResult
+	ResponseMetadata ResponseMetadata
+}
+
+// GetSessionTokenResult is the result of a GetSessionToken call
+type GetSessionTokenResult struct {
+	XMLName     xml.Name `xml:"GetSessionTokenResult"`
+	Credentials Credentials
+}
+
+// ErrorResponse is an sts error response, which is shaped differently from
+// s3 error responses
+type ErrorResponse struct {
+	XMLName xml.Name `xml:"https://sts.amazonaws.com/doc/2011-06-15/ ErrorResponse"`
+	Error   struct {
+		Type    string `xml:"Type"`
+		Code    string `xml:"Code"`
+		Message string `xml:"Message"`
+	} `xml:"Error"`
+	RequestID string `xml:"RequestId"`
+}
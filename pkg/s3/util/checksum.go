@@ -0,0 +1,194 @@
+package s3util
+
+import (
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base64"
+	"hash"
+	"hash/crc32"
+	"hash/crc64"
+	"net/http"
+	"strings"
+)
+
+const (
+	// checksumHeaderPrefix is the prefix of the headers and trailers carrying
+	// the checksum of a payload, ie `x-amz-checksum-crc32`
+	checksumHeaderPrefix = "x-amz-checksum-"
+
+	// ChecksumTypeFullObject is the type of checksums of the whole contents
+	// of an object
+	ChecksumTypeFullObject = "FULL_OBJECT"
+	// ChecksumTypeComposite is the type of checksums of multipart uploads
+	// that are the checksum of the checksums of their parts
+	ChecksumTypeComposite = "COMPOSITE"
+)
+
+// crc64NVMETable is the table of the CRC-64/NVME checksum
+var crc64NVMETable = crc64.MakeTable(0x9a6c9329ac4bc9b5)
+
+// checksumAlgorithms maps the supported checksum algorithms, by their
+// lowercase name, to constructors of their hash
+var checksumAlgorithms = map[string]func() hash.Hash{
+	"crc32":     func() hash.Hash { return crc32.NewIEEE() },
+	"crc32c":    func() hash.Hash { return crc32.New(crc32.MakeTable(crc32.Castagnoli)) },
+	"crc64nvme": func() hash.Hash { return crc64.New(crc64NVMETable) },
+	"sha1":      sha1.New,
+	"sha256":    sha256.New,
+}
+
+// Checksum is the checksum of an object or part, computed with one of the
+// flexible checksum algorithms
+type Checksum struct {
+	// Algorithm is the uppercase checksum algorithm, ie `CRC32C`
+	Algorithm string `json:"algorithm"`
+	// Value is the base64 encoded checksum. Composite checksums are suffixed
+	// with the number of parts they combine, ie `-3`.
+	Value string `json:"value,omitempty"`
+	// Type is either FULL_OBJECT or COMPOSITE
+	Type string `json:"type,omitempty"`
+}
+
+// ChecksumFields are the XML elements of a checksum in parts and results,
+// of which at most one is set
+type ChecksumFields struct {
+	ChecksumCRC32     string `xml:"ChecksumCRC32,omitempty"`
+	ChecksumCRC32C    string `xml:"ChecksumCRC32C,omitempty"`
+	ChecksumCRC64NVME string `xml:"ChecksumCRC64NVME,omitempty"`
+	ChecksumSHA1      string `xml:"ChecksumSHA1,omitempty"`
+	ChecksumSHA256    string `xml:"ChecksumSHA256,omitempty"`
+}
+
+// ChecksumAlgorithm returns the lowercase checksum algorithm of a checksum
+// header name, ie `crc32` for `x-amz-checksum-crc32`, and whether it is
+// supported
+func ChecksumAlgorithm(header string) (string, bool) {
+	lower := strings.ToLower(header)
+	if !strings.HasPrefix(lower, checksumHeaderPrefix) {
+		return "", false
+	}
+	algorithm := strings.TrimPrefix(lower, checksumHeaderPrefix)
+	_, ok := checksumAlgorithms[algorithm]
+	return algorithm, ok
+}
+
+// ValidChecksumAlgorithm returns whether a checksum algorithm is supported,
+// regardless of case
+func ValidChecksumAlgorithm(algorithm string) bool {
+	_, ok := checksumAlgorithms[strings.ToLower(algorithm)]
+	return ok
+}
+
+// ValidChecksumType returns whether a checksum type may be used with an
+// algorithm. CRC64NVME only supports full object checksums, and the SHA
+// algorithms only composite ones.
+func ValidChecksumType(algorithm, checksumType string) bool {
+	switch checksumType {
+	case ChecksumTypeFullObject:
+		return !strings.HasPrefix(strings.ToLower(algorithm), "sha")
+	case ChecksumTypeComposite:
+		return !strings.EqualFold(algorithm, "crc64nvme")
+	}
+	return false
+}
+
+// DefaultChecksumType returns the checksum type of multipart uploads that
+// do not specify one
+func DefaultChecksumType(algorithm string) string {
+	if strings.EqualFold(algorithm, "crc64nvme") {
+		return ChecksumTypeFullObject
+	}
+	return ChecksumTypeComposite
+}
+
+// NewChecksum returns a hash of a supported checksum algorithm
+func NewChecksum(algorithm string) hash.Hash {
+	return checksumAlgorithms[strings.ToLower(algorithm)]()
+}
+
+// EncodeChecksum encodes a checksum the way it is sent in headers
+func EncodeChecksum(h hash.Hash) string {
+	return base64.StdEncoding.EncodeToString(h.Sum(nil))
+}
+
+// validChecksumValue returns whether a base64 checksum value has the size of
+// the checksums of an algorithm
+func validChecksumValue(algorithm, value string) bool {
+	decoded, err := base64.StdEncoding.DecodeString(value)
+	return err == nil && len(decoded) == NewChecksum(algorithm).Size()
+}
+
+// ChecksumFromHeader returns the checksum in the `x-amz-checksum-*` headers
+// of a request or response, or nil if there is none
+func ChecksumFromHeader(header http.Header) *Checksum {
+	for name, values := range header {
+		algorithm, ok := ChecksumAlgorithm(name)
+		if !ok || len(values) == 0 || values[0] == "" {
+			continue
+		}
+		checksumType := header.Get("x-amz-checksum-type")
+		if checksumType == "" {
+			checksumType = ChecksumTypeFullObject
+		}
+		return &Checksum{
+			Algorithm: strings.ToUpper(algorithm),
+			Value:     values[0],
+			Type:      checksumType,
+		}
+	}
+	return nil
+}
+
+// ChecksumFromFields returns the checksum set in XML checksum fields, or nil
+// if there is none
+func ChecksumFromFields(fields ChecksumFields, checksumType string) *Checksum {
+	for algorithm, value := range map[string]string{
+		"CRC32":     fields.ChecksumCRC32,
+		"CRC32C":    fields.ChecksumCRC32C,
+		"CRC64NVME": fields.ChecksumCRC64NVME,
+		"SHA1":      fields.ChecksumSHA1,
+		"SHA256":    fields.ChecksumSHA256,
+	} {
+		if value != "" {
+			return &Checksum{Algorithm: algorithm, Value: value, Type: checksumType}
+		}
+	}
+	return nil
+}
+
+// Header returns the name of the header of a checksum
+func (c *Checksum) Header() string {
+	return checksumHeaderPrefix + strings.ToLower(c.Algorithm)
+}
+
+// WriteHeader sets the `x-amz-checksum-*` headers of a checksum
+func (c *Checksum) WriteHeader(header http.Header) {
+	if c == nil || c.Value == "" {
+		return
+	}
+	header.Set(c.Header(), c.Value)
+	if c.Type != "" {
+		header.Set("x-amz-checksum-type", c.Type)
+	}
+}
+
+// Fields returns the XML checksum fields of a checksum
+func (c *Checksum) Fields() ChecksumFields {
+	fields := ChecksumFields{}
+	if c == nil {
+		return fields
+	}
+	switch strings.ToUpper(c.Algorithm) {
+	case "CRC32":
+		fields.ChecksumCRC32 = c.Value
+	case "CRC32C":
+		fields.ChecksumCRC32C = c.Value
+	case "CRC64NVME":
+		fields.ChecksumCRC64NVME = c.Value
+	case "SHA1":
+		fields.ChecksumSHA1 = c.Value
+	case "SHA256":
+		fields.ChecksumSHA256 = c.Value
+	}
+	return fields
+}
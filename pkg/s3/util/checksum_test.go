@@ -0,0 +1,198 @@
+package s3util
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	s3error "github.com/jakthom/s3c/pkg/s3/error"
+)
+
+// checkInput is the input of the published check values of CRC algorithms
+const checkInput = "123456789"
+
+func TestChecksumCheckValues(t *testing.T) {
+	tests := []struct {
+		algorithm string
+		sum       uint64
+		encoded   string
+	}{
+		{"crc32", 0xcbf43926, "y/Q5Jg=="},
+		{"crc32c", 0xe3069283, "4waSgw=="},
+		{"crc64nvme", 0xae8b14860a799888, "rosUhgp5mIg="},
+		{"sha1", 0, "98O8HYCOBHMq32eZZczDTKeuNEE="},
+		{"sha256", 0, "FeKw08M4keuw8e9gnsQZQgwg4yDOlMZfvIwzEkSOsiU="},
+	}
+	for _, tt := range tests {
+		h := NewChecksum(strings.ToUpper(tt.algorithm))
+		h.Write([]byte(checkInput))
+		if tt.sum != 0 {
+			var sum uint64
+			for _, b := range h.Sum(nil) {
+				sum = sum<<8 | uint64(b)
+			}
+			if sum != tt.sum {
+				t.Errorf("%s = %#x, want %#x", tt.algorithm, sum, tt.sum)
+			}
+		}
+		if encoded := EncodeChecksum(h); encoded != tt.encoded {
+			t.Errorf("%s encodes as %s, want %s", tt.algorithm, encoded, tt.encoded)
+		}
+		if !validChecksumValue(tt.algorithm, tt.encoded) {
+			t.Errorf("%s: %s is not a valid value", tt.algorithm, tt.encoded)
+		}
+	}
+	if validChecksumValue("crc32", "rosUhgp5mIg=") || validChecksumValue("crc64nvme", "not base64") {
+		t.Error("value of another size or encoding is valid")
+	}
+}
+
+func TestChecksumAlgorithms(t *testing.T) {
+	if algorithm, ok := ChecksumAlgorithm("X-Amz-Checksum-CRC64NVME"); !ok || algorithm != "crc64nvme" {
+		t.Errorf("algorithm = %q, %v", algorithm, ok)
+	}
+	for _, header := range []string{"x-amz-checksum-md5", "x-amz-checksum-type", "x-amz-checksum-algorithm", "content-md5"} {
+		if _, ok := ChecksumAlgorithm(header); ok {
+			t.Errorf("%s names a checksum", header)
+		}
+	}
+	if !ValidChecksumAlgorithm("CRC32C") || ValidChecksumAlgorithm("MD5") {
+		t.Error("algorithms are validated incorrectly")
+	}
+
+	tests := []struct {
+		algorithm   string
+		fullObject  bool
+		composite   bool
+		defaultType string
+	}{
+		{"CRC32", true, true, ChecksumTypeComposite},
+		{"CRC32C", true, true, ChecksumTypeComposite},
+		{"CRC64NVME", true, false, ChecksumTypeFullObject},
+		{"SHA1", false, true, ChecksumTypeComposite},
+		{"SHA256", false, true, ChecksumTypeComposite},
+	}
+	for _, tt := range tests {
+		if ValidChecksumType(tt.algorithm, ChecksumTypeFullObject) != tt.fullObject || ValidChecksumType(tt.algorithm, ChecksumTypeComposite) != tt.composite {
+			t.Errorf("%s: valid types are wrong", tt.algorithm)
+		}
+		if got := DefaultChecksumType(tt.algorithm); got != tt.defaultType {
+			t.Errorf("%s: default type = %s, want %s", tt.algorithm, got, tt.defaultType)
+		}
+	}
+	if ValidChecksumType("CRC32", "PARTIAL") {
+		t.Error("unknown checksum type is valid")
+	}
+}
+
+func TestChecksumHeaders(t *testing.T) {
+	checksum := &Checksum{Algorithm: "CRC32C", Value: "4waSgw==-3", Type: ChecksumTypeComposite}
+	header := http.Header{}
+	checksum.WriteHeader(header)
+	if header.Get("x-amz-checksum-crc32c") != "4waSgw==-3" || header.Get("x-amz-checksum-type") != ChecksumTypeComposite {
+		t.Errorf("headers = %v", header)
+	}
+	if parsed := ChecksumFromHeader(header); parsed == nil || *parsed != *checksum {
+		t.Errorf("parsed %v, want %v", parsed, checksum)
+	}
+	if parsed := ChecksumFromFields(checksum.Fields(), ChecksumTypeComposite); parsed == nil || *parsed != *checksum {
+		t.Errorf("parsed fields %v, want %v", parsed, checksum)
+	}
+
+	// Checksums sent without a type are of the full object
+	header = http.Header{"X-Amz-Checksum-Crc64nvme": {"rosUhgp5mIg="}}
+	want := Checksum{Algorithm: "CRC64NVME", Value: "rosUhgp5mIg=", Type: ChecksumTypeFullObject}
+	if parsed := ChecksumFromHeader(header); parsed == nil || *parsed != want {
+		t.Errorf("parsed %v, want %v", parsed, want)
+	}
+	if ChecksumFromHeader(http.Header{"Content-Md5": {"x"}}) != nil || ChecksumFromFields(ChecksumFields{}, "") != nil {
+		t.Error("checksum found where there is none")
+	}
+	var none *Checksum
+	none.WriteHeader(header)
+	if none.Fields() != (ChecksumFields{}) {
+		t.Error("nil checksum has fields")
+	}
+}
+
+func TestRequestBodyChecksums(t *testing.T) {
+	tests := []struct {
+		name     string
+		header   http.Header
+		checksum *Checksum
+		code     string
+		err      string
+	}{
+		{
+			name:     "matching checksum",
+			header:   http.Header{"X-Amz-Checksum-Crc64nvme": {"rosUhgp5mIg="}},
+			checksum: &Checksum{Algorithm: "CRC64NVME", Value: "rosUhgp5mIg=", Type: ChecksumTypeFullObject},
+		},
+		{
+			name:   "mismatched checksum",
+			header: http.Header{"X-Amz-Checksum-Crc32": {"4waSgw=="}},
+			err:    "BadDigest",
+		},
+		{
+			name:     "checksum computed for the sdk",
+			header:   http.Header{"X-Amz-Sdk-Checksum-Algorithm": {"CRC32C"}},
+			checksum: &Checksum{Algorithm: "CRC32C", Value: "4waSgw==", Type: ChecksumTypeFullObject},
+		},
+		{
+			name:     "checksum named by the sdk",
+			header:   http.Header{"X-Amz-Sdk-Checksum-Algorithm": {"SHA1"}, "X-Amz-Checksum-Sha1": {"98O8HYCOBHMq32eZZczDTKeuNEE="}},
+			checksum: &Checksum{Algorithm: "SHA1", Value: "98O8HYCOBHMq32eZZczDTKeuNEE=", Type: ChecksumTypeFullObject},
+		},
+		{
+			name:   "checksum of another algorithm than the sdk's",
+			header: http.Header{"X-Amz-Sdk-Checksum-Algorithm": {"CRC32"}, "X-Amz-Checksum-Crc32c": {"4waSgw=="}},
+			code:   "InvalidRequest",
+		},
+		{
+			name:   "unsupported sdk algorithm",
+			header: http.Header{"X-Amz-Sdk-Checksum-Algorithm": {"MD5"}},
+			code:   "InvalidRequest",
+		},
+		{
+			name:   "several checksums",
+			header: http.Header{"X-Amz-Checksum-Crc32": {"y/Q5Jg=="}, "X-Amz-Checksum-Crc32c": {"4waSgw=="}},
+			code:   "InvalidRequest",
+		},
+		{
+			name:   "checksum of the wrong size",
+			header: http.Header{"X-Amz-Checksum-Crc32": {"rosUhgp5mIg="}},
+			code:   "InvalidRequest",
+		},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodPut, "/bucket/key", strings.NewReader(checkInput))
+		for name, values := range tt.header {
+			r.Header[name] = values
+		}
+		body, err := RequestBody(r)
+		if tt.code != "" {
+			if s3Err, ok := err.(*s3error.Error); !ok || s3Err.Code != tt.code {
+				t.Errorf("%s: got %v, want %s", tt.name, err, tt.code)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		payload, err := io.ReadAll(body)
+		if tt.err != "" {
+			if s3Err, ok := PayloadError(r, err).(*s3error.Error); !ok || s3Err.Code != tt.err || len(payload) == len(checkInput) {
+				t.Errorf("%s: read %q, got %v, want %s", tt.name, payload, err, tt.err)
+			}
+			continue
+		}
+		if err != nil || string(payload) != checkInput {
+			t.Errorf("%s: read %q, %v", tt.name, payload, err)
+		}
+		if checksum := PayloadChecksum(body); checksum == nil || *checksum != *tt.checksum {
+			t.Errorf("%s: checksum = %v, want %v", tt.name, checksum, tt.checksum)
+		}
+	}
+}
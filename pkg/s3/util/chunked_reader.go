@@ -5,27 +5,150 @@ import (
 	"crypto/sha256"
 	"errors"
 	"fmt"
+	"hash"
 	"io"
+	"net/http"
 	"regexp"
 	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+	s3error "github.com/jakthom/s3c/pkg/s3/error"
+)
+
+// The `x-amz-content-sha256` values of aws-chunked request bodies
+const (
+	// StreamingPayload is a body of signed chunks
+	StreamingPayload = "STREAMING-AWS4-HMAC-SHA256-PAYLOAD"
+	// StreamingPayloadTrailer is a body of signed chunks followed by signed
+	// trailers
+	StreamingPayloadTrailer = "STREAMING-AWS4-HMAC-SHA256-PAYLOAD-TRAILER"
+	// StreamingUnsignedPayloadTrailer is a body of unsigned chunks followed
+	// by unsigned trailers
+	StreamingUnsignedPayloadTrailer = "STREAMING-UNSIGNED-PAYLOAD-TRAILER"
+	// streamingECDSAPrefix is the prefix of the aws-chunked variants signed
+	// with AWS' auth V4A, which s3c does not support
+	streamingECDSAPrefix = "STREAMING-AWS4-ECDSA-P256-SHA256-PAYLOAD"
+
+	// maxChunkSize is the largest chunk s3c accepts. SDKs send 64KB chunks.
+	maxChunkSize = 16 << 20
+	// emptySHA256 is the hex SHA256 hash of an empty string
+	emptySHA256 = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
 )
 
 var (
-	// chunkValidator is a regexp for validating a chunk "header" in the
-	// request body of a multi-chunk upload
-	chunkValidator = regexp.MustCompile(`^([0-9a-fA-F]+);chunk-signature=([0-9a-fA-F]+)`)
+	// signedChunkValidator is a regexp for validating a chunk "header" in
+	// the request body of a signed multi-chunk upload
+	signedChunkValidator = regexp.MustCompile(`^([0-9a-fA-F]+);chunk-signature=([0-9a-fA-F]{64})\r\n$`)
+	// unsignedChunkValidator is a regexp for validating a chunk "header" in
+	// the request body of an unsigned multi-chunk upload, which may carry
+	// extensions s3c ignores
+	unsignedChunkValidator = regexp.MustCompile(`^([0-9a-fA-F]+)(;[^\r\n]*)?\r\n$`)
 
 	// InvalidChunk is an error returned when reading a multi-chunk object
-	// upload that contains an invalid chunk header or body
+	// upload that contains a chunk or trailer with an invalid signature
 	InvalidChunk = errors.New("invalid chunk")
+	// MalformedChunk is an error returned when reading a multi-chunk object
+	// upload that is not well-formed or whose length does not match
+	// `x-amz-decoded-content-length`
+	MalformedChunk = errors.New("malformed chunk")
+	// MalformedTrailer is an error returned when reading a multi-chunk
+	// object upload whose trailers are not well-formed or were not declared
+	// in `x-amz-trailer`
+	MalformedTrailer = errors.New("malformed trailer")
 )
 
+// isStreaming returns whether an `x-amz-content-sha256` value is that of an
+// aws-chunked body
+func isStreaming(contentSha256 string) bool {
+	return strings.HasPrefix(contentSha256, "STREAMING-")
+}
+
+// newChunkedReader returns a reader decoding the aws-chunked body of a
+// request. It fails if the body uses an aws-chunked variant or trailer s3c
+// does not support.
+func newChunkedReader(r *http.Request, contentSha256 string) (*chunkedReader, error) {
+	var signed bool
+	switch contentSha256 {
+	case StreamingPayload, StreamingPayloadTrailer:
+		signed = true
+	case StreamingUnsignedPayloadTrailer:
+		signed = false
+	default:
+		if strings.HasPrefix(contentSha256, streamingECDSAPrefix) {
+			return nil, s3error.NotImplementedError(r)
+		}
+		return nil, s3error.InvalidArgumentError(r)
+	}
+
+	c := &chunkedReader{
+		body:          r.Body,
+		bufBody:       bufio.NewReader(r.Body),
+		decodedLength: -1,
+	}
+	if decoded := r.Header.Get("x-amz-decoded-content-length"); decoded != "" {
+		length, err := strconv.ParseInt(decoded, 10, 64)
+		if err != nil || length < 0 {
+			return nil, s3error.InvalidArgumentError(r)
+		}
+		c.decodedLength = length
+	}
+	if signed {
+		// Signed chunks are chained to the signature of the request, which
+		// only auth V4 headers provide
+		vars := mux.Vars(r)
+		if vars["authMethod"] != "v4" {
+			return nil, s3error.InvalidRequestError(r, "Streaming uploads must be signed with an AWS4-HMAC-SHA256 Authorization header.")
+		}
+		c.signed = true
+		c.signingKey = []byte(vars["authSignatureKey"])
+		c.lastSignature = vars["authSignature"]
+		c.timestamp = vars["authSignatureTimestamp"]
+		c.date = vars["authSignatureDate"]
+		c.region = vars["authSignatureRegion"]
+	}
+	c.trailing = contentSha256 != StreamingPayload
+	// The trailer must be declared up front, so its checksum can be computed
+	// while the chunks are read
+	if trailer := strings.ToLower(strings.TrimSpace(r.Header.Get("x-amz-trailer"))); trailer != "" {
+		algorithm, ok := ChecksumAlgorithm(trailer)
+		if !ok {
+			return nil, s3error.InvalidRequestError(r, "Unsupported trailer: "+trailer)
+		}
+		c.trailer = trailer
+		c.trailerAlgorithm = algorithm
+		c.trailerChecksum = NewChecksum(algorithm)
+	}
+	if c.trailing != (c.trailer != "") {
+		return nil, s3error.InvalidRequestError(r, "The x-amz-trailer header does not match the x-amz-content-sha256 header.")
+	}
+	return c, nil
+}
+
 // Reads a multi-chunk upload body
 type chunkedReader struct {
-	body      io.ReadCloser
-	lastChunk []byte
-	bufBody   *bufio.Reader
+	body    io.ReadCloser
+	bufBody *bufio.Reader
+	// chunk holds the decoded bytes that have not been read yet
+	chunk []byte
+	// final is set once the final chunk and trailers have been verified
+	final bool
+	err   error
+
+	// decodedLength is the expected length of the payload, or -1 if unknown
+	decodedLength int64
+	length        int64
+	// trailer is the name of the declared trailer, if any, and
+	// trailerChecksum the checksum of the payload it is verified against
+	trailer          string
+	trailerAlgorithm string
+	trailerChecksum  hash.Hash
+	// checksum is the verified checksum of the trailer
+	checksum *Checksum
 
+	// trailing is set if the final chunk is followed by trailers
+	trailing      bool
+	signed        bool
 	signingKey    []byte
 	lastSignature string
 	timestamp     string
@@ -33,93 +156,177 @@ type chunkedReader struct {
 	region        string
 }
 
-func NewChunkedReader(body io.ReadCloser, signingKey []byte, seedSignature, timestamp, date, region string) *chunkedReader {
-	return &chunkedReader{
-		body:      body,
-		lastChunk: nil,
-		bufBody:   bufio.NewReader(body),
-
-		signingKey:    signingKey,
-		lastSignature: seedSignature,
-		timestamp:     timestamp,
-		date:          date,
-		region:        region,
-	}
-}
-
 func (c *chunkedReader) Read(p []byte) (n int, err error) {
-	if c.lastChunk == nil {
-		if err := c.readChunk(); err != nil {
+	if c.err != nil {
+		return 0, c.err
+	}
+	// The last bytes of a chunk are only returned once the next chunk has
+	// been read, so that a failure at the end of the body, like a bad
+	// trailing checksum, is reported before the payload has been read whole
+	for len(c.chunk) <= len(p) && !c.final {
+		chunk, err := c.readChunk()
+		if err != nil {
+			c.err = err
 			return 0, err
 		}
+		c.chunk = append(c.chunk, chunk...)
 	}
-
-	n = copy(p, c.lastChunk)
-
-	if n == len(c.lastChunk) {
-		c.lastChunk = nil
-	} else {
-		c.lastChunk = c.lastChunk[n:]
+	if len(c.chunk) == 0 {
+		return 0, io.EOF
 	}
-
+	n = copy(p, c.chunk)
+	c.chunk = c.chunk[n:]
 	return n, nil
 }
 
-func (c *chunkedReader) readChunk() error {
-	// step 1: read the chunk header
-	line, err := c.bufBody.ReadString('\n')
+// readLine reads a CRLF-terminated line of the body
+func (c *chunkedReader) readLine() (string, error) {
+	line, err := c.bufBody.ReadSlice('\n')
 	if err != nil {
-		if err == io.EOF {
-			return err
-		}
-		return InvalidChunk
+		return "", MalformedChunk
 	}
+	return string(line), nil
+}
 
-	match := chunkValidator.FindStringSubmatch(line)
+// readChunk reads and verifies the next chunk, returning its payload. After
+// the final chunk, it reads and verifies the trailers.
+func (c *chunkedReader) readChunk() ([]byte, error) {
+	// step 1: read the chunk header
+	line, err := c.readLine()
+	if err != nil {
+		return nil, err
+	}
+	validator := unsignedChunkValidator
+	if c.signed {
+		validator = signedChunkValidator
+	}
+	match := validator.FindStringSubmatch(line)
 	if len(match) == 0 {
-		return InvalidChunk
+		return nil, MalformedChunk
 	}
-
-	chunkLengthHexStr := match[1]
-	chunkSignature := match[2]
-
-	chunkLength, err := strconv.ParseUint(chunkLengthHexStr, 16, 32)
-	if err != nil {
-		return InvalidChunk
+	chunkLength, err := strconv.ParseUint(match[1], 16, 32)
+	if err != nil || chunkLength > maxChunkSize {
+		return nil, MalformedChunk
 	}
 
 	// step 2: read the chunk body
 	chunk := make([]byte, chunkLength)
-	_, err = io.ReadFull(c.bufBody, chunk)
-	if err != nil {
-		return InvalidChunk
+	if _, err := io.ReadFull(c.bufBody, chunk); err != nil {
+		return nil, MalformedChunk
+	}
+	c.length += int64(chunkLength)
+	if c.decodedLength >= 0 && c.length > c.decodedLength {
+		return nil, MalformedChunk
+	}
+
+	// step 3: verify the chunk signature
+	if c.signed {
+		stringToSign := fmt.Sprintf(
+			"AWS4-HMAC-SHA256-PAYLOAD\n%s\n%s/%s/s3/aws4_request\n%s\n%s\n%x",
+			c.timestamp,
+			c.date,
+			c.region,
+			c.lastSignature,
+			emptySHA256,
+			sha256.Sum256(chunk),
+		)
+		signature := HmacSHA256(c.signingKey, stringToSign)
+		if match[2] != fmt.Sprintf("%x", signature) {
+			return nil, InvalidChunk
+		}
+		c.lastSignature = match[2]
+	}
+	if c.trailerChecksum != nil {
+		c.trailerChecksum.Write(chunk)
+	}
+
+	if chunkLength > 0 {
+		// step 4: read the chunk terminator
+		if err := c.readCRLF(); err != nil {
+			return nil, err
+		}
+		return chunk, nil
+	}
+
+	// step 4: the final chunk is followed by the trailers, if any
+	if c.decodedLength >= 0 && c.length != c.decodedLength {
+		return nil, MalformedChunk
+	}
+	if !c.trailing {
+		if err := c.readCRLF(); err != nil {
+			return nil, err
+		}
+	} else if err := c.readTrailers(); err != nil {
+		return nil, err
 	}
+	c.final = true
+	return chunk, nil
+}
 
-	// step 3: read the trailer
-	trailer := make([]byte, 2)
-	_, err = io.ReadFull(c.bufBody, trailer)
-	if err != nil || trailer[0] != '\r' || trailer[1] != '\n' {
-		return InvalidChunk
+// readCRLF reads the CRLF terminating a chunk
+func (c *chunkedReader) readCRLF() error {
+	crlf := make([]byte, 2)
+	if _, err := io.ReadFull(c.bufBody, crlf); err != nil || crlf[0] != '\r' || crlf[1] != '\n' {
+		return MalformedChunk
 	}
+	return nil
+}
 
-	// step 4: construct the string to sign
-	stringToSign := fmt.Sprintf(
-		"AWS4-HMAC-SHA256-PAYLOAD\n%s\n%s/%s/s3/aws4_request\n%s\ne3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855\n%x",
-		c.timestamp,
-		c.date,
-		c.region,
-		c.lastSignature,
-		sha256.Sum256(chunk),
-	)
+// readTrailers reads the trailer following the final chunk, verifying its
+// signature and checksum
+func (c *chunkedReader) readTrailers() error {
+	var value, trailerSignature string
+	for {
+		line, err := c.readLine()
+		if err != nil {
+			return MalformedTrailer
+		}
+		if line == "\r\n" {
+			break
+		}
+		name, v, ok := strings.Cut(strings.TrimSuffix(line, "\r\n"), ":")
+		if !ok {
+			return MalformedTrailer
+		}
+		switch strings.ToLower(strings.TrimSpace(name)) {
+		case "x-amz-trailer-signature":
+			trailerSignature = strings.TrimSpace(v)
+		case c.trailer:
+			value = strings.TrimSpace(v)
+		default:
+			return MalformedTrailer
+		}
+	}
+	if value == "" {
+		return MalformedTrailer
+	}
 
-	// step 5: calculate & verify the signature
-	signature := HmacSHA256(c.signingKey, stringToSign)
-	if chunkSignature != fmt.Sprintf("%x", signature) {
-		return InvalidChunk
+	if c.signed {
+		if trailerSignature == "" {
+			return MalformedTrailer
+		}
+		stringToSign := fmt.Sprintf(
+			"AWS4-HMAC-SHA256-TRAILER\n%s\n%s/%s/s3/aws4_request\n%s\n%x",
+			c.timestamp,
+			c.date,
+			c.region,
+			c.lastSignature,
+			sha256.Sum256([]byte(c.trailer+":"+value+"\n")),
+		)
+		signature := HmacSHA256(c.signingKey, stringToSign)
+		if trailerSignature != fmt.Sprintf("%x", signature) {
+			return InvalidChunk
+		}
 	}
 
-	c.lastChunk = chunk
-	c.lastSignature = chunkSignature
+	if value != EncodeChecksum(c.trailerChecksum) {
+		return &ChecksumMismatchError{Algorithm: c.trailerAlgorithm}
+	}
+	c.checksum = &Checksum{
+		Algorithm: strings.ToUpper(c.trailerAlgorithm),
+		Value:     value,
+		Type:      ChecksumTypeFullObject,
+	}
 	return nil
 }
 
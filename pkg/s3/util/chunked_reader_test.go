@@ -0,0 +1,265 @@
+package s3util
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	s3error "github.com/jakthom/s3c/pkg/s3/error"
+)
+
+// The examples of AWS' documentation of aws-chunked uploads: 66560 bytes of
+// "a", sent as a 64KB chunk, a 1KB chunk and the final empty chunk
+const (
+	exampleSecretKey = "wJalrXUtnFEMI/K7MDENG/bPxRfiCYEXAMPLEKEY"
+	// exampleSeedSignature is the signature of the request headers of the
+	// upload without trailers
+	exampleSeedSignature = "4f232c4386841ef735655705268965c44a0e4690baa4adea153f7db9fa80a0a9"
+	// exampleTrailerSeedSignature is the signature of the request headers of
+	// the upload with a CRC32C trailer
+	exampleTrailerSeedSignature = "106e2a8a18243abcf37539882f36619c00e2dfc72633413f02d3b74544bfeb8e"
+	// exampleTrailer is the trailer of the upload with a trailer, and
+	// exampleTrailerSignature its signature
+	exampleTrailer          = "x-amz-checksum-crc32c:sOO8/Q=="
+	exampleTrailerSignature = "d81f82fc3505edab99d459891051a732e8730629a2e4a59689829ca17fe2e435"
+)
+
+var (
+	exampleChunks          = [][]byte{bytes.Repeat([]byte("a"), 65536), bytes.Repeat([]byte("a"), 1024), {}}
+	exampleChunkSignatures = []string{
+		"ad80c730a21e5b8d04586a2213dd63b9a0e99e0e2307b0ade35a65485a288648",
+		"0055627c9e194cb4542bae2aa5492e3c1575bbb81b612b7d234b86a503ef5497",
+		"b6c6ea8a5354eaf15b3cb7646744f4275b71ea724fed81ceb9323e279d449df9",
+	}
+	exampleTrailerChunkSignatures = []string{
+		"b474d8862b1487a5145d686f57f013e54db672cee1c953b3010fb58501ef5aa2",
+		"1c1344b170168f8e65b41376b44b20fe354e373826ccbbe2c1d40a8cae51e5c7",
+		"2ca2aba2005185cf7159c6277faf83795951dd77a3a99e6e65d5c9f85863f992",
+	}
+)
+
+// chunkedBody encodes chunks as an aws-chunked body, signed if signatures
+// are given, followed by trailers if any are given
+func chunkedBody(chunks [][]byte, signatures []string, trailers ...string) string {
+	var b strings.Builder
+	for i, chunk := range chunks {
+		fmt.Fprintf(&b, "%x", len(chunk))
+		if signatures != nil {
+			b.WriteString(";chunk-signature=" + signatures[i])
+		}
+		b.WriteString("\r\n")
+		b.Write(chunk)
+		if len(chunk) > 0 || len(trailers) == 0 {
+			b.WriteString("\r\n")
+		}
+	}
+	for _, trailer := range trailers {
+		b.WriteString(trailer + "\r\n")
+	}
+	if len(trailers) > 0 {
+		b.WriteString("\r\n")
+	}
+	return b.String()
+}
+
+// chunkedRequest creates an upload of an aws-chunked body, authenticated
+// with the example's seed signature as auth V4 would
+func chunkedRequest(contentSha256, seedSignature, trailer, body string) *http.Request {
+	r := httptest.NewRequest(http.MethodPut, "/examplebucket/chunkObject.txt", strings.NewReader(body))
+	r.Header.Set("Content-Encoding", "aws-chunked")
+	r.Header.Set("x-amz-content-sha256", contentSha256)
+	r.Header.Set("x-amz-decoded-content-length", "66560")
+	if trailer != "" {
+		r.Header.Set("x-amz-trailer", trailer)
+	}
+	signingKey := HmacSHA256(HmacSHA256(HmacSHA256(HmacSHA256([]byte("AWS4"+exampleSecretKey), "20130524"), "us-east-1"), "s3"), "aws4_request")
+	return mux.SetURLVars(r, map[string]string{
+		"authMethod":             "v4",
+		"authSignature":          seedSignature,
+		"authSignatureKey":       string(signingKey),
+		"authSignatureTimestamp": "20130524T000000Z",
+		"authSignatureDate":      "20130524",
+		"authSignatureRegion":    "us-east-1",
+	})
+}
+
+// readPayload reads the payload of an upload, returning how much of it was
+// read before an error
+func readPayload(t *testing.T, r *http.Request) (io.ReadCloser, []byte, error) {
+	t.Helper()
+	body, err := RequestBody(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var read []byte
+	buf := make([]byte, 1024)
+	for {
+		n, err := body.Read(buf)
+		read = append(read, buf[:n]...)
+		if err == io.EOF {
+			return body, read, nil
+		}
+		if err != nil {
+			return body, read, err
+		}
+	}
+}
+
+func TestChunkedReaderSignedExample(t *testing.T) {
+	r := chunkedRequest(StreamingPayload, exampleSeedSignature, "", chunkedBody(exampleChunks, exampleChunkSignatures))
+	body, payload, err := readPayload(t, r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(payload, bytes.Repeat([]byte("a"), 66560)) {
+		t.Errorf("decoded %d bytes", len(payload))
+	}
+	if PayloadLength(body) != 66560 || PayloadChecksum(body) != nil {
+		t.Errorf("payload of %d bytes with checksum %v", PayloadLength(body), PayloadChecksum(body))
+	}
+}
+
+func TestChunkedReaderSignedErrors(t *testing.T) {
+	tampered := append([][]byte{}, exampleChunks...)
+	tampered[1] = append(bytes.Repeat([]byte("a"), 1023), 'b')
+	tests := []struct {
+		name string
+		seed string
+		body string
+		err  error
+	}{
+		{"tampered chunk", exampleSeedSignature, chunkedBody(tampered, exampleChunkSignatures), InvalidChunk},
+		{"another seed signature", exampleTrailerSeedSignature, chunkedBody(exampleChunks, exampleChunkSignatures), InvalidChunk},
+		{"reordered signatures", exampleSeedSignature, chunkedBody(exampleChunks, []string{exampleChunkSignatures[1], exampleChunkSignatures[0], exampleChunkSignatures[2]}), InvalidChunk},
+		{"unsigned chunks", exampleSeedSignature, chunkedBody(exampleChunks, nil), MalformedChunk},
+		{"missing final chunk", exampleSeedSignature, chunkedBody(exampleChunks[:2], exampleChunkSignatures[:2]), MalformedChunk},
+		{"truncated chunk", exampleSeedSignature, chunkedBody(exampleChunks, exampleChunkSignatures)[:30000], MalformedChunk},
+		{"longer than declared", exampleSeedSignature, chunkedBody([][]byte{exampleChunks[0], exampleChunks[0]}, exampleChunkSignatures), MalformedChunk},
+	}
+	for _, tt := range tests {
+		r := chunkedRequest(StreamingPayload, tt.seed, "", tt.body)
+		_, payload, err := readPayload(t, r)
+		if !errors.Is(err, tt.err) {
+			t.Errorf("%s: got %v, want %v", tt.name, err, tt.err)
+		}
+		// A payload that fails verification is never returned whole
+		if len(payload) >= 66560 {
+			t.Errorf("%s: read %d bytes before failing", tt.name, len(payload))
+		}
+	}
+
+	// Chunks must add up to the declared length
+	r := chunkedRequest(StreamingPayload, exampleSeedSignature, "", chunkedBody(exampleChunks, exampleChunkSignatures))
+	r.Header.Set("x-amz-decoded-content-length", "66561")
+	if _, _, err := readPayload(t, r); !errors.Is(err, MalformedChunk) {
+		t.Errorf("shorter than declared: got %v, want %v", err, MalformedChunk)
+	}
+}
+
+func TestChunkedReaderSignedTrailerExample(t *testing.T) {
+	body := chunkedBody(exampleChunks, exampleTrailerChunkSignatures, exampleTrailer, "x-amz-trailer-signature:"+exampleTrailerSignature)
+	r := chunkedRequest(StreamingPayloadTrailer, exampleTrailerSeedSignature, "x-amz-checksum-crc32c", body)
+	reader, payload, err := readPayload(t, r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(payload) != 66560 {
+		t.Errorf("decoded %d bytes", len(payload))
+	}
+	want := Checksum{Algorithm: "CRC32C", Value: "sOO8/Q==", Type: ChecksumTypeFullObject}
+	if checksum := PayloadChecksum(reader); checksum == nil || *checksum != want {
+		t.Errorf("checksum = %v, want %v", checksum, want)
+	}
+
+	tests := []struct {
+		name     string
+		trailers []string
+		err      error
+	}{
+		{"tampered trailer", []string{"x-amz-checksum-crc32c:AAAAAA==", "x-amz-trailer-signature:" + exampleTrailerSignature}, InvalidChunk},
+		{"unsigned trailer", []string{exampleTrailer}, MalformedTrailer},
+		{"undeclared trailer", []string{"x-amz-checksum-crc32:sOO8/Q==", "x-amz-trailer-signature:" + exampleTrailerSignature}, MalformedTrailer},
+		{"missing trailer", []string{"x-amz-trailer-signature:" + exampleTrailerSignature}, MalformedTrailer},
+		{"malformed trailer", []string{"x-amz-checksum-crc32c sOO8/Q==", "x-amz-trailer-signature:" + exampleTrailerSignature}, MalformedTrailer},
+	}
+	for _, tt := range tests {
+		r := chunkedRequest(StreamingPayloadTrailer, exampleTrailerSeedSignature, "x-amz-checksum-crc32c", chunkedBody(exampleChunks, exampleTrailerChunkSignatures, tt.trailers...))
+		_, payload, err := readPayload(t, r)
+		if !errors.Is(err, tt.err) {
+			t.Errorf("%s: got %v, want %v", tt.name, err, tt.err)
+		}
+		if len(payload) >= 66560 {
+			t.Errorf("%s: read %d bytes before failing", tt.name, len(payload))
+		}
+	}
+}
+
+func TestChunkedReaderUnsignedTrailer(t *testing.T) {
+	body := chunkedBody(exampleChunks, nil, exampleTrailer)
+	reader, payload, err := readPayload(t, chunkedRequest(StreamingUnsignedPayloadTrailer, "", "x-amz-checksum-crc32c", body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(payload) != 66560 || PayloadChecksum(reader).Value != "sOO8/Q==" {
+		t.Errorf("decoded %d bytes with checksum %v", len(payload), PayloadChecksum(reader))
+	}
+
+	// Unsigned chunks may carry extensions
+	body = strings.Replace(body, "400\r\n", "400;ext=1\r\n", 1)
+	if _, _, err := readPayload(t, chunkedRequest(StreamingUnsignedPayloadTrailer, "", "x-amz-checksum-crc32c", body)); err != nil {
+		t.Errorf("chunk with an extension: %v", err)
+	}
+
+	// The checksum of an unsigned trailer must match the payload
+	r := chunkedRequest(StreamingUnsignedPayloadTrailer, "", "x-amz-checksum-crc32c", chunkedBody(exampleChunks, nil, "x-amz-checksum-crc32c:AAAAAA=="))
+	_, payload, err = readPayload(t, r)
+	var mismatch *ChecksumMismatchError
+	if !errors.As(err, &mismatch) || mismatch.Algorithm != "crc32c" {
+		t.Errorf("mismatched checksum: got %v", err)
+	}
+	if len(payload) >= 66560 {
+		t.Errorf("read %d bytes of a payload with a mismatched checksum", len(payload))
+	}
+	if code := PayloadError(r, err).(*s3error.Error).Code; code != "BadDigest" {
+		t.Errorf("mismatched checksum: got %q, want BadDigest", code)
+	}
+}
+
+func TestNewChunkedReader(t *testing.T) {
+	tests := []struct {
+		name          string
+		contentSha256 string
+		trailer       string
+		authMethod    string
+		code          string
+	}{
+		{"signed", StreamingPayload, "", "v4", ""},
+		{"signed with a trailer", StreamingPayloadTrailer, "x-amz-checksum-sha256", "v4", ""},
+		{"unsigned with a trailer", StreamingUnsignedPayloadTrailer, "x-amz-checksum-crc64nvme", "v4-query", ""},
+		{"signed by a presigned url", StreamingPayload, "", "v4-query", "InvalidRequest"},
+		{"signed with auth V2", StreamingPayload, "", "v2", "InvalidRequest"},
+		{"signed with auth V4A", "STREAMING-AWS4-ECDSA-P256-SHA256-PAYLOAD", "", "v4", "NotImplemented"},
+		{"unknown variant", "STREAMING-PAYLOAD", "", "v4", "InvalidArgument"},
+		{"trailer without a trailing variant", StreamingPayload, "x-amz-checksum-crc32", "v4", "InvalidRequest"},
+		{"trailing variant without a trailer", StreamingPayloadTrailer, "", "v4", "InvalidRequest"},
+		{"unsupported trailer", StreamingUnsignedPayloadTrailer, "x-amz-checksum-md5", "v4", "InvalidRequest"},
+	}
+	for _, tt := range tests {
+		r := chunkedRequest(tt.contentSha256, exampleSeedSignature, tt.trailer, "")
+		mux.Vars(r)["authMethod"] = tt.authMethod
+		_, err := newChunkedReader(r, tt.contentSha256)
+		code := ""
+		if s3Err, ok := err.(*s3error.Error); ok {
+			code = s3Err.Code
+		}
+		if code != tt.code {
+			t.Errorf("%s: got %q, want %q", tt.name, code, tt.code)
+		}
+	}
+}
@@ -1,9 +1,12 @@
 package s3util
 
 import (
+	"bytes"
 	"crypto/hmac"
+	"crypto/md5"
 	"crypto/sha1"
 	"crypto/sha256"
+	"encoding/base64"
 	"fmt"
 	"net/http"
 	"net/url"
@@ -124,6 +127,12 @@ func NormQuery(v url.Values) string {
 	return strings.Replace(queryString, "+", "%20", -1)
 }
 
+// EncodeKey url-encodes an object key for listings requested with
+// `encoding-type=url`. Slashes are left as is, as S3 does.
+func EncodeKey(key string) string {
+	return strings.ReplaceAll(url.QueryEscape(key), "%2F", "/")
+}
+
 // hmacSHA1 computes HMAC with SHA1
 func HmacSHA1(key []byte, content string) []byte {
 	mac := hmac.New(sha1.New, key)
@@ -147,6 +156,24 @@ func RequireContentLength(r *http.Request) error {
 	return nil
 }
 
+// VerifyContentMD5 checks that a request body matches its `Content-MD5`
+// header, if the request has one.
+func VerifyContentMD5(r *http.Request, body []byte) error {
+	contentMD5, ok := SingleHeader(r, "Content-Md5")
+	if !ok {
+		return nil
+	}
+	expected, err := base64.StdEncoding.DecodeString(contentMD5)
+	if err != nil || len(expected) != md5.Size {
+		return s3error.InvalidDigestError(r)
+	}
+	actual := md5.Sum(body)
+	if !bytes.Equal(expected, actual[:]) {
+		return s3error.BadDigestError(r)
+	}
+	return nil
+}
+
 // singleHeader gets a single header value. This is used in places instead of
 // `r.Header.Get()` because it differentiates between missing headers versus
 // empty header values.
@@ -9,6 +9,8 @@ import (
 	"net/textproto"
 	"strings"
 	"time"
+
+	s3error "github.com/jakthom/s3c/pkg/s3/error"
 )
 
 func CheckIfMatch(im string, etag string) bool {
@@ -106,6 +108,95 @@ func CheckIfModifiedSince(ims string, modtime time.Time) bool {
 	return true
 }
 
+// CheckPreconditions evaluates the conditional headers of a read of an
+// object with the given quoted ETag, returning the status of the response:
+// 412 or 304 if the object must not be served, or 200. As in RFC 7232,
+// `If-Match` takes precedence over `If-Unmodified-Since`, and
+// `If-None-Match` over `If-Modified-Since`.
+func CheckPreconditions(r *http.Request, etag string, modtime time.Time) int {
+	if im := r.Header.Get("If-Match"); im != "" {
+		if !CheckIfMatch(im, etag) {
+			return http.StatusPreconditionFailed
+		}
+	} else if !CheckIfUnmodifiedSince(r.Header.Get("If-Unmodified-Since"), modtime) {
+		return http.StatusPreconditionFailed
+	}
+	if inm := r.Header.Get("If-None-Match"); inm != "" {
+		if !CheckIfNoneMatch(inm, etag) {
+			return http.StatusNotModified
+		}
+	} else if !CheckIfModifiedSince(r.Header.Get("If-Modified-Since"), modtime) {
+		return http.StatusNotModified
+	}
+	return http.StatusOK
+}
+
+// CheckIfRange returns whether the range of a read of an object with the
+// given quoted ETag is to be served, according to its `If-Range` header
+func CheckIfRange(r *http.Request, etag string, modtime time.Time) bool {
+	ir := textproto.TrimString(r.Header.Get("If-Range"))
+	if ir == "" {
+		return true
+	}
+	if checkEtag, _ := scanETag(ir); checkEtag != "" {
+		return etagStrongMatch(checkEtag, etag)
+	}
+	t, err := http.ParseTime(ir)
+	if err != nil || isZeroTime(modtime) {
+		return false
+	}
+	return modtime.Truncate(time.Second).Equal(t)
+}
+
+// WriteCondition is the condition of a conditional write of an object, set
+// with `If-None-Match: *` to only create the object, or with `If-Match` to
+// only replace a given version of it
+type WriteCondition struct {
+	// IfNoneMatch is set if the object must not exist
+	IfNoneMatch bool
+	// IfMatch is the `If-Match` header the ETag of the object must match, if
+	// any
+	IfMatch string
+}
+
+// WriteConditionFromRequest returns the condition of a write of an object, or
+// nil if the write is unconditional. `If-None-Match` only supports `*`.
+func WriteConditionFromRequest(r *http.Request) (*WriteCondition, error) {
+	inm := textproto.TrimString(r.Header.Get("If-None-Match"))
+	im := textproto.TrimString(r.Header.Get("If-Match"))
+	if inm == "" && im == "" {
+		return nil, nil
+	}
+	if inm != "" && inm != "*" {
+		return nil, s3error.NotImplementedError(r)
+	}
+	// ETags are matched quoted, but clients may send them without quotes
+	if im != "" && im != "*" && !strings.Contains(im, "\"") {
+		im = AddETagQuotes(im)
+	}
+	return &WriteCondition{IfNoneMatch: inm == "*", IfMatch: im}, nil
+}
+
+// Check returns the error of a write under the condition, given whether the
+// object exists and its quoted ETag
+func (c *WriteCondition) Check(r *http.Request, exists bool, etag string) error {
+	if c == nil {
+		return nil
+	}
+	if c.IfNoneMatch && exists {
+		return s3error.PreconditionFailedError(r)
+	}
+	if c.IfMatch != "" {
+		if !exists {
+			return s3error.NoSuchKeyError(r)
+		}
+		if !CheckIfMatch(c.IfMatch, etag) {
+			return s3error.PreconditionFailedError(r)
+		}
+	}
+	return nil
+}
+
 // scanETag determines if a syntactically valid ETag is present at s. If so,
 // the ETag and remaining text after consuming ETag is returned. Otherwise,
 // it returns "", "".
@@ -0,0 +1,244 @@
+package s3util
+
+import (
+	"bytes"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"hash"
+	"io"
+	"net/http"
+	"strings"
+
+	s3error "github.com/jakthom/s3c/pkg/s3/error"
+)
+
+var (
+	// ContentMD5Mismatch is an error returned when reading a payload that
+	// does not match its `Content-MD5`
+	ContentMD5Mismatch = errors.New("content md5 mismatch")
+	// ContentSHA256Mismatch is an error returned when reading a payload that
+	// does not match its `x-amz-content-sha256`
+	ContentSHA256Mismatch = errors.New("content sha256 mismatch")
+)
+
+// ChecksumMismatchError is returned when reading a payload whose checksum
+// does not match the checksum sent with it
+type ChecksumMismatchError struct {
+	// Algorithm is the lowercase checksum algorithm, ie `crc32`
+	Algorithm string
+}
+
+func (e *ChecksumMismatchError) Error() string {
+	return "checksum mismatch: " + e.Algorithm
+}
+
+// payloadReader reads the payload of an upload, verifying it against the
+// digests and checksum sent with it before its last bytes are returned, so
+// that origins never store a corrupted payload
+type payloadReader struct {
+	body io.ReadCloser
+	// chunked is the decoder of aws-chunked bodies, if any
+	chunked *chunkedReader
+	// length is the expected length of the payload, or -1 if unknown
+	length   int64
+	read     int64
+	verified bool
+	err      error
+
+	md5            hash.Hash
+	expectedMD5    []byte
+	sha256         hash.Hash
+	expectedSHA256 string
+	// checksum is the checksum computed for the x-amz-checksum-* header or
+	// x-amz-sdk-checksum-algorithm of the request, if any
+	checksum         hash.Hash
+	algorithm        string
+	expectedChecksum string
+	// result is the checksum of the payload, once it has been verified
+	result *Checksum
+}
+
+// RequestBody returns the payload of an object or part upload. It decodes
+// aws-chunked bodies, and verifies the payload against its `Content-MD5`,
+// `x-amz-content-sha256` and flexible checksum headers or trailer while it
+// is read. It fails if the request asks for something s3c does not support.
+func RequestBody(r *http.Request) (io.ReadCloser, error) {
+	p := &payloadReader{
+		body:   r.Body,
+		length: r.ContentLength,
+	}
+	contentSha256 := r.Header.Get("x-amz-content-sha256")
+	if isStreaming(contentSha256) {
+		chunked, err := newChunkedReader(r, contentSha256)
+		if err != nil {
+			return nil, err
+		}
+		p.body = chunked
+		p.chunked = chunked
+		p.length = chunked.decodedLength
+	} else if len(contentSha256) == sha256.Size*2 {
+		p.sha256 = sha256.New()
+		p.expectedSHA256 = strings.ToLower(contentSha256)
+	}
+
+	if contentMD5, ok := r.Header["Content-Md5"]; ok {
+		expected, err := base64.StdEncoding.DecodeString(contentMD5[0])
+		if err != nil || len(expected) != md5.Size {
+			return nil, s3error.InvalidDigestError(r)
+		}
+		p.md5 = md5.New()
+		p.expectedMD5 = expected
+	}
+
+	for name, values := range r.Header {
+		algorithm, ok := ChecksumAlgorithm(name)
+		if !ok {
+			continue
+		}
+		if p.algorithm != "" || (p.chunked != nil && p.chunked.trailer != "") {
+			return nil, s3error.InvalidRequestError(r, "Expecting a single x-amz-checksum- header. Multiple checksum Types are not allowed.")
+		}
+		if !validChecksumValue(algorithm, values[0]) {
+			return nil, s3error.InvalidRequestError(r, "Value for x-amz-checksum-"+algorithm+" header is invalid.")
+		}
+		p.algorithm = algorithm
+		p.checksum = NewChecksum(algorithm)
+		p.expectedChecksum = values[0]
+	}
+
+	// The SDK names the algorithm of the checksum it sends, or that s3c
+	// should compute if it sends none
+	if sdkAlgorithm := strings.ToLower(r.Header.Get("x-amz-sdk-checksum-algorithm")); sdkAlgorithm != "" {
+		if !ValidChecksumAlgorithm(sdkAlgorithm) {
+			return nil, s3error.InvalidRequestError(r, "Checksum algorithm provided is unsupported. Please try again with any of the valid types: [CRC32, CRC32C, CRC64NVME, SHA1, SHA256]")
+		}
+		declared := p.algorithm
+		if p.chunked != nil && p.chunked.trailer != "" {
+			declared = p.chunked.trailerAlgorithm
+		}
+		if declared != "" && declared != sdkAlgorithm {
+			return nil, s3error.InvalidRequestError(r, "Value for x-amz-sdk-checksum-algorithm header is invalid.")
+		}
+		if declared == "" {
+			p.algorithm = sdkAlgorithm
+			p.checksum = NewChecksum(sdkAlgorithm)
+		}
+	}
+	return p, nil
+}
+
+// PayloadError returns the s3 error of a failure to read a body returned by
+// `RequestBody`, which origins may have wrapped, or the error itself if it
+// isn't one
+func PayloadError(r *http.Request, err error) error {
+	var s3Err *s3error.Error
+	var checksumErr *ChecksumMismatchError
+	switch {
+	case errors.As(err, &s3Err):
+		return s3Err
+	case errors.Is(err, InvalidChunk):
+		return s3error.SignatureDoesNotMatchError(r)
+	case errors.Is(err, MalformedChunk):
+		return s3error.IncompleteBodyError(r)
+	case errors.Is(err, MalformedTrailer):
+		return s3error.MalformedTrailerError(r)
+	case errors.Is(err, ContentMD5Mismatch):
+		return s3error.BadDigestError(r)
+	case errors.Is(err, ContentSHA256Mismatch):
+		return s3error.XAmzContentSHA256MismatchError(r)
+	case errors.As(err, &checksumErr):
+		return s3error.BadChecksumError(r, strings.ToUpper(checksumErr.Algorithm))
+	}
+	return err
+}
+
+// PayloadChecksum returns the checksum of a payload returned by
+// `RequestBody` once it has been read, or nil if it has none
+func PayloadChecksum(reader io.Reader) *Checksum {
+	if p, ok := reader.(*payloadReader); ok {
+		return p.result
+	}
+	return nil
+}
+
+// PayloadLength returns the number of bytes read from a payload returned by
+// `RequestBody`, which once it has been read is the size of the payload
+func PayloadLength(reader io.Reader) int64 {
+	if p, ok := reader.(*payloadReader); ok {
+		return p.read
+	}
+	return 0
+}
+
+// PayloadChecksumAlgorithm returns the uppercase algorithm of the checksum a
+// payload returned by `RequestBody` will have once it has been read, or an
+// empty string if it will have none
+func PayloadChecksumAlgorithm(reader io.Reader) string {
+	p, ok := reader.(*payloadReader)
+	if !ok {
+		return ""
+	}
+	if p.chunked != nil && p.chunked.trailer != "" {
+		return strings.ToUpper(p.chunked.trailerAlgorithm)
+	}
+	return strings.ToUpper(p.algorithm)
+}
+
+func (p *payloadReader) Read(b []byte) (int, error) {
+	if p.err != nil {
+		return 0, p.err
+	}
+	n, err := p.body.Read(b)
+	p.read += int64(n)
+	for _, h := range []hash.Hash{p.md5, p.sha256, p.checksum} {
+		if h != nil {
+			h.Write(b[:n])
+		}
+	}
+	if err != nil && err != io.EOF {
+		p.err = err
+		return n, err
+	}
+	// The payload is verified before its last bytes are returned
+	if !p.verified && (err == io.EOF || p.read == p.length) {
+		p.verified = true
+		if p.err = p.verify(); p.err != nil {
+			return 0, p.err
+		}
+	}
+	return n, err
+}
+
+// verify checks the payload against its digests and checksum
+func (p *payloadReader) verify() error {
+	if p.length >= 0 && p.read != p.length {
+		return MalformedChunk
+	}
+	if p.md5 != nil && !bytes.Equal(p.md5.Sum(nil), p.expectedMD5) {
+		return ContentMD5Mismatch
+	}
+	if p.sha256 != nil && hex.EncodeToString(p.sha256.Sum(nil)) != p.expectedSHA256 {
+		return ContentSHA256Mismatch
+	}
+	if p.checksum != nil {
+		value := EncodeChecksum(p.checksum)
+		if p.expectedChecksum != "" && value != p.expectedChecksum {
+			return &ChecksumMismatchError{Algorithm: p.algorithm}
+		}
+		p.result = &Checksum{
+			Algorithm: strings.ToUpper(p.algorithm),
+			Value:     value,
+			Type:      ChecksumTypeFullObject,
+		}
+	} else if p.chunked != nil {
+		p.result = p.chunked.checksum
+	}
+	return nil
+}
+
+func (p *payloadReader) Close() error {
+	return p.body.Close()
+}
@@ -0,0 +1,142 @@
+package s3util
+
+import (
+	"encoding/xml"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	s3error "github.com/jakthom/s3c/pkg/s3/error"
+)
+
+const (
+	// MaxObjectTags is the maximum number of tags of an object
+	MaxObjectTags = 10
+	// MaxBucketTags is the maximum number of tags of a bucket
+	MaxBucketTags = 50
+
+	// maxTagKeyLength and maxTagValueLength are the maximum number of
+	// characters of the keys and values of tags
+	maxTagKeyLength   = 128
+	maxTagValueLength = 256
+)
+
+// Tag is an XML marshallable tag of an object or bucket
+type Tag struct {
+	Key   string `xml:"Key"`
+	Value string `xml:"Value"`
+}
+
+// Tagging is an XML marshallable response to a GetObjectTagging or
+// GetBucketTagging call
+type Tagging struct {
+	XMLName xml.Name `xml:"http://s3.amazonaws.com/doc/2006-03-01/ Tagging"`
+	TagSet  []Tag    `xml:"TagSet>Tag"`
+}
+
+// NewTagging returns the XML representation of a set of tags, sorted by key
+func NewTagging(tags map[string]string) Tagging {
+	tagging := Tagging{TagSet: []Tag{}}
+	for key, value := range tags {
+		tagging.TagSet = append(tagging.TagSet, Tag{Key: key, Value: value})
+	}
+	sort.Slice(tagging.TagSet, func(i, j int) bool {
+		return tagging.TagSet[i].Key < tagging.TagSet[j].Key
+	})
+	return tagging
+}
+
+// ReadTagging reads and validates the tags of a PutObjectTagging or
+// PutBucketTagging request body, of which there may be at most `maxTags`
+func ReadTagging(r *http.Request, maxTags int) (map[string]string, error) {
+	payload := struct {
+		XMLName xml.Name `xml:"Tagging"`
+		TagSet  []Tag    `xml:"TagSet>Tag"`
+	}{}
+	if err := ReadXMLBody(r, &payload); err != nil {
+		return nil, err
+	}
+	tags := map[string]string{}
+	for _, tag := range payload.TagSet {
+		if _, ok := tags[tag.Key]; ok {
+			return nil, s3error.InvalidTagError(r, "Cannot provide multiple Tags with the same key")
+		}
+		tags[tag.Key] = tag.Value
+	}
+	if err := ValidateTags(r, tags, maxTags); err != nil {
+		return nil, err
+	}
+	return tags, nil
+}
+
+// TaggingFromHeader reads and validates the tags set on an object as it is
+// uploaded, in the `x-amz-tagging` header as URL query parameters. It
+// returns nil if the header is not set.
+func TaggingFromHeader(r *http.Request) (map[string]string, error) {
+	header := r.Header.Get("x-amz-tagging")
+	if header == "" {
+		return nil, nil
+	}
+	query, err := url.ParseQuery(header)
+	if err != nil {
+		return nil, s3error.InvalidArgumentError(r)
+	}
+	tags := map[string]string{}
+	for key, values := range query {
+		if len(values) != 1 {
+			return nil, s3error.InvalidTagError(r, "Cannot provide multiple Tags with the same key")
+		}
+		tags[key] = values[0]
+	}
+	if err := ValidateTags(r, tags, MaxObjectTags); err != nil {
+		return nil, err
+	}
+	return tags, nil
+}
+
+// EncodeTagging encodes tags the way they are sent in `x-amz-tagging`
+func EncodeTagging(tags map[string]string) string {
+	query := url.Values{}
+	for key, value := range tags {
+		query.Set(key, value)
+	}
+	return strings.ReplaceAll(query.Encode(), "+", "%20")
+}
+
+// ValidateTags checks tags against the limits of s3: at most `maxTags` tags,
+// whose keys are 1 to 128 characters long and values up to 256 characters
+// long, made of letters, numbers, spaces and `+ - = . _ : / @`
+func ValidateTags(r *http.Request, tags map[string]string, maxTags int) error {
+	if len(tags) > maxTags {
+		if maxTags == MaxObjectTags {
+			return s3error.InvalidTagError(r, "Object tags cannot be greater than 10")
+		}
+		return s3error.InvalidTagError(r, "Bucket tag count cannot be greater than 50")
+	}
+	for key, value := range tags {
+		if key == "" || utf8.RuneCountInString(key) > maxTagKeyLength || !validTagCharacters(key) {
+			return s3error.InvalidTagError(r, "The TagKey you have provided is invalid")
+		}
+		if strings.HasPrefix(strings.ToLower(key), "aws:") {
+			return s3error.InvalidTagError(r, "Your TagKey cannot be prefixed with aws:")
+		}
+		if utf8.RuneCountInString(value) > maxTagValueLength || !validTagCharacters(value) {
+			return s3error.InvalidTagError(r, "The TagValue you have provided is invalid")
+		}
+	}
+	return nil
+}
+
+// validTagCharacters returns whether a tag key or value only contains the
+// characters s3 allows
+func validTagCharacters(s string) bool {
+	for _, c := range s {
+		if !unicode.IsLetter(c) && !unicode.IsDigit(c) && !unicode.IsSpace(c) && !strings.ContainsRune("+-=._:/@", c) {
+			return false
+		}
+	}
+	return true
+}
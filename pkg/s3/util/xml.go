@@ -11,9 +11,17 @@ import (
 	zlog "github.com/rs/zerolog/log"
 )
 
-// WriteError serializes an error to a response as XML
+// WriteError serializes an error to a response as XML. Responses to HEAD
+// requests have no body, so only the status of their errors is written.
 func WriteError(w http.ResponseWriter, r *http.Request, err error) {
 	s3Err := s3error.NewGenericError(r, err)
+	if r.Method == http.MethodHead {
+		requestID := mux.Vars(r)["requestID"]
+		w.Header().Set("x-amz-id-2", requestID)
+		w.Header().Set("x-amz-request-id", requestID)
+		w.WriteHeader(s3Err.HTTPStatus)
+		return
+	}
 	WriteXML(w, r, s3Err.HTTPStatus, s3Err)
 }
 
@@ -45,13 +53,16 @@ func WriteXML(w http.ResponseWriter, r *http.Request, code int, v interface{}) {
 	WriteXMLBody(w, v)
 }
 
-// readXMLBody reads an HTTP request body's bytes, and unmarshals it into
-// `payload`.
+// readXMLBody reads an HTTP request body's bytes, verifies them against any
+// `Content-MD5` header, and unmarshals them into `payload`.
 func ReadXMLBody(r *http.Request, payload interface{}) error {
 	bodyBytes, err := ioutil.ReadAll(r.Body)
 	if err != nil {
 		return err
 	}
+	if err := VerifyContentMD5(r, bodyBytes); err != nil {
+		return err
+	}
 	err = xml.Unmarshal(bodyBytes, &payload)
 	if err != nil {
 		return s3error.MalformedXMLError(r)
@@ -0,0 +1,222 @@
+package website
+
+import (
+	"fmt"
+	"html"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"path"
+	"strings"
+
+	"github.com/gorilla/mux"
+	s3bucket "github.com/jakthom/s3c/pkg/s3/bucket"
+	s3error "github.com/jakthom/s3c/pkg/s3/error"
+	s3object "github.com/jakthom/s3c/pkg/s3/object"
+	s3policy "github.com/jakthom/s3c/pkg/s3/policy"
+	s3util "github.com/jakthom/s3c/pkg/s3/util"
+	"github.com/rs/zerolog/log"
+)
+
+// defaultContentType is the content type of objects stored without one
+const defaultContentType = "binary/octet-stream"
+
+// Handler serves the buckets with a website configuration as static
+// websites. Requests are anonymous, so only the objects that the policy or
+// ACL of a bucket lets anyone read are served.
+type Handler struct {
+	Websites   s3bucket.WebsiteController
+	Controller s3object.ObjectController
+	Authorizer *s3policy.Authorizer
+	// Domain is the domain websites are served under, as `<bucket>.<domain>`.
+	// Requests to other hosts name their bucket in the first segment of
+	// their path.
+	Domain string
+}
+
+// site is the website a request is made to
+type site struct {
+	bucket string
+	// root is the path of the website: `/` for requests naming their bucket
+	// in their host, and `/<bucket>/` for those naming it in their path
+	root string
+	key  string
+}
+
+// site returns the website a request is made to
+func (h *Handler) site(r *http.Request) site {
+	host := r.Host
+	if name, _, err := net.SplitHostPort(host); err == nil {
+		host = name
+	}
+	if h.Domain != "" && strings.HasSuffix(host, "."+h.Domain) {
+		return site{
+			bucket: strings.TrimSuffix(host, "."+h.Domain),
+			root:   "/",
+			key:    strings.TrimPrefix(r.URL.Path, "/"),
+		}
+	}
+	bucket, key, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	return site{bucket: bucket, root: "/" + bucket + "/", key: key}
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		writePage(w, r, s3error.MethodNotAllowedError(r))
+		return
+	}
+	s := h.site(r)
+	if s.bucket == "" {
+		writePage(w, r, s3error.NoSuchBucketError(r))
+		return
+	}
+	r = h.Authorizer.Attach(r, nil, nil)
+	config, err := h.Websites.GetBucketWebsite(r, s.bucket)
+	if err != nil {
+		writePage(w, r, err)
+		return
+	}
+	if redirect := config.RedirectAllRequestsTo; redirect != nil {
+		location := requestProtocol(r, redirect.Protocol) + "://" + redirect.HostName + "/" + s.key
+		http.Redirect(w, r, location, http.StatusMovedPermanently)
+		return
+	}
+	// The root of a website named in the path needs its trailing slash for
+	// relative links to resolve within it
+	if s.root != "/" && r.URL.Path == strings.TrimSuffix(s.root, "/") {
+		http.Redirect(w, r, s.root, http.StatusFound)
+		return
+	}
+	if rule := config.RoutingRule(s.key, 0); rule != nil {
+		h.redirect(w, r, s, rule)
+		return
+	}
+
+	key := s.key
+	if key == "" || strings.HasSuffix(key, "/") {
+		key += config.IndexDocument.Suffix
+	}
+	result, err := h.get(r, s.bucket, key)
+	if err == nil {
+		serve(w, r, key, result, http.StatusOK)
+		return
+	}
+	status := s3error.NewGenericError(r, err).HTTPStatus
+	// Directories requested without their trailing slash are redirected to
+	// it, if they have an index document
+	if status == http.StatusNotFound && key == s.key {
+		if h.exists(r, s.bucket, key+"/"+config.IndexDocument.Suffix) {
+			http.Redirect(w, r, s.root+key+"/", http.StatusFound)
+			return
+		}
+	}
+	if rule := config.RoutingRule(s.key, status); rule != nil {
+		h.redirect(w, r, s, rule)
+		return
+	}
+	if config.ErrorDocument != nil {
+		if result, docErr := h.get(r, s.bucket, config.ErrorDocument.Key); docErr == nil {
+			serve(w, r, config.ErrorDocument.Key, result, status)
+			return
+		}
+	}
+	writePage(w, r, err)
+}
+
+// get reads an object of a website, if anyone may read it
+func (h *Handler) get(r *http.Request, bucket, key string) (*s3object.GetObjectResult, error) {
+	if err := s3policy.Authorize(r, "s3:GetObject", s3policy.ObjectResource(bucket, key)); err != nil {
+		return nil, err
+	}
+	result, err := h.Controller.GetObject(r, bucket, key, "")
+	if err != nil {
+		return nil, err
+	}
+	if result.DeleteMarker {
+		result.Close()
+		return nil, s3error.NoSuchKeyError(r)
+	}
+	return result, nil
+}
+
+// exists returns whether an object of a website exists, and anyone may read
+// it
+func (h *Handler) exists(r *http.Request, bucket, key string) bool {
+	if err := s3policy.Authorize(r, "s3:GetObject", s3policy.ObjectResource(bucket, key)); err != nil {
+		return false
+	}
+	result, err := h.Controller.HeadObject(r, bucket, key, "", 0)
+	return err == nil && !result.DeleteMarker
+}
+
+// redirect redirects a request by a routing rule
+func (h *Handler) redirect(w http.ResponseWriter, r *http.Request, s site, rule *s3bucket.RoutingRule) {
+	host := rule.Redirect.HostName
+	root := "/"
+	if host == "" {
+		host = r.Host
+		root = s.root
+	}
+	location := requestProtocol(r, rule.Redirect.Protocol) + "://" + host + root + rule.RedirectKey(s.key)
+	http.Redirect(w, r, location, rule.RedirectCode())
+}
+
+// requestProtocol returns the protocol of a redirect, which is that of the
+// request if not set
+func requestProtocol(r *http.Request, protocol string) string {
+	if protocol != "" {
+		return protocol
+	}
+	if r.TLS != nil {
+		return "https"
+	}
+	return "http"
+}
+
+// serve writes an object of a website, with the status of the response
+func serve(w http.ResponseWriter, r *http.Request, key string, result *s3object.GetObjectResult, status int) {
+	defer result.Close()
+	if result.ETag != "" {
+		w.Header().Set("ETag", s3util.AddETagQuotes(result.ETag))
+	}
+	result.Metadata.WriteHeader(w.Header())
+	if w.Header().Get("Content-Type") == "" {
+		contentType := mime.TypeByExtension(path.Ext(key))
+		if contentType == "" {
+			contentType = defaultContentType
+		}
+		w.Header().Set("Content-Type", contentType)
+	}
+	if status == http.StatusOK {
+		// Ranges and conditional requests are honored for objects only, not
+		// for error documents
+		http.ServeContent(w, r, key, result.ModTime, result.Content)
+		return
+	}
+	w.WriteHeader(status)
+	if r.Method == http.MethodHead {
+		return
+	}
+	if _, err := io.Copy(w, result.Content); err != nil {
+		log.Error().Err(err).Msg("Failed to write website error document: " + key)
+	}
+}
+
+// writePage writes an error as the HTML page websites respond with
+func writePage(w http.ResponseWriter, r *http.Request, err error) {
+	s3Err := s3error.NewGenericError(r, err)
+	if s3Err.HTTPStatus == http.StatusInternalServerError {
+		log.Error().Err(err).Msg("Failed to serve website: " + r.URL.Path)
+	}
+	requestID := mux.Vars(r)["requestID"]
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("x-amz-request-id", requestID)
+	w.WriteHeader(s3Err.HTTPStatus)
+	if r.Method == http.MethodHead {
+		return
+	}
+	title := fmt.Sprintf("%d %s", s3Err.HTTPStatus, http.StatusText(s3Err.HTTPStatus))
+	fmt.Fprintf(w, "<html>\n<head><title>%s</title></head>\n<body>\n<h1>%s</h1>\n<ul>\n<li>Code: %s</li>\n<li>Message: %s</li>\n<li>RequestId: %s</li>\n</ul>\n<hr/>\n</body>\n</html>\n",
+		title, title, html.EscapeString(s3Err.Code), html.EscapeString(s3Err.Message), html.EscapeString(requestID))
+}
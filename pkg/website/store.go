@@ -0,0 +1,115 @@
+package website
+
+import (
+	"encoding/xml"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	s3bucket "github.com/jakthom/s3c/pkg/s3/bucket"
+	s3error "github.com/jakthom/s3c/pkg/s3/error"
+	"github.com/rs/zerolog/log"
+)
+
+// Store persists the website configurations of buckets as xml files within a
+// directory. They are kept in memory, as every request to a website is
+// routed by them.
+type Store struct {
+	dir     string
+	mu      sync.RWMutex
+	configs map[string]*s3bucket.WebsiteConfiguration
+}
+
+// NewStore creates a store of the bucket website configurations in a
+// directory
+func NewStore(dir string) (*Store, error) {
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return nil, err
+	}
+	s := &Store{
+		dir:     dir,
+		configs: map[string]*s3bucket.WebsiteConfiguration{},
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range entries {
+		if entry.IsDir() || filepath.Ext(entry.Name()) != ".xml" {
+			continue
+		}
+		bucket := strings.TrimSuffix(entry.Name(), ".xml")
+		content, err := os.ReadFile(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+		config := &s3bucket.WebsiteConfiguration{}
+		if err := xml.Unmarshal(content, config); err != nil {
+			log.Error().Err(err).Msg("Ignoring invalid bucket website configuration: " + bucket)
+			continue
+		}
+		s.configs[bucket] = config
+	}
+	return s, nil
+}
+
+func (s *Store) path(bucket string) string {
+	return filepath.Join(s.dir, bucket+".xml")
+}
+
+func (s *Store) GetBucketWebsite(r *http.Request, bucket string) (*s3bucket.WebsiteConfiguration, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	config, ok := s.configs[bucket]
+	if !ok {
+		return nil, s3error.NoSuchWebsiteConfigurationError(r)
+	}
+	return config, nil
+}
+
+func (s *Store) PutBucketWebsite(r *http.Request, bucket string, config *s3bucket.WebsiteConfiguration) error {
+	document, err := xml.Marshal(config)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := writeFileAtomic(s.path(bucket), document); err != nil {
+		log.Error().Err(err).Msg("Failed to write bucket website configuration: " + bucket)
+		return err
+	}
+	s.configs[bucket] = config
+	return nil
+}
+
+func (s *Store) DeleteBucketWebsite(r *http.Request, bucket string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := os.Remove(s.path(bucket)); err != nil && !os.IsNotExist(err) {
+		log.Error().Err(err).Msg("Failed to delete bucket website configuration: " + bucket)
+		return err
+	}
+	delete(s.configs, bucket)
+	return nil
+}
+
+// writeFileAtomic writes a file by renaming a temporary file in its
+// directory into place, so that it is never partially written
+func writeFileAtomic(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".tmp-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}